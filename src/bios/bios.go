@@ -0,0 +1,305 @@
+// Package bios implements the ROM BIOS services of the emulated PC.
+package bios
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"time"
+
+	"dos-emulator/cpu"
+	"dos-emulator/memory"
+)
+
+// The equipment word at 0040:0010 that INT 11h returns: a diskette drive
+// and an 80x25 colour display, plus the coprocessor bit when one is
+// installed.
+const (
+	bdaEquipment     = 0x410
+	defaultEquipment = 0x0021
+	equipmentFPU     = 0x0002
+)
+
+type BIOS struct {
+	cpu       *cpu.CPU
+	memory    *memory.Memory
+	video     *VideoMemory
+	renderer  *TerminalRenderer
+	input     *bufio.Reader // the keyboard
+	gfx       *Graphics
+	vga       *vgaPorts
+	debugMode bool
+}
+
+func New(c *cpu.CPU, mem *memory.Memory) *BIOS {
+	b := &BIOS{
+		cpu:    c,
+		memory: mem,
+		video: &VideoMemory{
+			buffer:       mem.Slice(TextBase, TextEnd),
+			memory:       mem,
+			cursorStart:  6,
+			cursorEnd:    7,
+			columns:      80,
+			currentColor: 0x07,
+			videoMode:    0x03,
+		},
+	}
+	b.renderer = NewTerminalRenderer(os.Stdout, b.video)
+	b.input = bufio.NewReader(os.Stdin)
+	b.gfx = newGraphics(mem)
+	b.vga = &vgaPorts{gfx: b.gfx}
+	b.fillBuffer(b.video.currentColor)
+	b.syncVideoDataArea()
+	b.setTickCount(ticksSinceMidnight(time.Now()))
+	mem.Write16(bdaEquipment, defaultEquipment|equipmentFPU)
+
+	mem.Watch(TextBase, TextEnd, func(addr uint32) {
+		if b.gfx.mode != nil {
+			b.gfx.dirty = true
+			return
+		}
+		b.renderer.Activate()
+		b.renderer.MarkDirty()
+	})
+	mem.Watch(GraphicsBase, GraphicsEnd, func(addr uint32) {
+		b.gfx.cpuWrite(addr-GraphicsBase, mem.Read8(addr))
+	})
+	return b
+}
+
+func (b *BIOS) SetDebugMode(enabled bool) {
+	b.debugMode = enabled
+}
+
+// SetCoprocessor sets or clears the coprocessor bit of the equipment word.
+func (b *BIOS) SetCoprocessor(present bool) {
+	equipment := b.memory.Read16(bdaEquipment) &^ equipmentFPU
+	if present {
+		equipment |= equipmentFPU
+	}
+	b.memory.Write16(bdaEquipment, equipment)
+}
+
+// WriteChar writes a character to the console at the cursor position, the
+// way INT 10h AH=0Eh does. DOS console output goes through here so that it
+// lands in video memory too.
+func (b *BIOS) WriteChar(char byte) {
+	b.teletypeOutput(char)
+	b.syncVideoDataArea()
+}
+
+// FullScreen reports whether the terminal is being repainted from video
+// memory rather than receiving teletype output as a stream.
+func (b *BIOS) FullScreen() bool {
+	return b.renderer.Active()
+}
+
+// RefreshScreen repaints the terminal if video memory changed. It is
+// throttled and cheap enough to call from the instruction loop.
+func (b *BIOS) RefreshScreen() {
+	b.renderer.Refresh()
+	if b.gfx.dirty && time.Since(b.gfx.lastFrame) >= frameInterval {
+		b.saveFrame()
+	}
+}
+
+// FlushScreen brings the terminal up to date before blocking for input.
+func (b *BIOS) FlushScreen() {
+	b.renderer.Flush()
+}
+
+// FinishScreen paints the final screen when a program exits and hands the
+// terminal back to line-oriented output.
+func (b *BIOS) FinishScreen() {
+	b.renderer.Finish()
+	b.saveFrame()
+}
+
+// SetFramesDir makes the BIOS write the graphics screen to numbered PNG
+// files in dir whenever it changes, at most every frameInterval.
+func (b *BIOS) SetFramesDir(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	b.gfx.framesDir = dir
+	return nil
+}
+
+// Screenshot writes the current graphics screen to path as a PNG image.
+func (b *BIOS) Screenshot(path string) error {
+	if b.gfx.mode == nil {
+		return fmt.Errorf("video mode %02Xh is not a graphics mode", b.video.videoMode)
+	}
+	return b.gfx.writePNG(path)
+}
+
+func (b *BIOS) saveFrame() {
+	if err := b.gfx.writeFrame(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing frame: %v\n", err)
+		b.gfx.framesDir = ""
+	}
+}
+
+// HandleInterrupt services a BIOS interrupt. It returns false if intNum is
+// not a BIOS service.
+func (b *BIOS) HandleInterrupt(intNum byte) bool {
+	switch intNum {
+	case 0x08:
+		b.timerTick()
+	case 0x10:
+		b.handleInt10()
+	case 0x11:
+		b.cpu.AX = b.memory.Read16(bdaEquipment)
+	case 0x12:
+		b.cpu.AX = 640
+	case 0x13:
+		b.handleInt13()
+	case 0x16:
+		b.handleInt16()
+	case 0x1A:
+		b.handleInt1A()
+	case 0x33:
+		b.handleInt33()
+	default:
+		return false
+	}
+	return true
+}
+
+func (b *BIOS) handleInt13() {
+	ah := b.cpu.GetAH()
+
+	switch ah {
+	case 0x00:
+		b.cpu.SetAH(0)
+		b.cpu.Flags.SetCF(false)
+	case 0x02:
+		b.cpu.SetAH(0)
+		b.cpu.SetAL(b.cpu.GetAL())
+		b.cpu.Flags.SetCF(false)
+	case 0x08:
+		b.cpu.SetAH(0)
+		b.cpu.SetCH(79)
+		b.cpu.SetCL(18)
+		b.cpu.SetDH(1)
+		b.cpu.SetDL(2)
+		b.cpu.Flags.SetCF(false)
+	default:
+		if b.debugMode {
+			fmt.Printf("Unhandled INT 13h function: AH=0x%02X\n", ah)
+		}
+		b.cpu.Flags.SetCF(true)
+	}
+}
+
+// SetInput makes the keyboard read from input, which must be the only
+// buffered reader of its source so that no keystrokes are lost between
+// readers.
+func (b *BIOS) SetInput(input *bufio.Reader) {
+	b.input = input
+}
+
+func (b *BIOS) handleInt16() {
+	ah := b.cpu.GetAH()
+
+	switch ah {
+	case 0x00, 0x10:
+		b.renderer.Flush()
+		char, _ := b.input.ReadByte()
+		b.cpu.SetAL(char)
+		b.cpu.SetAH(0)
+	case 0x01, 0x11:
+		b.cpu.Flags.SetZF(true)
+	case 0x02, 0x12:
+		b.cpu.SetAL(0)
+	default:
+		if b.debugMode {
+			fmt.Printf("Unhandled INT 16h function: AH=0x%02X\n", ah)
+		}
+	}
+}
+
+// BIOS data area fields maintained by the timer interrupt.
+const (
+	bdaTickCount   = 0x46C
+	bdaMidnight    = 0x470
+	ticksPerDay    = 0x1800B0
+	ticksPerSecond = 1193182.0 / 65536
+)
+
+func ticksSinceMidnight(now time.Time) uint32 {
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	return uint32(now.Sub(midnight).Seconds() * ticksPerSecond)
+}
+
+func (b *BIOS) tickCount() uint32 {
+	return uint32(b.memory.Read16(bdaTickCount)) | uint32(b.memory.Read16(bdaTickCount+2))<<16
+}
+
+func (b *BIOS) setTickCount(ticks uint32) {
+	b.memory.Write16(bdaTickCount, uint16(ticks))
+	b.memory.Write16(bdaTickCount+2, uint16(ticks>>16))
+}
+
+// timerTick is the BIOS part of the INT 08h handler: it counts timer
+// ticks since midnight and flags the day rollover.
+func (b *BIOS) timerTick() {
+	ticks := b.tickCount() + 1
+	if ticks >= ticksPerDay {
+		ticks = 0
+		b.memory.Write8(bdaMidnight, 1)
+	}
+	b.setTickCount(ticks)
+}
+
+func (b *BIOS) handleInt1A() {
+	ah := b.cpu.GetAH()
+
+	switch ah {
+	case 0x00:
+		ticks := b.tickCount()
+		b.cpu.CX = uint16(ticks >> 16)
+		b.cpu.DX = uint16(ticks)
+		b.cpu.SetAL(b.memory.Read8(bdaMidnight))
+		b.memory.Write8(bdaMidnight, 0)
+	case 0x01:
+		b.setTickCount(uint32(b.cpu.CX)<<16 | uint32(b.cpu.DX))
+		b.memory.Write8(bdaMidnight, 0)
+	case 0x02:
+		now := time.Now()
+		b.cpu.SetCH(byte(now.Hour()))
+		b.cpu.SetCL(byte(now.Minute()))
+		b.cpu.SetDH(byte(now.Second()))
+		b.cpu.Flags.SetCF(false)
+	case 0x04:
+		now := time.Now()
+		b.cpu.SetCH(byte(now.Year() / 100))
+		b.cpu.SetCL(byte(now.Year() % 100))
+		b.cpu.SetDH(byte(now.Month()))
+		b.cpu.SetDL(byte(now.Day()))
+		b.cpu.Flags.SetCF(false)
+	default:
+		if b.debugMode {
+			fmt.Printf("Unhandled INT 1Ah function: AH=0x%02X\n", ah)
+		}
+	}
+}
+
+func (b *BIOS) handleInt33() {
+	ax := b.cpu.AX
+
+	switch ax {
+	case 0x00:
+		b.cpu.AX = 0xFFFF
+		b.cpu.BX = 2
+	case 0x03:
+		b.cpu.BX = 0
+		b.cpu.CX = 0
+		b.cpu.DX = 0
+	default:
+		if b.debugMode {
+			fmt.Printf("Unhandled INT 33h function: AX=0x%04X\n", ax)
+		}
+	}
+}
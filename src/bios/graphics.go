@@ -0,0 +1,357 @@
+package bios
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"time"
+
+	"dos-emulator/memory"
+)
+
+// Location of the EGA/VGA graphics window.
+const (
+	GraphicsBase = 0xA0000
+	GraphicsEnd  = 0xB0000
+)
+
+// frameInterval limits how often frames are written to the frames
+// directory while a program is drawing.
+const frameInterval = 100 * time.Millisecond
+
+type framebufferKind int
+
+const (
+	// CGA modes pack 2 or 4 pixels per byte at B800h, with even scan
+	// lines at offset 0 and odd scan lines at offset 2000h.
+	framebufferCGA framebufferKind = iota
+	// EGA/VGA 16-colour modes keep one bit per pixel in each of four
+	// planes sharing the A000h window.
+	framebufferPlanar
+	// VGA mode 13h stores one byte per pixel at A000h.
+	framebufferLinear
+)
+
+type graphicsMode struct {
+	width, height int
+	kind          framebufferKind
+	bitsPerPixel  int
+}
+
+var graphicsModes = map[byte]graphicsMode{
+	0x04: {320, 200, framebufferCGA, 2},
+	0x05: {320, 200, framebufferCGA, 2},
+	0x06: {640, 200, framebufferCGA, 1},
+	0x0D: {320, 200, framebufferPlanar, 4},
+	0x0E: {640, 200, framebufferPlanar, 4},
+	0x10: {640, 350, framebufferPlanar, 4},
+	0x12: {640, 480, framebufferPlanar, 4},
+	0x13: {320, 200, framebufferLinear, 8},
+}
+
+// cgaPalettes maps the four CGA colours of palettes 0 and 1 onto the
+// EGA colour numbers; colour 0 is the background colour.
+var cgaPalettes = [2][4]byte{
+	{0, 2, 4, 6},
+	{0, 3, 5, 7},
+}
+
+// Graphics holds the state of the graphics adapter: the current mode,
+// the plane memory of the 16-colour modes, the palette registers and the
+// 256-entry DAC with 6-bit colour components.
+type Graphics struct {
+	mode          *graphicsMode
+	memory        *memory.Memory
+	linear        []byte // A000h window, read directly, written with Store
+	cga           []byte // B800h window, likewise
+	planes        [4][]byte
+	mapMask       byte
+	palette       [16]byte
+	dac           [256][3]byte
+	cgaPalette    byte
+	cgaBackground byte
+
+	journal PlaneHook // see SetPlaneJournal
+
+	dirty      bool
+	framesDir  string
+	frameCount int
+	lastFrame  time.Time
+}
+
+func newGraphics(mem *memory.Memory) *Graphics {
+	g := &Graphics{
+		memory:     mem,
+		linear:     mem.Slice(GraphicsBase, GraphicsEnd),
+		cga:        mem.Slice(TextBase, TextEnd),
+		mapMask:    0x0F,
+		cgaPalette: 1,
+	}
+	for i := range g.planes {
+		g.planes[i] = make([]byte, GraphicsEnd-GraphicsBase)
+	}
+	g.resetPalette()
+	return g
+}
+
+// resetPalette loads the default VGA palette: the 16 EGA colours, a grey
+// ramp and the 216-entry colour wheel the BIOS installs on a mode set.
+func (g *Graphics) resetPalette() {
+	ega := [16][3]byte{
+		{0, 0, 0}, {0, 0, 42}, {0, 42, 0}, {0, 42, 42},
+		{42, 0, 0}, {42, 0, 42}, {42, 21, 0}, {42, 42, 42},
+		{21, 21, 21}, {21, 21, 63}, {21, 63, 21}, {21, 63, 63},
+		{63, 21, 21}, {63, 21, 63}, {63, 63, 21}, {63, 63, 63},
+	}
+	grey := [16]byte{0, 5, 8, 11, 14, 17, 20, 24, 28, 32, 36, 40, 45, 50, 56, 63}
+
+	for i := range g.palette {
+		g.palette[i] = byte(i)
+	}
+	g.dac = [256][3]byte{}
+	copy(g.dac[:16], ega[:])
+	for i, v := range grey {
+		g.dac[16+i] = [3]byte{v, v, v}
+	}
+
+	// Three brightness levels, each with three saturation levels, each
+	// a 24-step hue wheel from blue through magenta, red, yellow, green
+	// and cyan back towards blue.
+	levels := [9][5]byte{
+		{0, 16, 31, 47, 63}, {31, 39, 47, 55, 63}, {45, 49, 54, 58, 63},
+		{0, 7, 14, 21, 28}, {14, 17, 21, 24, 28}, {20, 22, 24, 26, 28},
+		{0, 4, 8, 12, 16}, {8, 10, 12, 14, 16}, {11, 12, 13, 15, 16},
+	}
+	n := 32
+	for _, l := range levels {
+		lo, hi := l[0], l[4]
+		for i := 0; i < 24; i++ {
+			step := i % 4
+			var c [3]byte
+			switch {
+			case i < 4: // red rising
+				c = [3]byte{l[step], lo, hi}
+			case i < 8: // blue falling
+				c = [3]byte{hi, lo, l[4-step]}
+			case i < 12: // green rising
+				c = [3]byte{hi, l[step], lo}
+			case i < 16: // red falling
+				c = [3]byte{l[4-step], hi, lo}
+			case i < 20: // blue rising
+				c = [3]byte{lo, hi, l[step]}
+			default: // green falling
+				c = [3]byte{lo, l[4-step], hi}
+			}
+			g.dac[n] = c
+			n++
+		}
+	}
+}
+
+// setMode switches to graphics mode m, clearing the framebuffer unless
+// keep is set.
+func (g *Graphics) setMode(m graphicsMode, keep bool) {
+	g.mode = &m
+	g.mapMask = 0x0F
+	g.cgaPalette = 1
+	g.cgaBackground = 0
+	g.resetPalette()
+	if !keep {
+		g.clearWindow(GraphicsBase, g.linear)
+		g.clearWindow(TextBase, g.cga)
+		for p := range g.planes {
+			g.clearPlane(p)
+		}
+	}
+	g.dirty = true
+}
+
+// clearWindow zeroes window, the guest memory starting at base.
+func (g *Graphics) clearWindow(base uint32, window []byte) {
+	for i, b := range window {
+		if b != 0 {
+			g.memory.Store(base+uint32(i), 0)
+		}
+	}
+}
+
+// cpuWrite mirrors a guest write to the A000h window into the planes
+// selected by the map mask when a 16-colour mode is active.
+func (g *Graphics) cpuWrite(offset uint32, value byte) {
+	if g.mode == nil {
+		return
+	}
+	if g.mode.kind == framebufferPlanar {
+		for p := range g.planes {
+			if g.mapMask&(1<<p) != 0 {
+				g.setPlane(p, offset, value)
+			}
+		}
+	}
+	g.dirty = true
+}
+
+// setPlane stores a byte of a plane, telling the journal if it changes.
+func (g *Graphics) setPlane(plane int, offset uint32, value byte) {
+	if old := g.planes[plane][offset]; old != value && g.journal != nil {
+		g.journal(plane, offset, old)
+	}
+	g.planes[plane][offset] = value
+}
+
+func (g *Graphics) clearPlane(plane int) {
+	if g.journal == nil {
+		clear(g.planes[plane])
+		return
+	}
+	for offset := range g.planes[plane] {
+		g.setPlane(plane, uint32(offset), 0)
+	}
+}
+
+func (g *Graphics) inBounds(x, y int) bool {
+	return g.mode != nil && x >= 0 && y >= 0 && x < g.mode.width && y < g.mode.height
+}
+
+// pixel returns the colour number stored for (x, y).
+func (g *Graphics) pixel(x, y int) byte {
+	if !g.inBounds(x, y) {
+		return 0
+	}
+	m := g.mode
+
+	switch m.kind {
+	case framebufferCGA:
+		offset, shift := g.cgaLocation(x, y)
+		mask := byte(1<<m.bitsPerPixel - 1)
+		return (g.cga[offset] >> shift) & mask
+	case framebufferPlanar:
+		offset := y*(m.width/8) + x/8
+		bit := byte(0x80 >> (x % 8))
+		var value byte
+		for p := range g.planes {
+			if g.planes[p][offset]&bit != 0 {
+				value |= 1 << p
+			}
+		}
+		return value
+	default:
+		return g.linear[y*m.width+x]
+	}
+}
+
+// setPixel stores colour number value at (x, y). In the CGA and
+// 16-colour modes bit 7 of value XORs the colour onto the pixel, as
+// INT 10h AH=0Ch does.
+func (g *Graphics) setPixel(x, y int, value byte) {
+	if !g.inBounds(x, y) {
+		return
+	}
+	m := g.mode
+
+	switch m.kind {
+	case framebufferCGA:
+		mask := byte(1<<m.bitsPerPixel - 1)
+		color := value & mask
+		if value&0x80 != 0 {
+			color ^= g.pixel(x, y)
+		}
+		offset, shift := g.cgaLocation(x, y)
+		g.memory.Store(TextBase+uint32(offset), g.cga[offset]&^(mask<<shift)|color<<shift)
+	case framebufferPlanar:
+		color := value & 0x0F
+		if value&0x80 != 0 {
+			color ^= g.pixel(x, y)
+		}
+		offset := y*(m.width/8) + x/8
+		bit := byte(0x80 >> (x % 8))
+		for p := range g.planes {
+			if color&(1<<p) != 0 {
+				g.setPlane(p, uint32(offset), g.planes[p][offset]|bit)
+			} else {
+				g.setPlane(p, uint32(offset), g.planes[p][offset]&^bit)
+			}
+		}
+	default:
+		g.memory.Store(GraphicsBase+uint32(y*m.width+x), value)
+	}
+	g.dirty = true
+}
+
+func (g *Graphics) cgaLocation(x, y int) (int, uint) {
+	bpp := g.mode.bitsPerPixel
+	offset := (y&1)*0x2000 + (y>>1)*80 + x*bpp/8
+	shift := uint(8 - bpp - x*bpp%8)
+	return offset, shift
+}
+
+// colorIndex maps a colour number of the current mode to a DAC entry.
+func (g *Graphics) colorIndex(value byte) byte {
+	switch g.mode.kind {
+	case framebufferCGA:
+		if g.mode.bitsPerPixel == 1 {
+			if value != 0 {
+				return g.palette[15]
+			}
+			return g.palette[0]
+		}
+		if value == 0 {
+			return g.palette[g.cgaBackground]
+		}
+		return g.palette[cgaPalettes[g.cgaPalette][value]]
+	case framebufferPlanar:
+		return g.palette[value&0x0F]
+	default:
+		return value
+	}
+}
+
+// Image renders the current graphics screen using the DAC colours.
+func (g *Graphics) Image() *image.Paletted {
+	m := g.mode
+	pal := make(color.Palette, len(g.dac))
+	for i, c := range g.dac {
+		pal[i] = color.RGBA{dacTo8(c[0]), dacTo8(c[1]), dacTo8(c[2]), 0xFF}
+	}
+
+	img := image.NewPaletted(image.Rect(0, 0, m.width, m.height), pal)
+	for y := 0; y < m.height; y++ {
+		for x := 0; x < m.width; x++ {
+			img.Pix[y*img.Stride+x] = g.colorIndex(g.pixel(x, y))
+		}
+	}
+	return img
+}
+
+func dacTo8(v byte) byte {
+	v &= 0x3F
+	return v<<2 | v>>4
+}
+
+func (g *Graphics) writePNG(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, g.Image()); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// writeFrame saves the screen to the next numbered file in the frames
+// directory if it changed since the last frame.
+func (g *Graphics) writeFrame() error {
+	if g.framesDir == "" || g.mode == nil || !g.dirty {
+		return nil
+	}
+	g.dirty = false
+	g.lastFrame = time.Now()
+	g.frameCount++
+	name := filepath.Join(g.framesDir, fmt.Sprintf("frame-%05d.png", g.frameCount))
+	return g.writePNG(name)
+}
@@ -0,0 +1,390 @@
+package bios
+
+import (
+	"fmt"
+
+	"dos-emulator/memory"
+)
+
+func (b *BIOS) handleInt10() {
+	ah := b.cpu.GetAH()
+	v := b.video
+
+	switch ah {
+	case 0x00:
+		b.setVideoMode(b.cpu.GetAL())
+	case 0x01:
+		v.cursorStart = b.cpu.GetCH()
+		v.cursorEnd = b.cpu.GetCL()
+		b.renderer.MarkDirty()
+	case 0x02:
+		page := int(b.cpu.GetBH()) % TextPages
+		b.renderer.Activate()
+		v.cursorY[page] = int(b.cpu.GetDH())
+		v.cursorX[page] = int(b.cpu.GetDL())
+		b.renderer.MarkDirty()
+	case 0x03:
+		page := int(b.cpu.GetBH()) % TextPages
+		b.cpu.SetDH(byte(v.cursorY[page]))
+		b.cpu.SetDL(byte(v.cursorX[page]))
+		b.cpu.SetCH(v.cursorStart)
+		b.cpu.SetCL(v.cursorEnd)
+	case 0x05:
+		page := int(b.cpu.GetAL())
+		if page < TextPages {
+			b.renderer.Activate()
+			v.activePage = page
+			b.renderer.MarkDirty()
+		}
+	case 0x06, 0x07:
+		b.renderer.Activate()
+		b.scrollWindow(v.activePage,
+			int(b.cpu.GetCH()), int(b.cpu.GetCL()), int(b.cpu.GetDH()), int(b.cpu.GetDL()),
+			int(b.cpu.GetAL()), b.cpu.GetBH(), ah == 0x06)
+	case 0x08:
+		if v.graphics() {
+			b.cpu.AX = 0
+			break
+		}
+		page := int(b.cpu.GetBH()) % TextPages
+		pos := v.cell(page, v.cursorX[page], v.cursorY[page])
+		if pos < len(v.buffer) {
+			b.cpu.SetAL(v.buffer[pos])
+			b.cpu.SetAH(v.buffer[pos+1])
+		}
+	case 0x09, 0x0A:
+		if v.graphics() {
+			break
+		}
+		page := int(b.cpu.GetBH()) % TextPages
+		b.renderer.Activate()
+		b.writeRepeated(page, b.cpu.GetAL(), b.cpu.GetBL(), int(b.cpu.CX), ah == 0x09)
+	case 0x0B:
+		if b.cpu.GetBH() == 0x00 {
+			b.gfx.cgaBackground = b.cpu.GetBL() & 0x0F
+		} else {
+			b.gfx.cgaPalette = b.cpu.GetBL() & 0x01
+		}
+		b.gfx.dirty = true
+	case 0x0C:
+		b.gfx.setPixel(int(b.cpu.CX), int(b.cpu.DX), b.cpu.GetAL())
+	case 0x0D:
+		b.cpu.SetAL(b.gfx.pixel(int(b.cpu.CX), int(b.cpu.DX)))
+	case 0x0E:
+		b.teletypeOutput(b.cpu.GetAL())
+	case 0x0F:
+		b.cpu.SetAL(v.videoMode)
+		b.cpu.SetAH(byte(v.columns))
+		b.cpu.SetBH(byte(v.activePage))
+	case 0x10:
+		b.handlePalette()
+	case 0x13:
+		if v.graphics() {
+			break
+		}
+		b.renderer.Activate()
+		b.writeString()
+	case 0x1A:
+		// Display combination code: VGA with colour analog display.
+		if b.cpu.GetAL() == 0x00 {
+			b.cpu.SetBL(0x08)
+			b.cpu.SetBH(0x00)
+		}
+		b.cpu.SetAL(0x1A)
+	default:
+		if b.debugMode {
+			fmt.Printf("Unhandled INT 10h function: AH=0x%02X\n", ah)
+		}
+	}
+
+	b.syncVideoDataArea()
+}
+
+// setVideoMode implements INT 10h AH=00h. Bit 7 of mode asks the BIOS to
+// keep the contents of video memory.
+func (b *BIOS) setVideoMode(mode byte) {
+	v := b.video
+	keep := mode&0x80 != 0
+	mode &= 0x7F
+
+	if gm, ok := graphicsModes[mode]; ok {
+		b.renderer.Finish()
+		b.saveFrame()
+		v.videoMode = mode
+		v.columns = gm.width / 8
+		v.activePage = 0
+		v.cursorX = [TextPages]int{}
+		v.cursorY = [TextPages]int{}
+		b.gfx.setMode(gm, keep)
+		return
+	}
+	if !isTextMode(mode) {
+		if b.debugMode {
+			fmt.Printf("Unsupported video mode: 0x%02X\n", mode)
+		}
+		return
+	}
+
+	b.saveFrame()
+	b.gfx.mode = nil
+	v.videoMode = mode
+
+	v.columns = 80
+	if mode <= 0x01 {
+		v.columns = 40
+	}
+	v.activePage = 0
+	v.cursorX = [TextPages]int{}
+	v.cursorY = [TextPages]int{}
+	v.cursorStart, v.cursorEnd = 6, 7
+
+	b.renderer.Activate()
+	if !keep {
+		b.fillBuffer(v.currentColor)
+	}
+	b.renderer.MarkDirty()
+}
+
+// teletypeOutput writes char at the cursor of the active page and
+// advances the cursor, handling BEL, BS, TAB, CR and LF and scrolling at
+// the bottom of the screen. Until the renderer takes over the terminal
+// the character is also streamed to stdout, so programs that only print
+// text behave like a console tool.
+func (b *BIOS) teletypeOutput(char byte) {
+	if b.video.graphics() {
+		fmt.Printf("%c", char)
+		return
+	}
+	if !b.renderer.Active() || char == 7 {
+		fmt.Printf("%c", char)
+	}
+	b.teletype(b.video.activePage, char, 0, false)
+}
+
+// teletype performs teletype output on page. The attribute of the cell
+// is only changed when setAttr is true.
+func (b *BIOS) teletype(page int, char, attr byte, setAttr bool) {
+	v := b.video
+
+	switch char {
+	case 7:
+	case '\r':
+		v.cursorX[page] = 0
+	case '\n':
+		b.newLine(page)
+	case '\b':
+		if v.cursorX[page] > 0 {
+			v.cursorX[page]--
+		}
+	case '\t':
+		v.cursorX[page] = (v.cursorX[page] + 8) &^ 7
+		if v.cursorX[page] >= v.columns {
+			v.cursorX[page] = 0
+			b.newLine(page)
+		}
+	default:
+		pos := v.cell(page, v.cursorX[page], v.cursorY[page])
+		if pos < len(v.buffer) {
+			v.set(pos, char)
+			if setAttr {
+				v.set(pos+1, attr)
+			}
+		}
+		v.cursorX[page]++
+		if v.cursorX[page] >= v.columns {
+			v.cursorX[page] = 0
+			b.newLine(page)
+		}
+	}
+	b.renderer.MarkDirty()
+}
+
+// newLine moves the cursor of page down a row, scrolling the page up when
+// it is already on the last row. The new row takes the attribute of the
+// cell under the cursor.
+func (b *BIOS) newLine(page int) {
+	v := b.video
+	v.cursorY[page]++
+	if v.cursorY[page] >= TextRows {
+		v.cursorY[page] = TextRows - 1
+		attr := v.buffer[v.cell(page, 0, v.cursorY[page])+1]
+		b.scrollWindow(page, 0, 0, TextRows-1, v.columns-1, 1, attr, true)
+	}
+}
+
+// writeRepeated implements INT 10h AH=09h and AH=0Ah: count copies of
+// char starting at the cursor of page, without moving the cursor.
+func (b *BIOS) writeRepeated(page int, char, attr byte, count int, setAttr bool) {
+	v := b.video
+	pos := v.cell(page, v.cursorX[page], v.cursorY[page])
+	end := v.cell(page, 0, TextRows)
+	for i := 0; i < count && pos < end; i++ {
+		v.set(pos, char)
+		if setAttr {
+			v.set(pos+1, attr)
+		}
+		pos += 2
+	}
+	b.renderer.MarkDirty()
+}
+
+// writeString implements INT 10h AH=13h. Bit 0 of AL moves the cursor to
+// the end of the string, bit 1 means the string alternates characters and
+// attributes instead of using BL for every character.
+func (b *BIOS) writeString() {
+	v := b.video
+	mode := b.cpu.GetAL()
+	page := int(b.cpu.GetBH()) % TextPages
+	attr := b.cpu.GetBL()
+	count := int(b.cpu.CX)
+	addr := memory.CalculateAddress(b.cpu.ES, b.cpu.BP)
+
+	savedX, savedY := v.cursorX[page], v.cursorY[page]
+	v.cursorY[page] = int(b.cpu.GetDH())
+	v.cursorX[page] = int(b.cpu.GetDL())
+
+	for i := 0; i < count; i++ {
+		char := b.memory.Read8(addr)
+		addr++
+		if mode&0x02 != 0 {
+			attr = b.memory.Read8(addr)
+			addr++
+		}
+		if char == 7 {
+			fmt.Print("\a")
+		}
+		b.teletype(page, char, attr, true)
+	}
+
+	if mode&0x01 == 0 {
+		v.cursorX[page], v.cursorY[page] = savedX, savedY
+	}
+}
+
+// scrollWindow implements INT 10h AH=06h/07h on the rectangle from
+// (top, left) to (bottom, right) of page. lines == 0, or more lines than
+// the window holds, blanks the whole window with attr.
+func (b *BIOS) scrollWindow(page, top, left, bottom, right, lines int, attr byte, up bool) {
+	v := b.video
+	if bottom >= TextRows {
+		bottom = TextRows - 1
+	}
+	if right >= v.columns {
+		right = v.columns - 1
+	}
+	if top > bottom || left > right {
+		return
+	}
+
+	height := bottom - top + 1
+	if lines == 0 || lines > height {
+		lines = height
+	}
+	width := (right - left + 1) * 2
+
+	for i := 0; i < height-lines; i++ {
+		dst, src := top+i, top+i+lines
+		if !up {
+			dst, src = bottom-i, bottom-i-lines
+		}
+		d := v.cell(page, left, dst)
+		s := v.cell(page, left, src)
+		for j := 0; j < width; j++ {
+			v.set(d+j, v.buffer[s+j])
+		}
+	}
+
+	for i := 0; i < lines; i++ {
+		row := bottom - i
+		if !up {
+			row = top + i
+		}
+		pos := v.cell(page, left, row)
+		for j := 0; j < width; j += 2 {
+			v.set(pos+j, ' ')
+			v.set(pos+j+1, attr)
+		}
+	}
+	b.renderer.MarkDirty()
+}
+
+// handlePalette implements INT 10h AH=10h: the EGA palette registers and
+// the VGA DAC colour registers.
+func (b *BIOS) handlePalette() {
+	g := b.gfx
+	al := b.cpu.GetAL()
+
+	switch al {
+	case 0x00:
+		if bl := b.cpu.GetBL(); bl < 16 {
+			g.palette[bl] = b.cpu.GetBH()
+		}
+	case 0x02:
+		addr := memory.CalculateAddress(b.cpu.ES, b.cpu.DX)
+		for i := range g.palette {
+			g.palette[i] = b.memory.Read8(addr + uint32(i))
+		}
+	case 0x07:
+		if bl := b.cpu.GetBL(); bl < 16 {
+			b.cpu.SetBH(g.palette[bl])
+		}
+	case 0x10:
+		g.dac[b.cpu.BX&0xFF] = [3]byte{b.cpu.GetDH() & 0x3F, b.cpu.GetCH() & 0x3F, b.cpu.GetCL() & 0x3F}
+	case 0x12:
+		addr := memory.CalculateAddress(b.cpu.ES, b.cpu.DX)
+		for i := 0; i < int(b.cpu.CX); i++ {
+			entry := (int(b.cpu.BX) + i) & 0xFF
+			for c := 0; c < 3; c++ {
+				g.dac[entry][c] = b.memory.Read8(addr) & 0x3F
+				addr++
+			}
+		}
+	case 0x15:
+		c := g.dac[b.cpu.BX&0xFF]
+		b.cpu.SetDH(c[0])
+		b.cpu.SetCH(c[1])
+		b.cpu.SetCL(c[2])
+	case 0x17:
+		addr := memory.CalculateAddress(b.cpu.ES, b.cpu.DX)
+		for i := 0; i < int(b.cpu.CX); i++ {
+			entry := (int(b.cpu.BX) + i) & 0xFF
+			for c := 0; c < 3; c++ {
+				b.memory.Write8(addr, g.dac[entry][c])
+				addr++
+			}
+		}
+	default:
+		if b.debugMode {
+			fmt.Printf("Unhandled INT 10h palette function: AL=0x%02X\n", al)
+		}
+		return
+	}
+	g.dirty = true
+}
+
+// fillBuffer blanks every display page with attr.
+func (b *BIOS) fillBuffer(attr byte) {
+	for i := 0; i < len(b.video.buffer); i += 2 {
+		b.video.set(i, ' ')
+		b.video.set(i+1, attr)
+	}
+}
+
+// syncVideoDataArea mirrors the video state into the BIOS data area,
+// where many programs read the screen width and cursor position directly.
+func (b *BIOS) syncVideoDataArea() {
+	v := b.video
+	b.memory.Write8(bdaVideoMode, v.videoMode)
+	b.memory.Write16(bdaColumns, uint16(v.columns))
+	b.memory.Write16(bdaPageSize, uint16(v.pageSize()))
+	b.memory.Write16(bdaPageStart, uint16(v.activePage*v.pageSize()))
+	for p := 0; p < TextPages; p++ {
+		b.memory.Write8(uint32(bdaCursorPos+p*2), byte(v.cursorX[p]))
+		b.memory.Write8(uint32(bdaCursorPos+p*2+1), byte(v.cursorY[p]))
+	}
+	b.memory.Write8(bdaCursorType, v.cursorEnd)
+	b.memory.Write8(bdaCursorType+1, v.cursorStart)
+	b.memory.Write8(bdaActivePage, byte(v.activePage))
+	b.memory.Write16(bdaCRTCPort, defaultCRTCPort)
+	b.memory.Write8(bdaRows, TextRows-1)
+}
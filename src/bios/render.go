@@ -0,0 +1,169 @@
+package bios
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// refreshInterval limits how often the terminal is repainted while a
+// program is running.
+const refreshInterval = 40 * time.Millisecond
+
+// dosToANSI maps the IRGB colour order of the attribute byte onto the
+// BGR order of the ANSI SGR colour codes.
+var dosToANSI = [8]int{0, 4, 2, 6, 1, 5, 3, 7}
+
+// TerminalRenderer mirrors the text-mode video buffer onto an ANSI
+// terminal. It stays passive, letting teletype output stream to the
+// terminal as plain text, until a program addresses the screen directly:
+// by writing to B800h or through the cursor and window BIOS calls. From
+// then on the screen is repainted from the video buffer.
+type TerminalRenderer struct {
+	out       io.Writer
+	video     *VideoMemory
+	active    bool
+	dirty     bool
+	shown     []byte
+	lastPaint time.Time
+}
+
+func NewTerminalRenderer(out io.Writer, video *VideoMemory) *TerminalRenderer {
+	return &TerminalRenderer{out: out, video: video}
+}
+
+func (r *TerminalRenderer) Active() bool {
+	return r.active
+}
+
+// Activate switches the terminal to full-screen rendering.
+func (r *TerminalRenderer) Activate() {
+	if r.active {
+		return
+	}
+	r.active = true
+	r.dirty = true
+	r.shown = nil
+	io.WriteString(r.out, "\033[0m\033[2J")
+}
+
+func (r *TerminalRenderer) MarkDirty() {
+	r.dirty = true
+}
+
+// Refresh repaints the terminal if the screen changed and the previous
+// repaint is older than refreshInterval.
+func (r *TerminalRenderer) Refresh() {
+	if r.active && r.dirty && time.Since(r.lastPaint) >= refreshInterval {
+		r.paint()
+	}
+}
+
+// Flush repaints the terminal if the screen changed since the last paint.
+func (r *TerminalRenderer) Flush() {
+	if r.active && r.dirty {
+		r.paint()
+	}
+}
+
+// Finish paints the final screen, leaves the terminal cursor on a fresh
+// line below the program's cursor and returns to passive mode.
+func (r *TerminalRenderer) Finish() {
+	if !r.active {
+		return
+	}
+	r.paint()
+	row := r.video.cursorY[r.video.activePage]
+	if row >= TextRows {
+		row = TextRows - 1
+	}
+	fmt.Fprintf(r.out, "\033[0m\033[?25h\033[%d;1H\n", row+1)
+	r.active = false
+}
+
+func (r *TerminalRenderer) paint() {
+	r.dirty = false
+	r.lastPaint = time.Now()
+	if !isTextMode(r.video.videoMode) {
+		return
+	}
+
+	v := r.video
+	screen := v.page(v.activePage)
+	rowSize := v.columns * 2
+	if len(r.shown) != len(screen) {
+		r.shown = nil
+	}
+
+	var sb strings.Builder
+	lastAttr := -1
+
+	for row := 0; row < TextRows; row++ {
+		line := screen[row*rowSize : (row+1)*rowSize]
+		if r.shown != nil && bytes.Equal(line, r.shown[row*rowSize:(row+1)*rowSize]) {
+			continue
+		}
+
+		fmt.Fprintf(&sb, "\033[%d;1H", row+1)
+		for col := 0; col < v.columns; col++ {
+			ch := line[col*2]
+			attr := line[col*2+1]
+			if int(attr) != lastAttr {
+				sb.WriteString(attributeSGR(attr))
+				lastAttr = int(attr)
+			}
+			sb.WriteRune(cp437[ch])
+		}
+	}
+
+	sb.WriteString("\033[0m")
+	x, y := v.cursorX[v.activePage], v.cursorY[v.activePage]
+	if v.cursorHidden() || x >= v.columns || y >= TextRows {
+		sb.WriteString("\033[?25l")
+	} else {
+		fmt.Fprintf(&sb, "\033[%d;%dH\033[?25h", y+1, x+1)
+	}
+	io.WriteString(r.out, sb.String())
+
+	if r.shown == nil {
+		r.shown = make([]byte, len(screen))
+	}
+	copy(r.shown, screen)
+}
+
+// attributeSGR converts a text attribute byte into an ANSI escape
+// sequence. The low nibble is the foreground colour with bit 3 as
+// intensity, bits 4-6 the background colour and bit 7 blink.
+func attributeSGR(attr byte) string {
+	fg := dosToANSI[attr&0x07] + 30
+	if attr&0x08 != 0 {
+		fg += 60
+	}
+	bg := dosToANSI[(attr>>4)&0x07] + 40
+	if attr&0x80 != 0 {
+		return fmt.Sprintf("\033[0;5;%d;%dm", fg, bg)
+	}
+	return fmt.Sprintf("\033[0;%d;%dm", fg, bg)
+}
+
+// cp437 maps the IBM PC character set to Unicode.
+var cp437 = [256]rune{
+	' ', '☺', '☻', '♥', '♦', '♣', '♠', '•', '◘', '○', '◙', '♂', '♀', '♪', '♫', '☼',
+	'►', '◄', '↕', '‼', '¶', '§', '▬', '↨', '↑', '↓', '→', '←', '∟', '↔', '▲', '▼',
+	' ', '!', '"', '#', '$', '%', '&', '\'', '(', ')', '*', '+', ',', '-', '.', '/',
+	'0', '1', '2', '3', '4', '5', '6', '7', '8', '9', ':', ';', '<', '=', '>', '?',
+	'@', 'A', 'B', 'C', 'D', 'E', 'F', 'G', 'H', 'I', 'J', 'K', 'L', 'M', 'N', 'O',
+	'P', 'Q', 'R', 'S', 'T', 'U', 'V', 'W', 'X', 'Y', 'Z', '[', '\\', ']', '^', '_',
+	'`', 'a', 'b', 'c', 'd', 'e', 'f', 'g', 'h', 'i', 'j', 'k', 'l', 'm', 'n', 'o',
+	'p', 'q', 'r', 's', 't', 'u', 'v', 'w', 'x', 'y', 'z', '{', '|', '}', '~', '⌂',
+	'Ç', 'ü', 'é', 'â', 'ä', 'à', 'å', 'ç', 'ê', 'ë', 'è', 'ï', 'î', 'ì', 'Ä', 'Å',
+	'É', 'æ', 'Æ', 'ô', 'ö', 'ò', 'û', 'ù', 'ÿ', 'Ö', 'Ü', '¢', '£', '¥', '₧', 'ƒ',
+	'á', 'í', 'ó', 'ú', 'ñ', 'Ñ', 'ª', 'º', '¿', '⌐', '¬', '½', '¼', '¡', '«', '»',
+	'░', '▒', '▓', '│', '┤', '╡', '╢', '╖', '╕', '╣', '║', '╗', '╝', '╜', '╛', '┐',
+	'└', '┴', '┬', '├', '─', '┼', '╞', '╟', '╚', '╔', '╩', '╦', '╠', '═', '╬', '╧',
+	'╨', '╤', '╥', '╙', '╘', '╒', '╓', '╫', '╪', '┘', '┌', '█', '▄', '▌', '▐', '▀',
+	'α', 'ß', 'Γ', 'π', 'Σ', 'σ', 'µ', 'τ', 'Φ', 'Θ', 'Ω', 'δ', '∞', 'φ', 'ε', '∩',
+	'≡', '±', '≥', '≤', '⌠', '⌡', '÷', '≈', '°', '∙', '·', '√', 'ⁿ', '²', '■', ' ',
+}
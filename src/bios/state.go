@@ -0,0 +1,88 @@
+package bios
+
+// VideoState is the display state held outside video memory: the BIOS
+// cursor, page, mode and colour settings and the graphics adapter's mode,
+// palette and registers. It is comparable, so that the DOS recorder can
+// tell whether an instruction changed it.
+type VideoState struct {
+	cursorX, cursorY          [TextPages]int
+	cursorStart, cursorEnd    byte
+	activePage, columns       int
+	currentColor, videoMode   byte
+	graphics                  bool
+	mode                      graphicsMode
+	mapMask                   byte
+	palette                   [16]byte
+	dac                       [256][3]byte
+	cgaPalette, cgaBackground byte
+	vga                       vgaPorts
+}
+
+// VideoState returns the display state, for SetVideoState to put back
+// later.
+func (b *BIOS) VideoState() VideoState {
+	v, g := b.video, b.gfx
+	s := VideoState{
+		cursorX:       v.cursorX,
+		cursorY:       v.cursorY,
+		cursorStart:   v.cursorStart,
+		cursorEnd:     v.cursorEnd,
+		activePage:    v.activePage,
+		columns:       v.columns,
+		currentColor:  v.currentColor,
+		videoMode:     v.videoMode,
+		graphics:      g.mode != nil,
+		mapMask:       g.mapMask,
+		palette:       g.palette,
+		dac:           g.dac,
+		cgaPalette:    g.cgaPalette,
+		cgaBackground: g.cgaBackground,
+		vga:           *b.vga,
+	}
+	if g.mode != nil {
+		s.mode = *g.mode
+	}
+	return s
+}
+
+func (b *BIOS) SetVideoState(s VideoState) {
+	v, g := b.video, b.gfx
+	v.cursorX, v.cursorY = s.cursorX, s.cursorY
+	v.cursorStart, v.cursorEnd = s.cursorStart, s.cursorEnd
+	v.activePage, v.columns = s.activePage, s.columns
+	v.currentColor, v.videoMode = s.currentColor, s.videoMode
+	g.mode = nil
+	if s.graphics {
+		mode := s.mode
+		g.mode = &mode
+	}
+	g.mapMask = s.mapMask
+	g.palette, g.dac = s.palette, s.dac
+	g.cgaPalette, g.cgaBackground = s.cgaPalette, s.cgaBackground
+	*b.vga = s.vga
+	b.Redraw()
+}
+
+// PlaneHook is called with the old value whenever a byte of a 16-colour
+// graphics plane changes.
+type PlaneHook func(plane int, offset uint32, old byte)
+
+// SetPlaneJournal sets the hook called for changes to the graphics
+// planes, which live outside the address space, or removes it if hook is
+// nil.
+func (b *BIOS) SetPlaneJournal(hook PlaneHook) {
+	b.gfx.journal = hook
+}
+
+// RestorePlane puts back a byte the plane journal recorded.
+func (b *BIOS) RestorePlane(plane int, offset uint32, value byte) {
+	b.gfx.planes[plane][offset] = value
+	b.gfx.dirty = true
+}
+
+// Redraw repaints the screen from video memory, which has been changed
+// without going through the watch hooks.
+func (b *BIOS) Redraw() {
+	b.renderer.MarkDirty()
+	b.gfx.dirty = true
+}
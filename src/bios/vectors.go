@@ -0,0 +1,68 @@
+package bios
+
+import (
+	"dos-emulator/cpu"
+	"dos-emulator/memory"
+)
+
+// StubSegment is the ROM segment holding the interrupt entry stubs.
+const StubSegment = 0xF000
+
+// stubBase is the offset of the stub for vector 0 within StubSegment.
+// Each vector gets a four-byte stub: TRAP nn followed by IRET.
+const stubBase = 0x1000
+
+// timerStub is the offset of the INT 08h handler. Unlike the other stubs
+// it is real code: after the BIOS has counted the tick it calls the user
+// timer hook INT 1Ch and acknowledges the interrupt at the PIC, so that
+// programs hooking either vector see the same sequence as on a PC.
+const timerStub = 0x1400
+
+var timerHandler = []byte{
+	cpu.TrapOpcode, cpu.TrapModRM, 0x08, // TRAP 08h
+	0xCD, 0x1C, // INT 1Ch
+	0x50,       // PUSH AX
+	0xB0, 0x20, // MOV AL, 20h
+	0xE6, 0x20, // OUT 20h, AL
+	0x58, // POP AX
+	0xCF, // IRET
+}
+
+// StubAddress returns the segment:offset of the ROM stub for intNum.
+func StubAddress(intNum byte) (uint16, uint16) {
+	return StubSegment, stubBase + uint16(intNum)*4
+}
+
+// InstallVectors writes the ROM interrupt stubs and points every entry of
+// the interrupt vector table at 0000:0000 to its stub, as the BIOS power-on
+// self test does. Programs may then hook or chain any vector with
+// INT 21h AH=25h/35h or by writing the table directly.
+func (b *BIOS) InstallVectors() {
+	for i := 0; i < 256; i++ {
+		intNum := byte(i)
+		segment, offset := StubAddress(intNum)
+		stub := memory.CalculateAddress(segment, offset)
+		b.memory.Write8(stub, cpu.TrapOpcode)
+		b.memory.Write8(stub+1, cpu.TrapModRM)
+		b.memory.Write8(stub+2, intNum)
+		b.memory.Write8(stub+3, 0xCF)
+
+		vector := uint32(intNum) * 4
+		b.memory.Write16(vector, offset)
+		b.memory.Write16(vector+2, segment)
+	}
+
+	// The single-step, breakpoint and overflow exceptions and the INT 1Ch
+	// timer hook are there for programs to take over; by default they
+	// return at once.
+	for _, intNum := range []byte{0x01, 0x03, 0x04, 0x1C} {
+		segment, offset := StubAddress(intNum)
+		b.memory.Write8(memory.CalculateAddress(segment, offset), 0xCF)
+	}
+
+	timer := memory.CalculateAddress(StubSegment, timerStub)
+	for i, code := range timerHandler {
+		b.memory.Write8(timer+uint32(i), code)
+	}
+	b.memory.Write16(0x08*4, timerStub)
+}
@@ -0,0 +1,111 @@
+package bios
+
+import "dos-emulator/ioport"
+
+// VGA register ports handled by vgaPorts.
+const (
+	portSeqIndex     = 0x3C4
+	portSeqData      = 0x3C5
+	portDACReadIndex = 0x3C7
+	portDACIndex     = 0x3C8
+	portDACData      = 0x3C9
+	portInputStatus  = 0x3DA
+
+	seqMapMask = 0x02
+)
+
+// vgaPorts exposes the VGA registers that programs commonly program
+// directly: the sequencer map mask selecting the planes written through
+// A000h, the DAC colour registers and the input status register used to
+// wait for vertical retrace.
+type vgaPorts struct {
+	gfx          *Graphics
+	seqIndex     byte
+	dacRead      byte
+	dacWrite     byte
+	dacComponent int
+	dacReading   bool
+	statusReads  int
+}
+
+// RegisterPorts attaches the video adapter's registers to bus.
+func (b *BIOS) RegisterPorts(bus *ioport.Bus) {
+	bus.Register(portSeqIndex, portDACData, b.vga)
+	bus.Register(portInputStatus, portInputStatus, b.vga)
+}
+
+func (v *vgaPorts) Read8(port uint16) byte {
+	switch port {
+	case portSeqIndex:
+		return v.seqIndex
+	case portSeqData:
+		if v.seqIndex == seqMapMask {
+			return v.gfx.mapMask
+		}
+	case portDACReadIndex:
+		if v.dacReading {
+			return 0x03
+		}
+		return 0x00
+	case portDACIndex:
+		return v.dacWrite
+	case portDACData:
+		value := v.gfx.dac[v.dacRead][v.dacComponent]
+		v.nextComponent(&v.dacRead)
+		return value
+	case portInputStatus:
+		// Alternate between display and retrace so that loops waiting
+		// for either state finish. Bit 3 is vertical retrace, bit 0
+		// display disabled.
+		v.statusReads++
+		if v.statusReads&1 != 0 {
+			return 0x09
+		}
+		return 0x00
+	}
+	return 0xFF
+}
+
+func (v *vgaPorts) Write8(port uint16, value byte) {
+	switch port {
+	case portSeqIndex:
+		v.seqIndex = value
+	case portSeqData:
+		if v.seqIndex == seqMapMask {
+			v.gfx.mapMask = value & 0x0F
+		}
+	case portDACReadIndex:
+		v.dacRead = value
+		v.dacComponent = 0
+		v.dacReading = true
+	case portDACIndex:
+		v.dacWrite = value
+		v.dacComponent = 0
+		v.dacReading = false
+	case portDACData:
+		v.gfx.dac[v.dacWrite][v.dacComponent] = value & 0x3F
+		v.gfx.dirty = true
+		v.nextComponent(&v.dacWrite)
+	}
+}
+
+// nextComponent advances through red, green and blue, moving index to
+// the next colour register after blue.
+func (v *vgaPorts) nextComponent(index *byte) {
+	v.dacComponent++
+	if v.dacComponent == 3 {
+		v.dacComponent = 0
+		*index++
+	}
+}
+
+// Read16 and Write16 access the port pair as two byte ports, low byte
+// first, so that OUT DX, AX sets an index and its data register at once.
+func (v *vgaPorts) Read16(port uint16) uint16 {
+	return uint16(v.Read8(port)) | uint16(v.Read8(port+1))<<8
+}
+
+func (v *vgaPorts) Write16(port uint16, value uint16) {
+	v.Write8(port, byte(value))
+	v.Write8(port+1, byte(value>>8))
+}
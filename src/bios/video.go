@@ -0,0 +1,88 @@
+package bios
+
+import "dos-emulator/memory"
+
+// Geometry and location of the colour text-mode video buffer.
+const (
+	TextRows  = 25
+	TextPages = 8
+	TextBase  = 0xB8000
+	TextEnd   = 0xC0000
+)
+
+// BIOS data area fields describing the video state.
+const (
+	bdaVideoMode    = 0x449
+	bdaColumns      = 0x44A
+	bdaPageSize     = 0x44C
+	bdaPageStart    = 0x44E
+	bdaCursorPos    = 0x450
+	bdaCursorType   = 0x460
+	bdaActivePage   = 0x462
+	bdaCRTCPort     = 0x463
+	bdaRows         = 0x484
+	defaultCRTCPort = 0x3D4
+)
+
+// VideoMemory holds the text-mode display state. buffer aliases guest
+// memory from B800:0000 to the end of the colour video segment, so
+// programs writing there directly and the BIOS services see the same
+// screen. The BIOS reads the buffer directly but writes it with set, so
+// that watchpoints and the decode cache see its output. Each display
+// page has its own cursor.
+type VideoMemory struct {
+	buffer       []byte
+	memory       *memory.Memory
+	cursorX      [TextPages]int
+	cursorY      [TextPages]int
+	cursorStart  byte
+	cursorEnd    byte
+	activePage   int
+	columns      int
+	currentColor byte
+	videoMode    byte
+}
+
+// isTextMode reports whether mode is one of the CGA/MDA text modes.
+func isTextMode(mode byte) bool {
+	return mode <= 0x03 || mode == 0x07
+}
+
+// graphics reports whether a graphics mode is active.
+func (v *VideoMemory) graphics() bool {
+	return !isTextMode(v.videoMode)
+}
+
+// pageSize is the distance between display pages, rounded up to the
+// next 2 KB boundary as the BIOS does.
+func (v *VideoMemory) pageSize() int {
+	return (v.columns*TextRows*2 + 0x7FF) &^ 0x7FF
+}
+
+// screenSize is the number of bytes a page of character cells occupies.
+func (v *VideoMemory) screenSize() int {
+	return v.columns * TextRows * 2
+}
+
+// page returns the character cells of display page p.
+func (v *VideoMemory) page(p int) []byte {
+	start := (p % TextPages) * v.pageSize()
+	return v.buffer[start : start+v.screenSize()]
+}
+
+// cell returns the buffer offset of the character at row y, column x of
+// page p.
+func (v *VideoMemory) cell(p, x, y int) int {
+	return (p%TextPages)*v.pageSize() + (y*v.columns+x)*2
+}
+
+// set stores value at offset pos of the buffer.
+func (v *VideoMemory) set(pos int, value byte) {
+	v.memory.Store(TextBase+uint32(pos), value)
+}
+
+// cursorHidden reports whether the cursor was switched off with INT 10h
+// AH=01h (start line with bit 5 set).
+func (v *VideoMemory) cursorHidden() bool {
+	return v.cursorStart&0x20 != 0
+}
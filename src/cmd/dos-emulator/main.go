@@ -0,0 +1,150 @@
+// Command dos-emulator runs DOS COM and EXE programs or starts the
+// interactive emulator shell.
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"dos-emulator/cpu"
+	"dos-emulator/dos"
+	"dos-emulator/gdb"
+	"dos-emulator/shell"
+)
+
+func usage() {
+	fmt.Println("MS-DOS Emulator v5.2 - Complete COM & EXE Support")
+	fmt.Println("\nUsage:")
+	fmt.Println("  dos [options]            Start interactive shell")
+	fmt.Println("  dos [options] <file> [arguments]")
+	fmt.Println("                           Run COM or EXE file directly")
+	fmt.Println("\nOptions:")
+	fmt.Println("  -d, --debug              Run in debug mode")
+	fmt.Println("  --cpu <model>            Emulate an 8086, 80186, 80286 or 80386 (default 80286)")
+	fmt.Println("  --no-fpu                 Run without an 8087/287 coprocessor")
+	fmt.Println("  --check-flags            Check lazily evaluated flags against eager ones")
+	fmt.Println("  --clock <rate>           Run at 4.77MHz, 8MHz, ... or max (default max)")
+	fmt.Println("  --frames-dir <dir>       Save graphics frames as PNG files in dir")
+	fmt.Println("  --gdb [host]:port        Let gdb debug the program over TCP")
+	fmt.Println("\nSupported file formats:")
+	fmt.Println("  .COM files       - DOS COM executables")
+	fmt.Println("  .EXE files       - DOS EXE executables with relocations")
+	fmt.Println("\nFeatures:")
+	fmt.Println("  - Full 8086 CPU emulation")
+	fmt.Println("  - BIOS interrupts (INT 10h, 16h, 1Ah)")
+	fmt.Println("  - CGA, EGA and VGA graphics modes")
+	fmt.Println("  - DOS interrupts (INT 20h, 21h)")
+	fmt.Println("  - File system operations")
+	fmt.Println("  - Interactive debugger")
+	fmt.Println("  - REP prefix support for string operations (FULLY FIXED)")
+}
+
+// optionValue returns the value of an option given either as
+// "--name=value" or as "--name value", advancing i past a separate value.
+func optionValue(args []string, i *int) (string, bool) {
+	if _, value, ok := strings.Cut(args[*i], "="); ok {
+		return value, true
+	}
+	if *i+1 < len(args) {
+		*i++
+		return args[*i], true
+	}
+	return "", false
+}
+
+func main() {
+	emulator := dos.NewDOSEmulator()
+	args := os.Args[1:]
+	file := ""
+	gdbAddr := ""
+	var programArgs []string
+
+	for i := 0; i < len(args) && file == ""; i++ {
+		arg := args[i]
+		name, _, _ := strings.Cut(arg, "=")
+
+		switch name {
+		case "-h", "--help":
+			usage()
+			return
+		case "-d", "--debug":
+			emulator.SetDebugMode(true)
+		case "--cpu":
+			name, ok := optionValue(args, &i)
+			if !ok {
+				fmt.Println("Error: --cpu requires a model")
+				return
+			}
+			model, err := cpu.ParseModel(name)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				return
+			}
+			emulator.Executor().SetModel(model)
+		case "--no-fpu":
+			emulator.SetFPU(false)
+		case "--check-flags":
+			emulator.Executor().SetFlagCheck(true)
+		case "--clock":
+			rate, ok := optionValue(args, &i)
+			if !ok {
+				fmt.Println("Error: --clock requires a rate")
+				return
+			}
+			hz, err := dos.ParseClock(rate)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				return
+			}
+			emulator.SetClock(hz)
+		case "--frames-dir":
+			dir, ok := optionValue(args, &i)
+			if !ok {
+				fmt.Println("Error: --frames-dir requires a directory")
+				return
+			}
+			if err := emulator.BIOS().SetFramesDir(dir); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				return
+			}
+		case "--gdb":
+			addr, ok := optionValue(args, &i)
+			if !ok {
+				fmt.Println("Error: --gdb requires a port, such as :1234")
+				return
+			}
+			gdbAddr = addr
+		default:
+			if strings.HasPrefix(arg, "-") {
+				fmt.Printf("Error: unknown option %s\n", arg)
+				usage()
+				return
+			}
+			file = arg
+			programArgs = args[i+1:]
+		}
+	}
+
+	if file == "" {
+		if gdbAddr != "" {
+			fmt.Println("Error: --gdb requires a program to debug")
+			return
+		}
+		shell.New(emulator).Run()
+		return
+	}
+
+	if err := emulator.LoadFile(file, programArgs...); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	if gdbAddr != "" {
+		if err := gdb.Serve(emulator, gdbAddr); err != nil {
+			fmt.Printf("Error: %v\n", err)
+		}
+		emulator.BIOS().FinishScreen()
+		return
+	}
+	emulator.Run()
+}
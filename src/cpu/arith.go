@@ -0,0 +1,451 @@
+package cpu
+
+// This file holds the arithmetic, logic, shift and bit instructions.
+
+// sizeMask and signBit describe an operand of size bytes.
+func sizeMask(size int) uint32 {
+	if size == 4 {
+		return 0xFFFFFFFF
+	}
+	return 1<<(8*uint(size)) - 1
+}
+
+func signBit(size int) uint32 {
+	return 1 << (8*uint(size) - 1)
+}
+
+// signExtend returns value, an operand of size bytes, as a signed number.
+func signExtend(value uint32, size int) int64 {
+	shift := 64 - 8*uint(size)
+	return int64(uint64(value)<<shift) >> shift
+}
+
+// setResultFlags sets ZF, SF and PF for a result of size bytes.
+func (e *Executor) setResultFlags(result uint32, size int) {
+	e.cpu.Flags.record(opLogic, size, 0, 0, 0, result, resultFlags)
+}
+
+// alu performs the arithmetic or logic operation selected by op, in the
+// order of the reg field of opcodes 80h-83h (ADD, OR, ADC, SBB, AND, SUB,
+// XOR, CMP), on operands of size bytes and records it for the status
+// flags.
+func (e *Executor) alu(op byte, a, b uint32, size int) uint32 {
+	mask := sizeMask(size)
+	a &= mask
+	b &= mask
+	carry := uint32(0)
+	if (op == 2 || op == 3) && e.cpu.Flags.CF() {
+		carry = 1
+	}
+
+	var result uint32
+	switch op {
+	case 0, 2: // ADD, ADC
+		result = (a + b + carry) & mask
+		e.cpu.Flags.record(opAdd, size, a, b, carry, result, statusFlags)
+	case 3, 5, 7: // SBB, SUB, CMP
+		result = (a - b - carry) & mask
+		e.cpu.Flags.record(opSub, size, a, b, carry, result, statusFlags)
+	case 1, 4, 6: // OR, AND, XOR
+		switch op {
+		case 1:
+			result = a | b
+		case 4:
+			result = a & b
+		default:
+			result = a ^ b
+		}
+		e.cpu.Flags.record(opLogic, size, a, b, 0, result, statusFlags)
+	}
+	return result
+}
+
+// incDec adds one to value, or subtracts one if dec is set, setting the
+// status flags other than CF as INC and DEC do.
+func (e *Executor) incDec(dec bool, value uint32, size int) uint32 {
+	value &= sizeMask(size)
+	if dec {
+		result := (value - 1) & sizeMask(size)
+		e.cpu.Flags.record(opSub, size, value, 1, 0, result, statusFlags&^flagCF)
+		return result
+	}
+	result := (value + 1) & sizeMask(size)
+	e.cpu.Flags.record(opAdd, size, value, 1, 0, result, statusFlags&^flagCF)
+	return result
+}
+
+// shift performs the rotate or shift selected by op (the reg field of
+// opcodes C0h-D3h) count times on a value of size bytes. Processors from
+// the 80186 on mask the count to five bits; callers do that for them.
+func (e *Executor) shift(op byte, value uint32, count byte, size int) uint32 {
+	if count == 0 {
+		return value
+	}
+	mask := sizeMask(size)
+	sign := signBit(size)
+	value &= mask
+	original := value
+
+	for i := byte(0); i < count; i++ {
+		switch op {
+		case 0: // ROL
+			e.cpu.Flags.SetCF(value&sign != 0)
+			value = (value << 1) & mask
+			if e.cpu.Flags.CF() {
+				value |= 1
+			}
+		case 1: // ROR
+			e.cpu.Flags.SetCF(value&1 != 0)
+			value >>= 1
+			if e.cpu.Flags.CF() {
+				value |= sign
+			}
+		case 2: // RCL
+			carry := e.cpu.Flags.CF()
+			e.cpu.Flags.SetCF(value&sign != 0)
+			value = (value << 1) & mask
+			if carry {
+				value |= 1
+			}
+		case 3: // RCR
+			carry := e.cpu.Flags.CF()
+			e.cpu.Flags.SetCF(value&1 != 0)
+			value >>= 1
+			if carry {
+				value |= sign
+			}
+		case 4, 6: // SHL/SAL
+			e.cpu.Flags.SetCF(value&sign != 0)
+			value = (value << 1) & mask
+		case 5: // SHR
+			e.cpu.Flags.SetCF(value&1 != 0)
+			value >>= 1
+		case 7: // SAR
+			e.cpu.Flags.SetCF(value&1 != 0)
+			value = (value >> 1) | (value & sign)
+		}
+	}
+
+	switch op {
+	case 0, 2, 4, 6:
+		e.cpu.Flags.SetOF((value&sign != 0) != e.cpu.Flags.CF())
+	case 1, 3:
+		e.cpu.Flags.SetOF((value^(value<<1))&sign != 0)
+	case 5:
+		e.cpu.Flags.SetOF(original&sign != 0)
+	case 7:
+		e.cpu.Flags.SetOF(false)
+	}
+	if op >= 4 {
+		e.setResultFlags(value, size)
+	}
+	return value
+}
+
+// arith runs ADD, OR, ADC, SBB, AND, SUB, XOR and CMP. The one-byte
+// opcodes 00-3D select the operation in bits 3-5, opcodes 80-83 in the
+// reg field.
+func (e *Executor) arith(inst *Instruction) {
+	op := (inst.Opcode >> 3) & 0x07
+	if inst.Opcode >= 0x80 {
+		op = (inst.ModRM >> 3) & 0x07
+	}
+	dst := e.operand(inst, 0)
+	result := e.alu(op, e.load(dst, inst.size), e.load(e.operand(inst, 1), inst.size), inst.size)
+	if op != 7 {
+		e.store(dst, inst.size, result)
+	}
+}
+
+func (e *Executor) test(inst *Instruction) {
+	e.alu(4, e.load(e.operand(inst, 0), inst.size), e.load(e.operand(inst, 1), inst.size), inst.size)
+}
+
+// increment runs INC and DEC: opcodes 40-4F, and FE and FF with a reg
+// field of 0 or 1.
+func (e *Executor) increment(inst *Instruction) {
+	dec := inst.Opcode >= 0x48 && inst.Opcode <= 0x4F
+	if inst.HasModRM {
+		dec = (inst.ModRM>>3)&0x07 == 1
+	}
+	dst := e.operand(inst, 0)
+	e.store(dst, inst.size, e.incDec(dec, e.load(dst, inst.size), inst.size))
+}
+
+func (e *Executor) not(inst *Instruction) {
+	dst := e.operand(inst, 0)
+	e.store(dst, inst.size, ^e.load(dst, inst.size))
+}
+
+func (e *Executor) neg(inst *Instruction) {
+	dst := e.operand(inst, 0)
+	e.store(dst, inst.size, e.alu(5, 0, e.load(dst, inst.size), inst.size))
+}
+
+// accumulatorHigh returns the register that holds the upper half of the
+// double-size product or dividend of MUL, IMUL, DIV and IDIV: AH, DX or
+// EDX.
+func accumulatorHigh(size int) byte {
+	if size == 1 {
+		return 4
+	}
+	return 2
+}
+
+// mul multiplies the accumulator by the operand into AX, DX:AX or
+// EDX:EAX. CF and OF tell whether the upper half is in use.
+func (e *Executor) mul(inst *Instruction) {
+	size := inst.size
+	bits := 8 * uint(size)
+	result := uint64(e.readRegister(0, size)) * uint64(e.readOperand(inst, size))
+	e.writeRegister(0, size, uint32(result))
+	e.writeRegister(accumulatorHigh(size), size, uint32(result>>bits))
+	e.cpu.Flags.SetCF(result>>bits != 0)
+	e.cpu.Flags.SetOF(e.cpu.Flags.CF())
+}
+
+// imul is the signed form of mul. CF and OF tell whether the product
+// does not fit the lower half.
+func (e *Executor) imul(inst *Instruction) {
+	size := inst.size
+	bits := 8 * uint(size)
+	result := signExtend(e.readRegister(0, size), size) * signExtend(e.readOperand(inst, size), size)
+	e.writeRegister(0, size, uint32(result))
+	e.writeRegister(accumulatorHigh(size), size, uint32(uint64(result)>>bits))
+	e.cpu.Flags.SetCF(result != signExtend(uint32(result), size))
+	e.cpu.Flags.SetOF(e.cpu.Flags.CF())
+}
+
+// dividend returns AX, DX:AX or EDX:EAX for a divisor of size bytes.
+func (e *Executor) dividend(size int) uint64 {
+	return uint64(e.readRegister(accumulatorHigh(size), size))<<(8*uint(size)) | uint64(e.readRegister(0, size))
+}
+
+// div divides AX, DX:AX or EDX:EAX by the operand, leaving the quotient
+// in the lower and the remainder in the upper half.
+func (e *Executor) div(inst *Instruction) {
+	size := inst.size
+	divisor := uint64(e.readOperand(inst, size))
+	dividend := e.dividend(size)
+	if divisor == 0 || dividend/divisor > uint64(sizeMask(size)) {
+		e.divideError(inst)
+		return
+	}
+	e.writeRegister(0, size, uint32(dividend/divisor))
+	e.writeRegister(accumulatorHigh(size), size, uint32(dividend%divisor))
+}
+
+// idiv is the signed form of div. The 8086 also faults on the most
+// negative quotient, which later processors return.
+func (e *Executor) idiv(inst *Instruction) {
+	size := inst.size
+	shift := 64 - 16*uint(size)
+	dividend := int64(e.dividend(size)<<shift) >> shift
+	divisor := signExtend(e.readOperand(inst, size), size)
+	if divisor == 0 || (size == 4 && dividend == -1<<63 && divisor == -1) {
+		e.divideError(inst)
+		return
+	}
+	quotient := dividend / divisor
+	limit := int64(1) << (8*uint(size) - 1)
+	if quotient < -limit || quotient >= limit || (quotient == -limit && e.model == Model8086) {
+		e.divideError(inst)
+		return
+	}
+	e.writeRegister(0, size, uint32(quotient))
+	e.writeRegister(accumulatorHigh(size), size, uint32(dividend%divisor))
+}
+
+// imulRegister runs the forms of IMUL that name their destination
+// register: IMUL r, r/m, imm (69, 6B) and IMUL r, r/m (0F AF).
+func (e *Executor) imulRegister(inst *Instruction) {
+	size := inst.size
+	dst := e.operand(inst, 0)
+	a, b := e.load(dst, size), e.load(e.operand(inst, 1), size)
+	if inst.op.operands[2] != noOperand {
+		a, b = b, e.load(e.operand(inst, 2), size)
+	}
+	result := signExtend(a, size) * signExtend(b, size)
+	e.store(dst, size, uint32(result))
+	e.cpu.Flags.SetCF(result != signExtend(uint32(result), size))
+	e.cpu.Flags.SetOF(e.cpu.Flags.CF())
+}
+
+// shiftGroup runs the rotates and shifts of opcodes C0, C1 and D0-D3,
+// with the count given by 1, CL or an immediate.
+func (e *Executor) shiftGroup(inst *Instruction) {
+	count := byte(e.load(e.operand(inst, 1), 1))
+	if e.model >= Model80186 {
+		count &= 0x1F
+	}
+	dst := e.operand(inst, 0)
+	e.store(dst, inst.size, e.shift((inst.ModRM>>3)&0x07, e.load(dst, inst.size), count, inst.size))
+}
+
+// doubleShift runs SHLD and SHRD, which shift the bits of a register
+// into the destination.
+func (e *Executor) doubleShift(inst *Instruction) {
+	size := inst.size
+	count := uint(e.load(e.operand(inst, 2), 1)) & 0x1F
+	if count == 0 {
+		return
+	}
+	bits := uint(size * 8)
+	target := e.operand(inst, 0)
+	dst := uint64(e.load(target, size))
+	src := uint64(e.load(e.operand(inst, 1), size))
+	var result uint64
+	if inst.Opcode2 <= 0xA5 {
+		result = (dst<<count | src<<count>>bits) & uint64(sizeMask(size))
+		e.cpu.Flags.SetCF((dst<<count)>>bits&1 != 0)
+	} else {
+		result = (dst>>count | src<<(bits-count)) & uint64(sizeMask(size))
+		e.cpu.Flags.SetCF(dst>>(count-1)&1 != 0)
+	}
+	e.cpu.Flags.SetOF((uint32(result)^uint32(dst))&signBit(size) != 0)
+	e.setResultFlags(uint32(result), size)
+	e.store(target, size, uint32(result))
+}
+
+// decimalAdjust runs DAA (27) and DAS (2F), which correct AL after
+// adding or subtracting packed BCD numbers.
+func (e *Executor) decimalAdjust(inst *Instruction) {
+	step := byte(1) // -1 for DAS
+	if inst.Opcode == 0x2F {
+		step = 0xFF
+	}
+	al := e.cpu.GetAL()
+	oldAL := al
+	oldCF := e.cpu.Flags.CF()
+
+	if (al&0x0F) > 9 || e.cpu.Flags.AF() {
+		al += 0x06 * step
+		e.cpu.Flags.SetAF(true)
+	} else {
+		e.cpu.Flags.SetAF(false)
+	}
+
+	if oldAL > 0x99 || oldCF {
+		al += 0x60 * step
+		e.cpu.Flags.SetCF(true)
+	} else {
+		e.cpu.Flags.SetCF(false)
+	}
+
+	e.cpu.SetAL(al)
+	e.cpu.UpdateArithmeticFlags8(al)
+}
+
+// asciiAdjust runs AAA (37) and AAS (3F), which correct AL and AH after
+// adding or subtracting unpacked BCD digits.
+func (e *Executor) asciiAdjust(inst *Instruction) {
+	step := byte(1) // -1 for AAS
+	if inst.Opcode == 0x3F {
+		step = 0xFF
+	}
+	al := e.cpu.GetAL()
+	if (al&0x0F) > 9 || e.cpu.Flags.AF() {
+		e.cpu.SetAL((al + 6*step) & 0x0F)
+		e.cpu.SetAH(e.cpu.GetAH() + step)
+		e.cpu.Flags.SetAF(true)
+		e.cpu.Flags.SetCF(true)
+	} else {
+		e.cpu.Flags.SetAF(false)
+		e.cpu.Flags.SetCF(false)
+		e.cpu.SetAL(al & 0x0F)
+	}
+}
+
+// aam splits AL into digits of the immediate base (10 for the AAM
+// mnemonic) in AH and AL. A base of 0 is a divide error.
+func (e *Executor) aam(inst *Instruction) {
+	base := byte(inst.Immediate32)
+	if base == 0 {
+		e.divideError(inst)
+		return
+	}
+	al := e.cpu.GetAL()
+	e.cpu.SetAH(al / base)
+	e.cpu.SetAL(al % base)
+	e.cpu.UpdateArithmeticFlags8(e.cpu.GetAL())
+}
+
+// aad combines the digits in AH and AL of the immediate base into AL.
+func (e *Executor) aad(inst *Instruction) {
+	base := byte(inst.Immediate32)
+	al := e.cpu.GetAL() + e.cpu.GetAH()*base
+	e.cpu.SetAL(al)
+	e.cpu.SetAH(0)
+	e.cpu.UpdateArithmeticFlags8(al)
+}
+
+// bitOperand returns the operand holding the bit tested by BT, BTS, BTR
+// and BTC and the bit number within it. A register bit offset may reach
+// outside the addressed memory operand, in which case the address moves
+// by whole operands.
+func (e *Executor) bitOperand(inst *Instruction, offset uint32, size int, fromRegister bool) (operand, uint32) {
+	bits := uint32(size * 8)
+	target := e.rm(inst)
+	if target.where == inMemory && fromRegister {
+		var operands int32
+		if size == 2 {
+			operands = int32(int16(offset)) >> 4
+		} else {
+			operands = int32(offset) >> 5
+		}
+		target = target.next(uint32(operands * int32(size)))
+	}
+	return target, offset % bits
+}
+
+// bitTest runs BT, BTS, BTR and BTC, which copy a bit into CF and then
+// leave, set, clear or complement it.
+func (e *Executor) bitTest(inst *Instruction) {
+	size := inst.size
+	var offset uint32
+	var action byte
+	if inst.Opcode2 == 0xBA {
+		offset = inst.Immediate32 & 0xFF
+		action = (inst.ModRM>>3)&0x07 - 4
+	} else {
+		offset = e.load(e.operand(inst, 1), size)
+		action = (inst.Opcode2 - 0xA3) / 8
+	}
+	target, bit := e.bitOperand(inst, offset, size, inst.Opcode2 != 0xBA)
+	value := e.load(target, size)
+	e.cpu.Flags.SetCF(value&(1<<bit) != 0)
+	switch action {
+	case 0:
+		return
+	case 1:
+		value |= 1 << bit
+	case 2:
+		value &^= 1 << bit
+	case 3:
+		value ^= 1 << bit
+	}
+	e.store(target, size, value)
+}
+
+// bitScan runs BSF and BSR, which find the lowest or highest set bit.
+// ZF is set and the destination left alone if there is none.
+func (e *Executor) bitScan(inst *Instruction) {
+	size := inst.size
+	value := e.load(e.operand(inst, 1), size)
+	e.cpu.Flags.SetZF(value == 0)
+	if value == 0 {
+		return
+	}
+	index := uint32(0)
+	if inst.Opcode2 == 0xBC {
+		for value&(1<<index) == 0 {
+			index++
+		}
+	} else {
+		index = uint32(size*8 - 1)
+		for value&(1<<index) == 0 {
+			index--
+		}
+	}
+	e.store(e.operand(inst, 0), size, index)
+}
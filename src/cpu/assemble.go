@@ -0,0 +1,742 @@
+package cpu
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// This file holds a one-line assembler for the monitor's A command. It
+// has no instruction tables of its own: it tries every form in the
+// opcode maps whose mnemonic matches and whose operand kinds accept the
+// operands given, and keeps the shortest encoding. The syntax is that of
+// DEBUG, and that of the NASM text the disassembler prints: Intel operand
+// order, numbers in hex, memory operands in brackets.
+
+// asmOperand is a parsed operand.
+type asmOperand struct {
+	class   asmClass
+	size    int    // of a register, or of memory given with BYTE, WORD or DWORD PTR; 0 if unknown
+	reg     byte   // register number in ModRM order
+	value   uint32 // immediate, displacement or the offset of a far pointer
+	segment uint16 // segment of a far pointer
+	rm      byte   // ModRM encoding of the base and index registers
+	direct  bool   // memory at a plain offset
+	prefix  byte   // segment override prefix of a memory operand
+}
+
+type asmClass byte
+
+const (
+	asmRegister asmClass = iota
+	asmSegment
+	asmImmediate
+	asmMemory
+	asmFar
+	asmStack // coprocessor stack register ST(reg)
+)
+
+// baseIndex maps the registers of a 16-bit memory operand to the rm
+// field of the ModRM byte.
+var baseIndex = map[string]byte{
+	"BX+SI": 0, "BX+DI": 1, "BP+SI": 2, "BP+DI": 3,
+	"SI": 4, "DI": 5, "BP": 6, "BX": 7,
+}
+
+// mnemonicAliases maps alternative mnemonics to those of the opcode
+// maps.
+var mnemonicAliases = map[string]string{
+	"JE": "JZ", "JNE": "JNZ", "JC": "JB", "JNAE": "JB", "JNC": "JNB", "JAE": "JNB",
+	"JNA": "JBE", "JNBE": "JA", "JPE": "JP", "JPO": "JNP", "JNGE": "JL", "JNL": "JGE",
+	"JNG": "JLE", "JNLE": "JG", "LOOPZ": "LOOPE", "LOOPNZ": "LOOPNE", "SAL": "SHL",
+	"SETE": "SETZ", "SETNE": "SETNZ", "SETC": "SETB", "SETNC": "SETNB", "SETAE": "SETNB",
+	"SETNA": "SETBE", "SETNBE": "SETA", "SETNGE": "SETL", "SETNL": "SETGE",
+	"SETNG": "SETLE", "SETNLE": "SETG", "FWAIT": "WAIT",
+}
+
+// wordNames maps the mnemonics of the doubleword forms to those of the
+// word forms, which take them under a 66h prefix.
+var wordNames = map[string]string{
+	"PUSHAD": "PUSHA", "POPAD": "POPA", "PUSHFD": "PUSHF", "POPFD": "POPF",
+	"IRETD": "IRET", "CWDE": "CBW", "CDQ": "CWD", "MOVSD": "MOVSW", "CMPSD": "CMPSW",
+	"STOSD": "STOSW", "LODSD": "LODSW", "SCASD": "SCASW", "INSD": "INSW", "OUTSD": "OUTSW",
+}
+
+// waitForms are the coprocessor mnemonics that stand for WAIT followed
+// by the no-wait form.
+var waitForms = map[string]string{
+	"FINIT": "FNINIT", "FCLEX": "FNCLEX", "FENI": "FNENI", "FDISI": "FNDISI",
+	"FSTSW": "FNSTSW", "FSTCW": "FNSTCW", "FSTENV": "FNSTENV", "FSAVE": "FNSAVE",
+}
+
+// prefixBytes are the prefixes that may precede a mnemonic. Segment
+// overrides are written as in DEBUG ("ES:") or as in NASM ("es").
+var prefixBytes = map[string]byte{
+	"REP": 0xF3, "REPE": 0xF3, "REPZ": 0xF3, "REPNE": 0xF2, "REPNZ": 0xF2, "LOCK": 0xF0,
+	"ES:": 0x26, "CS:": 0x2E, "SS:": 0x36, "DS:": 0x3E, "FS:": 0x64, "GS:": 0x65,
+	"ES": 0x26, "CS": 0x2E, "SS": 0x36, "DS": 0x3E, "FS": 0x64, "GS": 0x65,
+}
+
+// Assemble encodes the instruction in text as it would be placed at
+// offset, using the instructions of model. Besides instructions it
+// accepts DB and DW with lists of numbers and quoted strings.
+func Assemble(text string, offset uint16, model Model) ([]byte, error) {
+	words := strings.Fields(strings.ToUpper(text))
+	var prefixes []byte
+	for len(words) > 0 {
+		prefix, ok := prefixBytes[words[0]]
+		if !ok {
+			break
+		}
+		prefixes = append(prefixes, prefix)
+		words = words[1:]
+	}
+	if err := checkPrefixes(prefixes, model); err != nil {
+		return nil, err
+	}
+	if len(words) == 0 {
+		if len(prefixes) > 0 {
+			return prefixes, nil
+		}
+		return nil, errors.New("missing instruction")
+	}
+
+	mnemonic := words[0]
+	rest := afterFields(text, len(prefixes)+1)
+	if mnemonic == "DB" || mnemonic == "DW" {
+		return assembleData(mnemonic == "DW", rest)
+	}
+	if alias, ok := mnemonicAliases[mnemonic]; ok {
+		mnemonic = alias
+	}
+	if word, ok := wordNames[mnemonic]; ok && model >= Model80386 {
+		mnemonic = word
+		prefixes = append(prefixes, 0x66)
+	}
+	modifier := ""
+	if len(words) > 1 && (words[1] == "FAR" || words[1] == "SHORT" || words[1] == "NEAR") {
+		modifier = words[1]
+		rest = afterFields(rest, 1)
+	}
+
+	var operands []asmOperand
+	if rest != "" {
+		for _, field := range splitOperands(rest) {
+			operand, err := parseOperand(field)
+			if err != nil {
+				return nil, err
+			}
+			if operand.prefix != 0 {
+				prefixes = append(prefixes, operand.prefix)
+			}
+			operands = append(operands, operand)
+		}
+	}
+
+	if err := checkPrefixes(prefixes, model); err != nil {
+		return nil, err
+	}
+
+	if code, ok, err := assembleFPU(mnemonic, operands, prefixes); ok {
+		return code, err
+	}
+	code, err := assembleInstruction(mnemonic, modifier, operands, prefixes, offset, model)
+	if (mnemonic == "XCHG" || mnemonic == "TEST") && len(operands) == 2 {
+		// Both orders mean the same, but the opcode maps hold only one
+		// of them for each form.
+		swapped := []asmOperand{operands[1], operands[0]}
+		if other, swapErr := assembleInstruction(mnemonic, modifier, swapped, prefixes, offset, model); swapErr == nil && (err != nil || len(other) < len(code)) {
+			return other, nil
+		}
+	}
+	return code, err
+}
+
+// checkPrefixes rejects the FS and GS overrides before the 386.
+func checkPrefixes(prefixes []byte, model Model) error {
+	for _, prefix := range prefixes {
+		if (prefix == 0x64 || prefix == 0x65) && model < Model80386 {
+			return errors.New("FS and GS need a 386")
+		}
+	}
+	return nil
+}
+
+// afterFields returns text after its first n space-separated fields.
+func afterFields(text string, n int) string {
+	for i := 0; i < n; i++ {
+		text = strings.TrimSpace(text)
+		if end := strings.IndexAny(text, " \t"); end >= 0 {
+			text = text[end:]
+		} else {
+			text = ""
+		}
+	}
+	return strings.TrimSpace(text)
+}
+
+// assembleInstruction returns the shortest encoding of the mnemonic with
+// the operands given. Forms with a 66h prefix are only tried on a 386
+// when no 16-bit form fits.
+func assembleInstruction(mnemonic, modifier string, operands []asmOperand, prefixes []byte, offset uint16, model Model) ([]byte, error) {
+	var best []byte
+	var sizes []int
+	named := false
+	for _, size32 := range []bool{false, true} {
+		if best != nil || size32 && model < Model80386 {
+			break
+		}
+		forEachOpcode(model, func(op *opcode, code []byte, group int) {
+			if !matchesName(op, mnemonic, modifier, operands) {
+				return
+			}
+			named = true
+			encoding, ok := encode(op, code, group, size32, operands, prefixes, offset)
+			if !ok {
+				return
+			}
+			sizes = append(sizes, op.operandSize(size32))
+			if best == nil || len(encoding) < len(best) {
+				best = encoding
+			}
+		})
+	}
+	if !named {
+		return nil, fmt.Errorf("unknown instruction: %s", mnemonic)
+	}
+	if best == nil {
+		return nil, errors.New("invalid operands")
+	}
+	for _, o := range operands {
+		if o.class == asmMemory && o.size == 0 && !sameSizes(sizes) {
+			return nil, errors.New("operand size unknown; use BYTE PTR or WORD PTR")
+		}
+	}
+	return best, nil
+}
+
+func sameSizes(sizes []int) bool {
+	for _, size := range sizes {
+		if size != sizes[0] {
+			return false
+		}
+	}
+	return true
+}
+
+// assembleFPU encodes a coprocessor instruction, trying every form of
+// ESC D8h-DFh that fpuName names. It returns false if mnemonic is not a
+// coprocessor instruction.
+func assembleFPU(mnemonic string, operands []asmOperand, prefixes []byte) ([]byte, bool, error) {
+	if !strings.HasPrefix(mnemonic, "F") {
+		return nil, false, nil
+	}
+	var wait []byte
+	if noWait, ok := waitForms[mnemonic]; ok {
+		mnemonic, wait = noWait, []byte{0x9B}
+	}
+
+	var best []byte
+	var sizes []int
+	named := false
+	for opcode := 0xD8; opcode <= 0xDF; opcode++ {
+		for reg := byte(0); reg < 8; reg++ {
+			if fpuMemoryNames[(opcode-0xD8)*8+int(reg)] != mnemonic {
+				continue
+			}
+			named = true
+			size := fpuMemorySize(byte(opcode), reg)
+			if len(operands) != 1 || operands[0].class != asmMemory || operands[0].size != 0 && operands[0].size != size {
+				continue
+			}
+			modrm := operands[0].memory()
+			modrm[0] |= reg << 3
+			sizes = append(sizes, size)
+			best = append(append(append(append([]byte{}, wait...), prefixes...), byte(opcode)), modrm...)
+		}
+		for modrm := 0xC0; modrm <= 0xFF; modrm++ {
+			name, want := splitFPUName(fpuName(byte(opcode), byte(modrm)))
+			if name != mnemonic {
+				continue
+			}
+			named = true
+			if best == nil && stackOperandsMatch(operands, want) {
+				best = append(append(append([]byte{}, wait...), prefixes...), byte(opcode), byte(modrm))
+			}
+		}
+	}
+	if !named {
+		return nil, false, nil
+	}
+	if best == nil {
+		return nil, true, errors.New("invalid operands")
+	}
+	if len(sizes) > 1 && operands[0].size == 0 {
+		return nil, true, errors.New("operand size unknown; use DWORD, QWORD or TBYTE PTR")
+	}
+	return best, true, nil
+}
+
+// stackOperandsMatch reports whether operands are the registers named in
+// want, as splitFPUName gives them.
+func stackOperandsMatch(operands []asmOperand, want []string) bool {
+	if len(operands) != len(want) {
+		return false
+	}
+	for i, o := range operands {
+		var name string
+		switch {
+		case o.class == asmStack:
+			name = fmt.Sprintf("ST%d", o.reg)
+		case o.class == asmRegister && o.size == 2 && o.reg == 0:
+			name = "AX"
+		}
+		if name != want[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// forEachOpcode calls fn for every entry of the opcode maps that model
+// has, with the opcode bytes and, for group members, the reg field that
+// selects it. A group member needs the model of its group as well.
+func forEachOpcode(model Model, fn func(op *opcode, code []byte, group int)) {
+	maps := []struct {
+		table  *[256]opcode
+		escape []byte
+	}{{&opcodes, nil}, {&opcodes0F, []byte{0x0F}}}
+	for _, m := range maps {
+		for i := range m.table {
+			code := append(append([]byte{}, m.escape...), byte(i))
+			op := &m.table[i]
+			if op.model > model {
+				continue
+			}
+			if op.group == nil {
+				fn(op, code, -1)
+				continue
+			}
+			for reg := range op.group {
+				if op.group[reg].model <= model {
+					fn(&op.group[reg], code, reg)
+				}
+			}
+		}
+	}
+}
+
+// matchesName reports whether op is a form of the mnemonic. Entries
+// named "CALL FAR" and "JMP FAR" need FAR, a segment:offset operand or
+// a DWORD PTR memory operand, and SHORT selects the forms with a byte displacement.
+func matchesName(op *opcode, mnemonic, modifier string, operands []asmOperand) bool {
+	base, suffix, _ := strings.Cut(op.name, " ")
+	if base != mnemonic || base == "" {
+		return false
+	}
+	switch modifier {
+	case "FAR":
+		return suffix == "FAR"
+	case "NEAR":
+		return suffix == ""
+	case "SHORT":
+		return suffix == "SHORT" || op.operands[0] == relByte
+	}
+	if suffix == "FAR" {
+		return len(operands) == 1 && (operands[0].class == asmFar || operands[0].class == asmMemory && operands[0].size == 4)
+	}
+	return true
+}
+
+// encode encodes the operands in the form op, returning false if they do
+// not fit it.
+func encode(op *opcode, code []byte, group int, size32 bool, operands []asmOperand, prefixes []byte, offset uint16) ([]byte, bool) {
+	// String instructions take their operands from the mnemonic.
+	var explicit []operandKind
+	if !isStringForm(op) {
+		for _, kind := range op.operands {
+			if kind != noOperand {
+				explicit = append(explicit, kind)
+			}
+		}
+	}
+	if len(explicit) != len(operands) {
+		return nil, false
+	}
+
+	size := op.operandSize(size32)
+	var modrm []byte
+	reg := byte(0)
+	if group >= 0 {
+		reg = byte(group)
+	}
+	var tail []byte
+	relAt, relSize := -1, 0
+	var target uint32
+	for i, kind := range explicit {
+		o := operands[i]
+		switch kind {
+		case rmByte, rmWord, rmWord16, memOnly, memFar:
+			want := map[operandKind]int{rmByte: 1, rmWord: size, rmWord16: 2}[kind]
+			switch {
+			case o.class == asmRegister && want != 0 && o.size == want:
+				modrm = []byte{0xC0 | o.reg}
+			case o.class == asmMemory && (kind == memOnly || kind == memFar || o.size == 0 || o.size == want):
+				if kind == memFar && o.size != 0 && o.size != 4 {
+					return nil, false
+				}
+				modrm = o.memory()
+			default:
+				return nil, false
+			}
+		case regByte, regWord:
+			want := 1
+			if kind == regWord {
+				want = size
+			}
+			if o.class != asmRegister || o.size != want {
+				return nil, false
+			}
+			reg = o.reg
+		case segReg:
+			if o.class != asmSegment {
+				return nil, false
+			}
+			reg = o.reg
+		case immByte, immSByte, immWord, imm:
+			if o.class != asmImmediate {
+				return nil, false
+			}
+			n := map[operandKind]int{immByte: 1, immSByte: 1, immWord: 2, imm: size}[kind]
+			if kind == immSByte && !fitsSignedByte(o.value, size) || kind != immSByte && !fits(o.value, n) {
+				return nil, false
+			}
+			// A size before an immediate gives the operand size or
+			// that of the immediate itself, as in PUSH BYTE 5.
+			if o.size != 0 && o.size != size && o.size != n {
+				return nil, false
+			}
+			tail = appendLittle(tail, o.value, n)
+		case relByte, rel:
+			if o.class != asmImmediate || size32 {
+				return nil, false
+			}
+			relAt, relSize, target = len(tail), 2, o.value
+			if kind == relByte {
+				relSize = 1
+			}
+			tail = append(tail, make([]byte, relSize)...)
+		case farImm:
+			if o.class != asmFar {
+				return nil, false
+			}
+			tail = appendLittle(tail, o.value, 2)
+			tail = appendLittle(tail, uint32(o.segment), 2)
+		case moffsByte, moffs:
+			want := 1
+			if kind == moffs {
+				want = size
+			}
+			if o.class != asmMemory || !o.direct || o.size != 0 && o.size != want {
+				return nil, false
+			}
+			tail = appendLittle(tail, o.value, 2)
+		case opRegByte, opReg:
+			want := 1
+			if kind == opReg {
+				want = size
+			}
+			if o.class != asmRegister || o.size != want || o.reg != code[len(code)-1]&7 {
+				return nil, false
+			}
+		case regAL, regCL, regDX, regAX:
+			want := map[operandKind][2]int{regAL: {1, 0}, regCL: {1, 1}, regDX: {2, 2}, regAX: {size, 0}}[kind]
+			if o.class != asmRegister || o.size != want[0] || int(o.reg) != want[1] {
+				return nil, false
+			}
+		case regES, regCS, regSS, regDS, regFS, regGS:
+			if o.class != asmSegment || o.reg != byte(kind-regES) {
+				return nil, false
+			}
+		case constOne, constThree:
+			want := uint32(1)
+			if kind == constThree {
+				want = 3
+			}
+			if o.class != asmImmediate || o.value != want {
+				return nil, false
+			}
+		default:
+			return nil, false
+		}
+	}
+
+	out := append([]byte{}, prefixes...)
+	if size32 {
+		out = append(out, 0x66)
+	}
+	out = append(out, code...)
+	if op.hasModRM() || group >= 0 {
+		if modrm == nil {
+			modrm = []byte{0}
+		}
+		modrm[0] |= reg << 3
+		out = append(out, modrm...)
+	}
+	start := len(out)
+	out = append(out, tail...)
+	if relAt >= 0 {
+		next := uint32(offset) + uint32(len(out))
+		displacement := (target - next) & 0xFFFF
+		if relSize == 1 && !fitsSignedByte(displacement, 2) {
+			return nil, false
+		}
+		copy(out[start+relAt:], appendLittle(nil, displacement, relSize))
+	}
+	return out, true
+}
+
+// isStringForm reports whether op is a string instruction, whose
+// operands are implied.
+func isStringForm(op *opcode) bool {
+	for _, kind := range op.operands {
+		if kind >= srcByte && kind <= dst {
+			return true
+		}
+	}
+	return false
+}
+
+// memory returns the ModRM byte, with a zero reg field, and displacement
+// of a memory operand.
+func (o *asmOperand) memory() []byte {
+	if o.direct {
+		return appendLittle([]byte{0x06}, o.value, 2)
+	}
+	displacement := o.value & 0xFFFF
+	switch {
+	case displacement == 0 && o.rm != 6:
+		return []byte{o.rm}
+	case fitsSignedByte(displacement, 2):
+		return []byte{0x40 | o.rm, byte(displacement)}
+	}
+	return appendLittle([]byte{0x80 | o.rm}, displacement, 2)
+}
+
+// fits reports whether value, taken as unsigned or as negative, fits in
+// n bytes.
+func fits(value uint32, n int) bool {
+	if n == 4 {
+		return true
+	}
+	limit := uint32(1) << (8 * n)
+	return value < limit || value >= -(limit/2)
+}
+
+// fitsSignedByte reports whether value, at size bytes, is a sign-extended
+// byte.
+func fitsSignedByte(value uint32, size int) bool {
+	if !fits(value, size) {
+		return false
+	}
+	value &= sizeMask(size)
+	return uint32(signExtend(value&0xFF, 1))&sizeMask(size) == value
+}
+
+func appendLittle(out []byte, value uint32, n int) []byte {
+	for i := 0; i < n; i++ {
+		out = append(out, byte(value>>(8*i)))
+	}
+	return out
+}
+
+// splitOperands splits an operand list at commas outside quotes.
+func splitOperands(text string) []string {
+	var fields []string
+	var quote rune
+	start := 0
+	for i, c := range text {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == ',':
+			fields = append(fields, strings.TrimSpace(text[start:i]))
+			start = i + 1
+		}
+	}
+	return append(fields, strings.TrimSpace(text[start:]))
+}
+
+// parseOperand parses a register, number, segment:offset pointer or
+// memory operand such as "WORD PTR ES:[BX+SI+10]".
+func parseOperand(text string) (asmOperand, error) {
+	upper := strings.ToUpper(strings.TrimSpace(text))
+	size := 0
+	for _, word := range []struct {
+		name string
+		size int
+	}{{"BYTE", 1}, {"WORD", 2}, {"DWORD", 4}, {"QWORD", 8}, {"TWORD", 10}, {"TBYTE", 10}} {
+		if rest, ok := strings.CutPrefix(upper, word.name+" "); ok {
+			size = word.size
+			upper = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(rest), "PTR"))
+		}
+	}
+
+	if size == 0 {
+		for i, names := range registerNames {
+			for reg, name := range names {
+				if upper == name {
+					return asmOperand{class: asmRegister, size: 1 << i, reg: byte(reg)}, nil
+				}
+			}
+		}
+		for reg, name := range segmentNames {
+			if upper == name {
+				return asmOperand{class: asmSegment, reg: byte(reg)}, nil
+			}
+		}
+		if upper == "ST" {
+			return asmOperand{class: asmStack}, nil
+		}
+		if n := strings.Trim(strings.TrimPrefix(upper, "ST"), "()"); len(upper) > 2 && upper[:2] == "ST" && len(n) == 1 && n[0] >= '0' && n[0] <= '7' {
+			return asmOperand{class: asmStack, reg: n[0] - '0'}, nil
+		}
+	}
+
+	var prefix byte
+	if len(upper) > 3 && upper[2] == ':' && strings.Contains(upper, "[") {
+		if p, ok := prefixBytes[upper[:3]]; ok {
+			prefix = p
+			upper = strings.TrimSpace(upper[3:])
+		}
+	}
+	if strings.HasPrefix(upper, "[") && strings.HasSuffix(upper, "]") {
+		o, err := parseMemory(upper[1 : len(upper)-1])
+		o.size = size
+		if prefix != 0 {
+			o.prefix = prefix
+		}
+		return o, err
+	}
+	if prefix != 0 {
+		return asmOperand{}, fmt.Errorf("invalid memory operand: %s", text)
+	}
+
+	if seg, off, ok := strings.Cut(upper, ":"); ok {
+		segment, err1 := parseAsmNumber(seg)
+		offset, err2 := parseAsmNumber(off)
+		if err1 != nil || err2 != nil || !fits(segment, 2) || !fits(offset, 2) {
+			return asmOperand{}, fmt.Errorf("invalid far address: %s", text)
+		}
+		return asmOperand{class: asmFar, value: offset, segment: uint16(segment)}, nil
+	}
+	number := strings.TrimSpace(text)
+	value, err := parseAsmNumber(number[len(number)-len(upper):])
+	if err != nil {
+		return asmOperand{}, err
+	}
+	return asmOperand{class: asmImmediate, size: size, value: value}, nil
+}
+
+// parseMemory parses the inside of the brackets of a memory operand:
+// BX or BP, SI or DI and a displacement, joined by + and -, optionally
+// after a segment override.
+func parseMemory(text string) (asmOperand, error) {
+	o := asmOperand{class: asmMemory}
+	if len(text) > 3 && text[2] == ':' {
+		if p, ok := prefixBytes[text[:3]]; ok {
+			o.prefix = p
+			text = text[3:]
+		}
+	}
+	var base, index string
+	terms := strings.Split(strings.ReplaceAll(strings.ReplaceAll(text, " ", ""), "-", "+-"), "+")
+	for _, term := range terms {
+		switch term {
+		case "":
+		case "BX", "BP":
+			if base != "" {
+				return o, fmt.Errorf("invalid memory operand: [%s]", text)
+			}
+			base = term
+		case "SI", "DI":
+			if index != "" {
+				return o, fmt.Errorf("invalid memory operand: [%s]", text)
+			}
+			index = term
+		default:
+			value, err := parseAsmNumber(term)
+			if err != nil {
+				return o, err
+			}
+			o.value += value
+		}
+	}
+	o.value &= 0xFFFF
+	if base == "" && index == "" {
+		o.direct = true
+		return o, nil
+	}
+	key := base
+	if index != "" {
+		key = strings.TrimPrefix(base+"+"+index, "+")
+	}
+	o.rm = baseIndex[key]
+	return o, nil
+}
+
+// parseAsmNumber parses a number as DEBUG does, in hex, with an optional
+// minus sign, 0x prefix or h suffix. A quoted character stands for its
+// code.
+func parseAsmNumber(text string) (uint32, error) {
+	if len(text) == 3 && (text[0] == '\'' || text[0] == '"') && text[2] == text[0] {
+		return uint32(text[1]), nil
+	}
+	digits := strings.ToUpper(text)
+	negative := strings.HasPrefix(digits, "-")
+	digits = strings.TrimPrefix(digits, "-")
+	digits = strings.TrimPrefix(digits, "0X")
+	if len(digits) > 1 {
+		digits = strings.TrimSuffix(digits, "H")
+	}
+	value, err := strconv.ParseUint(digits, 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number: %s", text)
+	}
+	if negative {
+		value = -value
+	}
+	return uint32(value), nil
+}
+
+// assembleData encodes the list of a DB or DW directive.
+func assembleData(words bool, list string) ([]byte, error) {
+	var out []byte
+	for _, field := range splitOperands(list) {
+		if len(field) >= 2 && (field[0] == '\'' || field[0] == '"') && field[len(field)-1] == field[0] {
+			out = append(out, field[1:len(field)-1]...)
+			if words && len(field)%2 != 0 {
+				out = append(out, 0)
+			}
+			continue
+		}
+		value, err := parseAsmNumber(field)
+		n := 1
+		if words {
+			n = 2
+		}
+		if err != nil || !fits(value, n) {
+			return nil, fmt.Errorf("invalid value: %s", field)
+		}
+		out = appendLittle(out, value, n)
+	}
+	if len(out) == 0 {
+		return nil, errors.New("missing data")
+	}
+	return out, nil
+}
@@ -0,0 +1,307 @@
+package cpu
+
+import (
+	"bytes"
+	"testing"
+
+	"dos-emulator/memory"
+)
+
+// roundTrips are instructions in the form the disassembler prints them,
+// at offset 0. Each must assemble, decode to the length assembled and
+// disassemble to the same text.
+var roundTrips = []string{
+	// Registers and immediates
+	"nop",
+	"mov ax, bx",
+	"mov al, 0x12",
+	"mov cx, 0x1234",
+	"mov eax, 0x12345678",
+	"mov es, ax",
+	"mov ax, ds",
+	"add al, 0x7f",
+	"add ax, 0x1234",
+	"add bx, 0x0005",
+	"add bx, 0xfffb",
+	"sub ecx, 0x00000100",
+	"cmp dl, dh",
+	"xor ax, ax",
+	"test al, 0x01",
+	"test cx, dx",
+	"xchg bx, ax",
+	"xchg cl, dl",
+	"inc ax",
+	"dec edi",
+	"neg byte [bx]",
+	"not word [si]",
+	"mul cx",
+	"imul ax, bx, 0x000a",
+	"div byte [bp+2]",
+	"shl ax, 1",
+	"shr byte [di], cl",
+	"rol dx, 0x04",
+	"sar eax, 0x1f",
+	"shld ax, bx, 0x03",
+	"bt ax, 0x05",
+	"bsf cx, dx",
+	"movzx ax, byte [bx]",
+	"movsx eax, word [si]",
+	"setz al",
+	"lea si, [bp+di-0x10]",
+	"lds si, [0x1234]",
+
+	// Memory operands
+	"mov [0x1234], ax",
+	"mov al, [0x0080]",
+	"mov word [bx+si], 0x0001",
+	"mov byte [bp+6], 0xff",
+	"mov [bx+di+0x1234], cx",
+	"mov ax, [es:di]",
+	"mov [cs:0x0010], al",
+	"add word [bp-2], 0x0010",
+	"add dword [bx], 0x12345678",
+	"inc word [0x0100]",
+	"push word [bx+2]",
+	"pop word [di]",
+	"mov eax, [bx+si+4]",
+	"mov ax, [fs:bx]",
+	"mov ax, [bx+0xc]",
+	"mov ax, [di-9]",
+
+	// Stack and flags
+	"push ax",
+	"push es",
+	"pop ds",
+	"push 0x1234",
+	"push 0x0012",
+	"pusha",
+	"popad",
+	"pushf",
+	"popfd",
+	"enter 0x0010, 0x00",
+	"leave",
+	"clc",
+	"std",
+	"cli",
+	"cbw",
+	"cdq",
+
+	// Strings
+	"movsb",
+	"rep movsw",
+	"repne scasb",
+	"rep stosd",
+	"lodsb",
+	"cmpsw",
+	"es lodsb",
+	"es rep movsb",
+
+	// Control transfer
+	"jmp short 0x0010",
+	"jmp near 0x1000",
+	"jmp bx",
+	"jmp word [bx+4]",
+	"jmp 0x1234:0x5678",
+	"jmp far [bx]",
+	"call 0x0100",
+	"call si",
+	"call far [0x0020]",
+	"call 0xf000:0xfff0",
+	"jz short 0x0020",
+	"jnz short 0xfffe",
+	"jcxz 0x0004",
+	"loop 0xfff0",
+	"ja near 0x1000",
+	"ret",
+	"ret 0x0004",
+	"retf",
+	"int 0x21",
+	"int 3",
+	"into",
+	"iret",
+	"hlt",
+
+	// I/O
+	"in al, 0x60",
+	"out 0x43, al",
+	"in ax, dx",
+	"out dx, al",
+
+	// Prefixes
+	"lock inc word [bx]",
+	"lock xchg [si], ax",
+
+	// Coprocessor
+	"fld st1",
+	"fld dword [bx]",
+	"fld qword [bp-8]",
+	"fld tword [si+0x10]",
+	"fstp qword [es:di]",
+	"fild word [si]",
+	"fild qword [bx]",
+	"fistp dword [bx+2]",
+	"fbstp tword [di]",
+	"fiadd word [0x0100]",
+	"fldcw word [bx]",
+	"fnstcw word [bx]",
+	"fnstsw word [bx]",
+	"fnstsw ax",
+	"fldenv [bx]",
+	"fnsave [bp+0]",
+	"fadd st0, st3",
+	"fsubr st0, st1",
+	"fmul st2, st0",
+	"fdivp st1, st0",
+	"fcom st0, st2",
+	"fcompp",
+	"fucompp",
+	"fxch st1",
+	"fst st4",
+	"fstp st0",
+	"ffree st7",
+	"fchs",
+	"fld1",
+	"fldpi",
+	"fsqrt",
+	"fsin",
+	"fninit",
+	"fnclex",
+	"wait",
+}
+
+func TestAssembleRoundTrip(t *testing.T) {
+	mem := memory.New()
+	d := NewInstructionDecoder(mem)
+	d.SetModel(Model80386)
+
+	for _, text := range roundTrips {
+		code, err := Assemble(text, 0, Model80386)
+		if err != nil {
+			t.Errorf("%s: %v", text, err)
+			continue
+		}
+		inst := decodeBytes(d, mem, code)
+		if int(inst.Length) != len(code) {
+			t.Errorf("%s: assembled % X, decoded %d bytes", text, code, inst.Length)
+			continue
+		}
+		if got := inst.Disassemble(0, nil); got != text {
+			t.Errorf("%s: assembled % X, disassembled %q", text, code, got)
+		}
+	}
+}
+
+// TestDisassembleReassembles disassembles benchmarkLoop and assembles
+// each instruction back at its offset.
+func TestDisassembleReassembles(t *testing.T) {
+	mem := memory.New()
+	d := NewInstructionDecoder(mem)
+	d.SetModel(Model80386)
+	base := memory.CalculateAddress(0x0100, 0)
+	for i, v := range benchmarkLoop {
+		mem.Write8(base+uint32(i), v)
+	}
+
+	for ip := uint16(0); int(ip) < len(benchmarkLoop); {
+		inst := d.Decode(0x0100, ip)
+		want := benchmarkLoop[ip : ip+uint16(inst.Length)]
+		text := inst.Disassemble(ip, nil)
+		if code, err := Assemble(text, ip, Model80386); err != nil || !bytes.Equal(code, want) {
+			t.Errorf("%04X %s: assembled % X, %v; want % X", ip, text, code, err, want)
+		}
+		ip += uint16(inst.Length)
+	}
+}
+
+// TestAssembleShortest checks that the assembler picks the shortest of
+// the forms an instruction has.
+func TestAssembleShortest(t *testing.T) {
+	tests := []struct {
+		text string
+		code []byte
+	}{
+		{"add ax, 1234", []byte{0x05, 0x34, 0x12}},
+		{"add bx, 1234", []byte{0x81, 0xC3, 0x34, 0x12}},
+		{"add bx, -1", []byte{0x83, 0xC3, 0xFF}},
+		{"mov ax, [1234]", []byte{0xA1, 0x34, 0x12}},
+		{"mov bx, [1234]", []byte{0x8B, 0x1E, 0x34, 0x12}},
+		{"mov ax, [bp]", []byte{0x8B, 0x46, 0x00}},
+		{"mov ax, [bx+7F]", []byte{0x8B, 0x47, 0x7F}},
+		{"mov ax, [bx+80]", []byte{0x8B, 0x87, 0x80, 0x00}},
+		{"xchg bx, ax", []byte{0x93}},
+		{"xchg bx, ax", []byte{0x93}},
+		{"test [bx], al", []byte{0x84, 0x07}},
+		{"jmp 10", []byte{0xEB, 0x0E}},
+		{"jmp 200", []byte{0xE9, 0xFD, 0x01}},
+		{"jz 200", []byte{0x0F, 0x84, 0xFC, 0x01}},
+		{"shl ax, 1", []byte{0xD1, 0xE0}},
+		{"push 5", []byte{0x6A, 0x05}},
+		{"push byte 5", []byte{0x6A, 0x05}},
+		{"push word 1234", []byte{0x68, 0x34, 0x12}},
+		{"push dword 5", []byte{0x66, 0x6A, 0x05}},
+		{"add ax, byte 5", []byte{0x83, 0xC0, 0x05}},
+		{"mov word ptr [bx], word 1", []byte{0xC7, 0x07, 0x01, 0x00}},
+		{"fld st(1)", []byte{0xD9, 0xC1}},
+		{"fadd st, st(2)", []byte{0xD8, 0xC2}},
+		{"fld qword ptr [bx]", []byte{0xDD, 0x07}},
+		{"fwait", []byte{0x9B}},
+		{"finit", []byte{0x9B, 0xDB, 0xE3}},
+		{"fstsw ax", []byte{0x9B, 0xDF, 0xE0}},
+		{"es: mov ax, [bx]", []byte{0x26, 0x8B, 0x07}},
+		{"db 1, 'AB', 2", []byte{0x01, 0x41, 0x42, 0x02}},
+		{"dw 1234, 5", []byte{0x34, 0x12, 0x05, 0x00}},
+	}
+	for _, test := range tests {
+		code, err := Assemble(test.text, 0, Model80386)
+		if err != nil || !bytes.Equal(code, test.code) {
+			t.Errorf("%s: % X, %v; want % X", test.text, code, err, test.code)
+		}
+	}
+}
+
+// TestAssembleErrors checks operands the assembler must refuse.
+func TestAssembleErrors(t *testing.T) {
+	for _, text := range []string{
+		"fld [bx]",
+		"fld ax",
+		"fld st8",
+		"fadd st1, st2",
+		"fnstsw bx",
+		"push byte 1234",
+		"mov al, word 5",
+		"mov ax, [bx] [si]",
+	} {
+		if code, err := Assemble(text, 0, Model80386); err == nil {
+			t.Errorf("%s assembled to % X", text, code)
+		}
+	}
+}
+
+// TestAssembleModel checks that instructions newer than the model are
+// rejected.
+func TestAssembleModel(t *testing.T) {
+	tests := []struct {
+		text  string
+		model Model
+	}{
+		{"push 5", Model80186},
+		{"enter 10, 0", Model80186},
+		{"shl ax, 4", Model80186},
+		{"lmsw ax", Model80286},
+		{"movzx ax, bl", Model80386},
+		{"mov eax, ebx", Model80386},
+		{"mov ax, [fs:bx]", Model80386},
+		{"gs lodsb", Model80386},
+		{"popad", Model80386},
+		{"rep stosd", Model80386},
+		{"jz 200", Model80386},
+	}
+	for _, test := range tests {
+		if _, err := Assemble(test.text, 0, test.model-1); err == nil {
+			t.Errorf("%s assembled for model %d", test.text, test.model-1)
+		}
+		if _, err := Assemble(test.text, 0, test.model); err != nil {
+			t.Errorf("%s: %v", test.text, err)
+		}
+	}
+}
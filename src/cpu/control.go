@@ -0,0 +1,206 @@
+package cpu
+
+// This file holds the jumps, calls, returns and interrupts. They run
+// with IP already past the instruction, so relative targets are added to
+// it and it is the return address that calls push.
+
+// condition evaluates condition code cc (the low nibble of Jcc and SETcc
+// opcodes).
+func (e *Executor) condition(cc byte) bool {
+	f := &e.cpu.Flags
+	var result bool
+	switch cc >> 1 {
+	case 0:
+		result = f.OF()
+	case 1:
+		result = f.CF()
+	case 2:
+		result = f.ZF()
+	case 3:
+		result = f.CF() || f.ZF()
+	case 4:
+		result = f.SF()
+	case 5:
+		result = f.PF()
+	case 6:
+		result = f.SF() != f.OF()
+	case 7:
+		result = f.ZF() || f.SF() != f.OF()
+	}
+	if cc&1 != 0 {
+		return !result
+	}
+	return result
+}
+
+func (e *Executor) jump(inst *Instruction) {
+	e.cpu.IP += uint16(inst.Immediate32)
+}
+
+// jumpIf runs the conditional jumps 70-7F and 0F 80-8F.
+func (e *Executor) jumpIf(inst *Instruction) {
+	cc := inst.Opcode & 0x0F
+	if inst.Opcode == 0x0F {
+		cc = inst.Opcode2 & 0x0F
+	}
+	if e.condition(cc) {
+		e.jump(inst)
+	}
+}
+
+// setIf runs SETcc (0F 90-9F), which stores 1 if the condition holds and
+// 0 otherwise.
+func (e *Executor) setIf(inst *Instruction) {
+	value := uint32(0)
+	if e.condition(inst.Opcode2 & 0x0F) {
+		value = 1
+	}
+	e.writeOperand(inst, 1, value)
+}
+
+// loop runs LOOPNE, LOOPE, LOOP and JCXZ (E0-E3).
+func (e *Executor) loop(inst *Instruction) {
+	var taken bool
+	switch inst.Opcode {
+	case 0xE0:
+		e.cpu.CX--
+		taken = e.cpu.CX != 0 && !e.cpu.Flags.ZF()
+	case 0xE1:
+		e.cpu.CX--
+		taken = e.cpu.CX != 0 && e.cpu.Flags.ZF()
+	case 0xE2:
+		e.cpu.CX--
+		taken = e.cpu.CX != 0
+	case 0xE3:
+		taken = e.cpu.CX == 0
+	}
+	if taken {
+		e.jump(inst)
+	}
+}
+
+// call runs the near relative CALL, which pushes a 32-bit return address
+// under 66h.
+func (e *Executor) call(inst *Instruction) {
+	if inst.size == 4 {
+		e.Push32(uint32(e.cpu.IP))
+	} else {
+		e.Push(e.cpu.IP)
+	}
+	e.jump(inst)
+}
+
+// callIndirect and jumpIndirect take a near target from a register or
+// memory.
+func (e *Executor) callIndirect(inst *Instruction) {
+	target := uint16(e.readOperand(inst, 2))
+	e.Push(e.cpu.IP)
+	e.cpu.IP = target
+}
+
+func (e *Executor) jumpIndirect(inst *Instruction) {
+	e.cpu.IP = uint16(e.readOperand(inst, 2))
+}
+
+// farTarget returns the offset and segment of a far CALL or JMP: the
+// pointer that follows the opcode, or the one in memory for FF /3 and
+// /5. It reports false for the register forms of FF /3 and /5, which
+// have no pointer to use.
+func (e *Executor) farTarget(inst *Instruction) (uint16, uint16, bool) {
+	if inst.op.operands[0] == farImm {
+		return uint16(inst.Immediate32), inst.Immediate2, true
+	}
+	target := e.operand(inst, 0)
+	if target.where != inMemory {
+		return 0, 0, false
+	}
+	return uint16(e.load(target, 2)), uint16(e.load(target.next(2), 2)), true
+}
+
+func (e *Executor) callFar(inst *Instruction) {
+	offset, segment, ok := e.farTarget(inst)
+	if !ok {
+		e.invalidOpcode(inst)
+		return
+	}
+	e.Push(e.cpu.CS)
+	e.Push(e.cpu.IP)
+	e.cpu.IP = offset
+	e.cpu.CS = segment
+}
+
+func (e *Executor) jumpFar(inst *Instruction) {
+	offset, segment, ok := e.farTarget(inst)
+	if !ok {
+		e.invalidOpcode(inst)
+		return
+	}
+	e.cpu.IP = offset
+	e.cpu.CS = segment
+}
+
+// ret and retFar pop the return address, 32 bits wide under 66h, and
+// then release the number of bytes RET imm16 names.
+func (e *Executor) ret(inst *Instruction) {
+	if inst.size == 4 {
+		e.cpu.IP = uint16(e.Pop32())
+	} else {
+		e.cpu.IP = e.Pop()
+	}
+	if inst.op.operands[0] == immWord {
+		e.cpu.SP += uint16(inst.Immediate32)
+	}
+}
+
+func (e *Executor) retFar(inst *Instruction) {
+	if inst.size == 4 {
+		e.cpu.IP = uint16(e.Pop32())
+		e.cpu.CS = uint16(e.Pop32())
+	} else {
+		e.cpu.IP = e.Pop()
+		e.cpu.CS = e.Pop()
+	}
+	if inst.op.operands[0] == immWord {
+		e.cpu.SP += uint16(inst.Immediate32)
+	}
+}
+
+func (e *Executor) iret(inst *Instruction) {
+	if inst.size == 4 {
+		e.cpu.IP = uint16(e.Pop32())
+		e.cpu.CS = uint16(e.Pop32())
+		e.loadFlags(uint16(e.Pop32()))
+		return
+	}
+	e.cpu.IP = e.Pop()
+	e.cpu.CS = e.Pop()
+	e.loadFlags(e.Pop())
+}
+
+// interrupt runs INT 3 and INT imm8.
+func (e *Executor) interrupt(inst *Instruction) {
+	e.Interrupt(byte(e.load(e.operand(inst, 0), 1)))
+}
+
+func (e *Executor) into(inst *Instruction) {
+	if e.cpu.Flags.OF() {
+		e.Interrupt(4)
+	}
+}
+
+// bound raises INT 5 with the return address pointing at the instruction
+// if the signed register operand lies outside the bounds in memory.
+func (e *Executor) bound(inst *Instruction) {
+	bounds := e.operand(inst, 1)
+	if bounds.where != inMemory {
+		e.invalidOpcode(inst)
+		return
+	}
+	index := int16(e.load(e.operand(inst, 0), 2))
+	if index < int16(e.load(bounds, 2)) || index > int16(e.load(bounds.next(2), 2)) {
+		// INT 5 is also the BIOS print-screen vector, so an unhooked
+		// bound violation prints the screen and retries, as on a PC.
+		e.cpu.IP -= uint16(inst.Length)
+		e.Interrupt(5)
+	}
+}
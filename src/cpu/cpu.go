@@ -0,0 +1,146 @@
+// Package cpu implements the 8086 register file, instruction decoder and
+// executor.
+package cpu
+
+type CPU struct {
+	AX, BX, CX, DX uint16
+	SI, DI         uint16
+	SP, BP         uint16
+	CS, DS, ES, SS uint16
+	FS, GS         uint16
+	IP             uint16
+	Flags          Flags
+
+	// High holds the upper halves of EAX, ECX, EDX, EBX, ESP, EBP, ESI
+	// and EDI on the 80386, in ModRM register order. 16-bit operations
+	// leave them untouched, as the processor does.
+	High [8]uint16
+}
+
+// register16 returns the word register with ModRM number index.
+func (c *CPU) register16(index byte) *uint16 {
+	switch index & 0x07 {
+	case 0:
+		return &c.AX
+	case 1:
+		return &c.CX
+	case 2:
+		return &c.DX
+	case 3:
+		return &c.BX
+	case 4:
+		return &c.SP
+	case 5:
+		return &c.BP
+	case 6:
+		return &c.SI
+	}
+	return &c.DI
+}
+
+// Register32 returns the 32-bit register with ModRM number index
+// (0=EAX, 1=ECX, ... 7=EDI).
+func (c *CPU) Register32(index byte) uint32 {
+	return uint32(c.High[index&0x07])<<16 | uint32(*c.register16(index))
+}
+
+// SetRegister32 stores value in the 32-bit register with ModRM number
+// index.
+func (c *CPU) SetRegister32(index byte, value uint32) {
+	c.High[index&0x07] = uint16(value >> 16)
+	*c.register16(index) = uint16(value)
+}
+
+func (c *CPU) GetAL() byte {
+	return byte(c.AX & 0xFF)
+}
+
+func (c *CPU) SetAL(value byte) {
+	c.AX = (c.AX & 0xFF00) | uint16(value)
+}
+
+func (c *CPU) GetAH() byte {
+	return byte((c.AX >> 8) & 0xFF)
+}
+
+func (c *CPU) SetAH(value byte) {
+	c.AX = (c.AX & 0x00FF) | (uint16(value) << 8)
+}
+
+func (c *CPU) GetBL() byte {
+	return byte(c.BX & 0xFF)
+}
+
+func (c *CPU) SetBL(value byte) {
+	c.BX = (c.BX & 0xFF00) | uint16(value)
+}
+
+func (c *CPU) GetBH() byte {
+	return byte((c.BX >> 8) & 0xFF)
+}
+
+func (c *CPU) SetBH(value byte) {
+	c.BX = (c.BX & 0x00FF) | (uint16(value) << 8)
+}
+
+func (c *CPU) GetCL() byte {
+	return byte(c.CX & 0xFF)
+}
+
+func (c *CPU) SetCL(value byte) {
+	c.CX = (c.CX & 0xFF00) | uint16(value)
+}
+
+func (c *CPU) GetCH() byte {
+	return byte((c.CX >> 8) & 0xFF)
+}
+
+func (c *CPU) SetCH(value byte) {
+	c.CX = (c.CX & 0x00FF) | (uint16(value) << 8)
+}
+
+func (c *CPU) GetDL() byte {
+	return byte(c.DX & 0xFF)
+}
+
+func (c *CPU) SetDL(value byte) {
+	c.DX = (c.DX & 0xFF00) | uint16(value)
+}
+
+func (c *CPU) GetDH() byte {
+	return byte((c.DX >> 8) & 0xFF)
+}
+
+func (c *CPU) SetDH(value byte) {
+	c.DX = (c.DX & 0x00FF) | (uint16(value) << 8)
+}
+
+func (c *CPU) UpdateZeroFlag(result uint16) {
+	c.Flags.SetZF(result == 0)
+}
+
+func (c *CPU) UpdateZeroFlag8(result byte) {
+	c.Flags.SetZF(result == 0)
+}
+
+func (c *CPU) UpdateSignFlag(result uint16) {
+	c.Flags.SetSF((result & 0x8000) != 0)
+}
+
+func (c *CPU) UpdateSignFlag8(result byte) {
+	c.Flags.SetSF((result & 0x80) != 0)
+}
+
+func (c *CPU) UpdateParityFlag(result uint16) {
+	c.Flags.SetPF(parityTable[byte(result)])
+}
+
+// UpdateArithmeticFlags16 sets ZF, SF and PF from a word result. They are
+// computed when read.
+func (c *CPU) UpdateArithmeticFlags16(result uint16) {
+	c.Flags.record(opLogic, 2, 0, 0, 0, uint32(result), resultFlags)
+}
+
+func (c *CPU) UpdateArithmeticFlags8(result byte) {
+	c.Flags.record(opLogic, 1, 0, 0, 0, uint32(result), resultFlags)
+}
@@ -0,0 +1,271 @@
+package cpu
+
+// timing is the cost of an instruction in 8088 clock cycles: reg with
+// register operands (or for instructions without a ModRM byte), mem with
+// a memory operand, not counting the effective address calculation.
+type timing struct {
+	reg, mem uint8
+}
+
+// timings are the 8088 cycle counts from Intel's data sheet; word memory
+// operands cost four cycles more per transfer than on the 8086 because
+// of the 8-bit bus. Opcodes the 8088 lacks are charged like the nearest
+// 8088 instruction or with the 80186 figures. Groups, string
+// instructions, shifts by a count and conditional jumps are handled by
+// instructionCycles.
+var timings = [256]timing{
+	0x00: {3, 16}, 0x01: {3, 24}, 0x02: {3, 9}, 0x03: {3, 13}, 0x04: {4, 0}, 0x05: {4, 0}, 0x06: {14, 0}, 0x07: {12, 0},
+	0x08: {3, 16}, 0x09: {3, 24}, 0x0A: {3, 9}, 0x0B: {3, 13}, 0x0C: {4, 0}, 0x0D: {4, 0}, 0x0E: {14, 0}, 0x0F: {12, 0},
+	0x10: {3, 16}, 0x11: {3, 24}, 0x12: {3, 9}, 0x13: {3, 13}, 0x14: {4, 0}, 0x15: {4, 0}, 0x16: {14, 0}, 0x17: {12, 0},
+	0x18: {3, 16}, 0x19: {3, 24}, 0x1A: {3, 9}, 0x1B: {3, 13}, 0x1C: {4, 0}, 0x1D: {4, 0}, 0x1E: {14, 0}, 0x1F: {12, 0},
+	0x20: {3, 16}, 0x21: {3, 24}, 0x22: {3, 9}, 0x23: {3, 13}, 0x24: {4, 0}, 0x25: {4, 0}, 0x27: {4, 0},
+	0x28: {3, 16}, 0x29: {3, 24}, 0x2A: {3, 9}, 0x2B: {3, 13}, 0x2C: {4, 0}, 0x2D: {4, 0}, 0x2F: {4, 0},
+	0x30: {3, 16}, 0x31: {3, 24}, 0x32: {3, 9}, 0x33: {3, 13}, 0x34: {4, 0}, 0x35: {4, 0}, 0x37: {8, 0},
+	0x38: {3, 9}, 0x39: {3, 13}, 0x3A: {3, 9}, 0x3B: {3, 13}, 0x3C: {4, 0}, 0x3D: {4, 0}, 0x3F: {8, 0},
+
+	0x40: {2, 0}, 0x41: {2, 0}, 0x42: {2, 0}, 0x43: {2, 0}, 0x44: {2, 0}, 0x45: {2, 0}, 0x46: {2, 0}, 0x47: {2, 0},
+	0x48: {2, 0}, 0x49: {2, 0}, 0x4A: {2, 0}, 0x4B: {2, 0}, 0x4C: {2, 0}, 0x4D: {2, 0}, 0x4E: {2, 0}, 0x4F: {2, 0},
+	0x50: {15, 0}, 0x51: {15, 0}, 0x52: {15, 0}, 0x53: {15, 0}, 0x54: {15, 0}, 0x55: {15, 0}, 0x56: {15, 0}, 0x57: {15, 0},
+	0x58: {12, 0}, 0x59: {12, 0}, 0x5A: {12, 0}, 0x5B: {12, 0}, 0x5C: {12, 0}, 0x5D: {12, 0}, 0x5E: {12, 0}, 0x5F: {12, 0},
+	0x60: {36, 0}, 0x61: {51, 0}, 0x62: {35, 35}, 0x68: {10, 0}, 0x69: {22, 25}, 0x6A: {10, 0}, 0x6B: {22, 25},
+
+	0x84: {3, 9}, 0x85: {3, 13}, 0x86: {4, 17}, 0x87: {4, 25},
+	0x88: {2, 9}, 0x89: {2, 13}, 0x8A: {2, 8}, 0x8B: {2, 12}, 0x8C: {2, 13}, 0x8D: {2, 2}, 0x8E: {2, 12}, 0x8F: {12, 25},
+	0x90: {3, 0}, 0x91: {3, 0}, 0x92: {3, 0}, 0x93: {3, 0}, 0x94: {3, 0}, 0x95: {3, 0}, 0x96: {3, 0}, 0x97: {3, 0},
+	0x98: {2, 0}, 0x99: {5, 0}, 0x9A: {36, 0}, 0x9B: {3, 0}, 0x9C: {14, 0}, 0x9D: {12, 0}, 0x9E: {4, 0}, 0x9F: {4, 0},
+	0xA0: {10, 0}, 0xA1: {14, 0}, 0xA2: {10, 0}, 0xA3: {14, 0}, 0xA8: {4, 0}, 0xA9: {4, 0},
+	0xB0: {4, 0}, 0xB1: {4, 0}, 0xB2: {4, 0}, 0xB3: {4, 0}, 0xB4: {4, 0}, 0xB5: {4, 0}, 0xB6: {4, 0}, 0xB7: {4, 0},
+	0xB8: {4, 0}, 0xB9: {4, 0}, 0xBA: {4, 0}, 0xBB: {4, 0}, 0xBC: {4, 0}, 0xBD: {4, 0}, 0xBE: {4, 0}, 0xBF: {4, 0},
+
+	0xC2: {24, 0}, 0xC3: {20, 0}, 0xC4: {24, 24}, 0xC5: {24, 24}, 0xC6: {4, 10}, 0xC7: {4, 14},
+	0xC8: {15, 0}, 0xC9: {8, 0}, 0xCA: {33, 0}, 0xCB: {34, 0}, 0xCC: {72, 0}, 0xCD: {71, 0}, 0xCF: {44, 0},
+	0xD0: {2, 15}, 0xD1: {2, 23}, 0xD4: {83, 0}, 0xD5: {60, 0}, 0xD6: {4, 0}, 0xD7: {11, 0},
+	0xD8: {2, 8}, 0xD9: {2, 8}, 0xDA: {2, 8}, 0xDB: {2, 8}, 0xDC: {2, 8}, 0xDD: {2, 8}, 0xDE: {2, 8}, 0xDF: {2, 8},
+	0xE4: {10, 0}, 0xE5: {14, 0}, 0xE6: {10, 0}, 0xE7: {14, 0},
+	0xE8: {23, 0}, 0xE9: {15, 0}, 0xEA: {15, 0}, 0xEB: {15, 0}, 0xEC: {8, 0}, 0xED: {12, 0}, 0xEE: {8, 0}, 0xEF: {12, 0},
+	0xF4: {2, 0}, 0xF5: {2, 0}, 0xF8: {2, 0}, 0xF9: {2, 0}, 0xFA: {2, 0}, 0xFB: {2, 0}, 0xFC: {2, 0}, 0xFD: {2, 0},
+}
+
+// timings0F are the costs of the 80286 and 80386 instructions of the 0F
+// map, by second opcode byte, charged like the nearest 8088 instruction:
+// PUSH and POP FS and GS like those of the other segment registers, BT
+// like TEST and BTS, BTR and BTC like OR, IMUL like that of the 80186,
+// the far pointer loads like LES, SETcc like MOV r/m8,imm8 and MOVZX and
+// MOVSX like MOV. BSF and BSR, which have no 8088 counterpart, take the
+// 80386's base figure. The rest, the system instructions, cost as much
+// as a word ALU operation, timing0FOther. Near conditional jumps and
+// SHLD and SHRD are handled by cycles0F.
+var timings0F = map[byte]timing{
+	0xA0: {14, 0}, 0xA1: {12, 0}, 0xA8: {14, 0}, 0xA9: {12, 0},
+	0xA3: {3, 13}, 0xAB: {3, 24}, 0xB3: {3, 24}, 0xBB: {3, 24}, 0xBA: {3, 24},
+	0xAF: {22, 25}, 0xB2: {24, 24}, 0xB4: {24, 24}, 0xB5: {24, 24},
+	0xB6: {2, 8}, 0xB7: {2, 12}, 0xBE: {2, 8}, 0xBF: {2, 12}, 0xBC: {10, 14}, 0xBD: {10, 14},
+	0x90: {4, 10}, 0x91: {4, 10}, 0x92: {4, 10}, 0x93: {4, 10}, 0x94: {4, 10}, 0x95: {4, 10}, 0x96: {4, 10}, 0x97: {4, 10},
+	0x98: {4, 10}, 0x99: {4, 10}, 0x9A: {4, 10}, 0x9B: {4, 10}, 0x9C: {4, 10}, 0x9D: {4, 10}, 0x9E: {4, 10}, 0x9F: {4, 10},
+}
+
+// timing0FOther is the cost of a 0F instruction without an entry in
+// timings0F.
+var timing0FOther = timing{3, 13}
+
+// stringTiming gives the cycles of a string instruction in its byte and
+// word forms: single without a prefix, and per iteration when repeated.
+type stringTiming struct {
+	single, repeated [2]uint8
+}
+
+var stringTimings = map[byte]stringTiming{
+	0x6C: {[2]uint8{14, 14}, [2]uint8{8, 8}},   // INS
+	0x6E: {[2]uint8{14, 14}, [2]uint8{8, 8}},   // OUTS
+	0xA4: {[2]uint8{18, 26}, [2]uint8{17, 25}}, // MOVS
+	0xA6: {[2]uint8{22, 30}, [2]uint8{22, 30}}, // CMPS
+	0xAA: {[2]uint8{11, 15}, [2]uint8{10, 14}}, // STOS
+	0xAC: {[2]uint8{12, 16}, [2]uint8{13, 17}}, // LODS
+	0xAE: {[2]uint8{15, 19}, [2]uint8{15, 19}}, // SCAS
+}
+
+// repeatStartup is the cost of a REP prefix, paid once per repeated
+// instruction.
+const repeatStartup = 9
+
+// Cycles returns the number of clock cycles the executed instructions
+// would have taken on an 8088.
+func (e *Executor) Cycles() uint64 {
+	return e.cycles
+}
+
+// effectiveAddressCycles is the time the 8088 takes to compute the
+// address of a memory operand.
+func effectiveAddressCycles(inst *Instruction) int {
+	mod, rm := inst.ModRM>>6, inst.ModRM&0x07
+	cycles := 0
+	switch {
+	case mod == 0 && rm == 6:
+		cycles = 6
+	case rm == 0 || rm == 3: // [BX+SI], [BP+DI]
+		cycles = 7
+	case rm == 1 || rm == 2: // [BX+DI], [BP+SI]
+		cycles = 8
+	default:
+		cycles = 5
+	}
+	if mod == 1 || mod == 2 {
+		cycles += 4
+	}
+	if inst.SegmentPrefix != 0 {
+		cycles += 2
+	}
+	return cycles
+}
+
+// instructionCycles returns the cost of inst, which has just executed.
+// cs and ip are where it started and cx the count register before it
+// ran, from which the decision of conditional jumps, the shift count and
+// the progress of repeated string instructions follow.
+func (e *Executor) instructionCycles(inst *Instruction, cs, ip, cx uint16) int {
+	op := inst.Opcode
+	word := op & 1
+	memoryOperand := inst.HasModRM && inst.ModRM>>6 != 3
+	taken := e.cpu.CS != cs || e.cpu.IP != ip+uint16(inst.Length)
+
+	t := timings[op]
+	switch {
+	case op == TrapOpcode && inst.ModRM == TrapModRM:
+		return 0 // the emulator's TRAP escape, not an instruction
+	case op >= 0x70 && op <= 0x7F:
+		return pick(taken, 16, 4)
+	case op == 0xE0:
+		return pick(taken, 19, 5)
+	case op == 0xE1:
+		return pick(taken, 18, 6)
+	case op == 0xE2:
+		return pick(taken, 17, 5)
+	case op == 0xE3:
+		return pick(taken, 18, 6)
+	case op == 0xCE:
+		return pick(taken, 73, 4)
+	case op == 0x0F && e.model > Model8086:
+		return e.cycles0F(inst, taken, cx, memoryOperand)
+	case isStringOp(op):
+		st := stringTimings[op&^1]
+		if inst.RepPrefix == 0 {
+			return int(st.single[word])
+		}
+		if cx == 0 {
+			return repeatStartup
+		}
+		cycles := int(st.repeated[word])
+		if e.repeatPrefix == 0 {
+			cycles += repeatStartup
+		}
+		return cycles
+	case op >= 0x80 && op <= 0x83:
+		t = timing{4, 17}
+		if op != 0x80 && op != 0x82 {
+			t.mem = 25
+		}
+		if inst.ModRM>>3&7 == 7 { // CMP does not write its result
+			t.mem = 10 + 4*word
+		}
+	case op == 0xC0 || op == 0xC1 || op == 0xD2 || op == 0xD3:
+		count := int(byte(cx))
+		if op < 0xD0 {
+			count = int(byte(inst.Immediate))
+			t = timing{5, 17}
+		} else {
+			t = timing{8, 20 + 8*word}
+			count *= 4
+		}
+		if e.model > Model8086 {
+			count &= 0x1F
+		}
+		if memoryOperand {
+			return int(t.mem) + count + effectiveAddressCycles(inst)
+		}
+		return int(t.reg) + count
+	case op == 0xF6 || op == 0xF7:
+		t = group3Timing(inst.ModRM>>3&7, word)
+	case op == 0xFE || op == 0xFF:
+		t = group45Timing(inst.ModRM>>3&7, word)
+	}
+
+	return operandCycles(t, inst, memoryOperand)
+}
+
+// operandCycles returns the cost t gives inst, with the effective address
+// calculation for a memory operand.
+func operandCycles(t timing, inst *Instruction, memoryOperand bool) int {
+	if memoryOperand {
+		return int(t.mem) + effectiveAddressCycles(inst)
+	}
+	cycles := int(t.reg)
+	if inst.SegmentPrefix != 0 {
+		cycles += 2
+	}
+	return cycles
+}
+
+// cycles0F returns the cost of an instruction of the 0F map: near
+// conditional jumps like the short ones, SHLD and SHRD like the 80186's
+// shifts by an immediate count, and the others by timings0F.
+func (e *Executor) cycles0F(inst *Instruction, taken bool, cx uint16, memoryOperand bool) int {
+	op := inst.Opcode2
+	switch {
+	case op >= 0x80 && op <= 0x8F:
+		return pick(taken, 16, 4)
+	case op == 0xA4 || op == 0xA5 || op == 0xAC || op == 0xAD:
+		count := int(byte(cx))
+		if op&1 == 0 {
+			count = int(byte(inst.Immediate))
+		}
+		return operandCycles(timing{5, 17}, inst, memoryOperand) + count&0x1F
+	case op == 0xBA && inst.ModRM>>3&7 == 4: // BT r/m, imm8
+		return operandCycles(timings0F[0xA3], inst, memoryOperand)
+	}
+	t, ok := timings0F[op]
+	if !ok {
+		t = timing0FOther
+	}
+	return operandCycles(t, inst, memoryOperand)
+}
+
+// group3Cycles are the register-operand cycles of TEST, TEST, NOT, NEG,
+// MUL, IMUL, DIV and IDIV (F6/F7 /0-/7), byte forms first. The times of
+// the multiplications and divisions depend on the operands; the middle
+// of each range in the data sheet is used.
+var group3Cycles = [2][8]uint8{
+	{5, 5, 3, 3, 74, 89, 85, 107},
+	{5, 5, 3, 3, 126, 141, 153, 174},
+}
+
+func group3Timing(reg, word byte) timing {
+	t := timing{group3Cycles[word][reg], group3Cycles[word][reg] + 6 + 4*word}
+	switch reg {
+	case 0, 1:
+		t.mem = 11 + 4*word
+	case 2, 3:
+		t.mem = 16 + 8*word
+	}
+	return t
+}
+
+// group45Timing returns the cost of INC and DEC (FE) and of INC, DEC,
+// CALL, JMP and PUSH with a ModRM operand (FF). instructionCycles
+// charges nothing for the emulator's TRAP escape (FE /7).
+func group45Timing(reg, word byte) timing {
+	if word == 0 {
+		switch reg {
+		case 0, 1:
+			return timing{3, 15}
+		}
+		return timing{}
+	}
+	return [8]timing{{2, 23}, {2, 23}, {20, 29}, {0, 53}, {11, 22}, {0, 32}, {15, 24}, {15, 24}}[reg]
+}
+
+func pick(taken bool, yes, no int) int {
+	if taken {
+		return yes
+	}
+	return no
+}
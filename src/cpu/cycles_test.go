@@ -0,0 +1,38 @@
+package cpu
+
+import "testing"
+
+// TestInstructionCycles checks the cycle counts charged for the 0F
+// opcodes, a taken and a not taken near jump, and the TRAP escape.
+func TestInstructionCycles(t *testing.T) {
+	tests := []struct {
+		code   []byte
+		cycles uint64
+	}{
+		{[]byte{0x01, 0xD8}, 3},                          // add ax, bx
+		{[]byte{0x01, 0x07}, 24 + 5},                     // add [bx], ax
+		{[]byte{0x0F, 0xB6, 0x07}, 8 + 5},                // movzx ax, byte [bx]
+		{[]byte{0x0F, 0xBF, 0xC3}, 2},                    // movsx ax, bx
+		{[]byte{0x0F, 0x94, 0xC0}, 4},                    // setz al
+		{[]byte{0x0F, 0xA3, 0xD8}, 3},                    // bt ax, bx
+		{[]byte{0x0F, 0xAB, 0x07}, 24 + 5},               // bts [bx], ax
+		{[]byte{0x0F, 0xBA, 0xE0, 0x03}, 3},              // bt ax, 3
+		{[]byte{0x0F, 0xBA, 0x2F, 0x03}, 24 + 5},         // bts word [bx], 3
+		{[]byte{0x0F, 0xA4, 0xD8, 0x03}, 5 + 3},          // shld ax, bx, 3
+		{[]byte{0x0F, 0xAF, 0xC3}, 22},                   // imul ax, bx
+		{[]byte{0x0F, 0xA0}, 14},                         // push fs
+		{[]byte{0x0F, 0x84, 0x00, 0x00}, 4},              // jz near $+4, not taken
+		{[]byte{0x0F, 0x85, 0x02, 0x00, 0x90, 0x90}, 16}, // jnz near $+6, taken
+		{[]byte{0x0F, 0x01, 0xE0}, 3},                    // smsw ax
+		{[]byte{TrapOpcode, TrapModRM, 0x08}, 0},
+	}
+	for _, test := range tests {
+		e, c, mem := newTestExecutor()
+		c.Flags.SetZF(false)
+		before := e.Cycles()
+		run(e, c, mem, test.code)
+		if got := e.Cycles() - before; got != test.cycles {
+			t.Errorf("% X: %d cycles, want %d", test.code, got, test.cycles)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package cpu
+
+import (
+	"dos-emulator/memory"
+)
+
+type cachePage [memory.CodePageSize]*Instruction
+
+// DecodeCache keeps decoded instructions by physical address so that
+// loops are decoded once. Pages are dropped when the guest writes to
+// them; an instruction can extend into the following page, so a write
+// drops the page before it as well.
+type DecodeCache struct {
+	decoder *InstructionDecoder
+	memory  *memory.Memory
+	pages   [memory.Size >> memory.CodePageShift]*cachePage
+	model   Model
+	enabled bool
+	hits    uint64
+	misses  uint64
+}
+
+func NewDecodeCache(decoder *InstructionDecoder, mem *memory.Memory) *DecodeCache {
+	c := &DecodeCache{
+		decoder: decoder,
+		memory:  mem,
+		model:   decoder.model,
+		enabled: true,
+	}
+	mem.OnCodeWrite(c.invalidate)
+	return c
+}
+
+// SetEnabled turns the cache on or off. While off every instruction is
+// decoded afresh, which is only useful for comparing speeds.
+func (c *DecodeCache) SetEnabled(enabled bool) {
+	c.enabled = enabled
+	c.Flush()
+}
+
+func (c *DecodeCache) Enabled() bool {
+	return c.enabled
+}
+
+// Decode returns the instruction at segment:offset, decoding it on a
+// cache miss. The instruction returned is shared and must not be
+// modified. An instruction that wraps past offset FFFF is not cached,
+// since at another segment the same physical address does not wrap.
+func (c *DecodeCache) Decode(segment, offset uint16) *Instruction {
+	addr := memory.CalculateAddress(segment, offset)
+	if !c.enabled || addr >= memory.Size {
+		return c.decoder.Decode(segment, offset)
+	}
+	if c.model != c.decoder.model {
+		c.Flush()
+		c.model = c.decoder.model
+	}
+
+	page := c.pages[addr>>memory.CodePageShift]
+	if page != nil {
+		if inst := page[addr%memory.CodePageSize]; inst != nil {
+			c.hits++
+			return inst
+		}
+	}
+
+	c.misses++
+	inst := c.decoder.Decode(segment, offset)
+	if int(offset)+inst.Length > 0x10000 {
+		return inst
+	}
+	if page == nil {
+		page = &cachePage{}
+		c.pages[addr>>memory.CodePageShift] = page
+	}
+	page[addr%memory.CodePageSize] = inst
+	c.memory.MarkCode(addr)
+	c.memory.MarkCode(addr + uint32(inst.Length) - 1)
+	return inst
+}
+
+func (c *DecodeCache) invalidate(addr uint32) {
+	index := addr >> memory.CodePageShift
+	c.pages[index] = nil
+	if index > 0 {
+		c.pages[index-1] = nil
+	}
+}
+
+// Flush empties the cache.
+func (c *DecodeCache) Flush() {
+	c.pages = [len(c.pages)]*cachePage{}
+}
+
+// Stats returns the number of cache hits and misses.
+func (c *DecodeCache) Stats() (hits, misses uint64) {
+	return c.hits, c.misses
+}
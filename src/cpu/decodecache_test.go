@@ -0,0 +1,58 @@
+package cpu
+
+import (
+	"testing"
+
+	"dos-emulator/memory"
+)
+
+// benchmarkLoop is a fixed 16-bit loop of register arithmetic, a memory
+// store and the LOOP and JMP back:
+//
+//	start:	mov cx, 100h
+//	next:	add ax, bx
+//		xor dx, ax
+//		mov [si], ax
+//		inc si
+//		shl bx, 1
+//		loop next
+//		jmp start
+var benchmarkLoop = []byte{
+	0xB9, 0x00, 0x01,
+	0x01, 0xD8,
+	0x31, 0xC2,
+	0x89, 0x04,
+	0x46,
+	0xD1, 0xE3,
+	0xE2, 0xF5,
+	0xEB, 0xF0,
+}
+
+// BenchmarkExecute measures decoding and executing one instruction of
+// benchmarkLoop, with the decode cache on and off.
+func BenchmarkExecute(b *testing.B) {
+	for _, enabled := range []bool{true, false} {
+		name := "cache"
+		if !enabled {
+			name = "nocache"
+		}
+		b.Run(name, func(b *testing.B) {
+			e, c, mem := newTestExecutor()
+			c.DS = 0x3000
+			base := memory.CalculateAddress(c.CS, 0)
+			for i, v := range benchmarkLoop {
+				mem.Write8(base+uint32(i), v)
+			}
+			cache := NewDecodeCache(e.decoder, mem)
+			cache.SetEnabled(enabled)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				e.Execute(cache.Decode(c.CS, c.IP))
+			}
+			if int(c.IP) >= len(benchmarkLoop) {
+				b.Fatalf("left the loop at IP=%04X", c.IP)
+			}
+		})
+	}
+}
@@ -0,0 +1,284 @@
+package cpu
+
+import "dos-emulator/memory"
+
+type Instruction struct {
+	Opcode        byte
+	Opcode2       byte // second opcode byte of 0F-prefixed instructions
+	ModRM         byte
+	HasModRM      bool
+	Length        int
+	Immediate     uint16
+	Displacement  uint16 // of a ModRM memory operand, or a direct offset
+	SegmentPrefix byte
+	RepPrefix     byte
+	Lock          bool   // F0h prefix; a single processor has nothing to lock
+	Name          string // mnemonic; String and Disassemble add the operands
+
+	// Immediate32 holds the first immediate or relative offset at full
+	// width, sign-extended for the sign-extended byte forms. Immediate2
+	// is the second immediate: the segment of a far pointer or the
+	// nesting level of ENTER.
+	Immediate32 uint32
+	Immediate2  uint16
+
+	// 80386 forms. OperandSize32 and AddressSize32 record the 66h and 67h
+	// prefixes; Displacement32 is the displacement of a 32-bit address.
+	OperandSize32  bool
+	AddressSize32  bool
+	SIB            byte
+	Displacement32 uint32
+
+	op   *opcode // opcode table entry
+	size int     // operand size in bytes
+}
+
+// registerNames are the general registers of each operand size (1, 2
+// and 4 bytes, indexed by size/2) in ModRM order.
+var registerNames = [3][8]string{
+	{"AL", "CL", "DL", "BL", "AH", "CH", "DH", "BH"},
+	{"AX", "CX", "DX", "BX", "SP", "BP", "SI", "DI"},
+	{"EAX", "ECX", "EDX", "EBX", "ESP", "EBP", "ESI", "EDI"},
+}
+
+// segmentNames are the segment registers in ModRM order.
+var segmentNames = []string{"ES", "CS", "SS", "DS", "FS", "GS"}
+
+var segmentPrefixNames = map[byte]string{
+	0x26: "ES",
+	0x2E: "CS",
+	0x36: "SS",
+	0x3E: "DS",
+	0x64: "FS",
+	0x65: "GS",
+}
+
+// conditionNames are the condition code suffixes of Jcc and SETcc in
+// opcode order.
+var conditionNames = []string{"O", "NO", "B", "NB", "Z", "NZ", "BE", "A", "S", "NS", "P", "NP", "L", "GE", "LE", "G"}
+
+// TrapOpcode and TrapModRM form the three-byte escape "FE 38 nn" used by
+// the ROM interrupt stubs to call the Go implementation of interrupt nn.
+// FE /7 is undefined on the 8086, so real programs never contain it.
+const (
+	TrapOpcode = 0xFE
+	TrapModRM  = 0x38
+)
+
+// maxPrefixes bounds the number of prefix bytes consumed before an opcode,
+// so that a run of prefixes cannot hang the decoder.
+const maxPrefixes = 14
+
+type InstructionDecoder struct {
+	memory *memory.Memory
+	model  Model
+	base   uint32 // address of the code segment being decoded
+}
+
+func NewInstructionDecoder(mem *memory.Memory) *InstructionDecoder {
+	return &InstructionDecoder{memory: mem, model: Model80286}
+}
+
+// SetModel selects the instruction set to decode. Executor.SetModel calls
+// it, so only decoders used on their own need it directly.
+func (d *InstructionDecoder) SetModel(model Model) {
+	d.model = model
+}
+
+// alias8086 maps the opcodes the 80186 added onto the instructions an
+// 8086 actually executes for them: 60-6F repeat the conditional jumps
+// 70-7F and C0, C1, C8, C9 repeat RET and RETF.
+func alias8086(opcode byte) byte {
+	switch {
+	case opcode >= 0x60 && opcode <= 0x6F:
+		return opcode + 0x10
+	case opcode == 0xC0 || opcode == 0xC1 || opcode == 0xC8 || opcode == 0xC9:
+		return opcode + 2
+	}
+	return opcode
+}
+
+// read8, read16 and read32 read the instruction bytes at offset addr of
+// the code segment. Like IP, the offset wraps at 64K.
+func (d *InstructionDecoder) read8(addr uint32) byte {
+	return d.memory.Read8(d.base + addr&0xFFFF)
+}
+
+func (d *InstructionDecoder) read16(addr uint32) uint16 {
+	return uint16(d.read8(addr+1))<<8 | uint16(d.read8(addr))
+}
+
+func (d *InstructionDecoder) read32(addr uint32) uint32 {
+	return uint32(d.read16(addr+2))<<16 | uint32(d.read16(addr))
+}
+
+// Decode decodes the instruction at segment:offset. The opcode table
+// entry tells whether a ModRM byte follows and which immediates come
+// after it.
+func (d *InstructionDecoder) Decode(segment, offset uint16) *Instruction {
+	inst := &Instruction{}
+	d.base = uint32(segment) << 4
+	addr := uint32(offset)
+	start := addr
+
+	for addr-start < maxPrefixes {
+		b := d.read8(addr)
+		if b == 0x26 || b == 0x2E || b == 0x36 || b == 0x3E {
+			inst.SegmentPrefix = b
+		} else if b == 0xF2 || b == 0xF3 {
+			inst.RepPrefix = b
+		} else if b == 0xF0 {
+			inst.Lock = true
+		} else if d.model >= Model80386 && (b == 0x64 || b == 0x65) {
+			inst.SegmentPrefix = b
+		} else if d.model >= Model80386 && b == 0x66 {
+			inst.OperandSize32 = true
+		} else if d.model >= Model80386 && b == 0x67 {
+			inst.AddressSize32 = true
+		} else {
+			break
+		}
+		addr++
+	}
+
+	inst.Opcode = d.read8(addr)
+	addr++
+	if d.model == Model8086 {
+		inst.Opcode = alias8086(inst.Opcode)
+	}
+	entry := &opcodes[inst.Opcode]
+	if inst.Opcode == 0x0F {
+		if d.model == Model8086 {
+			entry = &popCS
+		} else {
+			inst.Opcode2 = d.read8(addr)
+			addr++
+			entry = &opcodes0F[inst.Opcode2]
+		}
+	}
+	if entry.model > d.model {
+		entry = &invalidOpcodeEntry
+	}
+
+	if entry.hasModRM() {
+		addr = d.decodeModRM(inst, addr)
+		if entry.group != nil {
+			reg := (inst.ModRM >> 3) & 0x07
+			entry = &entry.group[reg]
+			if entry.model > d.model {
+				entry = &invalidOpcodeEntry
+			} else if inst.Opcode == TrapOpcode && reg == 7 && inst.ModRM != TrapModRM {
+				entry = &undefinedOpcode
+			}
+		}
+	}
+	addr = d.decodeImmediates(inst, entry, addr)
+
+	inst.op = entry
+	inst.size = entry.operandSize(inst.OperandSize32)
+	inst.Name = entry.name
+	if inst.Opcode >= 0xD8 && inst.Opcode <= 0xDF {
+		inst.Name = fpuName(inst.Opcode, inst.ModRM)
+		if inst.Name == "" {
+			inst.Name = "ESC"
+		}
+	}
+	inst.Length = int(addr - start)
+	return inst
+}
+
+// decodeModRM reads the ModRM byte at addr and the SIB byte and
+// displacement that follow it, and returns the address after them.
+func (d *InstructionDecoder) decodeModRM(inst *Instruction, addr uint32) uint32 {
+	inst.ModRM = d.read8(addr)
+	inst.HasModRM = true
+	addr++
+	mod := inst.ModRM >> 6
+	rm := inst.ModRM & 0x07
+	if mod == 3 {
+		return addr
+	}
+
+	if inst.AddressSize32 {
+		base := rm
+		if rm == 4 {
+			inst.SIB = d.read8(addr)
+			addr++
+			base = inst.SIB & 0x07
+		}
+		switch {
+		case mod == 1:
+			inst.Displacement32 = uint32(int32(int8(d.read8(addr))))
+			addr++
+		case mod == 2 || base == 5:
+			inst.Displacement32 = d.read32(addr)
+			addr += 4
+		}
+		inst.Displacement = uint16(inst.Displacement32)
+		return addr
+	}
+
+	switch {
+	case mod == 1:
+		inst.Displacement = uint16(int16(int8(d.read8(addr))))
+		addr++
+	case mod == 2 || rm == 6:
+		inst.Displacement = d.read16(addr)
+		addr += 2
+	}
+	return addr
+}
+
+// decodeImmediates reads the immediates, relative offsets, far pointers
+// and direct offsets of entry's operands starting at addr, and returns
+// the address after them. A 66h prefix widens word immediates and 67h
+// direct offsets to doublewords.
+func (d *InstructionDecoder) decodeImmediates(inst *Instruction, entry *opcode, addr uint32) uint32 {
+	first := true
+	for _, kind := range entry.operands {
+		var value uint32
+		switch kind {
+		case immByte:
+			value = uint32(d.read8(addr))
+			addr++
+		case immSByte, relByte:
+			value = uint32(int32(int8(d.read8(addr))))
+			addr++
+		case immWord:
+			value = uint32(d.read16(addr))
+			addr += 2
+		case imm, rel, farImm:
+			if inst.OperandSize32 {
+				value = d.read32(addr)
+				addr += 4
+			} else {
+				value = uint32(d.read16(addr))
+				addr += 2
+			}
+			if kind == farImm {
+				inst.Immediate2 = d.read16(addr)
+				addr += 2
+			}
+		case moffsByte, moffs:
+			if inst.AddressSize32 {
+				inst.Displacement32 = d.read32(addr)
+				inst.Displacement = uint16(inst.Displacement32)
+				addr += 4
+			} else {
+				inst.Displacement = d.read16(addr)
+				addr += 2
+			}
+			continue
+		default:
+			continue
+		}
+		if first {
+			inst.Immediate32 = value
+			inst.Immediate = uint16(value)
+			first = false
+		} else {
+			inst.Immediate2 = uint16(value)
+		}
+	}
+	return addr
+}
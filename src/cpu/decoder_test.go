@@ -0,0 +1,329 @@
+package cpu
+
+import (
+	"testing"
+
+	"dos-emulator/memory"
+)
+
+// Independent of the opcode table: the one-byte opcodes followed by a
+// ModRM byte, and the immediate bytes after the opcode and ModRM with a
+// 16-bit operand size. Opcodes in wideImmediates take a doubleword
+// instead of a word under 66h.
+var (
+	modRMOpcodes = opcodeSet(
+		0x00, 0x01, 0x02, 0x03, 0x08, 0x09, 0x0A, 0x0B, 0x10, 0x11, 0x12, 0x13,
+		0x18, 0x19, 0x1A, 0x1B, 0x20, 0x21, 0x22, 0x23, 0x28, 0x29, 0x2A, 0x2B,
+		0x30, 0x31, 0x32, 0x33, 0x38, 0x39, 0x3A, 0x3B, 0x62, 0x69, 0x6B,
+		0x80, 0x81, 0x82, 0x83, 0x84, 0x85, 0x86, 0x87, 0x88, 0x89, 0x8A, 0x8B,
+		0x8C, 0x8D, 0x8E, 0x8F, 0xC0, 0xC1, 0xC4, 0xC5, 0xC6, 0xC7,
+		0xD0, 0xD1, 0xD2, 0xD3, 0xD8, 0xD9, 0xDA, 0xDB, 0xDC, 0xDD, 0xDE, 0xDF,
+		0xF6, 0xF7, 0xFE, 0xFF)
+
+	immediateBytes = map[byte]int{
+		0x04: 1, 0x0C: 1, 0x14: 1, 0x1C: 1, 0x24: 1, 0x2C: 1, 0x34: 1, 0x3C: 1,
+		0x05: 2, 0x0D: 2, 0x15: 2, 0x1D: 2, 0x25: 2, 0x2D: 2, 0x35: 2, 0x3D: 2,
+		0x68: 2, 0x69: 2, 0x6A: 1, 0x6B: 1,
+		0x80: 1, 0x81: 2, 0x82: 1, 0x83: 1, 0x9A: 4,
+		0xA0: 2, 0xA1: 2, 0xA2: 2, 0xA3: 2, 0xA8: 1, 0xA9: 2,
+		0xC0: 1, 0xC1: 1, 0xC2: 2, 0xC6: 1, 0xC7: 2, 0xC8: 3, 0xCA: 2, 0xCD: 1,
+		0xD4: 1, 0xD5: 1, 0xE8: 2, 0xE9: 2, 0xEA: 4, 0xEB: 1,
+		// F6 and F7 with a reg field of 0: TEST.
+		0xF6: 1, 0xF7: 2,
+	}
+
+	wideImmediates = opcodeSet(
+		0x05, 0x0D, 0x15, 0x1D, 0x25, 0x2D, 0x35, 0x3D, 0x68, 0x69, 0x81, 0x9A,
+		0xA9, 0xB8, 0xB9, 0xBA, 0xBB, 0xBC, 0xBD, 0xBE, 0xBF, 0xC7, 0xE8, 0xE9,
+		0xEA, 0xF7)
+
+	prefixOpcodes = opcodeSet(0x26, 0x2E, 0x36, 0x3E, 0x64, 0x65, 0x66, 0x67, 0xF0, 0xF2, 0xF3)
+)
+
+func init() {
+	for op := 0x70; op <= 0x7F; op++ {
+		immediateBytes[byte(op)] = 1
+	}
+	for op := 0xB0; op <= 0xB7; op++ {
+		immediateBytes[byte(op)] = 1
+		immediateBytes[byte(op+8)] = 2
+	}
+	for op := 0xE0; op <= 0xE7; op++ {
+		immediateBytes[byte(op)] = 1
+	}
+}
+
+func opcodeSet(ops ...byte) map[byte]bool {
+	set := make(map[byte]bool)
+	for _, op := range ops {
+		set[op] = true
+	}
+	return set
+}
+
+// modRMForms are ModRM bytes with reg field 0 and the number of
+// displacement bytes that follow them with 16-bit addressing.
+var modRMForms = []struct {
+	modRM        byte
+	displacement int
+}{
+	{0x00, 0}, // [BX+SI]
+	{0x06, 2}, // [disp16]
+	{0x47, 1}, // [BX+disp8]
+	{0x86, 2}, // [BP+disp16]
+	{0xC3, 0}, // BX
+}
+
+// decodeBytes decodes code placed at 0100:0000 by d.
+func decodeBytes(d *InstructionDecoder, mem *memory.Memory, code []byte) *Instruction {
+	base := memory.CalculateAddress(0x0100, 0)
+	for i := 0; i < 16; i++ {
+		mem.Write8(base+uint32(i), 0)
+	}
+	for i, b := range code {
+		mem.Write8(base+uint32(i), b)
+	}
+	return d.Decode(0x0100, 0)
+}
+
+// TestDecodeLengths decodes every row of the one-byte opcode map, with
+// and without a 66h prefix and with each addressing form, and compares
+// the length with the one the tables above give.
+func TestDecodeLengths(t *testing.T) {
+	mem := memory.New()
+	d := NewInstructionDecoder(mem)
+	d.SetModel(Model80386)
+
+	for op := 0; op < 256; op++ {
+		opcode := byte(op)
+		if prefixOpcodes[opcode] || opcode == 0x0F {
+			continue
+		}
+		forms := modRMForms
+		if !modRMOpcodes[opcode] {
+			forms = forms[:1]
+		}
+		for _, form := range forms {
+			for _, size32 := range []bool{false, true} {
+				var code []byte
+				want := 1 + immediateBytes[opcode]
+				if size32 {
+					code = append(code, 0x66)
+					want++
+					if wideImmediates[opcode] {
+						want += 2
+					}
+				}
+				code = append(code, opcode)
+				if modRMOpcodes[opcode] {
+					code = append(code, form.modRM)
+					want += 1 + form.displacement
+				}
+				inst := decodeBytes(d, mem, code)
+				if inst.Length != want {
+					t.Errorf("% X: length %d, want %d", code, inst.Length, want)
+				}
+				if inst.HasModRM != modRMOpcodes[opcode] {
+					t.Errorf("% X: HasModRM %v", code, inst.HasModRM)
+				}
+			}
+		}
+	}
+}
+
+// TestDecodeLengths0F does the same for the two-byte opcodes of the
+// 80386.
+func TestDecodeLengths0F(t *testing.T) {
+	mem := memory.New()
+	d := NewInstructionDecoder(mem)
+	d.SetModel(Model80386)
+	modRM := opcodeSet(0x01, 0xA3, 0xA4, 0xA5, 0xAB, 0xAC, 0xAD, 0xAF,
+		0xB2, 0xB3, 0xB4, 0xB5, 0xB6, 0xB7, 0xBA, 0xBB, 0xBC, 0xBD, 0xBE, 0xBF)
+	for op := 0x90; op <= 0x9F; op++ {
+		modRM[byte(op)] = true
+	}
+
+	for op := 0; op < 256; op++ {
+		opcode := byte(op)
+		for _, size32 := range []bool{false, true} {
+			var code []byte
+			want := 2
+			if size32 {
+				code = append(code, 0x66)
+				want++
+			}
+			code = append(code, 0x0F, opcode)
+			switch {
+			case opcode >= 0x80 && opcode <= 0x8F:
+				want += 2
+				if size32 {
+					want += 2
+				}
+			case modRM[opcode]:
+				code = append(code, 0x47)
+				want += 2
+				if opcode == 0xA4 || opcode == 0xAC || opcode == 0xBA {
+					want++
+				}
+			}
+			if opcode == 0xBA {
+				code[len(code)-1] = 0x67 // BT [BX+disp8], imm8
+			}
+			inst := decodeBytes(d, mem, code)
+			if inst.Length != want {
+				t.Errorf("% X: length %d, want %d", code, inst.Length, want)
+			}
+		}
+	}
+}
+
+// TestDecodeForms checks prefixes and the 32-bit addressing forms.
+func TestDecodeForms(t *testing.T) {
+	mem := memory.New()
+	d := NewInstructionDecoder(mem)
+	d.SetModel(Model80386)
+	tests := []struct {
+		code   []byte
+		length int
+		name   string
+	}{
+		{[]byte{0x26, 0xF3, 0xA4}, 3, "MOVSB"},
+		{[]byte{0xF0, 0x01, 0x07}, 3, "ADD"},
+		{[]byte{0x67, 0x8B, 0x04, 0x24}, 4, "MOV"},                   // [ESP]
+		{[]byte{0x67, 0x8B, 0x44, 0x8B, 0x04}, 5, "MOV"},             // [EBX+ECX*4+4]
+		{[]byte{0x67, 0x8B, 0x05, 1, 2, 3, 4}, 7, "MOV"},             // [disp32]
+		{[]byte{0x67, 0x8B, 0x04, 0x25, 1, 2, 3, 4}, 8, "MOV"},       // [disp32] by SIB
+		{[]byte{0x67, 0x8B, 0x84, 0x24, 1, 2, 3, 4}, 8, "MOV"},       // [ESP+disp32]
+		{[]byte{0x67, 0xA1, 1, 2, 3, 4}, 6, "MOV"},                   // moffs32
+		{[]byte{0x66, 0x67, 0xC7, 0x00, 1, 2, 3, 4}, 8, "MOV"},       // [EAX], imm32
+		{[]byte{0xFE, 0x38, 0x21}, 3, "TRAP"},                        // the ROM escape
+		{[]byte{0xFE, 0x39}, 2, ""},                                  // FE /7 otherwise
+		{[]byte{0xD9, 0xC0}, 2, "FLD ST(0)"},                         // coprocessor
+		{[]byte{0x66, 0x0F, 0x84, 1, 2, 3, 4}, 7, "JZ"},              // Jcc rel32
+		{[]byte{0x0F, 0xB6, 0x06, 0x34, 0x12}, 5, "MOVZX"},           // MOVZX r16, [disp16]
+		{[]byte{0x2E, 0x3E, 0x26, 0x36, 0xF3, 0xF2, 0x90}, 7, "NOP"}, // a run of prefixes
+	}
+	for _, test := range tests {
+		inst := decodeBytes(d, mem, test.code)
+		if inst.Length != test.length || inst.Name != test.name {
+			t.Errorf("% X: %s length %d, want %s length %d", test.code, inst.Name, inst.Length, test.name, test.length)
+		}
+	}
+}
+
+// TestOperandResolution resolves the operands of an instruction for each
+// operand kind and addressing form.
+func TestOperandResolution(t *testing.T) {
+	e, c, mem := newTestExecutor()
+	c.DS, c.ES, c.SS, c.FS, c.GS = 0x1000, 0x2000, 0x3000, 0x4000, 0x5000
+	c.BX, c.SI, c.DI, c.BP, c.SP = 0x0010, 0x0020, 0x0030, 0x0040, 0x0050
+	c.SetRegister32(1, 4) // ECX
+	c.High[6] = 0x0001    // ESI = 10020h
+
+	reg := func(index byte) operand { return operand{where: inRegister, index: index} }
+	seg := func(index byte) operand { return operand{where: inSegment, index: index} }
+	mem16 := func(segment uint16, offset uint32) operand {
+		return operand{where: inMemory, segment: segment, offset: offset}
+	}
+	mem32 := func(segment uint16, offset uint32) operand {
+		return operand{where: inMemory, segment: segment, offset: offset, wide: true}
+	}
+	value := func(v uint32) operand { return operand{value: v} }
+
+	tests := []struct {
+		code     []byte
+		size     int
+		operands []operand
+	}{
+		{[]byte{0x00, 0xD8}, 1, []operand{reg(0), reg(3)}},                          // ADD AL, BL
+		{[]byte{0x03, 0x47, 0x02}, 2, []operand{reg(0), mem16(0x1000, 0x12)}},       // ADD AX, [BX+2]
+		{[]byte{0x66, 0x03, 0x46, 0x02}, 4, []operand{reg(0), mem16(0x3000, 0x42)}}, // ADD EAX, [BP+2]
+		{[]byte{0x26, 0x8B, 0x46, 0x02}, 2, []operand{reg(0), mem16(0x2000, 0x42)}}, // MOV AX, ES:[BP+2]
+		{[]byte{0x8B, 0x06, 0x34, 0x12}, 2, []operand{reg(0), mem16(0x1000, 0x1234)}},
+		{[]byte{0x8B, 0x02}, 2, []operand{reg(0), mem16(0x3000, 0x60)}},                   // [BP+SI]
+		{[]byte{0x67, 0x8B, 0x04, 0x24}, 2, []operand{reg(0), mem32(0x3000, 0x50)}},       // [ESP]
+		{[]byte{0x67, 0x8B, 0x44, 0x8B, 0x04}, 2, []operand{reg(0), mem32(0x1000, 0x24)}}, // [EBX+ECX*4+4]
+		{[]byte{0x8C, 0xD8}, 2, []operand{reg(0), seg(3)}},                                // MOV AX, DS
+		{[]byte{0x66, 0x8C, 0xD8}, 2, []operand{reg(0), seg(3)}},
+		{[]byte{0x8E, 0xC3}, 2, []operand{seg(0), reg(3)}},                    // MOV ES, BX
+		{[]byte{0x8D, 0x40, 0x01}, 2, []operand{reg(0), mem16(0x1000, 0x31)}}, // LEA AX, [BX+SI+1]
+		{[]byte{0xC4, 0x1E, 0x00, 0x01}, 2, []operand{reg(3), mem16(0x1000, 0x100)}},
+		{[]byte{0xD9, 0x06, 0x00, 0x01}, 2, []operand{mem16(0x1000, 0x100)}}, // FLD [0100]
+		{[]byte{0xB3, 0x07}, 1, []operand{reg(3), value(7)}},
+		{[]byte{0xBB, 0x34, 0x12}, 2, []operand{reg(3), value(0x1234)}},
+		{[]byte{0x66, 0xBB, 1, 2, 3, 4}, 4, []operand{reg(3), value(0x04030201)}},
+		{[]byte{0x83, 0xC0, 0xFF}, 2, []operand{reg(0), value(0xFFFFFFFF)}},
+		{[]byte{0x04, 0x80}, 1, []operand{reg(0), value(0x80)}},
+		{[]byte{0xA1, 0x34, 0x12}, 2, []operand{reg(0), mem16(0x1000, 0x1234)}},
+		{[]byte{0x2E, 0xA2, 0x34, 0x12}, 1, []operand{mem16(0x0100, 0x1234), reg(0)}},
+		{[]byte{0xA4}, 1, []operand{mem16(0x2000, 0x30), mem16(0x1000, 0x20)}},       // MOVSB
+		{[]byte{0x26, 0xA5}, 2, []operand{mem16(0x2000, 0x30), mem16(0x2000, 0x20)}}, // ES: MOVSW
+		{[]byte{0x67, 0xAD}, 2, []operand{reg(0), mem32(0x1000, 0x10020)}},           // LODSW with ESI
+		{[]byte{0xEC}, 1, []operand{reg(0), reg(2)}},                                 // IN AL, DX
+		{[]byte{0xD2, 0xE0}, 1, []operand{reg(0), reg(1)}},                           // SHL AL, CL
+		{[]byte{0xD1, 0xE0}, 2, []operand{reg(0), value(1)}},                         // SHL AX, 1
+		{[]byte{0xCC}, 2, []operand{value(3)}},                                       // INT 3
+		{[]byte{0xCD, 0x21}, 2, []operand{value(0x21)}},                              // INT 21h
+		{[]byte{0x06}, 2, []operand{seg(0)}},                                         // PUSH ES
+		{[]byte{0x0F, 0xA8}, 2, []operand{seg(5)}},                                   // PUSH GS
+		{[]byte{0x4E}, 2, []operand{reg(6)}},                                         // DEC SI
+		{[]byte{0x0F, 0xB7, 0xC3}, 2, []operand{reg(0), reg(3)}},                     // MOVZX AX, BX
+		{[]byte{0x0F, 0xBE, 0x07}, 2, []operand{reg(0), mem16(0x1000, 0x10)}},        // MOVSX AX, BYTE [BX]
+		{[]byte{0xE8, 0xFD, 0xFF}, 2, []operand{value(0xFFFD)}},                      // CALL $
+		{[]byte{0xEB, 0xFE}, 2, []operand{value(0xFFFFFFFE)}},                        // JMP $
+		{[]byte{0x9A, 0x00, 0x01, 0x00, 0x20}, 2, []operand{value(0x0100)}},          // CALL 2000:0100
+		{[]byte{0x0F, 0x93, 0xC1}, 1, []operand{reg(1)}},                             // SETNB CL
+		{[]byte{0x64, 0x8B, 0x07}, 2, []operand{reg(0), mem16(0x4000, 0x10)}},        // MOV AX, FS:[BX]
+		{[]byte{0x69, 0xC3, 0x10, 0x00}, 2, []operand{reg(0), reg(3), value(0x10)}},  // IMUL AX, BX, 10h
+		{[]byte{0x0F, 0xA4, 0xD8, 0x04}, 2, []operand{reg(0), reg(3), value(4)}},     // SHLD AX, BX, 4
+	}
+	for _, test := range tests {
+		inst := decodeBytes(e.decoder, mem, test.code)
+		if inst.size != test.size {
+			t.Errorf("% X (%s): size %d, want %d", test.code, inst.Name, inst.size, test.size)
+		}
+		for n, want := range test.operands {
+			if got := e.operand(inst, n); got != want {
+				t.Errorf("% X (%s): operand %d is %+v, want %+v", test.code, inst.Name, n, got, want)
+			}
+		}
+	}
+}
+
+// TestSegmentWrap checks that the bytes of an instruction and of a word
+// or doubleword operand that run past offset FFFF continue at offset 0
+// of the same segment, not in the next 64K of memory.
+func TestSegmentWrap(t *testing.T) {
+	e, c, mem := newTestExecutor()
+	c.DS = 0x3000
+
+	c.IP = 0xFFFE
+	mem.Write8(memory.CalculateAddress(c.CS, 0xFFFE), 0xB8) // MOV AX, 1234h
+	mem.Write8(memory.CalculateAddress(c.CS, 0xFFFF), 0x34)
+	mem.Write8(memory.CalculateAddress(c.CS, 0x0000), 0x12)
+	inst := e.decoder.Decode(c.CS, c.IP)
+	e.Execute(inst)
+	if inst.Length != 3 || c.AX != 0x1234 || c.IP != 0x0001 {
+		t.Errorf("MOV AX at FFFE: length %d, AX=%04X, IP=%04X; want 3, 1234, 0001", inst.Length, c.AX, c.IP)
+	}
+
+	mem.Write8(memory.CalculateAddress(c.DS, 0xFFFF), 0x78)
+	mem.Write8(memory.CalculateAddress(c.DS, 0x0000), 0x56)
+	c.BX = 0xFFFF
+	run(e, c, mem, []byte{0x8B, 0x07}) // MOV AX, [BX]
+	if c.AX != 0x5678 {
+		t.Errorf("word at DS:FFFF read as %04X, want 5678", c.AX)
+	}
+
+	c.BX = 0xFFFE
+	c.SetRegister32(0, 0x11223344)
+	run(e, c, mem, []byte{0x66, 0x89, 0x07}) // MOV [BX], EAX
+	for i, want := range []byte{0x44, 0x33, 0x22, 0x11} {
+		if got := mem.Read8(memory.CalculateAddress(c.DS, 0xFFFE+uint16(i))); got != want {
+			t.Errorf("doubleword at DS:FFFE: byte %d is %02X, want %02X", i, got, want)
+		}
+	}
+	if got := mem.Read16(memory.CalculateAddress(c.DS, 0xFFFF) + 1); got != 0 {
+		t.Errorf("doubleword at DS:FFFE wrote %04X past the segment", got)
+	}
+}
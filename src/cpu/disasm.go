@@ -0,0 +1,378 @@
+package cpu
+
+import (
+	"fmt"
+	"strings"
+
+	"dos-emulator/memory"
+)
+
+// The disassembler prints instructions in NASM syntax: lowercase, numbers
+// in hex, segment overrides inside the brackets and the size of a memory
+// operand given by BYTE, WORD and so on where no register implies it, as
+// in "mov word [es:bp+si-4], 0x1234". The monitor's assembler accepts
+// it for the instructions it knows.
+
+// baseIndexNames are the registers of the 16-bit memory operands by rm
+// field.
+var baseIndexNames = [8]string{"bx+si", "bx+di", "bp+si", "bp+di", "si", "di", "bp", "bx"}
+
+// sizeNames are the NASM size keywords by operand size in bytes.
+var sizeNames = map[int]string{1: "byte", 2: "word", 4: "dword", 8: "qword", 10: "tword"}
+
+// dwordNames are the mnemonics that instructions without operands take
+// under a 66h prefix.
+var dwordNames = map[string]string{
+	"PUSHA": "PUSHAD", "POPA": "POPAD", "PUSHF": "PUSHFD", "POPF": "POPFD",
+	"IRET": "IRETD", "CBW": "CWDE", "CWD": "CDQ",
+}
+
+// Disassemble returns the instruction as it reads at offset ip of its
+// code segment. Relative jumps, calls and loops show their target, by
+// the name labels give it if there is one.
+func (inst *Instruction) Disassemble(ip uint16, labels map[uint16]string) string {
+	return inst.format(func() string {
+		if inst.OperandSize32 {
+			return fmt.Sprintf("0x%08x", uint32(ip)+uint32(inst.Length)+inst.Immediate32)
+		}
+		target, _ := inst.Target(ip)
+		if label, ok := labels[target]; ok {
+			return label
+		}
+		return fmt.Sprintf("0x%04x", target)
+	})
+}
+
+// String returns the instruction like Disassemble, but with relative
+// targets given from the start of the instruction ("$+0x12"), as the
+// instruction does not know its own address.
+func (inst *Instruction) String() string {
+	return inst.format(func() string {
+		distance := int32(inst.Length) + int32(inst.Immediate32)
+		if !inst.OperandSize32 {
+			distance = int32(int16(distance))
+		}
+		return "$" + displacementText(distance)
+	})
+}
+
+// Target returns where the relative jump, call or loop at offset ip
+// leads, and false for other instructions.
+func (inst *Instruction) Target(ip uint16) (uint16, bool) {
+	if inst.op == nil || inst.op.operands[0] != relByte && inst.op.operands[0] != rel {
+		return 0, false
+	}
+	return ip + uint16(inst.Length) + uint16(inst.Immediate32), true
+}
+
+// format builds the text of the instruction, taking that of a relative
+// target from target.
+func (inst *Instruction) format(target func() string) string {
+	op := inst.op
+	if op == nil || inst.Name == "" || inst.Name == "ESC" {
+		return inst.dataText()
+	}
+
+	var name, modifier string
+	var operands []string
+	overrideUsed := false
+	if inst.Opcode >= 0xD8 && inst.Opcode <= 0xDF {
+		name, operands, overrideUsed = inst.fpuOperands()
+	} else {
+		name, modifier, _ = strings.Cut(op.name, " ")
+		// String instructions take their operands from the mnemonic.
+		shown := op.operands
+		if isStringForm(op) {
+			shown = kinds{}
+		}
+		first := true
+		for i, kind := range shown {
+			var part string
+			switch kind {
+			case noOperand:
+				continue
+			case rmByte, rmWord, rmWord16, memOnly, memFar:
+				part = inst.rmText(i)
+				overrideUsed = overrideUsed || inst.ModRM < 0xC0
+			case regByte:
+				part = registerNames[0][(inst.ModRM>>3)&0x07]
+			case regWord:
+				part = registerNames[inst.size/2][(inst.ModRM>>3)&0x07]
+			case segReg:
+				part = "?"
+				if reg := (inst.ModRM >> 3) & 0x07; int(reg) < len(segmentNames) {
+					part = segmentNames[reg]
+				}
+			case immByte, immSByte, immWord, imm:
+				value := inst.Immediate32
+				if !first {
+					value = uint32(inst.Immediate2)
+				}
+				first = false
+				part = immediateText(kind, value, inst.size)
+			case relByte, rel:
+				part = target()
+				first = false
+			case farImm:
+				part = fmt.Sprintf("0x%04x:0x%04x", inst.Immediate2, inst.Immediate)
+				if inst.OperandSize32 {
+					part = fmt.Sprintf("0x%04x:0x%08x", inst.Immediate2, inst.Immediate32)
+				}
+				modifier = ""
+			case moffsByte, moffs:
+				part = fmt.Sprintf("[%s0x%04x]", inst.overrideText(), inst.Displacement)
+				if inst.AddressSize32 {
+					part = fmt.Sprintf("[%s0x%08x]", inst.overrideText(), inst.Displacement32)
+				}
+				overrideUsed = true
+			case opRegByte:
+				part = registerNames[0][inst.Opcode&0x07]
+			case opReg:
+				part = registerNames[inst.size/2][inst.Opcode&0x07]
+			case regAL:
+				part = "al"
+			case regCL:
+				part = "cl"
+			case regDX:
+				part = "dx"
+			case regAX:
+				part = registerNames[inst.size/2][0]
+			case regES, regCS, regSS, regDS, regFS, regGS:
+				part = segmentNames[kind-regES]
+			case constOne:
+				part = "1"
+			case constThree:
+				part = "3"
+			}
+			operands = append(operands, part)
+		}
+		if isStringForm(op) && inst.size == 4 {
+			name = name[:len(name)-1] + "D"
+		} else if dword, ok := dwordNames[name]; ok && inst.OperandSize32 {
+			name = dword
+		}
+	}
+
+	var text strings.Builder
+	if inst.Lock {
+		text.WriteString("lock ")
+	}
+	if inst.SegmentPrefix != 0 && !overrideUsed {
+		text.WriteString(segmentPrefixNames[inst.SegmentPrefix] + " ")
+	}
+	switch {
+	case inst.RepPrefix == 0xF2:
+		text.WriteString("repne ")
+	case inst.RepPrefix == 0xF3 && (strings.HasPrefix(name, "CMPS") || strings.HasPrefix(name, "SCAS")):
+		text.WriteString("repe ")
+	case inst.RepPrefix == 0xF3:
+		text.WriteString("rep ")
+	}
+	text.WriteString(name)
+	if modifier == "" {
+		modifier = inst.jumpModifier()
+	}
+	if modifier != "" && (len(operands) == 0 || !strings.HasPrefix(operands[0], "far ")) {
+		text.WriteString(" " + modifier)
+	}
+	if len(operands) > 0 {
+		text.WriteString(" " + strings.Join(operands, ", "))
+	}
+	return strings.ToLower(text.String())
+}
+
+// jumpModifier returns SHORT or NEAR for the relative jumps that have
+// both forms, so that the text assembles to the same encoding.
+func (inst *Instruction) jumpModifier() string {
+	switch {
+	case inst.Opcode >= 0x70 && inst.Opcode <= 0x7F:
+		return "SHORT"
+	case inst.Opcode == 0xE9, inst.Opcode == 0x0F && inst.op.operands[0] == rel:
+		return "NEAR"
+	}
+	return ""
+}
+
+// rmText formats operand i of the instruction, which the ModRM byte
+// addresses: a register, or memory with a size keyword unless another
+// operand is a register of the same size.
+func (inst *Instruction) rmText(i int) string {
+	kind := inst.op.operands[i]
+	size := map[operandKind]int{rmByte: 1, rmWord: inst.size, rmWord16: 2}[kind]
+	if inst.ModRM >= 0xC0 {
+		if size == 0 {
+			size = inst.size
+		}
+		return registerNames[size/2][inst.ModRM&0x07]
+	}
+
+	if kind == memFar && strings.HasSuffix(inst.op.name, " FAR") {
+		return "far " + inst.memoryText()
+	}
+	for j, other := range inst.op.operands {
+		otherSize := map[operandKind]int{regByte: 1, regWord: inst.size, segReg: 2}[other]
+		if j != i && otherSize == size {
+			size = 0
+		}
+	}
+	if name, ok := sizeNames[size]; ok {
+		return name + " " + inst.memoryText()
+	}
+	return inst.memoryText()
+}
+
+// memoryText formats the memory operand of the ModRM byte, with its
+// segment override.
+func (inst *Instruction) memoryText() string {
+	mod := inst.ModRM >> 6
+	rm := inst.ModRM & 0x07
+	var address string
+	switch {
+	case inst.AddressSize32:
+		address = inst.address32Text()
+	case mod == 0 && rm == 6:
+		address = fmt.Sprintf("0x%04x", inst.Displacement)
+	case mod == 0:
+		address = baseIndexNames[rm]
+	case mod == 1:
+		address = baseIndexNames[rm] + displacementText(int32(int16(inst.Displacement)))
+	default:
+		address = fmt.Sprintf("%s+0x%04x", baseIndexNames[rm], inst.Displacement)
+	}
+	return "[" + inst.overrideText() + address + "]"
+}
+
+// address32Text formats a 32-bit memory operand, with its SIB byte.
+func (inst *Instruction) address32Text() string {
+	mod := inst.ModRM >> 6
+	base := inst.ModRM & 0x07
+	var parts []string
+	if base == 4 {
+		base = inst.SIB & 0x07
+		if index := (inst.SIB >> 3) & 0x07; index != 4 {
+			scaled := registerNames[2][index]
+			if scale := inst.SIB >> 6; scale > 0 {
+				scaled += fmt.Sprintf("*%d", 1<<scale)
+			}
+			parts = append(parts, scaled)
+		}
+	}
+	if mod == 0 && base == 5 {
+		if len(parts) == 0 {
+			return fmt.Sprintf("0x%08x", inst.Displacement32)
+		}
+		return parts[0] + fmt.Sprintf("+0x%08x", inst.Displacement32)
+	}
+	address := strings.Join(append([]string{registerNames[2][base]}, parts...), "+")
+	switch mod {
+	case 1:
+		address += displacementText(int32(inst.Displacement32))
+	case 2:
+		address += fmt.Sprintf("+0x%08x", inst.Displacement32)
+	}
+	return address
+}
+
+// overrideText returns the segment override of a memory operand, such as
+// "es:", or "" if there is none.
+func (inst *Instruction) overrideText() string {
+	if inst.SegmentPrefix == 0 {
+		return ""
+	}
+	return segmentPrefixNames[inst.SegmentPrefix] + ":"
+}
+
+// fpuOperands splits the mnemonic of a coprocessor instruction from its
+// operands, renaming the stack registers after NASM (ST(1) is st1), and
+// reports whether a memory operand took the segment override.
+func (inst *Instruction) fpuOperands() (string, []string, bool) {
+	if inst.ModRM < 0xC0 {
+		operand := inst.memoryText()
+		if name, ok := sizeNames[fpuMemorySize(inst.Opcode, (inst.ModRM>>3)&0x07)]; ok {
+			operand = name + " " + operand
+		}
+		return inst.Name, []string{operand}, true
+	}
+	name, operands := splitFPUName(inst.Name)
+	return name, operands, false
+}
+
+// dataText shows an instruction no processor defines as the bytes of its
+// opcode and ModRM byte.
+func (inst *Instruction) dataText() string {
+	code := []string{fmt.Sprintf("0x%02x", inst.Opcode)}
+	if inst.Opcode == 0x0F && inst.op != &popCS {
+		code = append(code, fmt.Sprintf("0x%02x", inst.Opcode2))
+	}
+	if inst.HasModRM {
+		code = append(code, fmt.Sprintf("0x%02x", inst.ModRM))
+	}
+	return "db " + strings.Join(code, ", ")
+}
+
+// immediateText formats an immediate as a hex number of the width of its
+// operand.
+func immediateText(kind operandKind, value uint32, size int) string {
+	switch {
+	case kind == immByte:
+		return fmt.Sprintf("0x%02x", value&0xFF)
+	case kind == immWord || size == 2:
+		return fmt.Sprintf("0x%04x", value&0xFFFF)
+	}
+	return fmt.Sprintf("0x%08x", value)
+}
+
+// displacementText formats a signed displacement as "+4" or "-0x10".
+func displacementText(value int32) string {
+	sign := "+"
+	if value < 0 {
+		sign, value = "-", -value
+	}
+	if value < 10 {
+		return fmt.Sprintf("%s%d", sign, value)
+	}
+	return fmt.Sprintf("%s0x%x", sign, value)
+}
+
+// ListingLine is an instruction of a disassembly listing.
+type ListingLine struct {
+	Offset uint16
+	Code   []byte // the bytes of the instruction
+	Label  string // the name of the line if a jump in the listing leads to it
+	Text   string
+}
+
+// Listing disassembles the instructions from segment:offset on: count of
+// them, or if count is 0, those that start within length bytes. Relative
+// jumps, calls and loops to an instruction of the listing refer to it by
+// a label named after its offset, such as loc_0123.
+func (d *InstructionDecoder) Listing(segment, offset uint16, count int, length uint32) []ListingLine {
+	var lines []ListingLine
+	var insts []*Instruction
+	starts := make(map[uint16]int)
+	for done := uint32(0); count > 0 && len(lines) < count || count == 0 && done < length; {
+		inst := d.Decode(segment, offset)
+		code := make([]byte, inst.Length)
+		for i := range code {
+			code[i] = d.memory.Read8(memory.CalculateAddress(segment, offset+uint16(i)))
+		}
+		starts[offset] = len(lines)
+		lines = append(lines, ListingLine{Offset: offset, Code: code})
+		insts = append(insts, inst)
+		offset += uint16(inst.Length)
+		done += uint32(inst.Length)
+	}
+
+	labels := make(map[uint16]string)
+	for i, inst := range insts {
+		target, ok := inst.Target(lines[i].Offset)
+		if j, inListing := starts[target]; ok && inListing {
+			labels[target] = fmt.Sprintf("loc_%04x", target)
+			lines[j].Label = labels[target]
+		}
+	}
+	for i, inst := range insts {
+		lines[i].Text = inst.Disassemble(lines[i].Offset, labels)
+	}
+	return lines
+}
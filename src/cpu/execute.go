@@ -0,0 +1,306 @@
+package cpu
+
+import (
+	"fmt"
+
+	"dos-emulator/ioport"
+	"dos-emulator/memory"
+)
+
+// Host is implemented by the machine the CPU is plugged into. It services
+// software interrupts and reacts to the processor halting.
+type Host interface {
+	HandleInterrupt(intNum byte)
+	Halt()
+}
+
+type Executor struct {
+	cpu          *CPU
+	memory       *memory.Memory
+	decoder      *InstructionDecoder
+	ports        *ioport.Bus
+	host         Host
+	model        Model
+	fpu          *FPU
+	systemFlags  uint16 // IOPL and NT, which only the 80386 keeps in real mode
+	repeatPrefix byte
+	stack        []uint16
+	debugMode    bool
+
+	// shadow is set by an instruction that loads SS. Interrupts and the
+	// single-step trap wait until after the next instruction, which
+	// normally loads SP, so that they never push onto a half-loaded
+	// stack.
+	shadow bool
+
+	cycles         uint64 // 8088 clock cycles of the executed instructions
+	flagMismatches uint64 // found by the flag check; see SetFlagCheck
+}
+
+func NewExecutor(c *CPU, mem *memory.Memory, ports *ioport.Bus, decoder *InstructionDecoder, host Host) *Executor {
+	return &Executor{
+		cpu:     c,
+		memory:  mem,
+		ports:   ports,
+		decoder: decoder,
+		host:    host,
+		model:   Model80286,
+		fpu:     NewFPU(),
+		stack:   make([]uint16, 0),
+	}
+}
+
+// SetModel selects the processor to emulate. The 8086 executes the
+// opcodes later processors added as aliases of older instructions, does
+// not mask shift counts and reports divide errors after the instruction;
+// the 80186 adds PUSHA/POPA, PUSH imm, IMUL imm, ENTER/LEAVE, BOUND,
+// INS/OUTS and the invalid-opcode exception; the 80286 also pushes SP as
+// it was before PUSH SP and clears FLAGS bits 12-15 in real mode.
+func (e *Executor) SetModel(model Model) {
+	e.model = model
+	e.decoder.SetModel(model)
+}
+
+func (e *Executor) Model() Model {
+	return e.model
+}
+
+func (e *Executor) SetDebugMode(enabled bool) {
+	e.debugMode = enabled
+}
+
+// InterruptsInhibited reports whether the last instruction loaded SS,
+// so that a hardware interrupt must wait for the next one.
+func (e *Executor) InterruptsInhibited() bool {
+	return e.shadow
+}
+
+// RepeatPrefix returns the pending REP/REPNE prefix, or 0 if none is active.
+func (e *Executor) RepeatPrefix() byte {
+	return e.repeatPrefix
+}
+
+// Stack returns the shadow copy of the most recently pushed words, oldest
+// first.
+func (e *Executor) Stack() []uint16 {
+	return e.stack
+}
+
+// ExecutorState is the executor's own part of the machine state, which
+// the DOS recorder keeps with the registers to go back in time.
+type ExecutorState struct {
+	cycles       uint64
+	repeatPrefix byte
+	systemFlags  uint16
+	stackDepth   int
+	shadow       bool
+}
+
+// State returns the executor's state between instructions.
+func (e *Executor) State() ExecutorState {
+	return ExecutorState{
+		cycles:       e.cycles,
+		repeatPrefix: e.repeatPrefix,
+		systemFlags:  e.systemFlags,
+		stackDepth:   len(e.stack),
+		shadow:       e.shadow,
+	}
+}
+
+// SetState puts back a state State returned. The shadow stack is rebuilt
+// to its old depth from the words at SS:SP, so the registers and memory
+// must be restored first.
+func (e *Executor) SetState(s ExecutorState) {
+	e.cycles = s.cycles
+	e.repeatPrefix = s.repeatPrefix
+	e.systemFlags = s.systemFlags
+	e.shadow = s.shadow
+	e.stack = e.stack[:0]
+	for i := s.stackDepth - 1; i >= 0; i-- {
+		e.stack = append(e.stack, e.memory.Read16(memory.CalculateAddress(e.cpu.SS, e.cpu.SP+uint16(2*i))))
+	}
+}
+
+func (e *Executor) Push(value uint16) {
+	e.cpu.SP -= 2
+	addr := memory.CalculateAddress(e.cpu.SS, e.cpu.SP)
+	e.memory.Write16(addr, value)
+	if len(e.stack) < 1000 {
+		e.stack = append(e.stack, value)
+	}
+}
+
+func (e *Executor) Pop() uint16 {
+	addr := memory.CalculateAddress(e.cpu.SS, e.cpu.SP)
+	value := e.memory.Read16(addr)
+	e.cpu.SP += 2
+	if len(e.stack) > 0 {
+		e.stack = e.stack[:len(e.stack)-1]
+	}
+	return value
+}
+
+func (e *Executor) Push32(value uint32) {
+	e.Push(uint16(value >> 16))
+	e.Push(uint16(value))
+}
+
+func (e *Executor) Pop32() uint32 {
+	low := e.Pop()
+	high := e.Pop()
+	return uint32(high)<<16 | uint32(low)
+}
+
+// Interrupt performs the 8086 interrupt sequence for vector intNum: FLAGS,
+// CS and IP are pushed, IF and TF are cleared and execution continues at
+// the handler address stored in the interrupt vector table at 0000:0000.
+func (e *Executor) Interrupt(intNum byte) {
+	e.Push(e.flagsWord())
+	e.cpu.Flags.IF = false
+	e.cpu.Flags.TF = false
+	e.Push(e.cpu.CS)
+	e.Push(e.cpu.IP)
+
+	vector := uint32(intNum) * 4
+	e.cpu.IP = e.memory.Read16(vector)
+	e.cpu.CS = e.memory.Read16(vector + 2)
+}
+
+// flagsWord returns FLAGS as PUSHF stores it. Bits 12-15 always read as
+// 1 on the 8086 and 80186 and as 0 on the 80286 in real mode, while the
+// 80386 keeps whatever was loaded into IOPL and NT (bits 12-14), which is
+// how programs tell the processors apart.
+func (e *Executor) flagsWord() uint16 {
+	switch {
+	case e.model < Model80286:
+		return e.cpu.Flags.ToUint16() | 0xF000
+	case e.model >= Model80386:
+		return e.cpu.Flags.ToUint16() | e.systemFlags
+	}
+	return e.cpu.Flags.ToUint16()
+}
+
+// loadFlags sets FLAGS from a word popped by POPF or IRET.
+func (e *Executor) loadFlags(value uint16) {
+	e.cpu.Flags.FromUint16(value)
+	e.systemFlags = value & 0x7000
+}
+
+// pushedSP returns the value PUSH SP stores: the 8086 and 80186 write SP
+// after it has been decremented, the 80286 the value before.
+func (e *Executor) pushedSP() uint16 {
+	if e.model < Model80286 {
+		return e.cpu.SP - 2
+	}
+	return e.cpu.SP
+}
+
+// divideError raises INT 0 for a zero divisor or a quotient that does
+// not fit the destination. The registers are left unchanged. The 8086
+// returns to the next instruction, later processors to the faulting one.
+func (e *Executor) divideError(inst *Instruction) {
+	if e.model != Model8086 {
+		e.cpu.IP -= uint16(inst.Length)
+	}
+	e.Interrupt(0)
+}
+
+// invalidOpcode raises INT 6 with the return address pointing at the
+// undefined instruction. The 8086 has no such exception and goes on with
+// the next instruction.
+func (e *Executor) invalidOpcode(inst *Instruction) {
+	if e.model == Model8086 {
+		return
+	}
+	e.cpu.IP -= uint16(inst.Length)
+	if e.debugMode {
+		fmt.Printf("Invalid opcode: %s at %04X:%04X\n", inst, e.cpu.CS, e.cpu.IP)
+	}
+	e.Interrupt(6)
+}
+
+// statusFlags masks OF, SF, ZF, AF, PF and CF in the FLAGS register.
+const statusFlags = 0x08D5
+
+// trap runs the Go handler behind a ROM interrupt stub. The handler sees
+// the registers as the interrupted program left them. The status flags it
+// produces are then copied into the FLAGS image on the stack, so that the
+// stub's IRET hands them back to the caller.
+func (e *Executor) trap(inst *Instruction) {
+	e.host.HandleInterrupt(byte(inst.Immediate32))
+
+	flagsAddr := memory.CalculateAddress(e.cpu.SS, e.cpu.SP+4)
+	stacked := e.memory.Read16(flagsAddr)
+	stacked = (stacked &^ statusFlags) | (e.cpu.Flags.ToUint16() & statusFlags)
+	e.memory.Write16(flagsAddr, stacked)
+}
+
+// smsw stores the machine status word: the 80286 sets the reserved
+// bits, the 80386 clears them and reports a 387 in ET.
+func (e *Executor) smsw(inst *Instruction) {
+	msw := uint32(0xFFF0)
+	if e.model >= Model80386 {
+		msw = 0
+		if e.fpu != nil {
+			msw |= 0x0010
+		}
+	}
+	e.writeOperand(inst, 2, msw)
+}
+
+// hlt stops the processor until the host lets it go on.
+func (e *Executor) hlt(inst *Instruction) {
+	e.host.Halt()
+	if e.debugMode {
+		fmt.Println("CPU halted")
+	}
+}
+
+// esc hands a coprocessor instruction to the FPU.
+func (e *Executor) esc(inst *Instruction) {
+	e.executeFPU(inst)
+}
+
+func (e *Executor) nop(inst *Instruction) {}
+
+// Execute runs one decoded instruction. If TF was set when the
+// instruction started, a single-step trap (INT 1) follows it, so the
+// instruction that sets TF is not itself trapped and the one that clears
+// it still is. After MOV SS or POP SS the trap waits for the next
+// instruction.
+func (e *Executor) Execute(inst *Instruction) {
+	singleStep := e.cpu.Flags.TF
+	cs, ip, cx := e.cpu.CS, e.cpu.IP, e.cpu.CX
+	e.shadow = false
+	e.execute(inst)
+	if e.cpu.Flags.check {
+		e.checkFlags(inst, cs, ip)
+	}
+	e.cycles += uint64(e.instructionCycles(inst, cs, ip, cx))
+	if singleStep && !e.shadow {
+		e.Interrupt(1)
+	}
+}
+
+// execute advances IP past inst and runs the function its opcode table
+// entry names. Jumps and calls therefore work from the address of the
+// next instruction, and faults that restart the instruction back IP up
+// again.
+func (e *Executor) execute(inst *Instruction) {
+	e.repeatPrefix = inst.RepPrefix
+	e.cpu.IP += uint16(inst.Length)
+	if e.repeatPrefix != 0 && isStringOp(inst.Opcode) && e.stringRegister(inst, countRegister) == 0 {
+		// A repeated string instruction with CX=0 is a no-op.
+		e.repeatPrefix = 0
+		return
+	}
+
+	if inst.op.exec == nil {
+		if e.debugMode {
+			fmt.Printf("Unimplemented opcode: 0x%02X at %04X:%04X\n", inst.Opcode, e.cpu.CS, e.cpu.IP-uint16(inst.Length))
+		}
+		return
+	}
+	inst.op.exec(e, inst)
+	e.repeat(inst)
+}
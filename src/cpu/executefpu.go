@@ -0,0 +1,397 @@
+package cpu
+
+import (
+	"math"
+)
+
+// SetFPU installs or removes the numeric coprocessor. Without one, ESC
+// instructions compute their operand address and do nothing else, so
+// detection code that stores the control word finds memory unchanged.
+func (e *Executor) SetFPU(enabled bool) {
+	if enabled {
+		e.fpu = NewFPU()
+	} else {
+		e.fpu = nil
+	}
+}
+
+// FPU returns the coprocessor, or nil if none is installed.
+func (e *Executor) FPU() *FPU {
+	return e.fpu
+}
+
+func (e *Executor) readExtended(m operand) [10]byte {
+	var b [10]byte
+	for i := range b {
+		b[i] = e.memory.Read8(m.at(uint32(i)))
+	}
+	return b
+}
+
+func (e *Executor) writeExtended(m operand, b [10]byte) {
+	for i := range b {
+		e.memory.Write8(m.at(uint32(i)), b[i])
+	}
+}
+
+// loadReal reads a memory operand of the arithmetic forms: a 32-bit or
+// 64-bit real, or a 16-bit or 32-bit integer, depending on opcode.
+func (e *Executor) loadReal(opcode byte, m operand) float64 {
+	switch opcode {
+	case 0xD8, 0xD9:
+		return float64(math.Float32frombits(e.readMemory(m, 4)))
+	case 0xDA, 0xDB:
+		return float64(int32(e.readMemory(m, 4)))
+	case 0xDC, 0xDD:
+		return math.Float64frombits(e.readMemory64(m))
+	}
+	return float64(int16(e.readMemory(m, 2)))
+}
+
+func (e *Executor) readMemory64(m operand) uint64 {
+	return uint64(e.readMemory(m.next(4), 4))<<32 | uint64(e.readMemory(m, 4))
+}
+
+func (e *Executor) storeFloat64(m operand, value float64) {
+	e.writeMemory64(m, math.Float64bits(value))
+}
+
+func (e *Executor) writeMemory64(m operand, value uint64) {
+	e.writeMemory(m, 4, uint32(value))
+	e.writeMemory(m.next(4), 4, uint32(value>>32))
+}
+
+// storeEnvironment writes the 14-byte real-mode FSTENV image and returns
+// the memory following it.
+func (e *Executor) storeEnvironment(m operand) operand {
+	f := e.fpu
+	words := []uint16{f.control, f.StatusWord(), f.TagWord(), 0, 0, 0, 0}
+	for i, w := range words {
+		e.writeMemory(m.next(uint32(2*i)), 2, uint32(w))
+	}
+	return m.next(14)
+}
+
+func (e *Executor) loadEnvironment(m operand) operand {
+	f := e.fpu
+	f.control = uint16(e.readMemory(m, 2))
+	status := uint16(e.readMemory(m.next(2), 2))
+	f.status = status &^ 0x3800
+	f.top = int(status>>11) & 7
+	f.setTagWord(uint16(e.readMemory(m.next(4), 2)))
+	return m.next(14)
+}
+
+// executeFPU runs an ESC instruction (D8h-DFh).
+func (e *Executor) executeFPU(inst *Instruction) {
+	f := e.fpu
+	op := inst.Opcode
+	mod := (inst.ModRM >> 6) & 0x03
+	reg := (inst.ModRM >> 3) & 0x07
+	rm := inst.ModRM & 0x07
+
+	if mod != 3 {
+		m := e.rm(inst)
+		if f == nil {
+			return
+		}
+		e.fpuMemory(op, reg, m)
+		return
+	}
+	if f == nil {
+		return
+	}
+
+	i := int(rm)
+	switch op {
+	case 0xD8: // ST(0) = ST(0) op ST(i)
+		result := f.arithmetic(reg, f.get(0), f.get(i))
+		if reg != 2 && reg != 3 {
+			f.set(0, result)
+		} else if reg == 3 {
+			f.pop()
+		}
+
+	case 0xDC, 0xDE: // ST(i) = ST(i) op ST(0), popping for DEh
+		if op == 0xDE && inst.ModRM == 0xD9 { // FCOMPP
+			f.compare(f.get(0), f.get(1))
+			f.pop()
+			f.pop()
+			return
+		}
+		if reg == 2 || reg == 3 {
+			f.compare(f.get(0), f.get(i))
+			if reg == 3 || op == 0xDE {
+				f.pop()
+			}
+			return
+		}
+		if reg >= 4 {
+			reg ^= 1
+		}
+		f.set(i, f.arithmetic(reg, f.get(i), f.get(0)))
+		if op == 0xDE {
+			f.pop()
+		}
+
+	case 0xD9:
+		e.fpuD9(inst.ModRM)
+
+	case 0xDA:
+		if inst.ModRM == 0xE9 { // FUCOMPP
+			f.compare(f.get(0), f.get(1))
+			f.pop()
+			f.pop()
+		}
+
+	case 0xDB:
+		switch inst.ModRM {
+		case 0xE2: // FCLEX
+			f.status &^= 0x80FF
+		case 0xE3: // FINIT
+			f.Reset()
+		}
+		// FENI, FDISI and FSETPM have no effect here.
+
+	case 0xDD:
+		switch reg {
+		case 0: // FFREE
+			f.empty[f.reg(i)] = true
+		case 2, 3: // FST, FSTP ST(i)
+			src := f.reg(0)
+			value := f.get(0)
+			f.set(i, value)
+			dst := f.reg(i)
+			f.raw[dst], f.rawOK[dst] = f.raw[src], f.rawOK[src]
+			if reg == 3 {
+				f.pop()
+			}
+		case 4, 5: // FUCOM, FUCOMP
+			f.compare(f.get(0), f.get(i))
+			if reg == 5 {
+				f.pop()
+			}
+		}
+
+	case 0xDF:
+		if inst.ModRM == 0xE0 { // FSTSW AX
+			e.cpu.AX = f.StatusWord()
+		}
+	}
+}
+
+// fpuD9 runs the register forms of opcode D9h.
+func (e *Executor) fpuD9(modrm byte) {
+	f := e.fpu
+	i := int(modrm & 0x07)
+
+	switch {
+	case modrm < 0xC8: // FLD ST(i)
+		src := f.reg(i)
+		value := f.get(i)
+		raw, rawOK := f.raw[src], f.rawOK[src]
+		f.push(value)
+		f.raw[f.reg(0)], f.rawOK[f.reg(0)] = raw, rawOK
+		return
+	case modrm < 0xD0: // FXCH ST(i)
+		a, b := f.reg(0), f.reg(i)
+		if f.empty[a] || f.empty[b] {
+			f.exception(fpuInvalid | fpuStackFault)
+		}
+		f.st[a], f.st[b] = f.st[b], f.st[a]
+		f.raw[a], f.raw[b] = f.raw[b], f.raw[a]
+		f.rawOK[a], f.rawOK[b] = f.rawOK[b], f.rawOK[a]
+		f.empty[a], f.empty[b] = false, false
+		return
+	}
+
+	if value, ok := fpuConstants[modrm]; ok {
+		f.push(value)
+		return
+	}
+
+	switch modrm {
+	case 0xE0: // FCHS
+		f.set(0, -f.get(0))
+	case 0xE1: // FABS
+		f.set(0, math.Abs(f.get(0)))
+	case 0xE4: // FTST
+		f.compare(f.get(0), 0)
+	case 0xE5: // FXAM
+		f.examine()
+	case 0xF0: // F2XM1
+		f.set(0, math.Exp2(f.get(0))-1)
+	case 0xF1: // FYL2X
+		x := f.get(0)
+		if x < 0 {
+			f.exception(fpuInvalid)
+		} else if x == 0 {
+			f.exception(fpuZeroDivide)
+		}
+		f.set(1, f.get(1)*math.Log2(x))
+		f.pop()
+	case 0xF2: // FPTAN
+		f.set(0, math.Tan(f.get(0)))
+		f.push(1)
+		f.status &^= fpuC2
+	case 0xF3: // FPATAN
+		f.set(1, math.Atan2(f.get(1), f.get(0)))
+		f.pop()
+	case 0xF4: // FXTRACT
+		value := f.get(0)
+		if value == 0 {
+			f.exception(fpuZeroDivide)
+			f.set(0, math.Inf(-1))
+			f.push(value)
+			break
+		}
+		frac, exp := math.Frexp(value)
+		f.set(0, float64(exp-1))
+		f.push(frac * 2)
+	case 0xF5, 0xF8: // FPREM1, FPREM
+		x, y := f.get(0), f.get(1)
+		if y == 0 || math.IsInf(x, 0) {
+			f.exception(fpuInvalid)
+			f.set(0, math.NaN())
+			break
+		}
+		var quotient float64
+		if modrm == 0xF8 {
+			quotient = math.Trunc(x / y)
+		} else {
+			quotient = math.RoundToEven(x / y)
+		}
+		f.set(0, x-quotient*y)
+		q := uint64(math.Abs(quotient))
+		var bits uint16
+		if q&4 != 0 {
+			bits |= fpuC0
+		}
+		if q&2 != 0 {
+			bits |= fpuC3
+		}
+		if q&1 != 0 {
+			bits |= fpuC1
+		}
+		f.setConditions(bits)
+	case 0xF6: // FDECSTP
+		f.top = (f.top - 1) & 7
+	case 0xF7: // FINCSTP
+		f.top = (f.top + 1) & 7
+	case 0xF9: // FYL2XP1
+		f.set(1, f.get(1)*math.Log1p(f.get(0))/math.Ln2)
+		f.pop()
+	case 0xFA: // FSQRT
+		value := f.get(0)
+		if value < 0 {
+			f.exception(fpuInvalid)
+		}
+		f.set(0, math.Sqrt(value))
+	case 0xFB: // FSINCOS
+		value := f.get(0)
+		f.set(0, math.Sin(value))
+		f.push(math.Cos(value))
+		f.status &^= fpuC2
+	case 0xFC: // FRNDINT
+		f.set(0, f.round(f.get(0)))
+	case 0xFD: // FSCALE
+		f.set(0, math.Ldexp(f.get(0), int(math.Trunc(f.get(1)))))
+	case 0xFE: // FSIN
+		f.set(0, math.Sin(f.get(0)))
+		f.status &^= fpuC2
+	case 0xFF: // FCOS
+		f.set(0, math.Cos(f.get(0)))
+		f.status &^= fpuC2
+	}
+}
+
+// fpuMemory runs the memory forms of the ESC instructions.
+func (e *Executor) fpuMemory(op, reg byte, m operand) {
+	f := e.fpu
+
+	switch {
+	case op == 0xD8 || op == 0xDA || op == 0xDC || op == 0xDE:
+		result := f.arithmetic(reg, f.get(0), e.loadReal(op, m))
+		switch reg {
+		case 2:
+		case 3:
+			f.pop()
+		default:
+			f.set(0, result)
+		}
+		return
+	}
+
+	switch uint16(op)<<4 | uint16(reg) {
+	case 0xD90, 0xDD0, 0xDB0, 0xDF0: // FLD m32real/m64real, FILD m32int/m16int
+		f.push(e.loadReal(op, m))
+	case 0xDB5: // FLD m80real
+		raw := e.readExtended(m)
+		f.push(extendedToFloat(raw))
+		f.raw[f.reg(0)], f.rawOK[f.reg(0)] = raw, true
+	case 0xDF5: // FILD m64int
+		f.push(float64(int64(e.readMemory64(m))))
+	case 0xDF4: // FBLD
+		f.push(bcdToFloat(e.readExtended(m)))
+
+	case 0xD92, 0xD93: // FST/FSTP m32real
+		e.writeMemory(m, 4, math.Float32bits(float32(f.get(0))))
+	case 0xDD2, 0xDD3: // FST/FSTP m64real
+		e.storeFloat64(m, f.get(0))
+	case 0xDB7: // FSTP m80real
+		r := f.reg(0)
+		value := f.get(0)
+		if f.rawOK[r] {
+			e.writeExtended(m, f.raw[r])
+		} else {
+			e.writeExtended(m, floatToExtended(value))
+		}
+	case 0xDB2, 0xDB3: // FIST/FISTP m32int
+		e.writeMemory(m, 4, uint32(f.toInteger(f.get(0), 32)))
+	case 0xDF2, 0xDF3: // FIST/FISTP m16int
+		e.writeMemory(m, 2, uint32(uint16(f.toInteger(f.get(0), 16))))
+	case 0xDF7: // FISTP m64int
+		e.writeMemory64(m, uint64(f.toInteger(f.get(0), 64)))
+	case 0xDF6: // FBSTP
+		bcd, ok := floatToBCD(f.round(f.get(0)))
+		if !ok {
+			f.exception(fpuInvalid)
+		}
+		e.writeExtended(m, bcd)
+
+	case 0xD94: // FLDENV
+		e.loadEnvironment(m)
+	case 0xD95: // FLDCW
+		f.control = uint16(e.readMemory(m, 2))
+	case 0xD96: // FSTENV
+		e.storeEnvironment(m)
+	case 0xD97: // FSTCW
+		e.writeMemory(m, 2, uint32(f.control))
+	case 0xDD4: // FRSTOR
+		next := e.loadEnvironment(m)
+		for i := 0; i < 8; i++ {
+			raw := e.readExtended(next.next(uint32(10 * i)))
+			r := f.reg(i)
+			f.st[r] = extendedToFloat(raw)
+			f.raw[r], f.rawOK[r] = raw, true
+		}
+	case 0xDD6: // FSAVE
+		next := e.storeEnvironment(m)
+		for i := 0; i < 8; i++ {
+			r := f.reg(i)
+			raw := floatToExtended(f.st[r])
+			if f.rawOK[r] {
+				raw = f.raw[r]
+			}
+			e.writeExtended(next.next(uint32(10*i)), raw)
+		}
+		f.Reset()
+	case 0xDD7: // FSTSW m16
+		e.writeMemory(m, 2, uint32(f.StatusWord()))
+	}
+
+	switch uint16(op)<<4 | uint16(reg) {
+	case 0xD93, 0xDD3, 0xDB7, 0xDB3, 0xDF3, 0xDF7, 0xDF6:
+		f.pop()
+	}
+}
@@ -0,0 +1,287 @@
+package cpu
+
+import "fmt"
+
+// Bits of the status flags in the FLAGS register.
+const (
+	flagCF = 0x0001
+	flagPF = 0x0004
+	flagAF = 0x0010
+	flagZF = 0x0040
+	flagSF = 0x0080
+	flagOF = 0x0800
+
+	resultFlags = flagZF | flagSF | flagPF
+)
+
+// flagOp identifies how the status flags of the last arithmetic
+// instruction follow from its operands and result.
+type flagOp byte
+
+const (
+	opLogic flagOp = iota // CF, OF and AF clear; ZF, SF, PF from the result
+	opAdd                 // dst + src + carry
+	opSub                 // dst - src - carry
+)
+
+// Flags is the FLAGS register. The status flags are evaluated lazily:
+// arithmetic instructions record their operation, operands and result,
+// and CF, PF, AF, ZF, SF and OF are only computed when something reads
+// them. Most results are overwritten by the next instruction before any
+// flag is looked at.
+type Flags struct {
+	TF, IF, DF bool
+
+	// bits holds the status flags in their FLAGS positions, except those
+	// in pending, which follow from the recorded operation.
+	bits    uint16
+	pending uint16
+
+	op               flagOp
+	size             int
+	dst, src, result uint32
+	carry            uint32
+
+	// With check set, eager is kept up to date by the straightforward
+	// computation so that the lazy result can be compared with it.
+	check bool
+	eager uint16
+}
+
+// record notes an operation that defines the flags in defined. Flags
+// still pending from the previous operation that this one leaves alone
+// are computed first.
+func (f *Flags) record(op flagOp, size int, dst, src, carry, result uint32, defined uint16) {
+	if keep := f.pending &^ defined; keep != 0 {
+		f.bits = f.bits&^keep | f.evaluate(keep)
+	}
+	f.op, f.size = op, size
+	f.dst, f.src, f.carry, f.result = dst, src, carry, result&sizeMask(size)
+	f.pending = defined
+	if f.check {
+		f.eager = f.eager&^defined | eagerFlags(op, size, dst, src, carry, result)&defined
+	}
+}
+
+// evaluate computes the flags in which from the recorded operation.
+func (f *Flags) evaluate(which uint16) uint16 {
+	var bits uint16
+	sign := signBit(f.size)
+	r := f.result
+	if which&flagCF != 0 {
+		switch f.op {
+		case opAdd:
+			if uint64(f.dst)+uint64(f.src)+uint64(f.carry) > uint64(sizeMask(f.size)) {
+				bits |= flagCF
+			}
+		case opSub:
+			if uint64(f.dst) < uint64(f.src)+uint64(f.carry) {
+				bits |= flagCF
+			}
+		}
+	}
+	if which&flagPF != 0 && parityTable[byte(r)] {
+		bits |= flagPF
+	}
+	if which&flagAF != 0 && f.op != opLogic && (f.dst^f.src^r)&0x10 != 0 {
+		bits |= flagAF
+	}
+	if which&flagZF != 0 && r == 0 {
+		bits |= flagZF
+	}
+	if which&flagSF != 0 && r&sign != 0 {
+		bits |= flagSF
+	}
+	if which&flagOF != 0 {
+		switch f.op {
+		case opAdd:
+			if (f.dst^r)&(f.src^r)&sign != 0 {
+				bits |= flagOF
+			}
+		case opSub:
+			if (f.dst^f.src)&(f.dst^r)&sign != 0 {
+				bits |= flagOF
+			}
+		}
+	}
+	return bits
+}
+
+// status returns the status flags in their FLAGS positions.
+func (f *Flags) status() uint16 {
+	return f.bits&^f.pending | f.evaluate(f.pending)
+}
+
+func (f *Flags) get(flag uint16) bool {
+	if f.pending&flag != 0 {
+		return f.evaluate(flag) != 0
+	}
+	return f.bits&flag != 0
+}
+
+func (f *Flags) set(flag uint16, value bool) {
+	f.pending &^= flag
+	if value {
+		f.bits |= flag
+	} else {
+		f.bits &^= flag
+	}
+	if f.check {
+		if value {
+			f.eager |= flag
+		} else {
+			f.eager &^= flag
+		}
+	}
+}
+
+func (f *Flags) CF() bool { return f.get(flagCF) }
+func (f *Flags) PF() bool { return f.get(flagPF) }
+func (f *Flags) AF() bool { return f.get(flagAF) }
+func (f *Flags) ZF() bool { return f.get(flagZF) }
+func (f *Flags) SF() bool { return f.get(flagSF) }
+func (f *Flags) OF() bool { return f.get(flagOF) }
+
+func (f *Flags) SetCF(value bool) { f.set(flagCF, value) }
+func (f *Flags) SetPF(value bool) { f.set(flagPF, value) }
+func (f *Flags) SetAF(value bool) { f.set(flagAF, value) }
+func (f *Flags) SetZF(value bool) { f.set(flagZF, value) }
+func (f *Flags) SetSF(value bool) { f.set(flagSF, value) }
+func (f *Flags) SetOF(value bool) { f.set(flagOF, value) }
+
+func (f *Flags) ToUint16() uint16 {
+	var result uint16 = 0x0002 | f.status()
+	if f.TF {
+		result = result | 0x0100
+	}
+	if f.IF {
+		result = result | 0x0200
+	}
+	if f.DF {
+		result = result | 0x0400
+	}
+	return result
+}
+
+func (f *Flags) FromUint16(value uint16) {
+	f.bits = value & statusFlags
+	f.pending = 0
+	f.eager = f.bits
+	f.TF = (value & 0x0100) != 0
+	f.IF = (value & 0x0200) != 0
+	f.DF = (value & 0x0400) != 0
+}
+
+// parityTable holds PF for every byte value: set for an even number of
+// one bits.
+var parityTable [256]bool
+
+func init() {
+	for i := range parityTable {
+		ones := 0
+		for v := i; v != 0; v >>= 1 {
+			ones += v & 1
+		}
+		parityTable[i] = ones%2 == 0
+	}
+}
+
+// eagerFlags computes the status flags of an operation directly, bit by
+// bit and with signed arithmetic, the way the flags were computed before
+// they became lazy. The flag check compares evaluate against it.
+func eagerFlags(op flagOp, size int, dst, src, carry, result uint32) uint16 {
+	bits := uint(size * 8)
+	mask := sizeMask(size)
+	signed := func(v uint32) int64 {
+		v &= mask
+		if v&signBit(size) != 0 {
+			return int64(v) - int64(1)<<bits
+		}
+		return int64(v)
+	}
+	result &= mask
+
+	var flags uint16
+	switch op {
+	case opAdd:
+		if uint64(dst&mask)+uint64(src&mask)+uint64(carry) >= uint64(1)<<bits {
+			flags |= flagCF
+		}
+		sum := signed(dst) + signed(src) + int64(carry)
+		if sum != signed(result) {
+			flags |= flagOF
+		}
+		if (dst&0x0F)+(src&0x0F)+carry > 0x0F {
+			flags |= flagAF
+		}
+	case opSub:
+		if int64(dst&mask)-int64(src&mask)-int64(carry) < 0 {
+			flags |= flagCF
+		}
+		difference := signed(dst) - signed(src) - int64(carry)
+		if difference != signed(result) {
+			flags |= flagOF
+		}
+		if int32(dst&0x0F)-int32(src&0x0F)-int32(carry) < 0 {
+			flags |= flagAF
+		}
+	}
+	if result == 0 {
+		flags |= flagZF
+	}
+	if result>>(bits-1) != 0 {
+		flags |= flagSF
+	}
+	ones := 0
+	for i := 0; i < 8; i++ {
+		if result&(1<<uint(i)) != 0 {
+			ones++
+		}
+	}
+	if ones%2 == 0 {
+		flags |= flagPF
+	}
+	return flags
+}
+
+// SetFlagCheck turns the flag check on or off. While it is on, every
+// change to the status flags is also computed eagerly by eagerFlags, and
+// after each instruction the lazily evaluated flags are compared with
+// that result. Mismatches are reported and counted.
+func (e *Executor) SetFlagCheck(enabled bool) {
+	e.cpu.Flags.check = enabled
+	e.cpu.Flags.eager = e.cpu.Flags.status()
+}
+
+func (e *Executor) FlagCheck() bool {
+	return e.cpu.Flags.check
+}
+
+// FlagMismatches returns the number of instructions after which the flag
+// check found the lazy and eager flags different.
+func (e *Executor) FlagMismatches() uint64 {
+	return e.flagMismatches
+}
+
+func (e *Executor) checkFlags(inst *Instruction, cs, ip uint16) {
+	lazy := e.cpu.Flags.status()
+	if lazy == e.cpu.Flags.eager {
+		return
+	}
+	e.flagMismatches++
+	fmt.Printf("Flag check: %s at %04X:%04X: lazy %s, eager %s\n",
+		inst, cs, ip, statusString(lazy), statusString(e.cpu.Flags.eager))
+	e.cpu.Flags.eager = lazy
+}
+
+// statusString shows the status flags as the letters OSZAPC, with a dash
+// for each flag that is clear.
+func statusString(bits uint16) string {
+	letters := []byte("OSZAPC")
+	for i, flag := range []uint16{flagOF, flagSF, flagZF, flagAF, flagPF, flagCF} {
+		if bits&flag == 0 {
+			letters[i] = '-'
+		}
+	}
+	return string(letters)
+}
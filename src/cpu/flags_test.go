@@ -0,0 +1,344 @@
+package cpu
+
+import (
+	"testing"
+
+	"dos-emulator/ioport"
+	"dos-emulator/memory"
+)
+
+// testHost is the Host of executors under test, whose code raises no
+// interrupts.
+type testHost struct{}
+
+func (testHost) HandleInterrupt(intNum byte) {}
+func (testHost) Halt()                       {}
+
+// newTestExecutor returns an 80386 executor with code to be placed at
+// CS:IP 0100:0000.
+func newTestExecutor() (*Executor, *CPU, *memory.Memory) {
+	mem := memory.New()
+	c := &CPU{CS: 0x0100, SS: 0x2000, SP: 0xFFFE}
+	e := NewExecutor(c, mem, ioport.New(), NewInstructionDecoder(mem), testHost{})
+	e.SetModel(Model80386)
+	return e, c, mem
+}
+
+// run executes the instructions in code one by one from CS:0.
+func run(e *Executor, c *CPU, mem *memory.Memory, code []byte) {
+	base := memory.CalculateAddress(c.CS, 0)
+	for i, b := range code {
+		mem.Write8(base+uint32(i), b)
+	}
+	c.IP = 0
+	for uint32(c.IP) < uint32(len(code)) {
+		e.Execute(e.decoder.Decode(c.CS, c.IP))
+	}
+}
+
+// baselineResultFlags computes ZF, SF and PF of a result the way
+// UpdateArithmeticFlags16 and UpdateArithmeticFlags8 did before the
+// flags became lazy: zero test, top bit, and a count of the one bits in
+// the low byte.
+func baselineResultFlags(result uint32, size int) uint16 {
+	var flags uint16
+	if result&sizeMask(size) == 0 {
+		flags |= flagZF
+	}
+	if result&signBit(size) != 0 {
+		flags |= flagSF
+	}
+	count := 0
+	value := byte(result & 0xFF)
+	for i := 0; i < 8; i++ {
+		if (value & (1 << uint(i))) != 0 {
+			count++
+		}
+	}
+	if count%2 == 0 {
+		flags |= flagPF
+	}
+	return flags
+}
+
+// flagInstruction is an instruction under test in its register form:
+// opcode is the byte form, opcode+1 the word and doubleword form. The
+// destination is AL, AX or EAX; the source BL, BX or EBX, or CL for the
+// shifts.
+type flagInstruction struct {
+	name   string
+	opcode byte
+	modRM  byte
+}
+
+var flagInstructions = []flagInstruction{
+	{"ADD", 0x00, 0xD8}, {"ADC", 0x10, 0xD8}, {"SUB", 0x28, 0xD8}, {"SBB", 0x18, 0xD8},
+	{"CMP", 0x38, 0xD8}, {"AND", 0x20, 0xD8}, {"OR", 0x08, 0xD8}, {"XOR", 0x30, 0xD8},
+	{"TEST", 0x84, 0xD8}, {"INC", 0xFE, 0xC0}, {"DEC", 0xFE, 0xC8}, {"NEG", 0xF6, 0xD8},
+	{"MUL", 0xF6, 0xE3}, {"IMUL", 0xF6, 0xEB},
+	{"ROL", 0xD2, 0xC0}, {"ROR", 0xD2, 0xC8}, {"RCL", 0xD2, 0xD0}, {"RCR", 0xD2, 0xD8},
+	{"SHL", 0xD2, 0xE0}, {"SHR", 0xD2, 0xE8}, {"SAR", 0xD2, 0xF8},
+}
+
+func (fi flagInstruction) shift() bool { return fi.opcode == 0xD2 }
+
+// referenceFlags returns the status flags fi leaves after operating on a
+// and b with carry in, where before holds the flags it started with, and
+// the mask of flags the processor defines for these operands.
+func referenceFlags(fi flagInstruction, size int, a, b uint32, carry bool, before uint16) (uint16, uint16) {
+	bits := uint(size * 8)
+	mask := sizeMask(size)
+	sign := signBit(size)
+	signed := func(v uint32) int64 { return signExtend(v&mask, size) }
+	fits := func(v int64) bool { return v >= -int64(sign) && v < int64(sign) }
+	c := uint32(0)
+	if carry {
+		c = 1
+	}
+	flag := func(bit uint16, set bool) uint16 {
+		if set {
+			return bit
+		}
+		return 0
+	}
+
+	var flags uint16
+	switch fi.name {
+	case "ADD", "ADC", "INC":
+		if fi.name == "ADD" {
+			c = 0
+		}
+		if fi.name == "INC" {
+			b, c = 1, 0
+		}
+		r := (a + b + c) & mask
+		flags = baselineResultFlags(r, size) |
+			flag(flagCF, uint64(a)+uint64(b)+uint64(c) > uint64(mask)) |
+			flag(flagOF, !fits(signed(a)+signed(b)+int64(c))) |
+			flag(flagAF, a&0x0F+b&0x0F+c > 0x0F)
+		if fi.name == "INC" {
+			flags = flags&^flagCF | before&flagCF
+		}
+	case "SUB", "SBB", "CMP", "DEC", "NEG":
+		switch fi.name {
+		case "SUB", "CMP":
+			c = 0
+		case "DEC":
+			b, c = 1, 0
+		case "NEG":
+			a, b, c = 0, a, 0
+		}
+		r := (a - b - c) & mask
+		flags = baselineResultFlags(r, size) |
+			flag(flagCF, uint64(a) < uint64(b)+uint64(c)) |
+			flag(flagOF, !fits(signed(a)-signed(b)-int64(c))) |
+			flag(flagAF, a&0x0F < b&0x0F+c)
+		if fi.name == "DEC" {
+			flags = flags&^flagCF | before&flagCF
+		}
+	case "AND", "TEST":
+		return baselineResultFlags(a&b, size), statusFlags &^ flagAF
+	case "OR":
+		return baselineResultFlags(a|b, size), statusFlags &^ flagAF
+	case "XOR":
+		return baselineResultFlags(a^b, size), statusFlags &^ flagAF
+	case "MUL":
+		high := uint64(a&mask) * uint64(b&mask) >> bits
+		return flag(flagCF|flagOF, high != 0), flagCF | flagOF
+	case "IMUL":
+		return flag(flagCF|flagOF, !fits(signed(a)*signed(b))), flagCF | flagOF
+	default:
+		return referenceShiftFlags(fi.name, size, a, b&0x1F, carry, before)
+	}
+	return flags, statusFlags
+}
+
+// referenceShiftFlags is referenceFlags for the rotates and shifts, by
+// count bits. OF is only defined for a count of 1, and CF not for shifts
+// past the end of the operand.
+func referenceShiftFlags(name string, size int, a, count uint32, carry bool, before uint16) (uint16, uint16) {
+	if count == 0 {
+		return before, statusFlags
+	}
+	bits := uint32(size * 8)
+	mask := sizeMask(size)
+	sign := signBit(size)
+	a &= mask
+
+	var r uint32
+	var cf bool
+	defined := uint16(flagCF | flagOF)
+	switch name {
+	case "ROL", "ROR":
+		n := count % bits
+		if name == "ROR" {
+			n = (bits - n) % bits
+		}
+		r = (a<<n | a>>(bits-n)) & mask
+		if name == "ROL" {
+			cf = r&1 != 0
+		} else {
+			cf = r&sign != 0
+		}
+	case "RCL", "RCR":
+		// Rotate the bits+1 bit value CF:a.
+		width := bits + 1
+		v := uint64(a)
+		if carry {
+			v |= 1 << bits
+		}
+		n := count % width
+		if name == "RCR" {
+			n = (width - n) % width
+		}
+		v = (v<<n | v>>(width-n)) & (1<<width - 1)
+		r, cf = uint32(v)&mask, v>>bits != 0
+	case "SHL":
+		r = uint32(uint64(a) << count & uint64(mask))
+		cf = count <= bits && a>>(bits-count)&1 != 0
+	case "SHR":
+		r = uint32(uint64(a) >> count)
+		cf = count <= bits && a>>(count-1)&1 != 0
+	case "SAR":
+		s := signExtend(a, size)
+		r = uint32(s>>count) & mask
+		cf = s>>(count-1)&1 != 0
+	}
+
+	var of bool
+	switch name {
+	case "ROL", "RCL", "SHL":
+		of = (r&sign != 0) != cf
+	case "ROR", "RCR":
+		of = (r^r<<1)&sign != 0
+	case "SHR":
+		of = a&sign != 0
+	}
+
+	flags := before &^ (flagCF | flagOF)
+	if cf {
+		flags |= flagCF
+	}
+	if of {
+		flags |= flagOF
+	}
+	if name == "SHL" || name == "SHR" || name == "SAR" {
+		flags = flags&^resultFlags | baselineResultFlags(r, size)
+		defined |= resultFlags
+		if count > bits && name != "SAR" {
+			defined &^= flagCF
+		}
+	} else {
+		defined |= resultFlags | flagAF
+	}
+	if count != 1 {
+		defined &^= flagOF
+	}
+	return flags, defined
+}
+
+// flagOperands returns edge values for an operand of size bytes: zero,
+// the nibble carry points, the values around the sign bit and the top,
+// and alternating bit patterns.
+func flagOperands(size int) []uint32 {
+	mask, sign := sizeMask(size), signBit(size)
+	var values []uint32
+	seen := map[uint32]bool{}
+	for _, v := range []uint32{0, 1, 2, 0x0F, 0x10, 0x7F, 0x80, 0xFF, sign - 1, sign, sign + 1, mask - 1, mask, 0x5A5A5A5A, 0xA5A5A5A5} {
+		v &= mask
+		if !seen[v] {
+			seen[v] = true
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// shiftCounts are the CL values the rotates and shifts are run with.
+var shiftCounts = []uint32{0, 1, 2, 3, 7, 8, 9, 15, 16, 17, 31, 32, 33}
+
+// TestFlags runs every instruction that sets the arithmetic flags over
+// edge-case operands in all three sizes and compares the lazily
+// evaluated CF, PF, AF, ZF, SF and OF with the reference computation and
+// with the executor's own eager flag check.
+func TestFlags(t *testing.T) {
+	e, c, mem := newTestExecutor()
+	e.SetFlagCheck(true)
+	failures := 0
+
+	for _, size := range []int{1, 2, 4} {
+		for _, fi := range flagInstructions {
+			opcode := fi.opcode
+			var code []byte
+			// CMP DL, DH leaves CF pending, as most instructions find it.
+			code = append(code, 0x38, 0xF2)
+			if size == 4 {
+				code = append(code, 0x66)
+			}
+			if size > 1 {
+				opcode++
+			}
+			code = append(code, opcode, fi.modRM)
+
+			sources := flagOperands(size)
+			if fi.shift() {
+				sources = shiftCounts
+			}
+			for _, a := range flagOperands(size) {
+				for _, b := range sources {
+					for _, carry := range []bool{false, true} {
+						c.SetRegister32(0, a)
+						c.SetRegister32(3, b)
+						c.SetRegister32(1, b)
+						// CMP 0, 0 or CMP 0, 1.
+						c.DX = 0
+						before := uint16(flagZF | flagPF)
+						if carry {
+							c.DX, before = 0x0100, flagCF|flagPF|flagAF|flagSF
+						}
+
+						run(e, c, mem, code)
+						got := c.Flags.ToUint16() & statusFlags
+						want, defined := referenceFlags(fi, size, a, b, carry, before)
+						if got&defined != want&defined {
+							t.Errorf("%s size %d a=%X b=%X CF=%v: flags %s, want %s (of %s)",
+								fi.name, size, a, b, carry, statusString(got), statusString(want), statusString(defined))
+							if failures++; failures > 20 {
+								t.FailNow()
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+	if n := e.FlagMismatches(); n != 0 {
+		t.Errorf("flag check found %d mismatches between lazy and eager flags", n)
+	}
+}
+
+// TestFlagsPreserved checks that the flags an instruction leaves alone
+// keep the values the previous instruction left pending.
+func TestFlagsPreserved(t *testing.T) {
+	e, c, mem := newTestExecutor()
+	tests := []struct {
+		name       string
+		code       []byte
+		ax, bx, cx uint16
+		want       uint16
+	}{
+		// ADD AL, BL carries out; INC CL keeps CF.
+		{"INC", []byte{0x00, 0xD8, 0xFE, 0xC1}, 0x00FF, 0x0001, 0x0001, flagCF},
+		// SUB AL, BL borrows; DEC CL keeps CF and sets ZF.
+		{"DEC", []byte{0x28, 0xD8, 0xFE, 0xC9}, 0x0000, 0x0001, 0x0001, flagCF | flagZF | flagPF},
+		// ADD AL, BL gives 0; ROL CL, 1 replaces CF and keeps the rest.
+		{"ROL", []byte{0x00, 0xD8, 0xD0, 0xC1}, 0x00FF, 0x0001, 0x0002, flagZF | flagPF | flagAF},
+	}
+	for _, test := range tests {
+		c.AX, c.BX, c.CX = test.ax, test.bx, test.cx
+		run(e, c, mem, test.code)
+		if got := c.Flags.ToUint16() & statusFlags; got != test.want {
+			t.Errorf("%s: flags %s, want %s", test.name, statusString(got), statusString(test.want))
+		}
+	}
+}
@@ -0,0 +1,468 @@
+package cpu
+
+import (
+	"math"
+	"strings"
+)
+
+// FPU is an 8087/80287-compatible numeric coprocessor. Registers hold
+// float64 values, so arithmetic carries 53 rather than 64 mantissa bits;
+// a value loaded with FLD tbyte and stored again unchanged keeps its
+// exact 80-bit image.
+type FPU struct {
+	st      [8]float64
+	raw     [8][10]byte // 80-bit image of st[i] while rawOK[i]
+	rawOK   [8]bool
+	empty   [8]bool
+	top     int
+	control uint16
+	status  uint16
+}
+
+// Status word bits.
+const (
+	fpuInvalid      = 0x0001
+	fpuZeroDivide   = 0x0004
+	fpuOverflow     = 0x0008
+	fpuPrecision    = 0x0020
+	fpuStackFault   = 0x0040
+	fpuErrorSummary = 0x0080
+	fpuC0           = 0x0100
+	fpuC1           = 0x0200
+	fpuC2           = 0x0400
+	fpuC3           = 0x4000
+	fpuConditions   = fpuC0 | fpuC1 | fpuC2 | fpuC3
+)
+
+// Rounding control values (control word bits 10-11).
+const (
+	roundNearest = 0
+	roundDown    = 1
+	roundUp      = 2
+	roundChop    = 3
+)
+
+func NewFPU() *FPU {
+	f := &FPU{}
+	f.Reset()
+	return f
+}
+
+// Reset performs FINIT: all exceptions masked, round to nearest, 64-bit
+// precision and an empty register stack.
+func (f *FPU) Reset() {
+	f.control = 0x037F
+	f.status = 0
+	f.top = 0
+	for i := range f.empty {
+		f.empty[i] = true
+		f.rawOK[i] = false
+	}
+}
+
+// exception records the exception bits in the status word, setting the
+// error summary bit for those not masked in the control word. Unmasked
+// exceptions are not delivered as interrupts; the masked response is
+// always used.
+func (f *FPU) exception(bits uint16) {
+	f.status |= bits
+	if bits&^f.control&0x3F != 0 {
+		f.status |= fpuErrorSummary
+	}
+}
+
+func (f *FPU) setConditions(bits uint16) {
+	f.status = f.status&^fpuConditions | bits
+}
+
+func (f *FPU) reg(i int) int {
+	return (f.top + i) & 7
+}
+
+// get returns ST(i). Reading an empty register is a stack underflow and
+// yields the indefinite NaN.
+func (f *FPU) get(i int) float64 {
+	r := f.reg(i)
+	if f.empty[r] {
+		f.exception(fpuInvalid | fpuStackFault)
+		f.status &^= fpuC1
+		return math.NaN()
+	}
+	return f.st[r]
+}
+
+func (f *FPU) set(i int, value float64) {
+	r := f.reg(i)
+	f.st[r] = value
+	f.empty[r] = false
+	f.rawOK[r] = false
+}
+
+func (f *FPU) push(value float64) {
+	f.top = (f.top - 1) & 7
+	if !f.empty[f.top] {
+		f.exception(fpuInvalid | fpuStackFault)
+		f.status |= fpuC1
+		value = math.NaN()
+	}
+	f.set(0, value)
+}
+
+func (f *FPU) pop() {
+	f.empty[f.top] = true
+	f.rawOK[f.top] = false
+	f.top = (f.top + 1) & 7
+}
+
+func (f *FPU) roundingMode() uint16 {
+	return (f.control >> 10) & 3
+}
+
+// round rounds value to an integer using the rounding control.
+func (f *FPU) round(value float64) float64 {
+	switch f.roundingMode() {
+	case roundDown:
+		return math.Floor(value)
+	case roundUp:
+		return math.Ceil(value)
+	case roundChop:
+		return math.Trunc(value)
+	}
+	return math.RoundToEven(value)
+}
+
+// StatusWord returns the status word with the current stack top.
+func (f *FPU) StatusWord() uint16 {
+	return f.status&^0x3800 | uint16(f.top)<<11
+}
+
+// TagWord returns the tag word: 00 valid, 01 zero, 10 special, 11 empty
+// for each physical register.
+func (f *FPU) TagWord() uint16 {
+	var tags uint16
+	for r := 7; r >= 0; r-- {
+		tags <<= 2
+		value := f.st[r]
+		switch {
+		case f.empty[r]:
+			tags |= 3
+		case value == 0:
+			tags |= 1
+		case math.IsNaN(value) || math.IsInf(value, 0):
+			tags |= 2
+		}
+	}
+	return tags
+}
+
+func (f *FPU) setTagWord(tags uint16) {
+	for r := 0; r < 8; r++ {
+		f.empty[r] = (tags>>(2*r))&3 == 3
+	}
+}
+
+// compare sets C3, C2 and C0 as FCOM does for a compared with b.
+func (f *FPU) compare(a, b float64) {
+	switch {
+	case math.IsNaN(a) || math.IsNaN(b):
+		f.exception(fpuInvalid)
+		f.setConditions(fpuC3 | fpuC2 | fpuC0)
+	case a > b:
+		f.setConditions(0)
+	case a < b:
+		f.setConditions(fpuC0)
+	default:
+		f.setConditions(fpuC3)
+	}
+}
+
+// examine sets the condition codes as FXAM does for ST(0).
+func (f *FPU) examine() {
+	r := f.reg(0)
+	value := f.st[r]
+	var bits uint16
+	switch {
+	case f.empty[r]:
+		bits = fpuC3 | fpuC0
+	case math.IsNaN(value):
+		bits = fpuC0
+	case math.IsInf(value, 0):
+		bits = fpuC2 | fpuC0
+	case value == 0:
+		bits = fpuC3
+	case math.Abs(value) < 0x1p-1022:
+		bits = fpuC3 | fpuC2
+	default:
+		bits = fpuC2
+	}
+	if math.Signbit(value) && !f.empty[r] {
+		bits |= fpuC1
+	}
+	f.setConditions(bits)
+}
+
+// arithmetic applies operation op in the order of the reg field of
+// opcodes D8h and DCh (ADD, MUL, COM, COMP, SUB, SUBR, DIV, DIVR) to
+// dest and src and returns the result. The compare forms return dest.
+func (f *FPU) arithmetic(op byte, dest, src float64) float64 {
+	switch op {
+	case 0:
+		if math.IsInf(dest, 0) && math.IsInf(src, 0) && math.Signbit(dest) != math.Signbit(src) {
+			f.exception(fpuInvalid)
+		}
+		return dest + src
+	case 1:
+		return dest * src
+	case 2, 3:
+		f.compare(dest, src)
+		return dest
+	case 4:
+		return dest - src
+	case 5:
+		return src - dest
+	case 6:
+		return f.divide(dest, src)
+	}
+	return f.divide(src, dest)
+}
+
+func (f *FPU) divide(a, b float64) float64 {
+	if b == 0 {
+		if a == 0 || math.IsNaN(a) {
+			f.exception(fpuInvalid)
+			return math.NaN()
+		}
+		f.exception(fpuZeroDivide)
+	}
+	return a / b
+}
+
+// toInteger converts value to a signed integer of bits width using the
+// rounding control. Values that do not fit give the integer indefinite
+// (the most negative number) and an invalid operation exception.
+func (f *FPU) toInteger(value float64, bits uint) int64 {
+	rounded := f.round(value)
+	limit := math.Ldexp(1, int(bits-1))
+	if math.IsNaN(rounded) || rounded >= limit || rounded < -limit {
+		f.exception(fpuInvalid)
+		return -1 << (bits - 1)
+	}
+	if rounded != value {
+		f.exception(fpuPrecision)
+	}
+	return int64(rounded)
+}
+
+// extendedToFloat converts an 80-bit extended precision value.
+func extendedToFloat(b [10]byte) float64 {
+	var mantissa uint64
+	for i := 7; i >= 0; i-- {
+		mantissa = mantissa<<8 | uint64(b[i])
+	}
+	exponent := int(b[8]) | int(b[9]&0x7F)<<8
+	negative := b[9]&0x80 != 0
+
+	var value float64
+	switch {
+	case exponent == 0x7FFF && mantissa<<1 == 0:
+		value = math.Inf(1)
+	case exponent == 0x7FFF:
+		value = math.NaN()
+	case exponent == 0:
+		value = math.Ldexp(float64(mantissa), -16382-63)
+	default:
+		value = math.Ldexp(float64(mantissa), exponent-16383-63)
+	}
+	if negative {
+		value = -value
+	}
+	return value
+}
+
+// floatToExtended converts value to the 80-bit extended precision format.
+func floatToExtended(value float64) [10]byte {
+	var b [10]byte
+	var exponent int
+	var mantissa uint64
+
+	switch {
+	case math.IsNaN(value):
+		exponent = 0x7FFF
+		mantissa = 0xC000000000000000
+	case math.IsInf(value, 0):
+		exponent = 0x7FFF
+		mantissa = 0x8000000000000000
+	case value != 0:
+		frac, exp := math.Frexp(math.Abs(value))
+		mantissa = uint64(math.Ldexp(frac, 64))
+		exponent = exp - 1 + 16383
+	}
+
+	for i := 0; i < 8; i++ {
+		b[i] = byte(mantissa >> (8 * i))
+	}
+	b[8] = byte(exponent)
+	b[9] = byte(exponent >> 8)
+	if math.Signbit(value) {
+		b[9] |= 0x80
+	}
+	return b
+}
+
+// bcdToFloat converts an 18-digit packed BCD integer (FBLD).
+func bcdToFloat(b [10]byte) float64 {
+	var value float64
+	for i := 8; i >= 0; i-- {
+		value = value*100 + float64(b[i]>>4)*10 + float64(b[i]&0x0F)
+	}
+	if b[9]&0x80 != 0 {
+		value = -value
+	}
+	return value
+}
+
+// floatToBCD converts an integral value to 18-digit packed BCD (FBSTP).
+// It reports false if the value has more than 18 digits.
+func floatToBCD(value float64) ([10]byte, bool) {
+	var b [10]byte
+	if math.IsNaN(value) || math.Abs(value) >= 1e18 {
+		return [10]byte{0, 0, 0, 0, 0, 0, 0, 0, 0xC0, 0xFF}, false
+	}
+	if math.Signbit(value) {
+		b[9] = 0x80
+	}
+	n := uint64(math.Abs(value))
+	for i := 0; i < 9; i++ {
+		low := n % 10
+		n /= 10
+		high := n % 10
+		n /= 10
+		b[i] = byte(high<<4 | low)
+	}
+	return b, true
+}
+
+var fpuConstants = map[byte]float64{
+	0xE8: 1,
+	0xE9: math.Log2(10),
+	0xEA: math.Log2E,
+	0xEB: math.Pi,
+	0xEC: math.Log10(2),
+	0xED: math.Ln2,
+	0xEE: 0,
+}
+
+// fpuMemoryNames are the mnemonics of the memory forms of D8h-DFh,
+// indexed by (opcode-D8h)*8 + reg.
+var fpuMemoryNames = [64]string{
+	"FADD", "FMUL", "FCOM", "FCOMP", "FSUB", "FSUBR", "FDIV", "FDIVR",
+	"FLD", "", "FST", "FSTP", "FLDENV", "FLDCW", "FNSTENV", "FNSTCW",
+	"FIADD", "FIMUL", "FICOM", "FICOMP", "FISUB", "FISUBR", "FIDIV", "FIDIVR",
+	"FILD", "", "FIST", "FISTP", "", "FLD", "", "FSTP",
+	"FADD", "FMUL", "FCOM", "FCOMP", "FSUB", "FSUBR", "FDIV", "FDIVR",
+	"FLD", "", "FST", "FSTP", "FRSTOR", "", "FNSAVE", "FNSTSW",
+	"FIADD", "FIMUL", "FICOM", "FICOMP", "FISUB", "FISUBR", "FIDIV", "FIDIVR",
+	"FILD", "", "FIST", "FISTP", "FBLD", "FILD", "FBSTP", "FISTP",
+}
+
+// fpuMemorySizes are the usual operand sizes in bytes of the memory
+// forms of D8h-DFh; FLD/FSTP tbyte, FBLD/FBSTP and the 64-bit integer
+// forms of DFh are the exceptions.
+var fpuMemorySizes = [8]int{4, 4, 4, 4, 8, 8, 2, 2}
+
+// fpuMemorySize returns the size in bytes of the memory operand of the
+// ESC opcode with the given reg field, or 0 for the environment and state
+// forms, which have no fixed size.
+func fpuMemorySize(opcode, reg byte) int {
+	switch {
+	case (opcode == 0xD9 || opcode == 0xDD) && reg >= 4:
+		return map[byte]int{5: 2, 7: 2}[reg] // FLDCW, FNSTCW, FNSTSW
+	case opcode == 0xDB && reg >= 5, opcode == 0xDF && (reg == 4 || reg == 6):
+		return 10
+	case opcode == 0xDF && (reg == 5 || reg == 7):
+		return 8
+	}
+	return fpuMemorySizes[opcode-0xD8]
+}
+
+// fpuRegisterNames are the mnemonics of the register forms of D8h, DCh
+// and DEh by reg field. The DCh and DEh forms swap SUB/SUBR and DIV/DIVR.
+var fpuRegisterNames = [8]string{"FADD", "FMUL", "FCOM", "FCOMP", "FSUB", "FSUBR", "FDIV", "FDIVR"}
+
+var fpuD9Names = map[byte]string{
+	0xD0: "FNOP", 0xE0: "FCHS", 0xE1: "FABS", 0xE4: "FTST", 0xE5: "FXAM",
+	0xE8: "FLD1", 0xE9: "FLDL2T", 0xEA: "FLDL2E", 0xEB: "FLDPI",
+	0xEC: "FLDLG2", 0xED: "FLDLN2", 0xEE: "FLDZ",
+	0xF0: "F2XM1", 0xF1: "FYL2X", 0xF2: "FPTAN", 0xF3: "FPATAN",
+	0xF4: "FXTRACT", 0xF5: "FPREM1", 0xF6: "FDECSTP", 0xF7: "FINCSTP",
+	0xF8: "FPREM", 0xF9: "FYL2XP1", 0xFA: "FSQRT", 0xFB: "FSINCOS",
+	0xFC: "FRNDINT", 0xFD: "FSCALE", 0xFE: "FSIN", 0xFF: "FCOS",
+}
+
+// fpuName returns the mnemonic of the coprocessor instruction with the
+// given ESC opcode and ModRM byte, or "" if it is undefined.
+func fpuName(opcode, modrm byte) string {
+	reg := (modrm >> 3) & 0x07
+	if modrm < 0xC0 {
+		return fpuMemoryNames[(opcode-0xD8)*8+reg]
+	}
+	i := string('0' + modrm&0x07)
+	switch opcode {
+	case 0xD8:
+		return fpuRegisterNames[reg] + " ST, ST(" + i + ")"
+	case 0xD9:
+		switch reg {
+		case 0:
+			return "FLD ST(" + i + ")"
+		case 1:
+			return "FXCH ST(" + i + ")"
+		}
+		return fpuD9Names[modrm]
+	case 0xDA:
+		if modrm == 0xE9 {
+			return "FUCOMPP"
+		}
+	case 0xDB:
+		return map[byte]string{0xE0: "FNENI", 0xE1: "FNDISI", 0xE2: "FNCLEX", 0xE3: "FNINIT", 0xE4: "FSETPM"}[modrm]
+	case 0xDC:
+		return fpuRegisterNames[reg^boolToByte(reg >= 4)] + " ST(" + i + "), ST"
+	case 0xDD:
+		if name := []string{"FFREE", "", "FST", "FSTP", "FUCOM", "FUCOMP", "", ""}[reg]; name != "" {
+			return name + " ST(" + i + ")"
+		}
+	case 0xDE:
+		if modrm == 0xD9 {
+			return "FCOMPP"
+		}
+		return fpuRegisterNames[reg^boolToByte(reg >= 4)] + "P ST(" + i + "), ST"
+	case 0xDF:
+		if modrm == 0xE0 {
+			return "FNSTSW AX"
+		}
+	}
+	return ""
+}
+
+// splitFPUName splits the name fpuName gives a register form into the
+// mnemonic and the operands, with the stack registers written as NASM
+// writes them ("ST0", "ST1").
+func splitFPUName(text string) (string, []string) {
+	name, rest, _ := strings.Cut(text, " ")
+	var operands []string
+	if rest != "" {
+		for _, operand := range strings.Split(rest, ", ") {
+			if operand == "ST" {
+				operand = "ST0"
+			}
+			operands = append(operands, strings.NewReplacer("(", "", ")", "").Replace(operand))
+		}
+	}
+	return name, operands
+}
+
+func boolToByte(b bool) byte {
+	if b {
+		return 1
+	}
+	return 0
+}
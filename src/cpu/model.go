@@ -0,0 +1,42 @@
+package cpu
+
+import "fmt"
+
+// Model selects which processor generation the executor behaves like.
+type Model int
+
+const (
+	Model8086 Model = iota
+	Model80186
+	Model80286
+	Model80386
+)
+
+var modelNames = map[Model]string{
+	Model8086:  "8086",
+	Model80186: "80186",
+	Model80286: "80286",
+	Model80386: "80386",
+}
+
+func (m Model) String() string {
+	if name, ok := modelNames[m]; ok {
+		return name
+	}
+	return fmt.Sprintf("Model(%d)", int(m))
+}
+
+// ParseModel converts a name such as "8086", "186" or "80286" to a Model.
+func ParseModel(name string) (Model, error) {
+	switch name {
+	case "8086", "8088":
+		return Model8086, nil
+	case "186", "80186", "80188":
+		return Model80186, nil
+	case "286", "80286":
+		return Model80286, nil
+	case "386", "80386":
+		return Model80386, nil
+	}
+	return 0, fmt.Errorf("unknown CPU model %q (use 8086, 80186, 80286 or 80386)", name)
+}
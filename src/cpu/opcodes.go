@@ -0,0 +1,396 @@
+package cpu
+
+// operandKind describes an operand of an instruction form, after the
+// operand codes of Intel's opcode maps (given in the comments). The kinds
+// tell the decoder which bytes follow the opcode, the executor where to
+// find the operands, and the disassembler how to show them. Word kinds
+// become doublewords under a 66h prefix.
+type operandKind byte
+
+const (
+	noOperand operandKind = iota
+
+	// Operands addressed by a ModRM byte.
+	rmByte   // Eb: byte register or memory
+	rmWord   // Ev: word register or memory
+	rmWord16 // Ew: word register or memory regardless of operand size
+	memOnly  // M: memory only (LEA, BOUND)
+	memFar   // Mp: far pointer in memory
+	memEsc   // coprocessor operand of an ESC instruction
+	regByte  // Gb: byte register in the reg field
+	regWord  // Gv: word register in the reg field
+	segReg   // Sw: segment register in the reg field
+
+	// Operands that follow the opcode and ModRM bytes.
+	immByte   // Ib
+	immSByte  // Ib, sign-extended to the operand size
+	immWord   // Iw
+	imm       // Iv
+	relByte   // Jb: signed offset from the next instruction
+	rel       // Jv
+	farImm    // Ap: offset and segment
+	moffsByte // Ob: byte at a direct offset
+	moffs     // Ov
+
+	// Operands implied by the opcode.
+	opRegByte // byte register in the low three bits of the opcode
+	opReg     // word register in the low three bits of the opcode
+	regAL
+	regCL
+	regDX
+	regAX // AX, or EAX under 66h
+	regES // regES..regGS follow the ModRM numbering
+	regCS
+	regSS
+	regDS
+	regFS
+	regGS
+	constOne
+	constThree
+	srcByte // Xb: DS:SI
+	src     // Xv
+	dstByte // Yb: ES:DI
+	dst     // Yv
+)
+
+// opcode is an entry of the opcode table: the mnemonic of an instruction
+// form, its operands, the first processor that has it and the function
+// that executes it. Entries for opcodes whose ModRM reg field selects the
+// instruction point to a group of eight entries instead. An entry without
+// a function is not emulated and is skipped.
+type opcode struct {
+	name     string
+	operands [3]operandKind
+	model    Model
+	exec     func(e *Executor, inst *Instruction)
+	group    *[8]opcode
+}
+
+// hasModRM reports whether the entry's opcode is followed by a ModRM
+// byte.
+func (op *opcode) hasModRM() bool {
+	if op.group != nil {
+		return true
+	}
+	for _, kind := range op.operands {
+		if kind >= rmByte && kind <= segReg {
+			return true
+		}
+	}
+	return false
+}
+
+// operandSize returns the size of the entry's operands in bytes: that of
+// its first operand with a size of its own, or the operand size (2, or 4
+// under 66h) if none has one. Immediates, counts and port numbers take
+// the size of the other operands.
+func (op *opcode) operandSize(size32 bool) int {
+	for _, kind := range op.operands {
+		switch kind {
+		case rmByte, regByte, moffsByte, opRegByte, regAL, srcByte, dstByte:
+			return 1
+		case rmWord16:
+			return 2
+		case rmWord, regWord, moffs, opReg, regAX, src, dst:
+			if size32 {
+				return 4
+			}
+			return 2
+		}
+	}
+	if size32 {
+		return 4
+	}
+	return 2
+}
+
+// kinds lists the operands of an entry.
+type kinds = [3]operandKind
+
+// undefinedOpcode is decoded for byte sequences no processor defines; it
+// is skipped. invalidOpcodeEntry stands for instructions the selected
+// processor lacks, which raise the invalid-opcode exception.
+var (
+	undefinedOpcode    = opcode{}
+	invalidOpcodeEntry = opcode{exec: (*Executor).invalidOpcode}
+)
+
+// popCS is what the 8086 executes for 0F, which later processors use as
+// the escape to the two-byte opcodes.
+var popCS = opcode{name: "POP", operands: kinds{regCS}, exec: (*Executor).pop}
+
+// opcodes is the one-byte opcode map. The regular rows are filled in by
+// init. Prefix bytes are consumed by the decoder and left empty.
+var opcodes = [256]opcode{
+	0x60: {name: "PUSHA", model: Model80186, exec: (*Executor).pusha},
+	0x61: {name: "POPA", model: Model80186, exec: (*Executor).popa},
+	0x62: {name: "BOUND", operands: kinds{regWord, memOnly}, model: Model80186, exec: (*Executor).bound},
+	0x63: {exec: (*Executor).invalidOpcode},
+	0x64: {exec: (*Executor).invalidOpcode},
+	0x65: {exec: (*Executor).invalidOpcode},
+	0x66: {exec: (*Executor).invalidOpcode},
+	0x67: {exec: (*Executor).invalidOpcode},
+	0x68: {name: "PUSH", operands: kinds{imm}, model: Model80186, exec: (*Executor).push},
+	0x69: {name: "IMUL", operands: kinds{regWord, rmWord, imm}, model: Model80186, exec: (*Executor).imulRegister},
+	0x6A: {name: "PUSH", operands: kinds{immSByte}, model: Model80186, exec: (*Executor).push},
+	0x6B: {name: "IMUL", operands: kinds{regWord, rmWord, immSByte}, model: Model80186, exec: (*Executor).imulRegister},
+	0x6C: {name: "INSB", operands: kinds{dstByte, regDX}, model: Model80186, exec: (*Executor).ins},
+	0x6D: {name: "INSW", operands: kinds{dst, regDX}, model: Model80186, exec: (*Executor).ins},
+	0x6E: {name: "OUTSB", operands: kinds{regDX, srcByte}, model: Model80186, exec: (*Executor).outs},
+	0x6F: {name: "OUTSW", operands: kinds{regDX, src}, model: Model80186, exec: (*Executor).outs},
+
+	0x80: {group: group1(rmByte, immByte)},
+	0x81: {group: group1(rmWord, imm)},
+	0x82: {group: group1(rmByte, immByte)},
+	0x83: {group: group1(rmWord, immSByte)},
+	0x84: {name: "TEST", operands: kinds{rmByte, regByte}, exec: (*Executor).test},
+	0x85: {name: "TEST", operands: kinds{rmWord, regWord}, exec: (*Executor).test},
+	0x86: {name: "XCHG", operands: kinds{rmByte, regByte}, exec: (*Executor).xchg},
+	0x87: {name: "XCHG", operands: kinds{rmWord, regWord}, exec: (*Executor).xchg},
+	0x88: {name: "MOV", operands: kinds{rmByte, regByte}, exec: (*Executor).mov},
+	0x89: {name: "MOV", operands: kinds{rmWord, regWord}, exec: (*Executor).mov},
+	0x8A: {name: "MOV", operands: kinds{regByte, rmByte}, exec: (*Executor).mov},
+	0x8B: {name: "MOV", operands: kinds{regWord, rmWord}, exec: (*Executor).mov},
+	0x8C: {name: "MOV", operands: kinds{rmWord16, segReg}, exec: (*Executor).mov},
+	0x8D: {name: "LEA", operands: kinds{regWord, memOnly}, exec: (*Executor).lea},
+	0x8E: {name: "MOV", operands: kinds{segReg, rmWord16}, exec: (*Executor).mov},
+	0x8F: {name: "POP", operands: kinds{rmWord}, exec: (*Executor).pop},
+
+	0x90: {name: "NOP", exec: (*Executor).nop},
+	0x98: {name: "CBW", exec: (*Executor).convert},
+	0x99: {name: "CWD", exec: (*Executor).convert},
+	0x9A: {name: "CALL FAR", operands: kinds{farImm}, exec: (*Executor).callFar},
+	0x9B: {name: "WAIT", exec: (*Executor).nop},
+	0x9C: {name: "PUSHF", exec: (*Executor).pushf},
+	0x9D: {name: "POPF", exec: (*Executor).popf},
+	0x9E: {name: "SAHF", exec: (*Executor).sahf},
+	0x9F: {name: "LAHF", exec: (*Executor).lahf},
+
+	0xA0: {name: "MOV", operands: kinds{regAL, moffsByte}, exec: (*Executor).mov},
+	0xA1: {name: "MOV", operands: kinds{regAX, moffs}, exec: (*Executor).mov},
+	0xA2: {name: "MOV", operands: kinds{moffsByte, regAL}, exec: (*Executor).mov},
+	0xA3: {name: "MOV", operands: kinds{moffs, regAX}, exec: (*Executor).mov},
+	0xA4: {name: "MOVSB", operands: kinds{dstByte, srcByte}, exec: (*Executor).stringMove},
+	0xA5: {name: "MOVSW", operands: kinds{dst, src}, exec: (*Executor).stringMove},
+	0xA6: {name: "CMPSB", operands: kinds{srcByte, dstByte}, exec: (*Executor).stringCompare},
+	0xA7: {name: "CMPSW", operands: kinds{src, dst}, exec: (*Executor).stringCompare},
+	0xA8: {name: "TEST", operands: kinds{regAL, immByte}, exec: (*Executor).test},
+	0xA9: {name: "TEST", operands: kinds{regAX, imm}, exec: (*Executor).test},
+	0xAA: {name: "STOSB", operands: kinds{dstByte, regAL}, exec: (*Executor).stringMove},
+	0xAB: {name: "STOSW", operands: kinds{dst, regAX}, exec: (*Executor).stringMove},
+	0xAC: {name: "LODSB", operands: kinds{regAL, srcByte}, exec: (*Executor).stringMove},
+	0xAD: {name: "LODSW", operands: kinds{regAX, src}, exec: (*Executor).stringMove},
+	0xAE: {name: "SCASB", operands: kinds{regAL, dstByte}, exec: (*Executor).stringCompare},
+	0xAF: {name: "SCASW", operands: kinds{regAX, dst}, exec: (*Executor).stringCompare},
+
+	0xC0: {model: Model80186, group: group2(rmByte, immByte)},
+	0xC1: {model: Model80186, group: group2(rmWord, immByte)},
+	0xC2: {name: "RET", operands: kinds{immWord}, exec: (*Executor).ret},
+	0xC3: {name: "RET", exec: (*Executor).ret},
+	0xC4: {name: "LES", operands: kinds{regWord, memFar}, exec: (*Executor).loadFar},
+	0xC5: {name: "LDS", operands: kinds{regWord, memFar}, exec: (*Executor).loadFar},
+	0xC6: {name: "MOV", operands: kinds{rmByte, immByte}, exec: (*Executor).mov},
+	0xC7: {name: "MOV", operands: kinds{rmWord, imm}, exec: (*Executor).mov},
+	0xC8: {name: "ENTER", operands: kinds{immWord, immByte}, model: Model80186, exec: (*Executor).enter},
+	0xC9: {name: "LEAVE", model: Model80186, exec: (*Executor).leave},
+	0xCA: {name: "RETF", operands: kinds{immWord}, exec: (*Executor).retFar},
+	0xCB: {name: "RETF", exec: (*Executor).retFar},
+	0xCC: {name: "INT", operands: kinds{constThree}, exec: (*Executor).interrupt},
+	0xCD: {name: "INT", operands: kinds{immByte}, exec: (*Executor).interrupt},
+	0xCE: {name: "INTO", exec: (*Executor).into},
+	0xCF: {name: "IRET", exec: (*Executor).iret},
+
+	0xD0: {group: group2(rmByte, constOne)},
+	0xD1: {group: group2(rmWord, constOne)},
+	0xD2: {group: group2(rmByte, regCL)},
+	0xD3: {group: group2(rmWord, regCL)},
+	0xD4: {name: "AAM", operands: kinds{immByte}, exec: (*Executor).aam},
+	0xD5: {name: "AAD", operands: kinds{immByte}, exec: (*Executor).aad},
+	0xD7: {name: "XLAT", exec: (*Executor).xlat},
+
+	0xE0: {name: "LOOPNE", operands: kinds{relByte}, exec: (*Executor).loop},
+	0xE1: {name: "LOOPE", operands: kinds{relByte}, exec: (*Executor).loop},
+	0xE2: {name: "LOOP", operands: kinds{relByte}, exec: (*Executor).loop},
+	0xE3: {name: "JCXZ", operands: kinds{relByte}, exec: (*Executor).loop},
+	0xE4: {name: "IN", operands: kinds{regAL, immByte}, exec: (*Executor).in},
+	0xE5: {name: "IN", operands: kinds{regAX, immByte}, exec: (*Executor).in},
+	0xE6: {name: "OUT", operands: kinds{immByte, regAL}, exec: (*Executor).out},
+	0xE7: {name: "OUT", operands: kinds{immByte, regAX}, exec: (*Executor).out},
+	0xE8: {name: "CALL", operands: kinds{rel}, exec: (*Executor).call},
+	0xE9: {name: "JMP", operands: kinds{rel}, exec: (*Executor).jump},
+	0xEA: {name: "JMP FAR", operands: kinds{farImm}, exec: (*Executor).jumpFar},
+	0xEB: {name: "JMP SHORT", operands: kinds{relByte}, exec: (*Executor).jump},
+	0xEC: {name: "IN", operands: kinds{regAL, regDX}, exec: (*Executor).in},
+	0xED: {name: "IN", operands: kinds{regAX, regDX}, exec: (*Executor).in},
+	0xEE: {name: "OUT", operands: kinds{regDX, regAL}, exec: (*Executor).out},
+	0xEF: {name: "OUT", operands: kinds{regDX, regAX}, exec: (*Executor).out},
+
+	0xF4: {name: "HLT", exec: (*Executor).hlt},
+	0xF5: {name: "CMC", exec: (*Executor).changeFlag},
+	0xF6: {group: group3(rmByte, immByte)},
+	0xF7: {group: group3(rmWord, imm)},
+	0xF8: {name: "CLC", exec: (*Executor).changeFlag},
+	0xF9: {name: "STC", exec: (*Executor).changeFlag},
+	0xFA: {name: "CLI", exec: (*Executor).changeFlag},
+	0xFB: {name: "STI", exec: (*Executor).changeFlag},
+	0xFC: {name: "CLD", exec: (*Executor).changeFlag},
+	0xFD: {name: "STD", exec: (*Executor).changeFlag},
+	0xFE: {group: &group4},
+	0xFF: {group: &group5},
+}
+
+// opcodes0F is the map of the two-byte opcodes 0F xx. Entries init does
+// not fill raise the invalid-opcode exception.
+var opcodes0F = [256]opcode{
+	0x01: {model: Model80286, group: &group7},
+	0xA0: {name: "PUSH", operands: kinds{regFS}, model: Model80386, exec: (*Executor).push},
+	0xA1: {name: "POP", operands: kinds{regFS}, model: Model80386, exec: (*Executor).pop},
+	0xA3: {name: "BT", operands: kinds{rmWord, regWord}, model: Model80386, exec: (*Executor).bitTest},
+	0xA4: {name: "SHLD", operands: kinds{rmWord, regWord, immByte}, model: Model80386, exec: (*Executor).doubleShift},
+	0xA5: {name: "SHLD", operands: kinds{rmWord, regWord, regCL}, model: Model80386, exec: (*Executor).doubleShift},
+	0xA8: {name: "PUSH", operands: kinds{regGS}, model: Model80386, exec: (*Executor).push},
+	0xA9: {name: "POP", operands: kinds{regGS}, model: Model80386, exec: (*Executor).pop},
+	0xAB: {name: "BTS", operands: kinds{rmWord, regWord}, model: Model80386, exec: (*Executor).bitTest},
+	0xAC: {name: "SHRD", operands: kinds{rmWord, regWord, immByte}, model: Model80386, exec: (*Executor).doubleShift},
+	0xAD: {name: "SHRD", operands: kinds{rmWord, regWord, regCL}, model: Model80386, exec: (*Executor).doubleShift},
+	0xAF: {name: "IMUL", operands: kinds{regWord, rmWord}, model: Model80386, exec: (*Executor).imulRegister},
+	0xB2: {name: "LSS", operands: kinds{regWord, memFar}, model: Model80386, exec: (*Executor).loadFar},
+	0xB3: {name: "BTR", operands: kinds{rmWord, regWord}, model: Model80386, exec: (*Executor).bitTest},
+	0xB4: {name: "LFS", operands: kinds{regWord, memFar}, model: Model80386, exec: (*Executor).loadFar},
+	0xB5: {name: "LGS", operands: kinds{regWord, memFar}, model: Model80386, exec: (*Executor).loadFar},
+	0xB6: {name: "MOVZX", operands: kinds{regWord, rmByte}, model: Model80386, exec: (*Executor).movzx},
+	0xB7: {name: "MOVZX", operands: kinds{regWord, rmWord16}, model: Model80386, exec: (*Executor).movzx},
+	0xBA: {model: Model80386, group: &group8},
+	0xBB: {name: "BTC", operands: kinds{rmWord, regWord}, model: Model80386, exec: (*Executor).bitTest},
+	0xBC: {name: "BSF", operands: kinds{regWord, rmWord}, model: Model80386, exec: (*Executor).bitScan},
+	0xBD: {name: "BSR", operands: kinds{regWord, rmWord}, model: Model80386, exec: (*Executor).bitScan},
+	0xBE: {name: "MOVSX", operands: kinds{regWord, rmByte}, model: Model80386, exec: (*Executor).movsx},
+	0xBF: {name: "MOVSX", operands: kinds{regWord, rmWord16}, model: Model80386, exec: (*Executor).movsx},
+}
+
+// group1 builds the immediate forms of ADD, OR, ADC, SBB, AND, SUB, XOR
+// and CMP (opcodes 80-83).
+func group1(rm, immediate operandKind) *[8]opcode {
+	var g [8]opcode
+	for i, name := range []string{"ADD", "OR", "ADC", "SBB", "AND", "SUB", "XOR", "CMP"} {
+		g[i] = opcode{name: name, operands: kinds{rm, immediate}, exec: (*Executor).arith}
+	}
+	return &g
+}
+
+// group2 builds the rotates and shifts of opcodes C0, C1 and D0-D3.
+func group2(rm, count operandKind) *[8]opcode {
+	var g [8]opcode
+	for i, name := range []string{"ROL", "ROR", "RCL", "RCR", "SHL", "SHR", "SAL", "SAR"} {
+		g[i] = opcode{name: name, operands: kinds{rm, count}, exec: (*Executor).shiftGroup}
+	}
+	return &g
+}
+
+// group3 builds TEST, NOT, NEG, MUL, IMUL, DIV and IDIV (opcodes F6 and
+// F7).
+func group3(rm, immediate operandKind) *[8]opcode {
+	return &[8]opcode{
+		{name: "TEST", operands: kinds{rm, immediate}, exec: (*Executor).test},
+		{name: "TEST", operands: kinds{rm, immediate}, exec: (*Executor).test},
+		{name: "NOT", operands: kinds{rm}, exec: (*Executor).not},
+		{name: "NEG", operands: kinds{rm}, exec: (*Executor).neg},
+		{name: "MUL", operands: kinds{rm}, exec: (*Executor).mul},
+		{name: "IMUL", operands: kinds{rm}, exec: (*Executor).imul},
+		{name: "DIV", operands: kinds{rm}, exec: (*Executor).div},
+		{name: "IDIV", operands: kinds{rm}, exec: (*Executor).idiv},
+	}
+}
+
+// group4 is opcode FE: INC and DEC of a byte, and at /7 the emulator's
+// TRAP escape, which the decoder only accepts as FE 38 nn.
+var group4 = [8]opcode{
+	{name: "INC", operands: kinds{rmByte}, exec: (*Executor).increment},
+	{name: "DEC", operands: kinds{rmByte}, exec: (*Executor).increment},
+	7: {name: "TRAP", operands: kinds{immByte}, exec: (*Executor).trap},
+}
+
+// group5 is opcode FF.
+var group5 = [8]opcode{
+	{name: "INC", operands: kinds{rmWord}, exec: (*Executor).increment},
+	{name: "DEC", operands: kinds{rmWord}, exec: (*Executor).increment},
+	{name: "CALL", operands: kinds{rmWord}, exec: (*Executor).callIndirect},
+	{name: "CALL FAR", operands: kinds{memFar}, exec: (*Executor).callFar},
+	{name: "JMP", operands: kinds{rmWord}, exec: (*Executor).jumpIndirect},
+	{name: "JMP FAR", operands: kinds{memFar}, exec: (*Executor).jumpFar},
+	{name: "PUSH", operands: kinds{rmWord}, exec: (*Executor).push},
+}
+
+// group7 is 0F 01, the system instructions of the 80286, of which only
+// SMSW is usable in real mode.
+var group7 = [8]opcode{
+	{name: "SGDT", operands: kinds{memOnly}, model: Model80286, exec: (*Executor).invalidOpcode},
+	{name: "SIDT", operands: kinds{memOnly}, model: Model80286, exec: (*Executor).invalidOpcode},
+	{name: "LGDT", operands: kinds{memOnly}, model: Model80286, exec: (*Executor).invalidOpcode},
+	{name: "LIDT", operands: kinds{memOnly}, model: Model80286, exec: (*Executor).invalidOpcode},
+	{name: "SMSW", operands: kinds{rmWord16}, model: Model80286, exec: (*Executor).smsw},
+	{model: Model80286, exec: (*Executor).invalidOpcode},
+	{name: "LMSW", operands: kinds{rmWord16}, model: Model80286, exec: (*Executor).invalidOpcode},
+	{model: Model80286, exec: (*Executor).invalidOpcode},
+}
+
+// group8 is 0F BA: the bit tests with an immediate bit number.
+var group8 = [8]opcode{
+	{model: Model80386, exec: (*Executor).invalidOpcode},
+	{model: Model80386, exec: (*Executor).invalidOpcode},
+	{model: Model80386, exec: (*Executor).invalidOpcode},
+	{model: Model80386, exec: (*Executor).invalidOpcode},
+	{name: "BT", operands: kinds{rmWord, immByte}, model: Model80386, exec: (*Executor).bitTest},
+	{name: "BTS", operands: kinds{rmWord, immByte}, model: Model80386, exec: (*Executor).bitTest},
+	{name: "BTR", operands: kinds{rmWord, immByte}, model: Model80386, exec: (*Executor).bitTest},
+	{name: "BTC", operands: kinds{rmWord, immByte}, model: Model80386, exec: (*Executor).bitTest},
+}
+
+// init fills the rows of the opcode maps that follow a pattern.
+func init() {
+	for i, name := range []string{"ADD", "OR", "ADC", "SBB", "AND", "SUB", "XOR", "CMP"} {
+		forms := []kinds{
+			{rmByte, regByte}, {rmWord, regWord}, {regByte, rmByte},
+			{regWord, rmWord}, {regAL, immByte}, {regAX, imm},
+		}
+		for j, form := range forms {
+			opcodes[i*8+j] = opcode{name: name, operands: form, exec: (*Executor).arith}
+		}
+	}
+	for i, name := range []string{"DAA", "DAS", "AAA", "AAS"} {
+		exec := (*Executor).decimalAdjust
+		if i >= 2 {
+			exec = (*Executor).asciiAdjust
+		}
+		opcodes[0x27+i*8] = opcode{name: name, exec: exec}
+	}
+	for i := 0; i < 4; i++ {
+		seg := regES + operandKind(i)
+		opcodes[0x06+i*8] = opcode{name: "PUSH", operands: kinds{seg}, exec: (*Executor).push}
+		if seg != regCS {
+			opcodes[0x07+i*8] = opcode{name: "POP", operands: kinds{seg}, exec: (*Executor).pop}
+		}
+	}
+	for i := 0; i < 8; i++ {
+		opcodes[0x40+i] = opcode{name: "INC", operands: kinds{opReg}, exec: (*Executor).increment}
+		opcodes[0x48+i] = opcode{name: "DEC", operands: kinds{opReg}, exec: (*Executor).increment}
+		opcodes[0x50+i] = opcode{name: "PUSH", operands: kinds{opReg}, exec: (*Executor).push}
+		opcodes[0x58+i] = opcode{name: "POP", operands: kinds{opReg}, exec: (*Executor).pop}
+		if i > 0 {
+			opcodes[0x90+i] = opcode{name: "XCHG", operands: kinds{opReg, regAX}, exec: (*Executor).xchg}
+		}
+		opcodes[0xB0+i] = opcode{name: "MOV", operands: kinds{opRegByte, immByte}, exec: (*Executor).mov}
+		opcodes[0xB8+i] = opcode{name: "MOV", operands: kinds{opReg, imm}, exec: (*Executor).mov}
+		opcodes[0xD8+i] = opcode{name: "ESC", operands: kinds{memEsc}, exec: (*Executor).esc}
+	}
+	for cc, name := range conditionNames {
+		opcodes[0x70+cc] = opcode{name: "J" + name, operands: kinds{relByte}, exec: (*Executor).jumpIf}
+		opcodes0F[0x80+cc] = opcode{name: "J" + name, operands: kinds{rel}, model: Model80386, exec: (*Executor).jumpIf}
+		opcodes0F[0x90+cc] = opcode{name: "SET" + name, operands: kinds{rmByte}, model: Model80386, exec: (*Executor).setIf}
+	}
+	for i := range opcodes0F {
+		if opcodes0F[i].exec == nil && opcodes0F[i].group == nil {
+			opcodes0F[i] = opcode{model: Model80286, exec: (*Executor).invalidOpcode}
+		}
+	}
+}
@@ -0,0 +1,350 @@
+package cpu
+
+// This file resolves the operands described by the opcode table into
+// registers, memory locations and immediates, so that every instruction
+// addresses its operands the same way.
+
+// location tells where an operand lives.
+type location byte
+
+const (
+	inImmediate location = iota
+	inRegister           // general register by ModRM number; AL..BH for bytes
+	inSegment            // segment register by ModRM number: ES, CS, SS, DS, FS, GS
+	inMemory             // segment and offset
+)
+
+// operand is a resolved operand of an instruction. Resolving computes
+// the effective address once, so that an instruction that reads and
+// writes its destination addresses the same location both times.
+type operand struct {
+	where   location
+	index   byte
+	segment uint16
+	offset  uint32 // 16 bits unless wide
+	wide    bool   // addressed with a 67h prefix, so the offset does not wrap at 64K
+	value   uint32
+}
+
+// memoryOperand returns the operand at segment:offset, addressed as inst
+// addresses memory.
+func memoryOperand(inst *Instruction, segment uint16, offset uint32) operand {
+	return operand{where: inMemory, segment: segment, offset: offset, wide: inst.AddressSize32}
+}
+
+// next returns the memory operand n bytes after op in the same segment.
+func (op operand) next(n uint32) operand {
+	op.offset += n
+	if !op.wide {
+		op.offset &= 0xFFFF
+	}
+	return op
+}
+
+// wraps reports whether size bytes of memory operand op run past the
+// end of its segment and continue at offset 0.
+func (op operand) wraps(size int) bool {
+	return !op.wide && op.offset+uint32(size) > 0x10000
+}
+
+// at returns the physical address of byte n of memory operand op. Under
+// 16-bit addressing the offset wraps within the segment, so the high
+// byte of a word at offset FFFF is at offset 0.
+func (op operand) at(n uint32) uint32 {
+	return uint32(op.segment)<<4 + op.next(n).offset
+}
+
+// operand resolves operand n of inst as its opcode table entry describes
+// it.
+func (e *Executor) operand(inst *Instruction, n int) operand {
+	switch kind := inst.op.operands[n]; kind {
+	case rmByte, rmWord, rmWord16, memOnly, memFar, memEsc:
+		return e.rm(inst)
+	case regByte, regWord:
+		return operand{where: inRegister, index: (inst.ModRM >> 3) & 0x07}
+	case segReg:
+		return operand{where: inSegment, index: (inst.ModRM >> 3) & 0x07}
+	case opRegByte, opReg:
+		return operand{where: inRegister, index: inst.Opcode & 0x07}
+	case regAL, regAX:
+		return operand{where: inRegister, index: 0}
+	case regCL:
+		return operand{where: inRegister, index: 1}
+	case regDX:
+		return operand{where: inRegister, index: 2}
+	case regES, regCS, regSS, regDS, regFS, regGS:
+		return operand{where: inSegment, index: byte(kind - regES)}
+	case moffsByte, moffs:
+		offset := uint32(inst.Displacement)
+		if inst.AddressSize32 {
+			offset = inst.Displacement32
+		}
+		return memoryOperand(inst, e.segment(inst, e.cpu.DS), offset)
+	case srcByte, src:
+		return memoryOperand(inst, e.segment(inst, e.cpu.DS), e.stringRegister(inst, sourceRegister))
+	case dstByte, dst:
+		return memoryOperand(inst, e.cpu.ES, e.stringRegister(inst, destinationRegister))
+	case constOne:
+		return operand{value: 1}
+	case constThree:
+		return operand{value: 3}
+	}
+	return operand{value: inst.Immediate32}
+}
+
+// rm resolves the operand addressed by the ModRM byte of inst: a
+// register for mod 3, otherwise a memory location.
+func (e *Executor) rm(inst *Instruction) operand {
+	if inst.ModRM>>6 == 3 {
+		return operand{where: inRegister, index: inst.ModRM & 0x07}
+	}
+	segment, offset := e.effectiveAddress(inst)
+	return memoryOperand(inst, segment, offset)
+}
+
+// load reads an operand of size bytes. Segment registers are always
+// words.
+func (e *Executor) load(op operand, size int) uint32 {
+	switch op.where {
+	case inRegister:
+		return e.readRegister(op.index, size)
+	case inSegment:
+		if reg := e.segmentRegister(op.index); reg != nil {
+			return uint32(*reg)
+		}
+		return 0
+	case inMemory:
+		return e.readMemory(op, size)
+	}
+	return op.value & sizeMask(size)
+}
+
+// store writes an operand of size bytes. Writes to immediates and to
+// undefined segment registers are dropped.
+func (e *Executor) store(op operand, size int, value uint32) {
+	switch op.where {
+	case inRegister:
+		e.writeRegister(op.index, size, value)
+	case inSegment:
+		if reg := e.segmentRegister(op.index); reg != nil {
+			*reg = uint16(value)
+		}
+	case inMemory:
+		e.writeMemory(op, size, value)
+	}
+}
+
+// readOperand reads the r/m operand of inst as size bytes.
+func (e *Executor) readOperand(inst *Instruction, size int) uint32 {
+	return e.load(e.rm(inst), size)
+}
+
+// writeOperand writes the r/m operand of inst as size bytes.
+func (e *Executor) writeOperand(inst *Instruction, size int, value uint32) {
+	e.store(e.rm(inst), size, value)
+}
+
+// register16 returns the word register selected by a ModRM reg or rm
+// field.
+func (e *Executor) register16(index byte) *uint16 {
+	return e.cpu.register16(index)
+}
+
+// segmentRegister returns the segment register with ModRM number index,
+// or nil for the undefined numbers 6 and 7.
+func (e *Executor) segmentRegister(index byte) *uint16 {
+	switch index {
+	case 0:
+		return &e.cpu.ES
+	case 1:
+		return &e.cpu.CS
+	case 2:
+		return &e.cpu.SS
+	case 3:
+		return &e.cpu.DS
+	case 4:
+		return &e.cpu.FS
+	case 5:
+		return &e.cpu.GS
+	}
+	return nil
+}
+
+// readRegister returns the register with ModRM number index as an
+// operand of size bytes: AL..BH, AX..DI or EAX..EDI.
+func (e *Executor) readRegister(index byte, size int) uint32 {
+	switch size {
+	case 1:
+		value := *e.register16(index & 0x03)
+		if index&0x04 != 0 {
+			return uint32(value >> 8)
+		}
+		return uint32(value & 0xFF)
+	case 2:
+		return uint32(*e.register16(index))
+	}
+	return e.cpu.Register32(index)
+}
+
+func (e *Executor) writeRegister(index byte, size int, value uint32) {
+	switch size {
+	case 1:
+		reg := e.register16(index & 0x03)
+		if index&0x04 != 0 {
+			*reg = (*reg & 0x00FF) | uint16(byte(value))<<8
+		} else {
+			*reg = (*reg & 0xFF00) | uint16(byte(value))
+		}
+	case 2:
+		*e.register16(index) = uint16(value)
+	default:
+		e.cpu.SetRegister32(index, value)
+	}
+}
+
+// readMemory reads size bytes of memory operand op, low byte first.
+func (e *Executor) readMemory(op operand, size int) uint32 {
+	addr := op.at(0)
+	if size == 1 {
+		return uint32(e.memory.Read8(addr))
+	}
+	if op.wraps(size) {
+		var value uint32
+		for i := 0; i < size; i++ {
+			value |= uint32(e.memory.Read8(op.at(uint32(i)))) << (8 * i)
+		}
+		return value
+	}
+	if size == 2 {
+		return uint32(e.memory.Read16(addr))
+	}
+	return uint32(e.memory.Read16(addr+2))<<16 | uint32(e.memory.Read16(addr))
+}
+
+// writeMemory writes size bytes of value to memory operand op, low byte
+// first.
+func (e *Executor) writeMemory(op operand, size int, value uint32) {
+	addr := op.at(0)
+	switch {
+	case size == 1:
+		e.memory.Write8(addr, byte(value))
+	case op.wraps(size):
+		for i := 0; i < size; i++ {
+			e.memory.Write8(op.at(uint32(i)), byte(value>>(8*i)))
+		}
+	case size == 2:
+		e.memory.Write16(addr, uint16(value))
+	default:
+		e.memory.Write16(addr, uint16(value))
+		e.memory.Write16(addr+2, uint16(value>>16))
+	}
+}
+
+// segment returns the segment register selected by inst's override prefix,
+// or def if the instruction has none.
+func (e *Executor) segment(inst *Instruction, def uint16) uint16 {
+	switch inst.SegmentPrefix {
+	case 0x26:
+		return e.cpu.ES
+	case 0x2E:
+		return e.cpu.CS
+	case 0x36:
+		return e.cpu.SS
+	case 0x3E:
+		return e.cpu.DS
+	case 0x64:
+		return e.cpu.FS
+	case 0x65:
+		return e.cpu.GS
+	}
+	return def
+}
+
+// effectiveOffset computes the 16-bit offset addressed by a ModRM memory
+// operand.
+func (e *Executor) effectiveOffset(inst *Instruction) uint16 {
+	if inst.AddressSize32 {
+		offset, _ := e.effectiveOffset32(inst)
+		return uint16(offset)
+	}
+	mod := (inst.ModRM >> 6) & 0x03
+	rm := inst.ModRM & 0x07
+	if mod == 0 && rm == 6 {
+		return inst.Displacement
+	}
+
+	var offset uint16
+	switch rm {
+	case 0:
+		offset = e.cpu.BX + e.cpu.SI
+	case 1:
+		offset = e.cpu.BX + e.cpu.DI
+	case 2:
+		offset = e.cpu.BP + e.cpu.SI
+	case 3:
+		offset = e.cpu.BP + e.cpu.DI
+	case 4:
+		offset = e.cpu.SI
+	case 5:
+		offset = e.cpu.DI
+	case 6:
+		offset = e.cpu.BP
+	case 7:
+		offset = e.cpu.BX
+	}
+
+	if mod == 1 || mod == 2 {
+		offset += inst.Displacement
+	}
+	return offset
+}
+
+// effectiveOffset32 computes the offset addressed by a ModRM memory
+// operand under 32-bit addressing (67h prefix), including the SIB forms.
+// It also reports whether the base register is ESP or EBP, which makes
+// SS the default segment.
+func (e *Executor) effectiveOffset32(inst *Instruction) (uint32, bool) {
+	mod := (inst.ModRM >> 6) & 0x03
+	rm := inst.ModRM & 0x07
+	offset := inst.Displacement32
+
+	if rm != 4 {
+		if mod == 0 && rm == 5 {
+			return offset, false
+		}
+		return offset + e.cpu.Register32(rm), rm == 5
+	}
+
+	scale := inst.SIB >> 6
+	index := (inst.SIB >> 3) & 0x07
+	base := inst.SIB & 0x07
+	if index != 4 {
+		offset += e.cpu.Register32(index) << scale
+	}
+	if base == 5 && mod == 0 {
+		return offset, false
+	}
+	return offset + e.cpu.Register32(base), base == 4 || base == 5
+}
+
+// effectiveAddress returns the segment and offset of a ModRM memory
+// operand. BP-based forms default to SS, all others to DS, unless the
+// instruction carries a segment override prefix.
+func (e *Executor) effectiveAddress(inst *Instruction) (uint16, uint32) {
+	if inst.AddressSize32 {
+		offset, stack := e.effectiveOffset32(inst)
+		defaultSegment := e.cpu.DS
+		if stack {
+			defaultSegment = e.cpu.SS
+		}
+		return e.segment(inst, defaultSegment), offset
+	}
+
+	mod := (inst.ModRM >> 6) & 0x03
+	rm := inst.ModRM & 0x07
+	defaultSegment := e.cpu.DS
+	if rm == 2 || rm == 3 || (rm == 6 && mod != 0) {
+		defaultSegment = e.cpu.SS
+	}
+	return e.segment(inst, defaultSegment), uint32(e.effectiveOffset(inst))
+}
@@ -0,0 +1,124 @@
+package cpu
+
+// This file holds the string instructions and the repetition of them by
+// REP, REPE and REPNE prefixes. The source is DS:SI, or the segment an
+// override prefix names, and the destination always ES:DI. Under a 67h
+// prefix the count and indexes are ECX, ESI and EDI.
+
+// The registers string instructions use, by ModRM number.
+const (
+	countRegister       = 1 // CX
+	sourceRegister      = 6 // SI
+	destinationRegister = 7 // DI
+)
+
+// isStringOp reports whether opcode is a string instruction that honours
+// a REP/REPNE prefix.
+func isStringOp(opcode byte) bool {
+	if opcode >= 0x6C && opcode <= 0x6F {
+		return true
+	}
+	return opcode >= 0xA4 && opcode <= 0xAF && opcode != 0xA8 && opcode != 0xA9
+}
+
+// stringRegister returns the count or index register of a string
+// instruction at its address size.
+func (e *Executor) stringRegister(inst *Instruction, index byte) uint32 {
+	if inst.AddressSize32 {
+		return e.cpu.Register32(index)
+	}
+	return uint32(*e.cpu.register16(index))
+}
+
+func (e *Executor) setStringRegister(inst *Instruction, index byte, value uint32) {
+	if inst.AddressSize32 {
+		e.cpu.SetRegister32(index, value)
+		return
+	}
+	*e.cpu.register16(index) = uint16(value)
+}
+
+// stringStep returns the amount SI and DI move by for a string element
+// of size bytes, honouring DF.
+func (e *Executor) stringStep(size int) uint32 {
+	if e.cpu.Flags.DF {
+		return uint32(-size)
+	}
+	return uint32(size)
+}
+
+// stringAdvance moves SI and DI past the elements the instruction's
+// operands address.
+func (e *Executor) stringAdvance(inst *Instruction) {
+	for _, kind := range inst.op.operands {
+		index := byte(destinationRegister)
+		switch kind {
+		case srcByte, src:
+			index = sourceRegister
+		case dstByte, dst:
+		default:
+			continue
+		}
+		e.setStringRegister(inst, index, e.stringRegister(inst, index)+e.stringStep(inst.size))
+	}
+}
+
+// stringMove runs MOVS, STOS and LODS, which copy the second operand to
+// the first.
+func (e *Executor) stringMove(inst *Instruction) {
+	e.store(e.operand(inst, 0), inst.size, e.load(e.operand(inst, 1), inst.size))
+	e.stringAdvance(inst)
+}
+
+// stringCompare runs CMPS and SCAS, which subtract the second operand
+// from the first for the flags only.
+func (e *Executor) stringCompare(inst *Instruction) {
+	e.alu(7, e.load(e.operand(inst, 0), inst.size), e.load(e.operand(inst, 1), inst.size), inst.size)
+	e.stringAdvance(inst)
+}
+
+// ins reads the port in DX into ES:DI.
+func (e *Executor) ins(inst *Instruction) {
+	e.store(e.operand(inst, 0), inst.size, e.readPort(e.cpu.DX, inst.size))
+	e.stringAdvance(inst)
+}
+
+// outs writes DS:SI to the port in DX.
+func (e *Executor) outs(inst *Instruction) {
+	e.writePort(e.cpu.DX, inst.size, e.load(e.operand(inst, 1), inst.size))
+	e.stringAdvance(inst)
+}
+
+// repeat finishes one iteration of a REP-prefixed string instruction,
+// backing IP up to run it again while the repeat condition holds.
+func (e *Executor) repeat(inst *Instruction) {
+	if e.repeatPrefix == 0 {
+		return
+	}
+	if !isStringOp(inst.Opcode) {
+		e.repeatPrefix = 0
+		return
+	}
+
+	count := e.stringRegister(inst, countRegister)
+	if count > 0 {
+		count--
+		e.setStringRegister(inst, countRegister, count)
+	}
+	// Only CMPS and SCAS test ZF; the other string instructions repeat
+	// under F2h just as under F3h.
+	compares := inst.Opcode == 0xA6 || inst.Opcode == 0xA7 || inst.Opcode == 0xAE || inst.Opcode == 0xAF
+	again := count > 0
+	switch {
+	case compares && e.repeatPrefix == 0xF2: // REPNE: while ZF=0
+		again = again && !e.cpu.Flags.ZF()
+	case compares: // REPE: while ZF=1
+		again = again && e.cpu.Flags.ZF()
+	}
+
+	if again {
+		e.cpu.IP -= uint16(inst.Length)
+	} else {
+		e.repeatPrefix = 0
+	}
+}
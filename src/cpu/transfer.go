@@ -0,0 +1,287 @@
+package cpu
+
+import (
+	"dos-emulator/memory"
+)
+
+// This file holds the data transfer instructions: moves, exchanges,
+// stack operations, conversions, flag transfers and port I/O.
+
+func (e *Executor) mov(inst *Instruction) {
+	dst := e.operand(inst, 0)
+	if dst.where == inSegment && dst.index == 1 {
+		// MOV CS is undefined; the processors we emulate ignore it.
+		return
+	}
+	e.shadow = dst.where == inSegment && dst.index == 2
+	e.store(dst, inst.size, e.load(e.operand(inst, 1), inst.size))
+}
+
+func (e *Executor) xchg(inst *Instruction) {
+	a, b := e.operand(inst, 0), e.operand(inst, 1)
+	valueA, valueB := e.load(a, inst.size), e.load(b, inst.size)
+	e.store(a, inst.size, valueB)
+	e.store(b, inst.size, valueA)
+}
+
+// pushSized and popSized move a word, or a doubleword if size is 4.
+func (e *Executor) pushSized(value uint32, size int) {
+	if size == 4 {
+		e.Push32(value)
+	} else {
+		e.Push(uint16(value))
+	}
+}
+
+func (e *Executor) popSized(size int) uint32 {
+	if size == 4 {
+		return e.Pop32()
+	}
+	return uint32(e.Pop())
+}
+
+// isSegment reports whether kind names a segment register, which the
+// stack always holds as a word.
+func isSegment(kind operandKind) bool {
+	return kind >= regES && kind <= regGS
+}
+
+func (e *Executor) push(inst *Instruction) {
+	size := inst.size
+	if isSegment(inst.op.operands[0]) {
+		size = 2
+	}
+	src := e.operand(inst, 0)
+	value := e.load(src, size)
+	if size == 2 && src.where == inRegister && src.index == 4 {
+		value = uint32(e.pushedSP())
+	}
+	e.pushSized(value, size)
+}
+
+// pop pops the value before resolving a memory destination, so that an
+// address based on SP sees it incremented.
+func (e *Executor) pop(inst *Instruction) {
+	size := inst.size
+	if isSegment(inst.op.operands[0]) {
+		size = 2
+	}
+	value := e.popSized(size)
+	dst := e.operand(inst, 0)
+	e.shadow = dst.where == inSegment && dst.index == 2
+	e.store(dst, size, value)
+}
+
+// pusha pushes the general registers in ModRM order, with SP as it was
+// before the first push.
+func (e *Executor) pusha(inst *Instruction) {
+	sp := e.readRegister(4, inst.size)
+	for i := byte(0); i < 8; i++ {
+		if i == 4 {
+			e.pushSized(sp, inst.size)
+		} else {
+			e.pushSized(e.readRegister(i, inst.size), inst.size)
+		}
+	}
+}
+
+// popa pops the registers PUSHA pushed, skipping the saved SP.
+func (e *Executor) popa(inst *Instruction) {
+	for i := 7; i >= 0; i-- {
+		value := e.popSized(inst.size)
+		if i != 4 {
+			e.writeRegister(byte(i), inst.size, value)
+		}
+	}
+}
+
+func (e *Executor) pushf(inst *Instruction) {
+	e.pushSized(uint32(e.flagsWord()), inst.size)
+}
+
+func (e *Executor) popf(inst *Instruction) {
+	e.loadFlags(uint16(e.popSized(inst.size)))
+}
+
+// lea loads the offset of a memory operand, computed with the address
+// size, into a register of the operand size.
+func (e *Executor) lea(inst *Instruction) {
+	var offset uint32
+	if inst.AddressSize32 {
+		offset, _ = e.effectiveOffset32(inst)
+	} else {
+		offset = uint32(e.effectiveOffset(inst))
+	}
+	e.store(e.operand(inst, 0), inst.size, offset)
+}
+
+// loadFar runs LES, LDS, LSS, LFS and LGS, which load a register and a
+// segment register from a far pointer in memory.
+func (e *Executor) loadFar(inst *Instruction) {
+	pointer := e.operand(inst, 1)
+	if pointer.where != inMemory {
+		e.invalidOpcode(inst)
+		return
+	}
+	segment := byte(3) // LDS
+	switch {
+	case inst.Opcode == 0xC4:
+		segment = 0
+	case inst.Opcode == 0x0F:
+		segment = inst.Opcode2 - 0xB0
+	}
+	e.store(e.operand(inst, 0), inst.size, e.load(pointer, inst.size))
+	*e.segmentRegister(segment) = uint16(e.load(pointer.next(uint32(inst.size)), 2))
+}
+
+// movzx and movsx widen a byte (0F B6, 0F BE) or word (0F B7, 0F BF)
+// into a register, with zeros or copies of the sign bit.
+func (e *Executor) movzx(inst *Instruction) {
+	size := 1 + int(inst.Opcode2&1)
+	e.store(e.operand(inst, 0), inst.size, e.load(e.operand(inst, 1), size))
+}
+
+func (e *Executor) movsx(inst *Instruction) {
+	size := 1 + int(inst.Opcode2&1)
+	value := signExtend(e.load(e.operand(inst, 1), size), size)
+	e.store(e.operand(inst, 0), inst.size, uint32(value))
+}
+
+// convert runs CBW and CWDE (98), which sign-extend the lower half of
+// the accumulator into all of it, and CWD and CDQ (99), which fill DX or
+// EDX with the sign of AX or EAX.
+func (e *Executor) convert(inst *Instruction) {
+	size := inst.size
+	if inst.Opcode == 0x98 {
+		half := size / 2
+		e.writeRegister(0, size, uint32(signExtend(e.readRegister(0, half), half)))
+		return
+	}
+	sign := uint32(0)
+	if e.readRegister(0, size)&signBit(size) != 0 {
+		sign = sizeMask(size)
+	}
+	e.writeRegister(2, size, sign)
+}
+
+func (e *Executor) sahf(inst *Instruction) {
+	flags := e.cpu.GetAH()
+	e.cpu.Flags.SetCF((flags & 0x01) != 0)
+	e.cpu.Flags.SetPF((flags & 0x04) != 0)
+	e.cpu.Flags.SetAF((flags & 0x10) != 0)
+	e.cpu.Flags.SetZF((flags & 0x40) != 0)
+	e.cpu.Flags.SetSF((flags & 0x80) != 0)
+}
+
+func (e *Executor) lahf(inst *Instruction) {
+	flags := byte(0x02)
+	if e.cpu.Flags.CF() {
+		flags = flags | 0x01
+	}
+	if e.cpu.Flags.PF() {
+		flags = flags | 0x04
+	}
+	if e.cpu.Flags.AF() {
+		flags = flags | 0x10
+	}
+	if e.cpu.Flags.ZF() {
+		flags = flags | 0x40
+	}
+	if e.cpu.Flags.SF() {
+		flags = flags | 0x80
+	}
+	e.cpu.SetAH(flags)
+}
+
+func (e *Executor) xlat(inst *Instruction) {
+	addr := memory.CalculateAddress(e.segment(inst, e.cpu.DS), e.cpu.BX+uint16(e.cpu.GetAL()))
+	e.cpu.SetAL(e.memory.Read8(addr))
+}
+
+// changeFlag runs CMC, CLC, STC, CLI, STI, CLD and STD.
+func (e *Executor) changeFlag(inst *Instruction) {
+	switch inst.Opcode {
+	case 0xF5:
+		e.cpu.Flags.SetCF(!e.cpu.Flags.CF())
+	case 0xF8:
+		e.cpu.Flags.SetCF(false)
+	case 0xF9:
+		e.cpu.Flags.SetCF(true)
+	case 0xFA:
+		e.cpu.Flags.IF = false
+	case 0xFB:
+		e.cpu.Flags.IF = true
+	case 0xFC:
+		e.cpu.Flags.DF = false
+	case 0xFD:
+		e.cpu.Flags.DF = true
+	}
+}
+
+// enter builds a stack frame of Immediate32 bytes, copying the frame
+// pointers of the enclosing levels for a nesting level above zero.
+func (e *Executor) enter(inst *Instruction) {
+	level := inst.Immediate2 & 0x1F
+	e.Push(e.cpu.BP)
+	frame := e.cpu.SP
+	if level > 0 {
+		for i := uint16(1); i < level; i++ {
+			e.cpu.BP -= 2
+			e.Push(e.memory.Read16(memory.CalculateAddress(e.cpu.SS, e.cpu.BP)))
+		}
+		e.Push(frame)
+	}
+	e.cpu.BP = frame
+	e.cpu.SP -= uint16(inst.Immediate32)
+}
+
+func (e *Executor) leave(inst *Instruction) {
+	e.cpu.SP = e.cpu.BP
+	e.cpu.BP = e.Pop()
+}
+
+// readPort and writePort access a port with an operand of size bytes.
+func (e *Executor) readPort(port uint16, size int) uint32 {
+	switch size {
+	case 1:
+		return uint32(e.ports.Read8(port))
+	case 2:
+		return uint32(e.ports.Read16(port))
+	}
+	return e.readPort32(port)
+}
+
+func (e *Executor) writePort(port uint16, size int, value uint32) {
+	switch size {
+	case 1:
+		e.ports.Write8(port, byte(value))
+	case 2:
+		e.ports.Write16(port, uint16(value))
+	default:
+		e.writePort32(port, value)
+	}
+}
+
+// readPort32 and writePort32 access a doubleword port as two word
+// accesses, the way a 16-bit ISA bus splits them.
+func (e *Executor) readPort32(port uint16) uint32 {
+	low := e.ports.Read16(port)
+	high := e.ports.Read16(port + 2)
+	return uint32(high)<<16 | uint32(low)
+}
+
+func (e *Executor) writePort32(port uint16, value uint32) {
+	e.ports.Write16(port, uint16(value))
+	e.ports.Write16(port+2, uint16(value>>16))
+}
+
+// in and out take the port from an immediate byte or DX.
+func (e *Executor) in(inst *Instruction) {
+	port := uint16(e.load(e.operand(inst, 1), 2))
+	e.store(e.operand(inst, 0), inst.size, e.readPort(port, inst.size))
+}
+
+func (e *Executor) out(inst *Instruction) {
+	port := uint16(e.load(e.operand(inst, 0), 2))
+	e.writePort(port, inst.size, e.load(e.operand(inst, 1), inst.size))
+}
@@ -0,0 +1,439 @@
+package dos
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"dos-emulator/cpu"
+	"dos-emulator/memory"
+)
+
+// Breakpoint stops Run before the instruction at Segment:Offset executes.
+// Breakpoints match the linear address, so any segment:offset pair that
+// aliases it hits too. They belong to the emulator rather than to a
+// program and stay set across RUN commands. A watchpoint, one with a
+// Length, instead stops Run after an instruction writes to any of the
+// Length bytes from Segment:Offset.
+type Breakpoint struct {
+	ID        int
+	Segment   uint16
+	Offset    uint16
+	Length    uint16     // bytes a watchpoint watches; 0 for a breakpoint
+	Condition *Condition // nil to stop whenever the address is reached
+	Count     uint64     // stop only from this hit on; 0 and 1 stop on every hit
+	Hits      uint64     // times reached with the condition true since the program was loaded
+	Disabled  bool
+}
+
+func (bp *Breakpoint) String() string {
+	text := fmt.Sprintf("%2d  %04X:%04X", bp.ID, bp.Segment, bp.Offset)
+	if bp.Length > 0 {
+		text += fmt.Sprintf("  watch length %d", bp.Length)
+	}
+	if bp.Condition != nil {
+		text += "  if " + bp.Condition.String()
+	}
+	if bp.Count > 1 {
+		text += fmt.Sprintf("  count %d", bp.Count)
+	}
+	text += fmt.Sprintf("  hits %d", bp.Hits)
+	if bp.Disabled {
+		text += "  (disabled)"
+	}
+	return text
+}
+
+// Condition compares a register with a value, as in "AX==5" or
+// "CL<0x10".
+type Condition struct {
+	register string
+	operator string
+	value    uint16
+}
+
+// conditionOperators lists the comparisons, two-character ones first so
+// that "<=" is not taken for "<".
+var conditionOperators = []string{"==", "!=", "<=", ">=", "<", ">", "="}
+
+// ParseCondition parses a breakpoint condition: a register name, one of
+// ==, !=, <, <=, > and >=, and a number in decimal, or in hex with a 0x
+// prefix or h suffix. Spaces around the operator are optional.
+func ParseCondition(text string) (*Condition, error) {
+	text = strings.ReplaceAll(text, " ", "")
+	for _, op := range conditionOperators {
+		i := strings.Index(text, op)
+		if i < 0 {
+			continue
+		}
+		register := strings.ToUpper(text[:i])
+		if _, ok := registerValue(&cpu.CPU{}, register); !ok {
+			return nil, fmt.Errorf("unknown register: %s", text[:i])
+		}
+		value, err := parseNumber(text[i+len(op):])
+		if err != nil {
+			return nil, err
+		}
+		if op == "=" {
+			op = "=="
+		}
+		return &Condition{register: register, operator: op, value: value}, nil
+	}
+	return nil, fmt.Errorf("invalid condition: %s (use e.g. AX==5)", text)
+}
+
+func (c *Condition) String() string {
+	return fmt.Sprintf("%s%s0x%X", c.register, c.operator, c.value)
+}
+
+// holds evaluates the condition against the registers of p.
+func (c *Condition) holds(p *cpu.CPU) bool {
+	value, _ := registerValue(p, c.register)
+	switch c.operator {
+	case "!=":
+		return value != c.value
+	case "<":
+		return value < c.value
+	case "<=":
+		return value <= c.value
+	case ">":
+		return value > c.value
+	case ">=":
+		return value >= c.value
+	}
+	return value == c.value
+}
+
+// registerValue returns the register of c called name, which must be in
+// upper case.
+func registerValue(c *cpu.CPU, name string) (uint16, bool) {
+	switch name {
+	case "AX":
+		return c.AX, true
+	case "BX":
+		return c.BX, true
+	case "CX":
+		return c.CX, true
+	case "DX":
+		return c.DX, true
+	case "SI":
+		return c.SI, true
+	case "DI":
+		return c.DI, true
+	case "BP":
+		return c.BP, true
+	case "SP":
+		return c.SP, true
+	case "CS":
+		return c.CS, true
+	case "DS":
+		return c.DS, true
+	case "ES":
+		return c.ES, true
+	case "SS":
+		return c.SS, true
+	case "IP":
+		return c.IP, true
+	case "FL", "FLAGS":
+		return c.Flags.ToUint16(), true
+	case "AL":
+		return uint16(c.GetAL()), true
+	case "AH":
+		return uint16(c.GetAH()), true
+	case "BL":
+		return uint16(c.GetBL()), true
+	case "BH":
+		return uint16(c.GetBH()), true
+	case "CL":
+		return uint16(c.GetCL()), true
+	case "CH":
+		return uint16(c.GetCH()), true
+	case "DL":
+		return uint16(c.GetDL()), true
+	case "DH":
+		return uint16(c.GetDH()), true
+	}
+	return 0, false
+}
+
+// parseNumber parses a 16-bit number in decimal, or in hex with a 0x
+// prefix or an h suffix.
+func parseNumber(text string) (uint16, error) {
+	base := 0
+	if len(text) > 1 && strings.HasSuffix(strings.ToLower(text), "h") {
+		text = text[:len(text)-1]
+		base = 16
+	}
+	value, err := strconv.ParseUint(text, base, 16)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number: %s", text)
+	}
+	return uint16(value), nil
+}
+
+// ParseAddress parses a segment:offset address in hex. The segment may
+// also be named by a segment register, whose current value is used.
+func (e *DOSEmulator) ParseAddress(text string) (uint16, uint16, error) {
+	seg, off, ok := strings.Cut(text, ":")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid address: %s (use segment:offset)", text)
+	}
+	var segment uint16
+	switch name := strings.ToUpper(seg); name {
+	case "CS", "DS", "ES", "SS":
+		segment, _ = registerValue(e.cpu, name)
+	default:
+		value, err := strconv.ParseUint(seg, 16, 16)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid segment: %s", seg)
+		}
+		segment = uint16(value)
+	}
+	offset, err := strconv.ParseUint(off, 16, 16)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid offset: %s", off)
+	}
+	return segment, uint16(offset), nil
+}
+
+// AddBreakpoint sets a breakpoint at segment:offset, replacing any
+// breakpoint already set at the same linear address.
+func (e *DOSEmulator) AddBreakpoint(segment, offset uint16, cond *Condition, count uint64) *Breakpoint {
+	addr := memory.CalculateAddress(segment, offset)
+	bp := e.breakpoints[addr]
+	if bp == nil {
+		e.nextBreakpoint++
+		bp = &Breakpoint{ID: e.nextBreakpoint}
+		e.breakpoints[addr] = bp
+	}
+	bp.Segment, bp.Offset = segment, offset
+	bp.Condition = cond
+	bp.Count = count
+	bp.Hits = 0
+	bp.Disabled = false
+	return bp
+}
+
+// AddWatchpoint sets a watchpoint on the length bytes from
+// segment:offset.
+func (e *DOSEmulator) AddWatchpoint(segment, offset, length uint16) *Breakpoint {
+	e.nextBreakpoint++
+	wp := &Breakpoint{ID: e.nextBreakpoint, Segment: segment, Offset: offset, Length: length}
+	e.watchpoints = append(e.watchpoints, wp)
+	e.updateJournal()
+	return wp
+}
+
+// Breakpoints returns the breakpoints and watchpoints in the order they
+// were set.
+func (e *DOSEmulator) Breakpoints() []*Breakpoint {
+	list := make([]*Breakpoint, 0, len(e.breakpoints)+len(e.watchpoints))
+	for _, bp := range e.breakpoints {
+		list = append(list, bp)
+	}
+	list = append(list, e.watchpoints...)
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
+
+// DeleteBreakpoint removes breakpoint or watchpoint id. It returns false
+// if there is no such breakpoint.
+func (e *DOSEmulator) DeleteBreakpoint(id int) bool {
+	for addr, bp := range e.breakpoints {
+		if bp.ID == id {
+			delete(e.breakpoints, addr)
+			return true
+		}
+	}
+	for i, wp := range e.watchpoints {
+		if wp.ID == id {
+			e.watchpoints = append(e.watchpoints[:i], e.watchpoints[i+1:]...)
+			e.updateJournal()
+			return true
+		}
+	}
+	return false
+}
+
+// resetBreakpointHits starts the hit counts afresh for a new program.
+func (e *DOSEmulator) resetBreakpointHits() {
+	for _, bp := range e.breakpoints {
+		bp.Hits = 0
+	}
+}
+
+// breakpointAt counts a hit of the breakpoint at addr and returns it if
+// Run should stop there.
+func (e *DOSEmulator) breakpointAt(addr uint32) *Breakpoint {
+	bp := e.breakpoints[addr]
+	if bp == nil || bp.Disabled {
+		return nil
+	}
+	if bp.Condition != nil && !bp.Condition.holds(e.cpu) {
+		return nil
+	}
+	bp.Hits++
+	if bp.Hits < bp.Count {
+		return nil
+	}
+	return bp
+}
+
+// watchpointAt returns the enabled watchpoint watching addr, if any.
+func (e *DOSEmulator) watchpointAt(addr uint32) *Breakpoint {
+	for _, wp := range e.watchpoints {
+		start := memory.CalculateAddress(wp.Segment, wp.Offset)
+		if !wp.Disabled && addr >= start && addr < start+uint32(wp.Length) {
+			return wp
+		}
+	}
+	return nil
+}
+
+// memoryWritten is the memory journal hook while there are watchpoints
+// or a recording: it notes the first watchpoint hit for Run to stop at
+// and journals the write.
+func (e *DOSEmulator) memoryWritten(addr uint32, old byte) {
+	if e.rec != nil {
+		e.rec.written(addr, old, -1)
+	}
+	if e.watchHit == nil && len(e.watchpoints) != 0 {
+		e.watchHit = e.watchpointAt(addr)
+	}
+}
+
+// BreakpointCommand runs the breakpoint commands shared by the shell and
+// the monitor:
+//
+//	BP seg:off [if REG op value] [count N]   set a breakpoint
+//	WP seg:off [length]                       set a watchpoint
+//	BL                                        list breakpoints
+//	BC id|*                                   clear breakpoints
+//	BD id|*, BE id|*                          disable or enable them
+//
+// It returns false if parts is not a breakpoint command.
+func (e *DOSEmulator) BreakpointCommand(parts []string) bool {
+	if len(parts) == 0 {
+		return false
+	}
+	switch strings.ToUpper(parts[0]) {
+	case "BP":
+		e.setBreakpointCommand(parts[1:])
+	case "WP":
+		e.setWatchpointCommand(parts[1:])
+	case "BL":
+		list := e.Breakpoints()
+		if len(list) == 0 {
+			fmt.Println("No breakpoints")
+		}
+		for _, bp := range list {
+			fmt.Println(bp)
+		}
+	case "BC", "BD", "BE":
+		command := strings.ToUpper(parts[0])
+		if len(parts) < 2 {
+			fmt.Printf("Usage: %s <id>|*\n", command)
+			return true
+		}
+		for _, bp := range e.selectBreakpoints(parts[1]) {
+			switch command {
+			case "BC":
+				e.DeleteBreakpoint(bp.ID)
+				fmt.Printf("Breakpoint %d cleared\n", bp.ID)
+			case "BD":
+				bp.Disabled = true
+				fmt.Printf("Breakpoint %d disabled\n", bp.ID)
+			case "BE":
+				bp.Disabled = false
+				fmt.Printf("Breakpoint %d enabled\n", bp.ID)
+			}
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+// selectBreakpoints returns the breakpoint with the given id, or all of
+// them for "*".
+func (e *DOSEmulator) selectBreakpoints(arg string) []*Breakpoint {
+	if arg == "*" {
+		return e.Breakpoints()
+	}
+	id, err := strconv.Atoi(arg)
+	if err == nil {
+		for _, bp := range e.Breakpoints() {
+			if bp.ID == id {
+				return []*Breakpoint{bp}
+			}
+		}
+	}
+	fmt.Printf("No breakpoint %s\n", arg)
+	return nil
+}
+
+func (e *DOSEmulator) setBreakpointCommand(args []string) {
+	if len(args) == 0 {
+		fmt.Println("Usage: BP <seg:off> [if <reg><op><value>] [count <n>]")
+		return
+	}
+	segment, offset, err := e.ParseAddress(args[0])
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+
+	var cond *Condition
+	var count uint64
+	for i := 1; i < len(args); i++ {
+		switch strings.ToLower(args[i]) {
+		case "if":
+			end := i + 1
+			for end < len(args) && strings.ToLower(args[end]) != "count" {
+				end++
+			}
+			if cond, err = ParseCondition(strings.Join(args[i+1:end], "")); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				return
+			}
+			i = end - 1
+		case "count":
+			if i+1 < len(args) {
+				count, err = strconv.ParseUint(args[i+1], 10, 64)
+			}
+			if i+1 >= len(args) || err != nil || count == 0 {
+				fmt.Println("Error: count needs a positive number")
+				return
+			}
+			i++
+		default:
+			fmt.Printf("Error: unexpected %q\n", args[i])
+			return
+		}
+	}
+
+	bp := e.AddBreakpoint(segment, offset, cond, count)
+	fmt.Printf("Breakpoint %d at %04X:%04X\n", bp.ID, bp.Segment, bp.Offset)
+}
+
+func (e *DOSEmulator) setWatchpointCommand(args []string) {
+	if len(args) == 0 || len(args) > 2 {
+		fmt.Println("Usage: WP <seg:off> [length]")
+		return
+	}
+	segment, offset, err := e.ParseAddress(args[0])
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	length := uint16(1)
+	if len(args) > 1 {
+		if length, err = parseNumber(args[1]); err != nil || length == 0 {
+			fmt.Println("Error: length needs a positive number")
+			return
+		}
+	}
+	wp := e.AddWatchpoint(segment, offset, length)
+	fmt.Printf("Watchpoint %d at %04X:%04X length %d\n", wp.ID, wp.Segment, wp.Offset, wp.Length)
+}
@@ -0,0 +1,108 @@
+package dos
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"dos-emulator/hardware"
+)
+
+// ClockPC is the 4.77 MHz processor clock of the IBM PC and XT: the
+// 14.31818 MHz crystal divided by three, four times the timer's input
+// clock.
+const ClockPC = 4 * hardware.PITFrequency
+
+// ParseClock parses a clock rate for --clock: a frequency such as
+// "4.77MHz", "8MHz", "500kHz" or "8000000" (Hz), or "max" for no
+// throttling, which is returned as 0. Rates within 10 kHz of the PC's
+// clock are taken to mean it exactly.
+func ParseClock(s string) (uint64, error) {
+	text := strings.ToLower(strings.TrimSpace(s))
+	if text == "max" {
+		return 0, nil
+	}
+	scale := 1.0
+	for _, unit := range []struct {
+		suffix string
+		scale  float64
+	}{{"mhz", 1e6}, {"khz", 1e3}, {"hz", 1}} {
+		if strings.HasSuffix(text, unit.suffix) {
+			text = strings.TrimSpace(strings.TrimSuffix(text, unit.suffix))
+			scale = unit.scale
+			break
+		}
+	}
+	value, err := strconv.ParseFloat(text, 64)
+	if err != nil || value*scale < 1000 || value*scale > 1e10 {
+		return 0, fmt.Errorf("invalid clock rate: %s (use e.g. 4.77MHz, 8MHz or max)", s)
+	}
+	hz := uint64(value*scale + 0.5)
+	if hz > ClockPC-10000 && hz < ClockPC+10000 {
+		hz = ClockPC
+	}
+	return hz, nil
+}
+
+// FormatClock shows a clock rate as ParseClock accepts it.
+func FormatClock(hz uint64) string {
+	if hz == 0 {
+		return "max"
+	}
+	mhz := strconv.FormatFloat(float64(hz)/1e6, 'f', 2, 64)
+	return strings.TrimSuffix(strings.TrimRight(mhz, "0"), ".") + "MHz"
+}
+
+// SetClock sets the processor clock in Hz. The timer counts at its fixed
+// rate against the cycles the instructions take, and Run throttles
+// execution so that emulated time keeps pace with real time. A clock of
+// 0 runs as fast as the host allows, with the timer advancing as on a
+// 4.77 MHz PC.
+func (e *DOSEmulator) SetClock(hz uint64) {
+	e.clock = hz
+	if hz == 0 {
+		hz = ClockPC
+	}
+	e.pitStep = uint64(hardware.PITFrequency) << 16 / hz
+	e.pitFraction = 0
+	e.resetThrottle()
+}
+
+// Clock returns the processor clock in Hz, or 0 if execution is not
+// throttled.
+func (e *DOSEmulator) Clock() uint64 {
+	return e.clock
+}
+
+// advanceClock lets cycles processor clock cycles pass, advancing the
+// timer by the matching number of its input clocks.
+func (e *DOSEmulator) advanceClock(cycles uint64) {
+	e.elapsedCycles += cycles
+	e.pitFraction += cycles * e.pitStep
+	e.pit.Advance(uint32(e.pitFraction >> 16))
+	e.pitFraction &= 0xFFFF
+}
+
+func (e *DOSEmulator) resetThrottle() {
+	e.throttleStart = time.Now()
+	e.throttleCycles = e.elapsedCycles
+}
+
+// throttle sleeps while the emulated machine is ahead of real time. If
+// it has fallen far behind, because the host is too slow or the program
+// waited for input, the reference point moves so that it does not race
+// to catch up.
+func (e *DOSEmulator) throttle() {
+	if e.clock == 0 {
+		return
+	}
+	emulated := time.Duration(float64(e.elapsedCycles-e.throttleCycles) / float64(e.clock) * float64(time.Second))
+	ahead := emulated - time.Since(e.throttleStart)
+	switch {
+	case ahead > time.Millisecond:
+		time.Sleep(ahead)
+	case ahead < -100*time.Millisecond:
+		e.resetThrottle()
+	}
+}
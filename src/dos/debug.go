@@ -0,0 +1,151 @@
+package dos
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"dos-emulator/loader"
+	"dos-emulator/memory"
+)
+
+// Debug runs a DEBUG session on file, loaded with args on its command
+// line, or on an empty program if file is "". Unlike Run it starts in the
+// monitor, and the monitor's G, T and P commands run the program only
+// until it stops.
+func (e *DOSEmulator) Debug(file string, args []string) {
+	e.mon = monitorState{session: true, name: file, args: args}
+	defer func() { e.mon.session = false }()
+
+	if file == "" {
+		if err := e.loadEmpty(); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+	} else if !e.loadNamed(0, 0, false) {
+		return
+	}
+
+	for e.monitor() {
+		reason, stopped := e.execute(true)
+		if !stopped {
+			fmt.Printf("\nProgram terminated normally (%04X)\n", e.returnCode)
+			e.mon.terminated = true
+			continue
+		}
+		e.showStop(reason)
+	}
+	e.bios.FinishScreen()
+}
+
+// loadEmpty starts a program with nothing in it, as DEBUG does when it
+// is given no file: a PSP with CS:IP at its offset 100h.
+func (e *DOSEmulator) loadEmpty() error {
+	e.resetProcesses()
+	env, err := e.createEnvironment("DEBUG")
+	if err != nil {
+		return err
+	}
+	image, psp, err := e.loadCOM("DEBUG", nil, 0)
+	if err != nil {
+		return err
+	}
+	e.setupCommandLine(psp, env, nil)
+	e.startProgram(image, psp, "COM")
+	e.resetMonitorAddresses()
+	e.resetRecording()
+	return nil
+}
+
+// name runs N, which names the file for L and W and the arguments L
+// passes to a program.
+func (e *DOSEmulator) name(args []string) {
+	if len(args) == 0 {
+		if e.mon.name != "" {
+			fmt.Println(strings.Join(append([]string{e.mon.name}, e.mon.args...), " "))
+		}
+		return
+	}
+	e.mon.name = args[0]
+	e.mon.args = args[1:]
+}
+
+// load runs L. A COM or EXE file is loaded as a program, ready to run;
+// with an address, or for other files, the file is copied to memory at
+// the address, CS:0100 by default. BX:CX is set to the file size.
+func (e *DOSEmulator) load(args []string) {
+	if len(args) == 0 {
+		e.loadNamed(0, 0, false)
+		return
+	}
+	segment, offset, err := e.monitorAddress(args[0], e.cpu.CS)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	e.loadNamed(segment, offset, true)
+}
+
+// loadNamed loads the file N named, as a program unless raw is set or it
+// is not a COM or EXE file. It reports whether the file was loaded.
+func (e *DOSEmulator) loadNamed(segment, offset uint16, raw bool) bool {
+	if e.mon.name == "" {
+		fmt.Println("Error: no file name (use N)")
+		return false
+	}
+	data, err := os.ReadFile(e.mon.name)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return false
+	}
+
+	ext := strings.ToUpper(filepath.Ext(e.mon.name))
+	if !raw && (ext == ".COM" || ext == ".EXE" || loader.IsEXE(data)) {
+		if err := e.LoadFile(e.mon.name, e.mon.args...); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return false
+		}
+	} else {
+		if !raw {
+			segment, offset = e.cpu.CS, 0x100
+		}
+		e.writeBytes(segment, offset, data)
+	}
+	e.cpu.BX = uint16(len(data) >> 16)
+	e.cpu.CX = uint16(len(data))
+	return true
+}
+
+// write runs W, which writes the BX:CX bytes at the address, CS:0100 by
+// default, to the file N named.
+func (e *DOSEmulator) write(args []string) {
+	segment, offset := e.cpu.CS, uint16(0x100)
+	if len(args) > 0 {
+		var err error
+		if segment, offset, err = e.monitorAddress(args[0], e.cpu.CS); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+	}
+	if e.mon.name == "" {
+		fmt.Println("Error: no file name (use N)")
+		return
+	}
+	if ext := strings.ToUpper(filepath.Ext(e.mon.name)); ext == ".EXE" || ext == ".HEX" {
+		fmt.Println("Error: EXE and HEX files cannot be written")
+		return
+	}
+
+	size := uint32(e.cpu.BX)<<16 | uint32(e.cpu.CX)
+	data := make([]byte, size)
+	start := memory.CalculateAddress(segment, offset)
+	for i := range data {
+		data[i] = e.memory.Read8(start + uint32(i))
+	}
+	if err := os.WriteFile(e.mon.name, data, 0644); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	fmt.Printf("Writing %05X bytes\n", size)
+}
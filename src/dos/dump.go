@@ -0,0 +1,218 @@
+package dos
+
+import (
+	"bufio"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"dos-emulator/memory"
+)
+
+// This file holds the monitor's memory commands: D, E, F, S, M and C.
+// Their addresses default to the DS segment.
+
+// parseByteList parses a list of hex bytes and quoted strings.
+func parseByteList(args []string) ([]byte, error) {
+	var list []byte
+	for _, arg := range args {
+		if len(arg) >= 2 && (arg[0] == '\'' || arg[0] == '"') && arg[len(arg)-1] == arg[0] {
+			list = append(list, arg[1:len(arg)-1]...)
+			continue
+		}
+		value, err := strconv.ParseUint(arg, 16, 8)
+		if err != nil {
+			return nil, fmt.Errorf("invalid byte: %s", arg)
+		}
+		list = append(list, byte(value))
+	}
+	if len(list) == 0 {
+		return nil, fmt.Errorf("missing list")
+	}
+	return list, nil
+}
+
+// dump runs D, which shows a range in hex and ASCII, 128 bytes from where
+// the last D ended by default.
+func (e *DOSEmulator) dump(args []string) {
+	m := &e.mon
+	segment, offset, length := m.dumpSegment, m.dumpOffset, uint32(0x80)
+	if len(args) > 0 {
+		var err error
+		if segment, offset, length, _, err = e.monitorRange(args, e.cpu.DS, length); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+	}
+
+	end := uint32(offset) + length
+	for line := uint32(offset) &^ 0x0F; line < end; line += 16 {
+		var hex, text strings.Builder
+		for i := uint32(0); i < 16; i++ {
+			at := line + i
+			separator := " "
+			if i == 8 {
+				separator = "-"
+			}
+			if at < uint32(offset) || at >= end {
+				hex.WriteString(strings.Repeat(" ", 3))
+				text.WriteByte(' ')
+				continue
+			}
+			b := e.memory.Read8(memory.CalculateAddress(segment, uint16(at)))
+			fmt.Fprintf(&hex, "%s%02X", separator, b)
+			if b < 0x20 || b > 0x7E {
+				b = '.'
+			}
+			text.WriteByte(b)
+		}
+		fmt.Printf("%04X:%04X %s   %s\n", segment, uint16(line), hex.String(), strings.TrimRight(text.String(), " "))
+	}
+	m.dumpSegment, m.dumpOffset = segment, uint16(end)
+}
+
+// enter runs E. With a list it stores the list at the address; without
+// one it shows each byte in turn and reads a new value for it, keeping
+// the byte on "." and going back on "-", until an empty line.
+func (e *DOSEmulator) enter(args []string, reader *bufio.Reader) {
+	if len(args) == 0 {
+		fmt.Println("Usage: E address [list]")
+		return
+	}
+	segment, offset, err := e.monitorAddress(args[0], e.cpu.DS)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	if len(args) > 1 {
+		list, err := parseByteList(args[1:])
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+		e.writeBytes(segment, offset, list)
+		return
+	}
+
+	for {
+		addr := memory.CalculateAddress(segment, offset)
+		fmt.Printf("%04X:%04X  %02X.", segment, offset, e.memory.Read8(addr))
+		line, _ := reader.ReadString('\n')
+		switch input := strings.TrimSpace(line); input {
+		case "":
+			return
+		case ".":
+			offset++
+		case "-":
+			offset--
+		default:
+			value, err := strconv.ParseUint(input, 16, 8)
+			if err != nil {
+				fmt.Printf("Error: invalid byte: %s\n", input)
+				continue
+			}
+			e.memory.Write8(addr, byte(value))
+			offset++
+		}
+	}
+}
+
+func (e *DOSEmulator) writeBytes(segment, offset uint16, data []byte) {
+	for i, b := range data {
+		e.memory.Write8(memory.CalculateAddress(segment, offset+uint16(i)), b)
+	}
+}
+
+// fill runs F, which fills a range with repeats of a list.
+func (e *DOSEmulator) fill(args []string) {
+	segment, offset, length, rest, err := e.monitorRange(args, e.cpu.DS, 0)
+	if err == nil && length == 0 {
+		err = fmt.Errorf("missing range")
+	}
+	var list []byte
+	if err == nil {
+		list, err = parseByteList(rest)
+	}
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	for i := uint32(0); i < length; i++ {
+		e.memory.Write8(memory.CalculateAddress(segment, offset+uint16(i)), list[i%uint32(len(list))])
+	}
+}
+
+// search runs S, which lists the addresses in a range where a list
+// occurs.
+func (e *DOSEmulator) search(args []string) {
+	segment, offset, length, rest, err := e.monitorRange(args, e.cpu.DS, 0)
+	if err == nil && length == 0 {
+		err = fmt.Errorf("missing range")
+	}
+	var list []byte
+	if err == nil {
+		list, err = parseByteList(rest)
+	}
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	for i := uint32(0); i+uint32(len(list)) <= length; i++ {
+		at := offset + uint16(i)
+		match := true
+		for j, b := range list {
+			if e.memory.Read8(memory.CalculateAddress(segment, at+uint16(j))) != b {
+				match = false
+				break
+			}
+		}
+		if match {
+			fmt.Printf("%04X:%04X\n", segment, at)
+		}
+	}
+}
+
+// copyRange parses the "range address" arguments of M and C.
+func (e *DOSEmulator) copyRange(args []string) (uint16, uint16, uint32, uint16, uint16, error) {
+	segment, offset, length, rest, err := e.monitorRange(args, e.cpu.DS, 0)
+	if err != nil {
+		return 0, 0, 0, 0, 0, err
+	}
+	if length == 0 || len(rest) != 1 {
+		return 0, 0, 0, 0, 0, fmt.Errorf("use: range address")
+	}
+	toSegment, toOffset, err := e.monitorAddress(rest[0], e.cpu.DS)
+	return segment, offset, length, toSegment, toOffset, err
+}
+
+// move runs M, which copies a range to an address. The copy is made as
+// if through a buffer, so ranges may overlap.
+func (e *DOSEmulator) move(args []string) {
+	segment, offset, length, toSegment, toOffset, err := e.copyRange(args)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	data := make([]byte, length)
+	for i := range data {
+		data[i] = e.memory.Read8(memory.CalculateAddress(segment, offset+uint16(i)))
+	}
+	e.writeBytes(toSegment, toOffset, data)
+}
+
+// compare runs C, which lists the bytes of a range that differ from those
+// at an address.
+func (e *DOSEmulator) compare(args []string) {
+	segment, offset, length, toSegment, toOffset, err := e.copyRange(args)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	for i := uint16(0); uint32(i) < length; i++ {
+		a := e.memory.Read8(memory.CalculateAddress(segment, offset+i))
+		b := e.memory.Read8(memory.CalculateAddress(toSegment, toOffset+i))
+		if a != b {
+			fmt.Printf("%04X:%04X  %02X  %02X  %04X:%04X\n", segment, offset+i, a, b, toSegment, toOffset+i)
+		}
+	}
+}
@@ -0,0 +1,414 @@
+// Package dos ties the CPU, memory and BIOS together into an emulated
+// MS-DOS machine and implements the DOS kernel services.
+package dos
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"dos-emulator/bios"
+	"dos-emulator/cpu"
+	"dos-emulator/hardware"
+	"dos-emulator/ioport"
+	"dos-emulator/memory"
+)
+
+type DOSEmulator struct {
+	cpu              *cpu.CPU
+	memory           *memory.Memory
+	ports            *ioport.Bus
+	pic              *hardware.PIC
+	pit              *hardware.PIT
+	bios             *bios.BIOS
+	exec             *cpu.Executor
+	fs               *FileSystem
+	decoder          *cpu.InstructionDecoder
+	cache            *cpu.DecodeCache
+	dtaSegment       uint16
+	dtaOffset        uint16
+	searchDirs       []string
+	running          bool
+	halted           bool
+	debugMode        bool
+	stepMode         bool
+	traceMode        bool
+	breakpoints      map[uint32]*Breakpoint // by linear address
+	watchpoints      []*Breakpoint
+	watchHit         *Breakpoint // watchpoint written to, for Run to stop at
+	nextBreakpoint   int
+	rec              *recorder // nil unless recording
+	mon              monitorState
+	interrupt        atomic.Bool   // set by Interrupt
+	input            *bufio.Reader // stdin, shared by all that read it
+	fileHandles      map[uint16]*FileHandle
+	nextHandle       uint16
+	instructionCount uint64
+	startTime        time.Time
+	runTime          time.Duration
+	clock            uint64 // processor clock in Hz, 0 for unthrottled
+	pitStep          uint64 // timer clocks per processor cycle, 16.16 fixed point
+	pitFraction      uint64
+	elapsedCycles    uint64 // processor cycles including time spent halted
+	throttleStart    time.Time
+	throttleCycles   uint64
+	environment      map[string]string
+	psp              uint16
+	programType      string
+	processes        []process
+	returnCode       uint16
+}
+
+// Stats is a snapshot of the emulator counters shown by the shell.
+type Stats struct {
+	ProgramType  string
+	Instructions uint64
+	Elapsed      time.Duration
+	RunTime      time.Duration // time spent executing guest code
+	Cycles       uint64
+	Clock        uint64
+	DecodeHits   uint64
+	DecodeMisses uint64
+	StackDepth   int
+	FileHandles  int
+	RepeatPrefix byte
+}
+
+func NewDOSEmulator() *DOSEmulator {
+	currentDir, _ := os.Getwd()
+	mem := memory.New()
+	c := &cpu.CPU{}
+
+	emulator := &DOSEmulator{
+		cpu:     c,
+		memory:  mem,
+		ports:   ioport.New(),
+		bios:    bios.New(c, mem),
+		decoder: cpu.NewInstructionDecoder(mem),
+		fs: &FileSystem{
+			currentDir:   currentDir,
+			currentDrive: 0,
+			drives: map[byte]string{
+				0: currentDir,
+			},
+		},
+		running:     true,
+		debugMode:   false,
+		stepMode:    false,
+		traceMode:   false,
+		breakpoints: make(map[uint32]*Breakpoint),
+		fileHandles: make(map[uint16]*FileHandle),
+		nextHandle:  5,
+		startTime:   time.Now(),
+		environment: make(map[string]string),
+		psp:         0x1000,
+	}
+	emulator.cache = cpu.NewDecodeCache(emulator.decoder, mem)
+	emulator.exec = cpu.NewExecutor(c, mem, emulator.ports, emulator.decoder, emulator)
+
+	emulator.environment["PATH"] = "A:\\"
+	emulator.environment["COMSPEC"] = "A:\\COMMAND.COM"
+
+	emulator.input = bufio.NewReader(os.Stdin)
+	emulator.bios.SetInput(emulator.input)
+	emulator.bios.InstallVectors()
+	emulator.bios.RegisterPorts(emulator.ports)
+
+	emulator.pic = hardware.NewPIC()
+	emulator.pit = hardware.NewPIT(func() { emulator.pic.RaiseIRQ(0) })
+	emulator.ports.Register(hardware.PICCommandPort, hardware.PICDataPort, emulator.pic)
+	emulator.ports.Register(hardware.PITCounterPort, hardware.PITControlPort, emulator.pit)
+	emulator.SetClock(0)
+	emulator.initArena()
+
+	emulator.fileHandles[0] = &FileHandle{file: os.Stdin, handle: 0}
+	emulator.fileHandles[1] = &FileHandle{file: os.Stdout, handle: 1}
+	emulator.fileHandles[2] = &FileHandle{file: os.Stderr, handle: 2}
+
+	return emulator
+}
+
+func (e *DOSEmulator) CPU() *cpu.CPU {
+	return e.cpu
+}
+
+func (e *DOSEmulator) Memory() *memory.Memory {
+	return e.memory
+}
+
+// Input returns the buffered reader on stdin that the emulator reads
+// keyboard and console input from. Others reading stdin, such as a
+// shell, must use it too, or input buffered by one is lost to the
+// other.
+func (e *DOSEmulator) Input() *bufio.Reader {
+	return e.input
+}
+
+// Ports returns the I/O port bus, on which additional devices can be
+// registered.
+func (e *DOSEmulator) Ports() *ioport.Bus {
+	return e.ports
+}
+
+func (e *DOSEmulator) BIOS() *bios.BIOS {
+	return e.bios
+}
+
+func (e *DOSEmulator) Decoder() *cpu.InstructionDecoder {
+	return e.decoder
+}
+
+func (e *DOSEmulator) DecodeCache() *cpu.DecodeCache {
+	return e.cache
+}
+
+func (e *DOSEmulator) Executor() *cpu.Executor {
+	return e.exec
+}
+
+// SetFPU installs or removes the numeric coprocessor, keeping the BIOS
+// equipment word in step.
+func (e *DOSEmulator) SetFPU(enabled bool) {
+	e.exec.SetFPU(enabled)
+	e.bios.SetCoprocessor(enabled)
+}
+
+func (e *DOSEmulator) DebugMode() bool {
+	return e.debugMode
+}
+
+func (e *DOSEmulator) SetDebugMode(enabled bool) {
+	e.debugMode = enabled
+	e.bios.SetDebugMode(enabled)
+	e.ports.SetDebugMode(enabled)
+	e.exec.SetDebugMode(enabled)
+}
+
+func (e *DOSEmulator) StepMode() bool {
+	return e.stepMode
+}
+
+func (e *DOSEmulator) SetStepMode(enabled bool) {
+	e.stepMode = enabled
+}
+
+func (e *DOSEmulator) TraceMode() bool {
+	return e.traceMode
+}
+
+func (e *DOSEmulator) SetTraceMode(enabled bool) {
+	e.traceMode = enabled
+}
+
+func (e *DOSEmulator) InstructionCount() uint64 {
+	return e.instructionCount
+}
+
+// CurrentDrive returns the default drive number (0 = A:).
+func (e *DOSEmulator) CurrentDrive() byte {
+	return e.fs.currentDrive
+}
+
+func (e *DOSEmulator) CurrentDir() string {
+	return e.fs.currentDir
+}
+
+// ChangeDir changes the host working directory backing the current drive.
+func (e *DOSEmulator) ChangeDir(dir string) error {
+	if err := os.Chdir(dir); err != nil {
+		return err
+	}
+	e.fs.currentDir, _ = os.Getwd()
+	return nil
+}
+
+func (e *DOSEmulator) Stats() Stats {
+	hits, misses := e.cache.Stats()
+	return Stats{
+		ProgramType:  e.programType,
+		Instructions: e.instructionCount,
+		Elapsed:      time.Since(e.startTime),
+		RunTime:      e.runTime,
+		Cycles:       e.exec.Cycles(),
+		Clock:        e.clock,
+		DecodeHits:   hits,
+		DecodeMisses: misses,
+		StackDepth:   len(e.exec.Stack()),
+		FileHandles:  len(e.fileHandles),
+		RepeatPrefix: e.exec.RepeatPrefix(),
+	}
+}
+
+func (e *DOSEmulator) HandleInterrupt(intNum byte) {
+	switch intNum {
+	case 0x00:
+		e.divideOverflow()
+	case 0x06:
+		e.invalidOpcode()
+	case 0x20:
+		e.terminate(0, exitNormal)
+	case 0x21:
+		e.handleInt21()
+	default:
+		if !e.bios.HandleInterrupt(intNum) && e.debugMode {
+			fmt.Printf("Unhandled interrupt: 0x%02X (AH=0x%02X)\n", intNum, e.cpu.GetAH())
+		}
+	}
+}
+
+// haltCycles is the step in processor cycles by which time advances
+// while the CPU is halted.
+const haltCycles = 256
+
+// Halt is called by the CPU when it executes HLT. With interrupts enabled
+// the CPU waits for the next hardware interrupt; otherwise nothing can
+// wake it and Run stops.
+func (e *DOSEmulator) Halt() {
+	if e.cpu.Flags.IF && !e.pic.Masked() {
+		e.halted = true
+		return
+	}
+	e.running = false
+}
+
+// waitForInterrupt lets time pass while the CPU is halted until the PIC
+// has an interrupt ready. It returns false if none arrives within two
+// timer periods.
+func (e *DOSEmulator) waitForInterrupt() bool {
+	limit := uint64(2*0x10000) << 16 / e.pitStep
+	for waited := uint64(0); waited < limit; waited += haltCycles {
+		if e.pic.Pending() {
+			e.halted = false
+			e.throttle()
+			return true
+		}
+		e.advanceClock(haltCycles)
+	}
+	return false
+}
+
+// serviceInterrupts delivers a pending hardware interrupt if the CPU has
+// interrupts enabled and the last instruction did not load SS.
+func (e *DOSEmulator) serviceInterrupts() {
+	if !e.cpu.Flags.IF || e.exec.InterruptsInhibited() {
+		return
+	}
+	if vector, ok := e.pic.Acknowledge(); ok {
+		e.exec.Interrupt(vector)
+	}
+}
+
+func (e *DOSEmulator) Run() {
+	if !e.debugMode {
+		fmt.Printf("Running %s program...\n", e.programType)
+	}
+	e.mon.disarm()
+	e.execute(false)
+	if !e.debugMode {
+		fmt.Println()
+	}
+}
+
+// execute runs the program from CS:IP until it ends. At a breakpoint or
+// a stop the monitor armed it enters the monitor, or in a DEBUG session
+// returns the reason with true, leaving the program to be resumed. When
+// resuming, the instruction at CS:IP runs without being checked, so that
+// the program can continue from a breakpoint.
+func (e *DOSEmulator) execute(resuming bool) (string, bool) {
+	e.running = true
+	e.halted = false
+	maxInstructions := uint64(100000000)
+	start := time.Now()
+	defer func() { e.runTime += time.Since(start) }()
+	e.resetThrottle()
+	e.watchHit = nil
+
+	for e.running && e.instructionCount < maxInstructions {
+		if e.rec != nil {
+			e.recordEntry()
+		}
+		if e.halted && !e.waitForInterrupt() {
+			if e.debugMode {
+				fmt.Println("CPU halted with no interrupt pending")
+			}
+			break
+		}
+		e.serviceInterrupts()
+
+		addr := memory.CalculateAddress(e.cpu.CS, e.cpu.IP)
+		inst := e.cache.Decode(e.cpu.CS, e.cpu.IP)
+
+		if (e.mon.armed() || len(e.breakpoints) != 0 || len(e.watchpoints) != 0) && !resuming {
+			if reason, stop := e.stopReason(addr, inst); stop {
+				if e.mon.session {
+					return reason, true
+				}
+				paused := time.Now()
+				e.showStop(reason)
+				resume := e.monitor()
+				e.watchHit = nil
+				start = start.Add(time.Since(paused))
+				e.resetThrottle()
+				if !resume {
+					e.running = false
+					break
+				}
+				// The monitor may have moved CS:IP or changed the code.
+				addr = memory.CalculateAddress(e.cpu.CS, e.cpu.IP)
+				inst = e.cache.Decode(e.cpu.CS, e.cpu.IP)
+			}
+		}
+		resuming = false
+
+		if e.debugMode || e.traceMode {
+			fmt.Printf("%04X:%04X  %-30s  AX=%04X BX=%04X CX=%04X DX=%04X SI=%04X DI=%04X REP=%02X\n",
+				e.cpu.CS, e.cpu.IP, inst.Disassemble(e.cpu.IP, nil),
+				e.cpu.AX, e.cpu.BX, e.cpu.CX, e.cpu.DX, e.cpu.SI, e.cpu.DI, e.exec.RepeatPrefix())
+		}
+
+		if e.stepMode {
+			fmt.Print("Press Enter (c=continue, q=quit)> ")
+			input, _ := e.input.ReadString('\n')
+			input = strings.TrimSpace(input)
+			if input == "c" {
+				e.stepMode = false
+			} else if input == "q" {
+				e.running = false
+				return "", false
+			}
+		}
+
+		cycles := e.exec.Cycles()
+		e.exec.Execute(inst)
+		e.instructionCount++
+		e.advanceClock(e.exec.Cycles() - cycles)
+		if e.rec != nil {
+			e.recordExecuted(inst)
+		}
+
+		if e.instructionCount%1024 == 0 {
+			e.bios.RefreshScreen()
+			e.throttle()
+			if e.mon.session && e.interrupt.Swap(false) {
+				return interruptedReason, true
+			}
+		}
+
+		if e.instructionCount%100000 == 0 && !e.debugMode && !e.bios.FullScreen() && !e.mon.session {
+			fmt.Print(".")
+		}
+	}
+
+	e.bios.FinishScreen()
+
+	if e.instructionCount >= maxInstructions {
+		fmt.Println("\nMaximum instruction count reached")
+	}
+	if e.exec.FlagCheck() {
+		fmt.Printf("\nFlag check: %d mismatches\n", e.exec.FlagMismatches())
+	}
+	return "", false
+}
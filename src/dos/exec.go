@@ -0,0 +1,199 @@
+package dos
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"dos-emulator/cpu"
+	"dos-emulator/loader"
+	"dos-emulator/memory"
+)
+
+// Termination types reported in AH by INT 21h AH=4Dh.
+const (
+	exitNormal   byte = 0x00
+	exitCtrlC    byte = 0x01
+	exitResident byte = 0x03
+)
+
+// DOS error codes returned by EXEC.
+const (
+	errInvalidFunction uint16 = 1
+	errFileNotFound    uint16 = 2
+	errInvalidFormat   uint16 = 11
+)
+
+// process is a parent program suspended by EXEC while its child runs.
+type process struct {
+	psp         uint16
+	programType string
+	registers   cpu.CPU
+	dtaSegment  uint16
+	dtaOffset   uint16
+}
+
+// handleExec implements INT 21h AH=4Bh AL=00h: load and run the program
+// named by the ASCIIZ string at DS:DX with the parameter block at ES:BX.
+//
+// The parent's registers are saved, including CS:IP and SS:SP, which at
+// this point address the INT 21h stub and the parent's interrupt frame.
+// The child starts through the stub's IRET: a frame with the child's
+// entry point is pushed on the child's stack. When the child terminates
+// the parent's registers are restored and the same IRET returns to the
+// parent with CF clear.
+func (e *DOSEmulator) handleExec() {
+	if e.cpu.GetAL() != 0x00 {
+		e.execFailed(errInvalidFunction)
+		return
+	}
+
+	filename := e.readNullTerminatedString(memory.CalculateAddress(e.cpu.DS, e.cpu.DX))
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		e.execFailed(errFileNotFound)
+		return
+	}
+
+	env, err := e.execEnvironment(filename)
+	if err != nil {
+		e.execFailed(errInsufficientMemory)
+		return
+	}
+
+	var image *loader.Image
+	var psp uint16
+	programType := "COM"
+	if loader.IsEXE(data) {
+		programType = "EXE"
+		image, psp, err = e.loadEXE(filename, data, e.psp)
+	} else {
+		image, psp, err = e.loadCOM(filename, data, e.psp)
+	}
+	if err != nil {
+		e.freeMemory(env)
+		if errors.Is(err, errNoMemory) {
+			e.execFailed(errInsufficientMemory)
+		} else {
+			e.execFailed(errInvalidFormat)
+		}
+		return
+	}
+
+	e.setEnvironment(psp, env)
+	e.copyExecParameters(psp)
+
+	e.processes = append(e.processes, process{
+		psp:         e.psp,
+		programType: e.programType,
+		registers:   *e.cpu,
+		dtaSegment:  e.dtaSegment,
+		dtaOffset:   e.dtaOffset,
+	})
+
+	stub := e.cpu.CS
+	e.startProgram(image, psp, programType)
+	e.cpu.SP -= 6
+	frame := memory.CalculateAddress(e.cpu.SS, e.cpu.SP)
+	e.memory.Write16(frame, image.IP)
+	e.memory.Write16(frame+2, image.CS)
+	e.memory.Write16(frame+4, e.cpu.Flags.ToUint16())
+	e.cpu.CS = stub
+	e.cpu.IP = e.processes[len(e.processes)-1].registers.IP
+
+	if e.debugMode {
+		fmt.Printf("EXEC %s: PSP=%04X entry %04X:%04X\n", filepath.Base(filename), psp, image.CS, image.IP)
+	}
+}
+
+// execEnvironment copies the environment for the child program named
+// filename into a new block, before the child's own block is allocated.
+// The source is the segment in the EXEC parameter block at ES:BX, or the
+// parent's environment if that is 0.
+func (e *DOSEmulator) execEnvironment(filename string) (uint16, error) {
+	env := e.memory.Read16(memory.CalculateAddress(e.cpu.ES, e.cpu.BX))
+	if env == 0 {
+		env = e.memory.Read16(memory.CalculateAddress(e.psp, 0x2C))
+	}
+	return e.copyEnvironment(env, filename)
+}
+
+// copyExecParameters copies the command tail and FCBs from the EXEC
+// parameter block at ES:BX into the child's PSP.
+func (e *DOSEmulator) copyExecParameters(psp uint16) {
+	block := memory.CalculateAddress(e.cpu.ES, e.cpu.BX)
+	pspAddr := memory.CalculateAddress(psp, 0)
+
+	e.copyFarBlock(block+2, pspAddr+0x80, 128)
+	e.copyFarBlock(block+6, pspAddr+0x5C, 16)
+	e.copyFarBlock(block+10, pspAddr+0x6C, 20)
+}
+
+// copyFarBlock copies n bytes from the far pointer stored at ptr to dst.
+// A null pointer leaves dst unchanged.
+func (e *DOSEmulator) copyFarBlock(ptr, dst uint32, n uint32) {
+	offset := e.memory.Read16(ptr)
+	segment := e.memory.Read16(ptr + 2)
+	if segment == 0 && offset == 0 {
+		return
+	}
+	src := memory.CalculateAddress(segment, offset)
+	for i := uint32(0); i < n; i++ {
+		e.memory.Write8(dst+i, e.memory.Read8(src+i))
+	}
+}
+
+func (e *DOSEmulator) execFailed(errCode uint16) {
+	e.cpu.Flags.SetCF(true)
+	e.cpu.AX = errCode
+}
+
+// terminate ends the current program with exitCode. If it was started
+// by EXEC the parent resumes, otherwise Run stops. Unless the program
+// stays resident, its memory is released.
+func (e *DOSEmulator) terminate(exitCode, exitType byte) {
+	if exitType != exitResident {
+		e.releaseMemory(e.psp)
+	}
+	e.returnCode = uint16(exitType)<<8 | uint16(exitCode)
+
+	if e.debugMode {
+		fmt.Printf("\nProgram exited with code: %d\n", exitCode)
+	}
+
+	if len(e.processes) == 0 {
+		e.running = false
+		return
+	}
+
+	parent := e.processes[len(e.processes)-1]
+	e.processes = e.processes[:len(e.processes)-1]
+	e.psp = parent.psp
+	e.programType = parent.programType
+	e.dtaSegment = parent.dtaSegment
+	e.dtaOffset = parent.dtaOffset
+	*e.cpu = parent.registers
+	e.cpu.Flags.SetCF(false)
+}
+
+// divideOverflow is the default INT 0 handler DOS installs: like MS-DOS
+// it reports the error and aborts the program as Ctrl-C would.
+func (e *DOSEmulator) divideOverflow() {
+	for _, char := range []byte("\r\nDivide overflow\r\n") {
+		e.bios.WriteChar(char)
+	}
+	e.terminate(0, exitCtrlC)
+}
+
+// invalidOpcode is the default INT 6 handler. A PC has none, so the
+// faulting instruction would be retried forever; the emulator reports
+// the address from the interrupt frame and aborts the program instead.
+func (e *DOSEmulator) invalidOpcode() {
+	frame := memory.CalculateAddress(e.cpu.SS, e.cpu.SP)
+	message := fmt.Sprintf("\r\nInvalid opcode at %04X:%04X\r\n", e.memory.Read16(frame+2), e.memory.Read16(frame))
+	for _, char := range []byte(message) {
+		e.bios.WriteChar(char)
+	}
+	e.terminate(0, exitCtrlC)
+}
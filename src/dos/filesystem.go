@@ -0,0 +1,15 @@
+package dos
+
+import "os"
+
+type FileSystem struct {
+	currentDir   string
+	currentDrive byte
+	drives       map[byte]string
+}
+
+type FileHandle struct {
+	file     *os.File
+	handle   uint16
+	position int64
+}
@@ -0,0 +1,276 @@
+package dos
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"dos-emulator/memory"
+)
+
+// Layout of the 43-byte Disk Transfer Area filled in by FindFirst and
+// FindNext. The first 21 bytes are reserved for DOS; they hold the state
+// of the search so that a program can keep several searches going with
+// different DTAs.
+const (
+	dtaDrive     = 0x00 // drive number, 1 = A:
+	dtaTemplate  = 0x01 // 11-byte FCB-style name template
+	dtaSearchAtr = 0x0C // attribute mask from CX
+	dtaEntry     = 0x0D // index of the next directory entry to examine
+	dtaDirID     = 0x0F // key into DOSEmulator.searchDirs
+	dtaAttribute = 0x15
+	dtaTime      = 0x16
+	dtaDate      = 0x18
+	dtaSize      = 0x1A
+	dtaName      = 0x1E
+)
+
+// File attributes.
+const (
+	attrReadOnly  byte = 0x01
+	attrHidden    byte = 0x02
+	attrSystem    byte = 0x04
+	attrDirectory byte = 0x10
+	attrArchive   byte = 0x20
+)
+
+const errNoMoreFiles uint16 = 18
+
+func (e *DOSEmulator) dtaAddress() uint32 {
+	return memory.CalculateAddress(e.dtaSegment, e.dtaOffset)
+}
+
+// hostPath converts a DOS path to a host path: the drive letter is
+// dropped, backslashes become separators and a rooted path is taken
+// relative to the directory backing the current drive.
+func (e *DOSEmulator) hostPath(path string) string {
+	if len(path) >= 2 && path[1] == ':' {
+		path = path[2:]
+	}
+	path = strings.ReplaceAll(path, "\\", "/")
+	if strings.HasPrefix(path, "/") {
+		if root, ok := e.fs.drives[e.fs.currentDrive]; ok {
+			return filepath.Join(root, path)
+		}
+	}
+	return path
+}
+
+// dosPath converts a host path to the full DOS path of the same file,
+// the reverse of hostPath: the current drive's letter, then the path
+// below the directory backing the drive with backslashes. Names keep
+// their host case, so that hostPath finds the file again. A file outside
+// the drive keeps all its host directories.
+func (e *DOSEmulator) dosPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	if root, ok := e.fs.drives[e.fs.currentDrive]; ok {
+		if rel, err := filepath.Rel(root, path); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			path = rel
+		}
+	}
+	path = strings.TrimPrefix(filepath.ToSlash(path), "/")
+	if path == "." {
+		path = ""
+	}
+	return string(rune('A'+e.fs.currentDrive)) + ":\\" + strings.ReplaceAll(path, "/", "\\")
+}
+
+// searchDirID returns the key under which dir is remembered for FindNext.
+func (e *DOSEmulator) searchDirID(dir string) uint16 {
+	for id, d := range e.searchDirs {
+		if d == dir {
+			return uint16(id)
+		}
+	}
+	e.searchDirs = append(e.searchDirs, dir)
+	return uint16(len(e.searchDirs) - 1)
+}
+
+// fcbTemplate splits a file name into the blank-padded 8.3 form used by
+// FCBs, turning '*' into a run of '?'. It reports false if the name does
+// not fit in 8.3.
+func fcbTemplate(name string) ([11]byte, bool) {
+	var t [11]byte
+	for i := range t {
+		t[i] = ' '
+	}
+	base, ext, _ := strings.Cut(strings.ToUpper(name), ".")
+	if name == "." || name == ".." {
+		base, ext = name, ""
+	}
+	if len(base) > 8 || len(ext) > 3 || strings.Contains(ext, ".") {
+		return t, false
+	}
+
+	fill := func(dst []byte, s string) {
+		for i := 0; i < len(s); i++ {
+			if s[i] == '*' {
+				for j := i; j < len(dst); j++ {
+					dst[j] = '?'
+				}
+				return
+			}
+			dst[i] = s[i]
+		}
+	}
+	fill(t[:8], base)
+	fill(t[8:], ext)
+	return t, true
+}
+
+// templateName turns an 8.3 name in FCB form back into the name DOS
+// shows, such as "HELLO.COM".
+func templateName(t [11]byte) string {
+	name := strings.TrimRight(string(t[:8]), " ")
+	if ext := strings.TrimRight(string(t[8:]), " "); ext != "" {
+		name += "." + ext
+	}
+	return name
+}
+
+// matchTemplate reports whether the 8.3 name matches template, where '?'
+// matches any character including padding.
+func matchTemplate(template, name [11]byte) bool {
+	for i := range template {
+		if template[i] != '?' && template[i] != name[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// fileAttributes derives DOS attributes from host file information.
+func fileAttributes(name string, info os.FileInfo) byte {
+	var attr byte
+	if info.IsDir() {
+		attr |= attrDirectory
+	} else {
+		attr |= attrArchive
+	}
+	if info.Mode().Perm()&0200 == 0 {
+		attr |= attrReadOnly
+	}
+	if strings.HasPrefix(name, ".") {
+		attr |= attrHidden
+	}
+	return attr
+}
+
+func (e *DOSEmulator) handleSetDTA() {
+	e.dtaSegment = e.cpu.DS
+	e.dtaOffset = e.cpu.DX
+}
+
+func (e *DOSEmulator) handleGetDTA() {
+	e.cpu.ES = e.dtaSegment
+	e.cpu.BX = e.dtaOffset
+}
+
+// handleFindFirst implements INT 21h AH=4Eh: start a search for the
+// files matching the ASCIIZ pattern at DS:DX with attribute mask CX.
+func (e *DOSEmulator) handleFindFirst() {
+	addr := memory.CalculateAddress(e.cpu.DS, e.cpu.DX)
+	pattern := e.hostPath(e.readNullTerminatedString(addr))
+
+	dir, name := filepath.Split(pattern)
+	if dir == "" {
+		dir = "."
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		e.cpu.Flags.SetCF(true)
+		e.cpu.AX = 3
+		return
+	}
+
+	template, ok := fcbTemplate(name)
+	if !ok {
+		e.cpu.Flags.SetCF(true)
+		e.cpu.AX = 2
+		return
+	}
+
+	dta := e.dtaAddress()
+	e.memory.Write8(dta+dtaDrive, e.fs.currentDrive+1)
+	for i, ch := range template {
+		e.memory.Write8(dta+dtaTemplate+uint32(i), ch)
+	}
+	e.memory.Write8(dta+dtaSearchAtr, byte(e.cpu.CX))
+	e.memory.Write16(dta+dtaEntry, 0)
+	e.memory.Write16(dta+dtaDirID, e.searchDirID(dir))
+
+	e.handleFindNext()
+}
+
+// handleFindNext implements INT 21h AH=4Fh: continue the search whose
+// state is in the current DTA.
+func (e *DOSEmulator) handleFindNext() {
+	dta := e.dtaAddress()
+	var template [11]byte
+	for i := range template {
+		template[i] = e.memory.Read8(dta + dtaTemplate + uint32(i))
+	}
+	mask := e.memory.Read8(dta + dtaSearchAtr)
+	entry := int(e.memory.Read16(dta + dtaEntry))
+	id := int(e.memory.Read16(dta + dtaDirID))
+
+	if id >= len(e.searchDirs) {
+		e.cpu.Flags.SetCF(true)
+		e.cpu.AX = errNoMoreFiles
+		return
+	}
+	files, err := os.ReadDir(e.searchDirs[id])
+	if err != nil {
+		e.cpu.Flags.SetCF(true)
+		e.cpu.AX = errNoMoreFiles
+		return
+	}
+
+	for ; entry < len(files); entry++ {
+		file := files[entry]
+		name, ok := fcbTemplate(file.Name())
+		if !ok || !matchTemplate(template, name) {
+			continue
+		}
+		info, err := file.Info()
+		if err != nil {
+			continue
+		}
+		attr := fileAttributes(file.Name(), info)
+		if attr&(attrHidden|attrSystem|attrDirectory)&^mask != 0 {
+			continue
+		}
+
+		e.memory.Write16(dta+dtaEntry, uint16(entry+1))
+		e.writeFoundEntry(dta, templateName(name), attr, info)
+		e.cpu.Flags.SetCF(false)
+		return
+	}
+
+	e.memory.Write16(dta+dtaEntry, uint16(entry))
+	e.cpu.Flags.SetCF(true)
+	e.cpu.AX = errNoMoreFiles
+}
+
+// writeFoundEntry fills in the public part of the DTA for a match, whose
+// name is in the uppercase 8.3 form.
+func (e *DOSEmulator) writeFoundEntry(dta uint32, name string, attr byte, info os.FileInfo) {
+	modTime := info.ModTime()
+	e.memory.Write8(dta+dtaAttribute, attr)
+	e.memory.Write16(dta+dtaTime, uint16((modTime.Hour()<<11)|(modTime.Minute()<<5)|(modTime.Second()/2)))
+	e.memory.Write16(dta+dtaDate, uint16(((modTime.Year()-1980)<<9)|(int(modTime.Month())<<5)|modTime.Day()))
+	size := uint32(info.Size())
+	if info.IsDir() {
+		size = 0
+	}
+	e.memory.Write16(dta+dtaSize, uint16(size))
+	e.memory.Write16(dta+dtaSize+2, uint16(size>>16))
+	for i := uint32(0); i < 13; i++ {
+		var ch byte
+		if int(i) < len(name) {
+			ch = name[i]
+		}
+		e.memory.Write8(dta+dtaName+i, ch)
+	}
+}
@@ -0,0 +1,197 @@
+package dos
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"dos-emulator/cpu"
+	"dos-emulator/memory"
+)
+
+func TestMatchTemplate(t *testing.T) {
+	tests := []struct {
+		pattern, name string
+		match         bool
+	}{
+		{"*.*", "HELLO.COM", true},
+		{"*.*", "README", true},
+		{"*", "README", true},
+		{"*", "HELLO.COM", false},
+		{"*.COM", "hello.com", true},
+		{"*.COM", "HELLO.EXE", false},
+		{"H?LLO.C?M", "HALLO.CIM", true},
+		{"H?LLO.C?M", "HELLO.EXE", false},
+		{"HE*.*", "HELLO.COM", true},
+		{"HE*.*", "HI.COM", false},
+		{"HELLO?.COM", "HELLO.COM", true},
+		{"HELLO.COM", "HELLO.COMX", false},
+		{"A*B.*", "AXXB.TXT", true}, // the rest of the field after '*' is ignored
+		{"*.C*", "X.C", true},
+		{"????????.???", "LONGNAME.TXT", true},
+		{"*.*", "LONGFILENAME.TXT", false},
+	}
+	for _, test := range tests {
+		template, ok := fcbTemplate(test.pattern)
+		if !ok {
+			t.Fatalf("%s: not a valid template", test.pattern)
+		}
+		name, ok := fcbTemplate(test.name)
+		if got := ok && matchTemplate(template, name); got != test.match {
+			t.Errorf("%s matches %s: %v, want %v", test.pattern, test.name, got, test.match)
+		}
+	}
+}
+
+// newFindEmulator returns an emulator whose drive A: is dir, with the
+// DTA at 2000:0080.
+func newFindEmulator(dir string) *DOSEmulator {
+	return &DOSEmulator{
+		cpu:        &cpu.CPU{DS: 0x3000},
+		memory:     memory.New(),
+		fs:         &FileSystem{currentDir: dir, drives: map[byte]string{0: dir}},
+		dtaSegment: 0x2000,
+		dtaOffset:  0x0080,
+	}
+}
+
+// findAll runs FindFirst for pattern with attribute mask attr and
+// FindNext until no more files match. It returns the names and
+// attributes found and the error code that ended the search.
+func findAll(e *DOSEmulator, pattern string, attr uint16) ([]string, []byte, uint16) {
+	addr := memory.CalculateAddress(e.cpu.DS, 0)
+	for i := 0; i < len(pattern); i++ {
+		e.memory.Write8(addr+uint32(i), pattern[i])
+	}
+	e.memory.Write8(addr+uint32(len(pattern)), 0)
+	e.cpu.DX, e.cpu.CX = 0, attr
+
+	var names []string
+	var attrs []byte
+	e.handleFindFirst()
+	for !e.cpu.Flags.CF() {
+		dta := e.dtaAddress()
+		names = append(names, e.readNullTerminatedString(dta+dtaName))
+		attrs = append(attrs, e.memory.Read8(dta+dtaAttribute))
+		e.handleFindNext()
+	}
+	return names, attrs, e.cpu.AX
+}
+
+func TestFindFirstNext(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"HELLO.COM", "hello.exe", "ReadMe", "RO.TXT", ".x", "sub/Inner.dat"} {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	os.Chmod(filepath.Join(dir, "RO.TXT"), 0444)
+
+	// Names are matched and returned in uppercase whatever their case on
+	// the host, in the order of the host directory.
+
+	tests := []struct {
+		pattern string
+		attr    uint16
+		names   []string
+		err     uint16
+	}{
+		{`\*.*`, 0, []string{"HELLO.COM", "RO.TXT", "README", "HELLO.EXE"}, errNoMoreFiles},
+		{`A:\*.*`, 0x10, []string{"HELLO.COM", "RO.TXT", "README", "HELLO.EXE", "SUB"}, errNoMoreFiles},
+		{`\*.*`, 0x12, []string{".X", "HELLO.COM", "RO.TXT", "README", "HELLO.EXE", "SUB"}, errNoMoreFiles},
+		{`\*`, 0x10, []string{"README", "SUB"}, errNoMoreFiles},
+		{`\HELLO.*`, 0, []string{"HELLO.COM", "HELLO.EXE"}, errNoMoreFiles},
+		{`\H?LLO.?OM`, 0, []string{"HELLO.COM"}, errNoMoreFiles},
+		{`\sub\*.DAT`, 0, []string{"INNER.DAT"}, errNoMoreFiles},
+		{`\NONE.*`, 0x16, nil, errNoMoreFiles},
+		{`\MISSING\*.*`, 0, nil, 3},
+		{`\LONGFILENAME.*`, 0, nil, 2},
+	}
+	for _, test := range tests {
+		e := newFindEmulator(dir)
+		names, _, errCode := findAll(e, test.pattern, test.attr)
+		if !reflect.DeepEqual(names, test.names) || errCode != test.err {
+			t.Errorf("%s with attributes %02X: found %v, error %d; want %v, error %d",
+				test.pattern, test.attr, names, errCode, test.names, test.err)
+		}
+	}
+}
+
+func TestFindAttributes(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "RO.TXT"), nil, 0444)
+	os.WriteFile(filepath.Join(dir, "RW.TXT"), nil, 0644)
+	os.Mkdir(filepath.Join(dir, "SUB"), 0755)
+
+	e := newFindEmulator(dir)
+	names, attrs, _ := findAll(e, `\*.*`, 0x10)
+	want := []byte{attrArchive | attrReadOnly, attrArchive, attrDirectory}
+	if !reflect.DeepEqual(names, []string{"RO.TXT", "RW.TXT", "SUB"}) || !reflect.DeepEqual(attrs, want) {
+		t.Errorf("found %v with attributes %02X, want attributes %02X", names, attrs, want)
+	}
+}
+
+// TestFindInterleaved keeps two searches going with different DTAs: the
+// state of each lives in its DTA.
+func TestFindInterleaved(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"A.COM", "B.COM", "C.EXE", "D.EXE"} {
+		os.WriteFile(filepath.Join(dir, name), nil, 0644)
+	}
+	e := newFindEmulator(dir)
+	search := func(dtaOffset uint16, pattern string) string {
+		e.dtaOffset = dtaOffset
+		if pattern != "" {
+			addr := memory.CalculateAddress(e.cpu.DS, 0)
+			for i := 0; i < len(pattern); i++ {
+				e.memory.Write8(addr+uint32(i), pattern[i])
+			}
+			e.memory.Write8(addr+uint32(len(pattern)), 0)
+			e.cpu.DX, e.cpu.CX = 0, 0
+			e.handleFindFirst()
+		} else {
+			e.handleFindNext()
+		}
+		if e.cpu.Flags.CF() {
+			return ""
+		}
+		return e.readNullTerminatedString(e.dtaAddress() + dtaName)
+	}
+
+	got := []string{
+		search(0x100, `\*.COM`),
+		search(0x200, `\*.EXE`),
+		search(0x100, ""),
+		search(0x200, ""),
+		search(0x100, ""),
+	}
+	want := []string{"A.COM", "C.EXE", "B.COM", "D.EXE", ""}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("found %q, want %q", got, want)
+	}
+}
+
+func TestDOSPath(t *testing.T) {
+	dir := t.TempDir()
+	e := newFindEmulator(dir)
+	tests := []struct {
+		host, dos string
+	}{
+		{filepath.Join(dir, "HELLO.COM"), `A:\HELLO.COM`},
+		{filepath.Join(dir, "games", "Run.exe"), `A:\games\Run.exe`},
+		{filepath.Join(dir+"x", "P.COM"), `A:\` + strings.ReplaceAll(strings.TrimPrefix(dir+"x/P.COM", "/"), "/", `\`)},
+	}
+	for _, test := range tests {
+		got := e.dosPath(test.host)
+		if got != test.dos {
+			t.Errorf("%s: DOS path %s, want %s", test.host, got, test.dos)
+		}
+		if back := e.hostPath(got); strings.HasPrefix(test.host, dir+"/") && back != test.host {
+			t.Errorf("%s: back to host path %s", test.host, back)
+		}
+	}
+}
@@ -0,0 +1,447 @@
+package dos
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"dos-emulator/memory"
+)
+
+func (e *DOSEmulator) handleInt21() {
+	ah := e.cpu.GetAH()
+
+	switch ah {
+	case 0x00:
+		e.terminate(0, exitNormal)
+	case 0x01:
+		e.bios.FlushScreen()
+		char, _ := e.input.ReadByte()
+		e.bios.WriteChar(char)
+		e.cpu.SetAL(char)
+	case 0x02:
+		e.bios.WriteChar(e.cpu.GetDL())
+	case 0x06:
+		dl := e.cpu.GetDL()
+		if dl == 0xFF {
+			e.bios.FlushScreen()
+			char, err := e.input.ReadByte()
+			if err == nil {
+				e.cpu.SetAL(char)
+				e.cpu.Flags.SetZF(false)
+			} else {
+				e.cpu.Flags.SetZF(true)
+			}
+		} else {
+			e.bios.WriteChar(dl)
+		}
+	case 0x07, 0x08:
+		e.bios.FlushScreen()
+		char, _ := e.input.ReadByte()
+		e.cpu.SetAL(char)
+	case 0x09:
+		addr := memory.CalculateAddress(e.cpu.DS, e.cpu.DX)
+		for {
+			ch := e.memory.Read8(addr)
+			if ch == '$' {
+				break
+			}
+			e.bios.WriteChar(ch)
+			addr++
+		}
+	case 0x0A:
+		e.bios.FlushScreen()
+		input, _ := e.input.ReadString('\n')
+		input = strings.TrimRight(input, "\r\n")
+		addr := memory.CalculateAddress(e.cpu.DS, e.cpu.DX)
+		maxLen := e.memory.Read8(addr)
+		if len(input) > int(maxLen) {
+			input = input[:maxLen]
+		}
+		e.memory.Write8(addr+1, byte(len(input)))
+		for i, ch := range input {
+			e.memory.Write8(addr+2+uint32(i), byte(ch))
+		}
+	case 0x0E:
+		e.fs.currentDrive = e.cpu.GetDL()
+		e.cpu.SetAL(26)
+	case 0x19:
+		e.cpu.SetAL(e.fs.currentDrive)
+	case 0x1A:
+		e.handleSetDTA()
+	case 0x25:
+		vector := uint32(e.cpu.GetAL()) * 4
+		e.memory.Write16(vector, e.cpu.DX)
+		e.memory.Write16(vector+2, e.cpu.DS)
+	case 0x2A:
+		now := time.Now()
+		e.cpu.CX = uint16(now.Year())
+		e.cpu.SetDH(byte(now.Month()))
+		e.cpu.SetDL(byte(now.Day()))
+		e.cpu.SetAL(byte(now.Weekday()))
+	case 0x2C:
+		now := time.Now()
+		e.cpu.SetCH(byte(now.Hour()))
+		e.cpu.SetCL(byte(now.Minute()))
+		e.cpu.SetDH(byte(now.Second()))
+		e.cpu.SetDL(byte(now.Nanosecond() / 10000000))
+	case 0x2F:
+		e.handleGetDTA()
+	case 0x30:
+		e.cpu.SetAL(5)
+		e.cpu.SetAH(0)
+		e.cpu.BX = 0
+		e.cpu.CX = 0
+	case 0x31:
+		e.resizeMemory(e.psp, e.cpu.DX)
+		e.terminate(e.cpu.GetAL(), exitResident)
+	case 0x35:
+		vector := uint32(e.cpu.GetAL()) * 4
+		e.cpu.BX = e.memory.Read16(vector)
+		e.cpu.ES = e.memory.Read16(vector + 2)
+	case 0x39:
+		addr := memory.CalculateAddress(e.cpu.DS, e.cpu.DX)
+		dirname := e.readNullTerminatedString(addr)
+		err := os.Mkdir(dirname, 0755)
+		if err != nil {
+			e.cpu.Flags.SetCF(true)
+			e.cpu.AX = 3
+		} else {
+			e.cpu.Flags.SetCF(false)
+		}
+	case 0x3A:
+		addr := memory.CalculateAddress(e.cpu.DS, e.cpu.DX)
+		dirname := e.readNullTerminatedString(addr)
+		err := os.Remove(dirname)
+		if err != nil {
+			e.cpu.Flags.SetCF(true)
+			e.cpu.AX = 3
+		} else {
+			e.cpu.Flags.SetCF(false)
+		}
+	case 0x3B:
+		addr := memory.CalculateAddress(e.cpu.DS, e.cpu.DX)
+		dirname := e.readNullTerminatedString(addr)
+		err := os.Chdir(dirname)
+		if err != nil {
+			e.cpu.Flags.SetCF(true)
+			e.cpu.AX = 3
+		} else {
+			e.fs.currentDir, _ = os.Getwd()
+			e.cpu.Flags.SetCF(false)
+		}
+	case 0x3C:
+		e.handleCreateFile()
+	case 0x3D:
+		e.handleOpenFile()
+	case 0x3E:
+		e.handleCloseFile()
+	case 0x3F:
+		e.handleReadFile()
+	case 0x40:
+		e.handleWriteFile()
+	case 0x41:
+		e.handleDeleteFile()
+	case 0x42:
+		e.handleSeekFile()
+	case 0x43:
+		e.handleFileAttributes()
+	case 0x47:
+		e.handleGetCurrentDir()
+	case 0x48:
+		segment, largest, errCode := e.allocateMemory(e.cpu.BX, e.psp)
+		if errCode != 0 {
+			e.cpu.Flags.SetCF(true)
+			e.cpu.AX = errCode
+			e.cpu.BX = largest
+		} else {
+			e.cpu.Flags.SetCF(false)
+			e.cpu.AX = segment
+		}
+	case 0x49:
+		if errCode := e.freeMemory(e.cpu.ES); errCode != 0 {
+			e.cpu.Flags.SetCF(true)
+			e.cpu.AX = errCode
+		} else {
+			e.cpu.Flags.SetCF(false)
+		}
+	case 0x4A:
+		if largest, errCode := e.resizeMemory(e.cpu.ES, e.cpu.BX); errCode != 0 {
+			e.cpu.Flags.SetCF(true)
+			e.cpu.AX = errCode
+			if errCode == errInsufficientMemory {
+				e.cpu.BX = largest
+			}
+		} else {
+			e.cpu.Flags.SetCF(false)
+		}
+	case 0x4B:
+		e.handleExec()
+	case 0x4C:
+		e.terminate(e.cpu.GetAL(), exitNormal)
+	case 0x4D:
+		e.cpu.AX = e.returnCode
+		e.returnCode = 0
+	case 0x4E:
+		e.handleFindFirst()
+	case 0x4F:
+		e.handleFindNext()
+	case 0x51, 0x62:
+		e.cpu.BX = e.psp
+	case 0x56:
+		e.handleRenameFile()
+	default:
+		if e.debugMode {
+			fmt.Printf("Unhandled INT 21h function: AH=0x%02X\n", ah)
+		}
+	}
+}
+
+func (e *DOSEmulator) handleCreateFile() {
+	addr := memory.CalculateAddress(e.cpu.DS, e.cpu.DX)
+	filename := e.readNullTerminatedString(addr)
+
+	file, err := os.Create(filename)
+	if err != nil {
+		e.cpu.Flags.SetCF(true)
+		e.cpu.AX = 3
+		return
+	}
+
+	handle := e.nextHandle
+	e.nextHandle++
+	e.fileHandles[handle] = &FileHandle{file: file, handle: handle}
+
+	e.cpu.AX = handle
+	e.cpu.Flags.SetCF(false)
+}
+
+func (e *DOSEmulator) handleOpenFile() {
+	addr := memory.CalculateAddress(e.cpu.DS, e.cpu.DX)
+	filename := e.readNullTerminatedString(addr)
+	mode := e.cpu.GetAL()
+
+	var file *os.File
+	var err error
+
+	switch mode & 0x03 {
+	case 0:
+		file, err = os.Open(filename)
+	case 1:
+		file, err = os.OpenFile(filename, os.O_WRONLY, 0644)
+	case 2:
+		file, err = os.OpenFile(filename, os.O_RDWR, 0644)
+	}
+
+	if err != nil {
+		e.cpu.Flags.SetCF(true)
+		e.cpu.AX = 2
+		return
+	}
+
+	handle := e.nextHandle
+	e.nextHandle++
+	e.fileHandles[handle] = &FileHandle{file: file, handle: handle}
+
+	e.cpu.AX = handle
+	e.cpu.Flags.SetCF(false)
+}
+
+func (e *DOSEmulator) handleCloseFile() {
+	handle := e.cpu.BX
+
+	if handle <= 2 {
+		e.cpu.Flags.SetCF(false)
+		return
+	}
+
+	if fh, ok := e.fileHandles[handle]; ok {
+		fh.file.Close()
+		delete(e.fileHandles, handle)
+		e.cpu.Flags.SetCF(false)
+	} else {
+		e.cpu.Flags.SetCF(true)
+		e.cpu.AX = 6
+	}
+}
+
+func (e *DOSEmulator) handleReadFile() {
+	handle := e.cpu.BX
+	count := e.cpu.CX
+	addr := memory.CalculateAddress(e.cpu.DS, e.cpu.DX)
+
+	if fh, ok := e.fileHandles[handle]; ok {
+		buffer := make([]byte, count)
+		var n int
+		if fh.file == os.Stdin {
+			n, _ = e.input.Read(buffer)
+		} else {
+			n, _ = fh.file.Read(buffer)
+		}
+
+		for i := 0; i < n; i++ {
+			e.memory.Write8(addr+uint32(i), buffer[i])
+		}
+
+		e.cpu.AX = uint16(n)
+		e.cpu.Flags.SetCF(false)
+	} else {
+		e.cpu.Flags.SetCF(true)
+		e.cpu.AX = 6
+	}
+}
+
+func (e *DOSEmulator) handleWriteFile() {
+	handle := e.cpu.BX
+	count := e.cpu.CX
+	addr := memory.CalculateAddress(e.cpu.DS, e.cpu.DX)
+
+	if handle == 1 || handle == 2 {
+		for i := uint16(0); i < count; i++ {
+			e.bios.WriteChar(e.memory.Read8(addr + uint32(i)))
+		}
+		e.cpu.AX = count
+		e.cpu.Flags.SetCF(false)
+		return
+	}
+
+	if fh, ok := e.fileHandles[handle]; ok {
+		buffer := make([]byte, count)
+		for i := uint16(0); i < count; i++ {
+			buffer[i] = e.memory.Read8(addr + uint32(i))
+		}
+
+		n, _ := fh.file.Write(buffer)
+		e.cpu.AX = uint16(n)
+		e.cpu.Flags.SetCF(false)
+	} else {
+		e.cpu.Flags.SetCF(true)
+		e.cpu.AX = 6
+	}
+}
+
+func (e *DOSEmulator) handleDeleteFile() {
+	addr := memory.CalculateAddress(e.cpu.DS, e.cpu.DX)
+	filename := e.readNullTerminatedString(addr)
+
+	err := os.Remove(filename)
+	if err != nil {
+		e.cpu.Flags.SetCF(true)
+		e.cpu.AX = 2
+	} else {
+		e.cpu.Flags.SetCF(false)
+	}
+}
+
+func (e *DOSEmulator) handleSeekFile() {
+	handle := e.cpu.BX
+	method := e.cpu.GetAL()
+	offset := int64(uint32(e.cpu.CX)<<16 | uint32(e.cpu.DX))
+
+	if fh, ok := e.fileHandles[handle]; ok {
+		var whence int
+		switch method {
+		case 0:
+			whence = io.SeekStart
+		case 1:
+			whence = io.SeekCurrent
+		case 2:
+			whence = io.SeekEnd
+		}
+
+		newPos, err := fh.file.Seek(offset, whence)
+		if err != nil {
+			e.cpu.Flags.SetCF(true)
+			e.cpu.AX = 1
+		} else {
+			e.cpu.DX = uint16((newPos >> 16) & 0xFFFF)
+			e.cpu.AX = uint16(newPos & 0xFFFF)
+			e.cpu.Flags.SetCF(false)
+		}
+	} else {
+		e.cpu.Flags.SetCF(true)
+		e.cpu.AX = 6
+	}
+}
+
+func (e *DOSEmulator) handleFileAttributes() {
+	al := e.cpu.GetAL()
+	addr := memory.CalculateAddress(e.cpu.DS, e.cpu.DX)
+	filename := e.readNullTerminatedString(addr)
+
+	if al == 0 {
+		info, err := os.Stat(filename)
+		if err != nil {
+			e.cpu.Flags.SetCF(true)
+			e.cpu.AX = 2
+		} else {
+			attr := uint16(0)
+			if info.IsDir() {
+				attr = attr | 0x10
+			}
+			if info.Mode().Perm()&0200 == 0 {
+				attr = attr | 0x01
+			}
+			e.cpu.CX = attr
+			e.cpu.Flags.SetCF(false)
+		}
+	} else {
+		e.cpu.Flags.SetCF(false)
+	}
+}
+
+func (e *DOSEmulator) handleGetCurrentDir() {
+	drive := e.cpu.GetDL()
+	addr := memory.CalculateAddress(e.cpu.DS, e.cpu.SI)
+
+	currentDir := e.fs.currentDir
+	if drive != 0 {
+		if path, ok := e.fs.drives[drive-1]; ok {
+			currentDir = path
+		}
+	}
+
+	currentDir = strings.TrimPrefix(currentDir, e.fs.drives[e.fs.currentDrive])
+	currentDir = strings.TrimPrefix(currentDir, string(filepath.Separator))
+
+	for i, ch := range currentDir {
+		e.memory.Write8(addr+uint32(i), byte(ch))
+	}
+	e.memory.Write8(addr+uint32(len(currentDir)), 0)
+
+	e.cpu.Flags.SetCF(false)
+}
+
+func (e *DOSEmulator) handleRenameFile() {
+	addr1 := memory.CalculateAddress(e.cpu.DS, e.cpu.DX)
+	addr2 := memory.CalculateAddress(e.cpu.ES, e.cpu.DI)
+	oldName := e.readNullTerminatedString(addr1)
+	newName := e.readNullTerminatedString(addr2)
+
+	err := os.Rename(oldName, newName)
+	if err != nil {
+		e.cpu.Flags.SetCF(true)
+		e.cpu.AX = 2
+	} else {
+		e.cpu.Flags.SetCF(false)
+	}
+}
+
+func (e *DOSEmulator) readNullTerminatedString(addr uint32) string {
+	var result []byte
+	for {
+		ch := e.memory.Read8(addr)
+		if ch == 0 {
+			break
+		}
+		result = append(result, ch)
+		addr++
+		if len(result) > 256 {
+			break
+		}
+	}
+	return string(result)
+}
@@ -0,0 +1,262 @@
+package dos
+
+import (
+	"path/filepath"
+	"strings"
+
+	"dos-emulator/memory"
+)
+
+// The memory arena is a chain of Memory Control Blocks covering
+// conventional memory. Each MCB occupies the paragraph before the block
+// it describes: a signature byte ('M', or 'Z' for the last block), the
+// owning PSP segment (0 for a free block), the block size in paragraphs
+// and, for program blocks, the program name at offset 8.
+const (
+	arenaStart uint16 = 0x0FFF
+	arenaEnd   uint16 = 0xA000
+
+	mcbMember = 'M'
+	mcbLast   = 'Z'
+
+	// systemOwner marks blocks that belong to DOS itself.
+	systemOwner uint16 = 0x0008
+)
+
+// DOS error codes returned by the memory functions.
+const (
+	errArenaTrashed       uint16 = 7
+	errInsufficientMemory uint16 = 8
+	errInvalidBlock       uint16 = 9
+)
+
+type mcb struct {
+	segment uint16
+	sig     byte
+	owner   uint16
+	size    uint16
+}
+
+func (e *DOSEmulator) readMCB(segment uint16) mcb {
+	addr := memory.CalculateAddress(segment, 0)
+	return mcb{
+		segment: segment,
+		sig:     e.memory.Read8(addr),
+		owner:   e.memory.Read16(addr + 1),
+		size:    e.memory.Read16(addr + 3),
+	}
+}
+
+func (e *DOSEmulator) writeMCB(m mcb) {
+	addr := memory.CalculateAddress(m.segment, 0)
+	e.memory.Write8(addr, m.sig)
+	e.memory.Write16(addr+1, m.owner)
+	e.memory.Write16(addr+3, m.size)
+}
+
+// next returns the segment of the MCB following m.
+func (m mcb) next() uint16 {
+	return m.segment + m.size + 1
+}
+
+func (m mcb) valid() bool {
+	return m.sig == mcbMember || m.sig == mcbLast
+}
+
+// initArena resets conventional memory to a single free block.
+func (e *DOSEmulator) initArena() {
+	e.writeMCB(mcb{segment: arenaStart, sig: mcbLast, size: arenaEnd - arenaStart - 1})
+}
+
+// walkArena returns the MCB chain, or errArenaTrashed if a block header
+// has been overwritten.
+func (e *DOSEmulator) walkArena() ([]mcb, uint16) {
+	var blocks []mcb
+	segment := arenaStart
+	for {
+		m := e.readMCB(segment)
+		if !m.valid() || m.next() > arenaEnd {
+			return nil, errArenaTrashed
+		}
+		blocks = append(blocks, m)
+		if m.sig == mcbLast {
+			return blocks, 0
+		}
+		segment = m.next()
+	}
+}
+
+// split shrinks m to size paragraphs and turns the remainder into a free
+// block, if there is room for one.
+func (e *DOSEmulator) split(m mcb, size uint16) mcb {
+	if m.size > size {
+		rest := mcb{segment: m.segment + size + 1, sig: m.sig, size: m.size - size - 1}
+		e.writeMCB(rest)
+		m.sig = mcbMember
+		m.size = size
+	}
+	e.writeMCB(m)
+	return m
+}
+
+// mergeFree joins runs of adjacent free blocks.
+func (e *DOSEmulator) mergeFree() {
+	blocks, errCode := e.walkArena()
+	if errCode != 0 {
+		return
+	}
+	for i := 0; i < len(blocks); i++ {
+		m := blocks[i]
+		if m.owner != 0 {
+			continue
+		}
+		for i+1 < len(blocks) && blocks[i+1].owner == 0 {
+			m.size += blocks[i+1].size + 1
+			m.sig = blocks[i+1].sig
+			i++
+		}
+		e.writeMCB(m)
+	}
+}
+
+// allocateMemory allocates paras paragraphs for owner using first fit.
+// On failure it returns the error code and the largest free block.
+func (e *DOSEmulator) allocateMemory(paras, owner uint16) (uint16, uint16, uint16) {
+	e.mergeFree()
+	blocks, errCode := e.walkArena()
+	if errCode != 0 {
+		return 0, 0, errCode
+	}
+
+	var largest uint16
+	for _, m := range blocks {
+		if m.owner != 0 {
+			continue
+		}
+		if m.size >= paras {
+			m.owner = owner
+			e.split(m, paras)
+			return m.segment + 1, 0, 0
+		}
+		largest = max(largest, m.size)
+	}
+	return 0, largest, errInsufficientMemory
+}
+
+// largestBlock returns the size in paragraphs of the largest free block,
+// as an allocation of FFFFh paragraphs reports it.
+func (e *DOSEmulator) largestBlock() uint16 {
+	e.mergeFree()
+	blocks, _ := e.walkArena()
+	var largest uint16
+	for _, m := range blocks {
+		if m.owner == 0 {
+			largest = max(largest, m.size)
+		}
+	}
+	return largest
+}
+
+// findBlock returns the MCB of the block starting at segment.
+func (e *DOSEmulator) findBlock(segment uint16) (mcb, int, []mcb, uint16) {
+	blocks, errCode := e.walkArena()
+	if errCode != 0 {
+		return mcb{}, 0, nil, errCode
+	}
+	for i, m := range blocks {
+		if m.segment+1 == segment && m.owner != 0 {
+			return m, i, blocks, 0
+		}
+	}
+	return mcb{}, 0, nil, errInvalidBlock
+}
+
+func (e *DOSEmulator) freeMemory(segment uint16) uint16 {
+	m, _, _, errCode := e.findBlock(segment)
+	if errCode != 0 {
+		return errCode
+	}
+	m.owner = 0
+	e.writeMCB(m)
+	e.mergeFree()
+	return 0
+}
+
+// resizeMemory changes the size of the block at segment to paras
+// paragraphs, growing into a following free block when needed and
+// joining what it gives up to the free block after it. On
+// failure it returns the error code and the largest size the block could
+// have.
+func (e *DOSEmulator) resizeMemory(segment, paras uint16) (uint16, uint16) {
+	e.mergeFree()
+	m, i, blocks, errCode := e.findBlock(segment)
+	if errCode != 0 {
+		return 0, errCode
+	}
+
+	available := m.size
+	if i+1 < len(blocks) && blocks[i+1].owner == 0 {
+		available += blocks[i+1].size + 1
+	}
+	if paras > available {
+		return available, errInsufficientMemory
+	}
+
+	if paras > m.size {
+		following := blocks[i+1]
+		m.size = available
+		m.sig = following.sig
+	}
+	e.split(m, paras)
+	e.mergeFree()
+	return 0, 0
+}
+
+// releaseMemory frees every block owned by psp, as DOS does when a
+// program terminates.
+func (e *DOSEmulator) releaseMemory(psp uint16) {
+	blocks, errCode := e.walkArena()
+	if errCode != 0 {
+		return
+	}
+	for _, m := range blocks {
+		if m.owner == psp {
+			m.owner = 0
+			e.writeMCB(m)
+		}
+	}
+	e.mergeFree()
+}
+
+// setBlockName records the program name in the MCB of the block at
+// segment, as DOS 4 and later do.
+func (e *DOSEmulator) setBlockName(segment uint16, filename string) {
+	base := filepath.Base(filename)
+	name := strings.ToUpper(strings.TrimSuffix(base, filepath.Ext(base)))
+	addr := memory.CalculateAddress(segment-1, 8)
+	for i := uint32(0); i < 8; i++ {
+		var ch byte
+		if int(i) < len(name) {
+			ch = name[i]
+		}
+		e.memory.Write8(addr+i, ch)
+	}
+}
+
+// MemoryInfo reports the size of conventional memory managed by DOS, the
+// number of free bytes and the largest free block, in bytes.
+func (e *DOSEmulator) MemoryInfo() (total, free, largest uint32) {
+	total = uint32(arenaEnd-arenaStart-1) * 16
+	blocks, errCode := e.walkArena()
+	if errCode != 0 {
+		return total, 0, 0
+	}
+	for _, m := range blocks {
+		if m.owner == 0 {
+			size := uint32(m.size) * 16
+			free += size
+			largest = max(largest, size)
+		}
+	}
+	return total, free, largest
+}
@@ -0,0 +1,154 @@
+package dos
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"dos-emulator/memory"
+)
+
+// mcbStep is one call in a sequence of memory functions. block selects a
+// block by the order in which the sequence allocated it. value is the
+// segment allocation returns, or the largest size a failed allocation or
+// resize reports.
+type mcbStep struct {
+	op    string // "alloc", "free", "resize" or "release"
+	block int
+	paras uint16
+	owner uint16
+	err   uint16
+	value uint16
+}
+
+// arenaLayout shows the MCB chain as owner/size pairs in hex.
+func arenaLayout(e *DOSEmulator) string {
+	blocks, errCode := e.walkArena()
+	if errCode != 0 {
+		return fmt.Sprintf("error %d", errCode)
+	}
+	var parts []string
+	for _, m := range blocks {
+		parts = append(parts, fmt.Sprintf("%x/%x", m.owner, m.size))
+	}
+	return strings.Join(parts, " ")
+}
+
+func TestMemoryArena(t *testing.T) {
+	tests := []struct {
+		name   string
+		steps  []mcbStep
+		layout string
+	}{
+		{"allocate splits the free block", []mcbStep{
+			{op: "alloc", paras: 0x10, owner: 0x100, value: 0x1000},
+		}, "100/10 0/8fef"},
+		{"allocate all of memory", []mcbStep{
+			{op: "alloc", paras: 0x9000, owner: 0x100, value: 0x1000},
+		}, "100/9000"},
+		{"allocate too much", []mcbStep{
+			{op: "alloc", paras: 0x10, owner: 0x100, value: 0x1000},
+			{op: "alloc", paras: 0xFFFF, owner: 0x100, err: errInsufficientMemory, value: 0x8FEF},
+		}, "100/10 0/8fef"},
+		{"first fit", []mcbStep{
+			{op: "alloc", paras: 0x10, owner: 0x100, value: 0x1000},
+			{op: "alloc", paras: 0x10, owner: 0x100, value: 0x1011},
+			{op: "alloc", paras: 0x10, owner: 0x100, value: 0x1022},
+			{op: "free", block: 0},
+			{op: "alloc", paras: 0x08, owner: 0x200, value: 0x1000},
+		}, "200/8 0/7 100/10 100/10 0/8fcd"},
+		{"free coalesces with both neighbours", []mcbStep{
+			{op: "alloc", paras: 0x10, owner: 0x100, value: 0x1000},
+			{op: "alloc", paras: 0x10, owner: 0x100, value: 0x1011},
+			{op: "alloc", paras: 0x10, owner: 0x100, value: 0x1022},
+			{op: "free", block: 1},
+			{op: "free", block: 0},
+			{op: "free", block: 2},
+		}, "0/9000"},
+		{"free an unallocated block", []mcbStep{
+			{op: "alloc", paras: 0x10, owner: 0x100, value: 0x1000},
+			{op: "free", block: 0},
+			{op: "free", block: 0, err: errInvalidBlock},
+		}, "0/9000"},
+		{"shrink", []mcbStep{
+			{op: "alloc", paras: 0x100, owner: 0x100, value: 0x1000},
+			{op: "resize", block: 0, paras: 0x10},
+		}, "100/10 0/8fef"},
+		{"grow into the following free block", []mcbStep{
+			{op: "alloc", paras: 0x10, owner: 0x100, value: 0x1000},
+			{op: "resize", block: 0, paras: 0x20},
+		}, "100/20 0/8fdf"},
+		{"grow into a freed neighbour exactly", []mcbStep{
+			{op: "alloc", paras: 0x10, owner: 0x100, value: 0x1000},
+			{op: "alloc", paras: 0x10, owner: 0x100, value: 0x1011},
+			{op: "alloc", paras: 0x10, owner: 0x100, value: 0x1022},
+			{op: "free", block: 1},
+			{op: "resize", block: 0, paras: 0x21},
+		}, "100/21 100/10 0/8fcd"},
+		{"grow past an allocated neighbour", []mcbStep{
+			{op: "alloc", paras: 0x10, owner: 0x100, value: 0x1000},
+			{op: "alloc", paras: 0x10, owner: 0x100, value: 0x1011},
+			{op: "resize", block: 0, paras: 0x11, err: errInsufficientMemory, value: 0x10},
+		}, "100/10 100/10 0/8fde"},
+		{"release frees every block of a program", []mcbStep{
+			{op: "alloc", paras: 0x10, owner: 0x100, value: 0x1000},
+			{op: "alloc", paras: 0x10, owner: 0x200, value: 0x1011},
+			{op: "alloc", paras: 0x10, owner: 0x100, value: 0x1022},
+			{op: "release", owner: 0x100},
+		}, "0/10 200/10 0/8fde"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e := &DOSEmulator{memory: memory.New()}
+			e.initArena()
+			var segments []uint16
+			for i, step := range test.steps {
+				var value, errCode uint16
+				switch step.op {
+				case "alloc":
+					var segment, largest uint16
+					segment, largest, errCode = e.allocateMemory(step.paras, step.owner)
+					value = segment
+					if errCode != 0 {
+						value = largest
+					} else {
+						segments = append(segments, segment)
+					}
+				case "free":
+					errCode = e.freeMemory(segments[step.block])
+				case "resize":
+					value, errCode = e.resizeMemory(segments[step.block], step.paras)
+				case "release":
+					e.releaseMemory(step.owner)
+				}
+				if errCode != step.err || value != step.value {
+					t.Fatalf("step %d (%s): error %d, value %04X; want error %d, value %04X",
+						i, step.op, errCode, value, step.err, step.value)
+				}
+			}
+			if got := arenaLayout(e); got != test.layout {
+				t.Errorf("arena %s, want %s", got, test.layout)
+			}
+		})
+	}
+}
+
+// TestMemoryArenaTrashed checks that the memory functions report a
+// damaged MCB chain.
+func TestMemoryArenaTrashed(t *testing.T) {
+	e := &DOSEmulator{memory: memory.New()}
+	e.initArena()
+	segment, _, _ := e.allocateMemory(0x10, 0x100)
+	e.memory.Write8(memory.CalculateAddress(segment+0x10, 0), 0)
+
+	if _, _, errCode := e.allocateMemory(0x10, 0x100); errCode != errArenaTrashed {
+		t.Errorf("allocate: error %d, want %d", errCode, errArenaTrashed)
+	}
+	if _, errCode := e.resizeMemory(segment, 0x20); errCode != errArenaTrashed {
+		t.Errorf("resize: error %d, want %d", errCode, errArenaTrashed)
+	}
+	if errCode := e.freeMemory(segment); errCode != errArenaTrashed {
+		t.Errorf("free: error %d, want %d", errCode, errArenaTrashed)
+	}
+}
@@ -0,0 +1,560 @@
+package dos
+
+import (
+	"bufio"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"dos-emulator/cpu"
+	"dos-emulator/memory"
+)
+
+// monitorState is what the monitor keeps between commands: the stops it
+// has armed for Run, the DEBUG session's file name and where the
+// commands that continue from their last address left off.
+type monitorState struct {
+	session    bool // in a DEBUG session rather than stopped inside Run
+	terminated bool // the session's program has ended
+	name       string
+	args       []string
+
+	stepCount   int  // instructions left to trace (T and P)
+	stepOver    bool // P rather than T
+	overPending bool // stop on returning to overAddr
+	overAddr    uint32
+	overSP      uint16
+	goTargets   []uint32 // temporary breakpoints of G
+
+	remoteBreakpoints map[uint32]bool // a remote debugger's, by linear address
+
+	dumpSegment, dumpOffset   uint16
+	unasmSegment, unasmOffset uint16
+	asmSegment, asmOffset     uint16
+}
+
+// armed reports whether Run has a step or temporary breakpoint to check.
+func (m *monitorState) armed() bool {
+	return m.stepCount > 0 || len(m.goTargets) > 0 || m.session && len(m.remoteBreakpoints) > 0
+}
+
+func (m *monitorState) disarm() {
+	m.stepCount = 0
+	m.overPending = false
+	m.goTargets = nil
+}
+
+// stopReason reports whether Run should stop before inst, which is at
+// addr, and why: a watchpoint written to, a finished step, a temporary
+// breakpoint or a breakpoint.
+// Traces of more than one instruction show the registers at each step
+// without stopping.
+func (e *DOSEmulator) stopReason(addr uint32, inst *cpu.Instruction) (string, bool) {
+	m := &e.mon
+	if wp := e.watchHit; wp != nil {
+		e.watchHit = nil
+		wp.Hits++
+		return fmt.Sprintf("Watchpoint %d", wp.ID), true
+	}
+	if m.stepCount > 0 && (!m.overPending || addr == m.overAddr && e.cpu.SP >= m.overSP) {
+		m.stepCount--
+		if m.stepCount == 0 {
+			return "", true
+		}
+		e.showRegisters()
+		e.armStep(inst)
+	}
+	// An interrupted REP string instruction comes round again for each
+	// element; only its first iteration counts as reaching it.
+	if e.exec.RepeatPrefix() != 0 {
+		return "", false
+	}
+	for _, target := range m.goTargets {
+		if target == addr {
+			return "", true
+		}
+	}
+	if m.session && m.remoteBreakpoints[addr] {
+		return "", true
+	}
+	if bp := e.breakpointAt(addr); bp != nil {
+		return fmt.Sprintf("Breakpoint %d", bp.ID), true
+	}
+	return "", false
+}
+
+// armStep arranges for Run to stop after inst. P lets calls, interrupts,
+// loops and repeated string instructions run to completion first,
+// detected by execution reaching the next instruction with the stack no
+// deeper than now; anything else is a single step.
+func (e *DOSEmulator) armStep(inst *cpu.Instruction) {
+	m := &e.mon
+	m.overPending = m.stepOver && stepsInto(inst)
+	m.overAddr = memory.CalculateAddress(e.cpu.CS, e.cpu.IP+uint16(inst.Length))
+	m.overSP = e.cpu.SP
+}
+
+// stepsInto reports whether inst transfers control somewhere that
+// returns to the following instruction, or repeats itself.
+func stepsInto(inst *cpu.Instruction) bool {
+	switch inst.Opcode {
+	case 0xE8, 0x9A, 0xCC, 0xCD, 0xCE, 0xE0, 0xE1, 0xE2:
+		return true
+	case 0xFF:
+		reg := (inst.ModRM >> 3) & 7
+		return reg == 2 || reg == 3
+	}
+	return inst.RepPrefix != 0
+}
+
+// showStop reports why Run stopped and shows the registers. U then
+// starts from the instruction it stopped at.
+func (e *DOSEmulator) showStop(reason string) {
+	e.bios.FlushScreen()
+	e.mon.unasmSegment, e.mon.unasmOffset = e.cpu.CS, e.cpu.IP
+	if reason != "" {
+		fmt.Printf("\n%s at %04X:%04X\n", reason, e.cpu.CS, e.cpu.IP)
+	}
+	e.showRegisters()
+}
+
+// monitor reads monitor commands until one resumes the program, which it
+// reports with true, or Q quits. Commands that resume arm the stop that
+// ends them before returning.
+func (e *DOSEmulator) monitor() bool {
+	e.mon.disarm()
+	reader := e.input
+	for {
+		fmt.Print("-")
+		input, err := reader.ReadString('\n')
+		if err != nil && input == "" {
+			fmt.Println()
+			return false
+		}
+		args := monitorFields(input)
+		if len(args) == 0 {
+			continue
+		}
+
+		command, args := strings.ToUpper(args[0]), args[1:]
+		switch command {
+		case "G", "T", "P":
+			if e.resumeCommand(command, args) {
+				return true
+			}
+		case "Q":
+			return false
+		case "R":
+			e.registerCommand(args, reader)
+		case "U":
+			e.unassemble(args)
+		case "A":
+			e.assemble(args, reader)
+		case "D":
+			e.dump(args)
+		case "E":
+			e.enter(args, reader)
+		case "F":
+			e.fill(args)
+		case "S":
+			e.search(args)
+		case "M":
+			e.move(args)
+		case "C":
+			e.compare(args)
+		case "N":
+			e.name(args)
+		case "L":
+			e.load(args)
+		case "W":
+			e.write(args)
+		case "BACK", "BACKSTEP", "REVERSE-CONTINUE":
+			e.backCommand(command, args)
+		case "?", "HELP":
+			showMonitorHelp()
+		default:
+			if !e.BreakpointCommand(append([]string{command}, args...)) && !e.RecordCommand(append([]string{command}, args...)) {
+				fmt.Printf("Unknown command: %s (? for help)\n", command)
+			}
+		}
+	}
+}
+
+func showMonitorHelp() {
+	fmt.Println("A [address]                  assemble")
+	fmt.Println("C range address              compare")
+	fmt.Println("D [range]                    dump")
+	fmt.Println("E address [list]             enter")
+	fmt.Println("F range list                 fill")
+	fmt.Println("G [=address] [addresses]     go")
+	fmt.Println("L [address]                  load")
+	fmt.Println("M range address              move")
+	fmt.Println("N filename [arguments]       name")
+	fmt.Println("P [=address] [number]        proceed over CALL, INT, LOOP and REP")
+	fmt.Println("Q                            quit")
+	fmt.Println("R [register]                 register")
+	fmt.Println("S range list                 search")
+	fmt.Println("T [=address] [number]        trace")
+	fmt.Println("U [range]                    unassemble")
+	fmt.Println("W [address]                  write BX:CX bytes")
+	fmt.Println("BP/WP/BL/BC/BD/BE            breakpoints and watchpoints")
+	fmt.Println("RECORD [ON [number]|OFF]     record execution to go back through")
+	fmt.Println("BACK number                  go back to instruction number (decimal)")
+	fmt.Println("BACKSTEP [number]            go back a number of instructions (hex)")
+	fmt.Println("REVERSE-CONTINUE             go back to a breakpoint or watchpoint")
+	fmt.Println("Numbers are in hex; a range is 'address L length' or 'address end'.")
+}
+
+// monitorWords are the monitor's commands of more than one letter that
+// start with the letter of a one-letter command.
+var monitorWords = map[string]bool{"RECORD": true, "REVERSE-CONTINUE": true, "WP": true}
+
+// monitorFields splits a command line at spaces and commas, keeping
+// quoted strings whole. As in DEBUG, a one-letter command may run into
+// its first argument ("D100").
+func monitorFields(line string) []string {
+	var fields []string
+	var field strings.Builder
+	var quote rune
+	flush := func() {
+		if field.Len() > 0 {
+			fields = append(fields, field.String())
+			field.Reset()
+		}
+	}
+	for _, c := range strings.TrimSpace(line) {
+		switch {
+		case quote != 0:
+			field.WriteRune(c)
+			if c == quote {
+				quote = 0
+				flush()
+			}
+		case c == '\'' || c == '"':
+			flush()
+			quote = c
+			field.WriteRune(c)
+		case c == ' ' || c == '\t' || c == ',':
+			flush()
+		default:
+			field.WriteRune(c)
+		}
+	}
+	flush()
+
+	if len(fields) > 0 && len(fields[0]) > 1 && strings.ContainsRune("ACDEFGLMNPRSTUW", rune(strings.ToUpper(fields[0])[0])) && !monitorWords[strings.ToUpper(fields[0])] {
+		fields = append([]string{fields[0][:1], fields[0][1:]}, fields[1:]...)
+	}
+	return fields
+}
+
+// monitorAddress parses an address, [segment:]offset in hex, with the
+// segment a number or a segment register and segment used if it has none.
+func (e *DOSEmulator) monitorAddress(text string, segment uint16) (uint16, uint16, error) {
+	if strings.Contains(text, ":") {
+		return e.ParseAddress(text)
+	}
+	offset, err := strconv.ParseUint(text, 16, 16)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid address: %s", text)
+	}
+	return segment, uint16(offset), nil
+}
+
+// monitorRange parses a range, "address L length" or "address end", at
+// the start of args, returning the arguments after it. A range without
+// a length or end is length bytes long.
+func (e *DOSEmulator) monitorRange(args []string, segment uint16, length uint32) (uint16, uint16, uint32, []string, error) {
+	if len(args) == 0 {
+		return 0, 0, 0, nil, fmt.Errorf("missing address")
+	}
+	segment, offset, err := e.monitorAddress(args[0], segment)
+	if err != nil {
+		return 0, 0, 0, nil, err
+	}
+	args = args[1:]
+	if len(args) > 0 && strings.HasPrefix(strings.ToUpper(args[0]), "L") {
+		text := args[0][1:]
+		args = args[1:]
+		if text == "" && len(args) > 0 {
+			text, args = args[0], args[1:]
+		}
+		n, err := strconv.ParseUint(text, 16, 32)
+		if err != nil || n == 0 || n > 0x10000 {
+			return 0, 0, 0, nil, fmt.Errorf("invalid length: %s", text)
+		}
+		return segment, offset, uint32(n), args, nil
+	}
+	if len(args) > 0 {
+		if end, err := strconv.ParseUint(args[0], 16, 16); err == nil {
+			if uint16(end) < offset {
+				return 0, 0, 0, nil, fmt.Errorf("range end before start")
+			}
+			return segment, offset, uint32(end) - uint32(offset) + 1, args[1:], nil
+		}
+	}
+	return segment, offset, length, args, nil
+}
+
+// resumeCommand runs G, T and P: it moves CS:IP to an "=address" if one
+// is given and arms the stop that ends the command. It returns false if
+// the arguments are invalid or there is no program to run.
+func (e *DOSEmulator) resumeCommand(command string, args []string) bool {
+	if e.mon.terminated {
+		fmt.Println("Program terminated; use L to load it again")
+		return false
+	}
+	if len(args) > 0 && strings.HasPrefix(args[0], "=") {
+		segment, offset, err := e.monitorAddress(args[0][1:], e.cpu.CS)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return false
+		}
+		e.cpu.CS, e.cpu.IP = segment, offset
+		args = args[1:]
+	}
+
+	if command == "G" {
+		var targets []uint32
+		for _, arg := range args {
+			segment, offset, err := e.monitorAddress(arg, e.cpu.CS)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				return false
+			}
+			targets = append(targets, memory.CalculateAddress(segment, offset))
+		}
+		e.mon.goTargets = targets
+		return true
+	}
+
+	count := uint64(1)
+	if len(args) > 0 {
+		var err error
+		if count, err = strconv.ParseUint(args[0], 16, 16); err != nil || count == 0 {
+			fmt.Printf("Error: invalid count: %s\n", args[0])
+			return false
+		}
+	}
+	e.mon.stepCount = int(count)
+	e.mon.stepOver = command == "P"
+	e.armStep(e.decoder.Decode(e.cpu.CS, e.cpu.IP))
+	return true
+}
+
+// monitorRegisters are the registers R can change, in the order it
+// shows them.
+var monitorRegisters = []string{"AX", "BX", "CX", "DX", "SP", "BP", "SI", "DI", "DS", "ES", "SS", "CS", "IP"}
+
+// registerCommand runs R: without arguments it shows the registers, with
+// a register name it shows that register and reads a new value, and
+// with F it reads flag names such as "ZR CY".
+func (e *DOSEmulator) registerCommand(args []string, reader *bufio.Reader) {
+	if len(args) == 0 {
+		e.showRegisters()
+		return
+	}
+	name := strings.ToUpper(args[0])
+	if name == "PC" {
+		name = "IP"
+	}
+
+	if name == "F" {
+		fmt.Printf("%s -", flagNames(&e.cpu.Flags))
+		input := args[1:]
+		if len(input) == 0 {
+			line, _ := reader.ReadString('\n')
+			input = strings.Fields(line)
+		}
+		for _, flag := range input {
+			if !setFlagName(&e.cpu.Flags, strings.ToUpper(flag)) {
+				fmt.Printf("Error: unknown flag: %s\n", flag)
+				return
+			}
+		}
+		return
+	}
+
+	known := false
+	for _, reg := range monitorRegisters {
+		known = known || reg == name
+	}
+	if !known {
+		fmt.Printf("Error: unknown register: %s\n", args[0])
+		return
+	}
+	value, _ := registerValue(e.cpu, name)
+	text := ""
+	if len(args) > 1 {
+		text = args[1]
+	} else {
+		fmt.Printf("%s %04X\n:", name, value)
+		line, _ := reader.ReadString('\n')
+		text = strings.TrimSpace(line)
+	}
+	if text == "" {
+		return
+	}
+	n, err := strconv.ParseUint(text, 16, 16)
+	if err != nil {
+		fmt.Printf("Error: invalid value: %s\n", text)
+		return
+	}
+	setRegister(e.cpu, name, uint16(n))
+}
+
+// setRegister sets the 16-bit register of c called name.
+func setRegister(c *cpu.CPU, name string, value uint16) {
+	switch name {
+	case "AX":
+		c.AX = value
+	case "BX":
+		c.BX = value
+	case "CX":
+		c.CX = value
+	case "DX":
+		c.DX = value
+	case "SP":
+		c.SP = value
+	case "BP":
+		c.BP = value
+	case "SI":
+		c.SI = value
+	case "DI":
+		c.DI = value
+	case "DS":
+		c.DS = value
+	case "ES":
+		c.ES = value
+	case "SS":
+		c.SS = value
+	case "CS":
+		c.CS = value
+	case "IP":
+		c.IP = value
+	}
+}
+
+// flagStates lists the flags as DEBUG names them, clear then set.
+var flagStates = []struct {
+	clear, set string
+	get        func(f *cpu.Flags) bool
+	put        func(f *cpu.Flags, value bool)
+}{
+	{"NV", "OV", (*cpu.Flags).OF, (*cpu.Flags).SetOF},
+	{"UP", "DN", func(f *cpu.Flags) bool { return f.DF }, func(f *cpu.Flags, v bool) { f.DF = v }},
+	{"DI", "EI", func(f *cpu.Flags) bool { return f.IF }, func(f *cpu.Flags, v bool) { f.IF = v }},
+	{"PL", "NG", (*cpu.Flags).SF, (*cpu.Flags).SetSF},
+	{"NZ", "ZR", (*cpu.Flags).ZF, (*cpu.Flags).SetZF},
+	{"NA", "AC", (*cpu.Flags).AF, (*cpu.Flags).SetAF},
+	{"PO", "PE", (*cpu.Flags).PF, (*cpu.Flags).SetPF},
+	{"NC", "CY", (*cpu.Flags).CF, (*cpu.Flags).SetCF},
+}
+
+func flagNames(f *cpu.Flags) string {
+	names := make([]string, len(flagStates))
+	for i, state := range flagStates {
+		names[i] = state.clear
+		if state.get(f) {
+			names[i] = state.set
+		}
+	}
+	return strings.Join(names, " ")
+}
+
+// setFlagName sets or clears the flag a DEBUG flag name refers to.
+func setFlagName(f *cpu.Flags, name string) bool {
+	for _, state := range flagStates {
+		if name == state.clear || name == state.set {
+			state.put(f, name == state.set)
+			return true
+		}
+	}
+	return false
+}
+
+// showRegisters prints the registers and the next instruction in the
+// layout of DEBUG's R command.
+func (e *DOSEmulator) showRegisters() {
+	c := e.cpu
+	fmt.Printf("AX=%04X  BX=%04X  CX=%04X  DX=%04X  SP=%04X  BP=%04X  SI=%04X  DI=%04X\n",
+		c.AX, c.BX, c.CX, c.DX, c.SP, c.BP, c.SI, c.DI)
+	fmt.Printf("DS=%04X  ES=%04X  SS=%04X  CS=%04X  IP=%04X   %s\n",
+		c.DS, c.ES, c.SS, c.CS, c.IP, flagNames(&c.Flags))
+	line := e.decoder.Listing(c.CS, c.IP, 1, 0)[0]
+	fmt.Println(disassemblyLine(c.CS, line))
+}
+
+// disassemblyLine formats a line of a listing with its address and
+// bytes.
+func disassemblyLine(segment uint16, line cpu.ListingLine) string {
+	return fmt.Sprintf("%04X:%04X %-14X %s", segment, line.Offset, line.Code, line.Text)
+}
+
+// unassemble runs U, which disassembles a range, by default the 32 bytes
+// after where the last U ended or at CS:IP after the program stopped.
+// Jumps within the range lead to labels.
+func (e *DOSEmulator) unassemble(args []string) {
+	m := &e.mon
+	segment, offset, length := m.unasmSegment, m.unasmOffset, uint32(0x20)
+	if len(args) > 0 {
+		var err error
+		if segment, offset, length, _, err = e.monitorRange(args, e.cpu.CS, length); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+	}
+	for _, line := range e.decoder.Listing(segment, offset, 0, length) {
+		if line.Label != "" {
+			fmt.Printf("%s:\n", line.Label)
+		}
+		fmt.Println(disassemblyLine(segment, line))
+		offset = line.Offset + uint16(len(line.Code))
+	}
+	m.unasmSegment, m.unasmOffset = segment, offset
+}
+
+// assemble runs A, which reads instructions a line at a time and stores
+// them from the address given, by default where the last A ended, until
+// an empty line.
+func (e *DOSEmulator) assemble(args []string, reader *bufio.Reader) {
+	m := &e.mon
+	segment, offset := m.asmSegment, m.asmOffset
+	if len(args) > 0 {
+		var err error
+		if segment, offset, err = e.monitorAddress(args[0], e.cpu.CS); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+	}
+	for {
+		fmt.Printf("%04X:%04X ", segment, offset)
+		line, err := reader.ReadString('\n')
+		line = strings.TrimSpace(line)
+		if line == "" {
+			if err != nil {
+				fmt.Println()
+			}
+			break
+		}
+		code, asmErr := cpu.Assemble(line, offset, e.exec.Model())
+		if asmErr != nil {
+			fmt.Printf("Error: %v\n", asmErr)
+			continue
+		}
+		for _, b := range code {
+			e.memory.Write8(memory.CalculateAddress(segment, offset), b)
+			offset++
+		}
+	}
+	m.asmSegment, m.asmOffset = segment, offset
+}
+
+// resetMonitorAddresses points U and A at CS:IP and D at DS:0100, as
+// after loading a program.
+func (e *DOSEmulator) resetMonitorAddresses() {
+	m := &e.mon
+	m.unasmSegment, m.unasmOffset = e.cpu.CS, e.cpu.IP
+	m.asmSegment, m.asmOffset = e.cpu.CS, e.cpu.IP
+	m.dumpSegment, m.dumpOffset = e.cpu.DS, 0x100
+}
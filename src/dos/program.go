@@ -0,0 +1,235 @@
+package dos
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"dos-emulator/loader"
+	"dos-emulator/memory"
+)
+
+func (e *DOSEmulator) SetupPSP(segment uint16) {
+	pspAddr := memory.CalculateAddress(segment, 0)
+	e.memory.Write8(pspAddr+0, 0xCD)
+	e.memory.Write8(pspAddr+1, 0x20)
+	e.memory.Write16(pspAddr+2, 0xA000)
+	e.memory.Write8(pspAddr+4, 0)
+	e.memory.Write8(pspAddr+5, 0x9A)
+	e.memory.Write16(pspAddr+6, 0x0000)
+	e.memory.Write16(pspAddr+8, 0x0000)
+	e.memory.Write16(pspAddr+0x0A, 0x0000)
+	e.memory.Write16(pspAddr+0x0C, segment)
+	e.memory.Write16(pspAddr+0x16, segment)
+
+	for i := uint32(0); i < 20; i++ {
+		e.memory.Write8(pspAddr+0x18+i, 0xFF)
+	}
+
+	e.memory.Write16(pspAddr+0x2C, 0)
+	e.memory.Write8(pspAddr+0x50, 0xCD)
+	e.memory.Write8(pspAddr+0x51, 0x21)
+	e.memory.Write8(pspAddr+0x52, 0xCB)
+
+	for i := uint32(0); i < 16; i++ {
+		e.memory.Write8(pspAddr+0x5C+i, 0)
+	}
+
+	for i := uint32(0); i < 16; i++ {
+		e.memory.Write8(pspAddr+0x6C+i, 0)
+	}
+
+	e.memory.Write8(pspAddr+0x80, 0)
+	e.memory.Write8(pspAddr+0x81, 0x0D)
+}
+
+// errNoMemory reports that the arena has no block large enough for a
+// program.
+var errNoMemory = errors.New("insufficient memory")
+
+func (e *DOSEmulator) LoadCOMFile(filename string, args ...string) error {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+
+	e.resetProcesses()
+	env, err := e.createEnvironment(filename)
+	if err != nil {
+		return err
+	}
+	image, psp, err := e.loadCOM(filename, data, 0)
+	if err != nil {
+		return err
+	}
+	e.setupCommandLine(psp, env, args)
+	e.startProgram(image, psp, "COM")
+
+	if e.debugMode {
+		fmt.Printf("Loaded COM file: %s (%d bytes)\n", filename, len(data))
+		fmt.Printf("Entry point: %04X:%04X\n", e.cpu.CS, e.cpu.IP)
+	}
+
+	return nil
+}
+
+func (e *DOSEmulator) LoadEXEFile(filename string, args ...string) error {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+
+	e.resetProcesses()
+	env, err := e.createEnvironment(filename)
+	if err != nil {
+		return err
+	}
+	image, psp, err := e.loadEXE(filename, data, 0)
+	if err != nil {
+		return err
+	}
+	e.setupCommandLine(psp, env, args)
+	e.startProgram(image, psp, "EXE")
+
+	if e.debugMode {
+		header, _ := loader.ReadEXEHeader(data)
+		fmt.Printf("Loaded EXE file: %s\n", filename)
+		fmt.Printf("Image size: %d bytes\n", image.Size)
+		fmt.Printf("Relocations: %d\n", header.Relocations)
+		fmt.Printf("Entry point: %04X:%04X\n", e.cpu.CS, e.cpu.IP)
+		fmt.Printf("Initial stack: %04X:%04X\n", e.cpu.SS, e.cpu.SP)
+	}
+
+	return nil
+}
+
+// LoadFile loads a COM or EXE program, passing args on its command line.
+func (e *DOSEmulator) LoadFile(filename string, args ...string) error {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+
+	e.resetBreakpointHits()
+	if loader.IsEXE(data) {
+		err = e.LoadEXEFile(filename, args...)
+	} else {
+		err = e.LoadCOMFile(filename, args...)
+	}
+	if err == nil {
+		e.mon.terminated = false
+		e.resetMonitorAddresses()
+		e.resetRecording()
+	}
+	return err
+}
+
+// resetProcesses discards any suspended parent programs and frees all of
+// conventional memory before a program is started from the shell.
+func (e *DOSEmulator) resetProcesses() {
+	e.processes = nil
+	e.initArena()
+}
+
+// startProgram makes the program whose PSP is at psp the current process,
+// with its DTA at PSP:0080, and points the CPU at its entry point.
+func (e *DOSEmulator) startProgram(image *loader.Image, psp uint16, programType string) {
+	e.psp = psp
+	e.programType = programType
+	e.dtaSegment = psp
+	e.dtaOffset = 0x80
+	e.resetRegisters(image)
+	e.cpu.DS = psp
+	e.cpu.ES = psp
+}
+
+// loadCOM allocates a block for a COM program, builds its PSP and copies
+// the image to PSP:0100. Like DOS, it gives the program the largest free
+// block; if that is smaller than 64 KB the stack starts at the top of the
+// block.
+func (e *DOSEmulator) loadCOM(filename string, data []byte, parent uint16) (*loader.Image, uint16, error) {
+	if len(data) > loader.MaxCOMSize {
+		return nil, 0, fmt.Errorf("COM file too large")
+	}
+
+	paras := e.largestBlock()
+	if uint32(paras)*16 < uint32(len(data))+0x200 {
+		return nil, 0, errNoMemory
+	}
+	psp, _, errCode := e.allocateMemory(paras, systemOwner)
+	if errCode != 0 {
+		return nil, 0, errNoMemory
+	}
+	e.setupProgramBlock(filename, psp, paras, parent)
+
+	image, err := loader.LoadCOM(e.memory, psp, data)
+	if err != nil {
+		e.freeMemory(psp)
+		return nil, 0, err
+	}
+	if paras < 0x1000 {
+		image.SP = paras*16 - 2
+	}
+	return image, psp, nil
+}
+
+// loadEXE allocates a block for an EXE program, builds its PSP and loads
+// and relocates the image after it. The block is the largest free block,
+// cut down to the header's maximum allocation; it fails if that is less
+// than the minimum allocation.
+func (e *DOSEmulator) loadEXE(filename string, data []byte, parent uint16) (*loader.Image, uint16, error) {
+	header, err := loader.ReadEXEHeader(data)
+	if err != nil {
+		return nil, 0, err
+	}
+	largest := uint32(e.largestBlock())
+	if header.MinParagraphs() > largest {
+		return nil, 0, errNoMemory
+	}
+	paras := uint16(min(header.MaxParagraphs(), largest))
+
+	psp, _, errCode := e.allocateMemory(paras, systemOwner)
+	if errCode != 0 {
+		return nil, 0, errNoMemory
+	}
+	e.setupProgramBlock(filename, psp, paras, parent)
+
+	image, _, err := loader.LoadEXE(e.memory, psp, data)
+	if err != nil {
+		e.freeMemory(psp)
+		return nil, 0, err
+	}
+	return image, psp, nil
+}
+
+// setupProgramBlock hands the block at psp to the new program and builds
+// its PSP. parent is the PSP of the program that started it, or 0 for a
+// program started from the shell.
+func (e *DOSEmulator) setupProgramBlock(filename string, psp, paras, parent uint16) {
+	m := e.readMCB(psp - 1)
+	m.owner = psp
+	e.writeMCB(m)
+	e.setBlockName(psp, filename)
+
+	e.SetupPSP(psp)
+	pspAddr := memory.CalculateAddress(psp, 0)
+	e.memory.Write16(pspAddr+0x02, psp+paras)
+	if parent != 0 {
+		e.memory.Write16(pspAddr+0x16, parent)
+	}
+}
+
+func (e *DOSEmulator) resetRegisters(image *loader.Image) {
+	e.cpu.CS = image.CS
+	e.cpu.IP = image.IP
+	e.cpu.SS = image.SS
+	e.cpu.SP = image.SP
+	e.cpu.AX = 0
+	e.cpu.BX = 0
+	e.cpu.CX = 0
+	e.cpu.DX = 0
+	e.cpu.SI = 0
+	e.cpu.DI = 0
+	e.cpu.BP = 0
+	e.cpu.Flags.FromUint16(0x0200)
+}
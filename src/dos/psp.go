@@ -0,0 +1,137 @@
+package dos
+
+import (
+	"sort"
+	"strings"
+
+	"dos-emulator/memory"
+)
+
+// createEnvironment copies the environment variables into a new memory
+// block: NUL-terminated KEY=VALUE strings, an empty string, a word
+// holding 1 and the DOS path of the program. The block belongs to DOS
+// until setupCommandLine hands it to the program.
+func (e *DOSEmulator) createEnvironment(program string) (uint16, error) {
+	keys := make([]string, 0, len(e.environment))
+	for key := range e.environment {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var block []byte
+	for _, key := range keys {
+		block = append(block, key+"="+e.environment[key]...)
+		block = append(block, 0)
+	}
+	return e.allocateEnvironment(append(block, 0), program)
+}
+
+// copyEnvironment copies the strings of the environment block at segment
+// into a new block for program, as EXEC does for a child.
+func (e *DOSEmulator) copyEnvironment(segment uint16, program string) (uint16, error) {
+	addr := memory.CalculateAddress(segment, 0)
+	var block []byte
+	for i := uint32(0); i < maxEnvironmentSize; i++ {
+		b := e.memory.Read8(addr + i)
+		block = append(block, b)
+		if b == 0 && (i == 0 || block[i-1] == 0) {
+			break
+		}
+	}
+	return e.allocateEnvironment(block, program)
+}
+
+// maxEnvironmentSize bounds the environment strings copyEnvironment
+// reads, the 32 KB limit of DOS.
+const maxEnvironmentSize = 0x8000
+
+// allocateEnvironment stores vars, the environment strings with their
+// terminating empty string, followed by the DOS path of the program file
+// in a new block owned by DOS.
+func (e *DOSEmulator) allocateEnvironment(vars []byte, program string) (uint16, error) {
+	block := append(vars, 0x01, 0x00)
+	block = append(block, e.dosPath(program)...)
+	block = append(block, 0)
+
+	segment, _, errCode := e.allocateMemory(uint16((len(block)+15)/16), systemOwner)
+	if errCode != 0 {
+		return 0, errNoMemory
+	}
+	addr := memory.CalculateAddress(segment, 0)
+	for i, b := range block {
+		e.memory.Write8(addr+uint32(i), b)
+	}
+	return segment, nil
+}
+
+// setupCommandLine gives the program at psp its environment block and
+// fills in the command tail at PSP:80h and the two FCBs at PSP:5Ch and
+// PSP:6Ch from args.
+func (e *DOSEmulator) setupCommandLine(psp, env uint16, args []string) {
+	e.setEnvironment(psp, env)
+
+	pspAddr := memory.CalculateAddress(psp, 0)
+
+	tail := ""
+	if len(args) > 0 {
+		tail = " " + strings.Join(args, " ")
+	}
+	if len(tail) > 126 {
+		tail = tail[:126]
+	}
+	e.memory.Write8(pspAddr+0x80, byte(len(tail)))
+	for i := 0; i < len(tail); i++ {
+		e.memory.Write8(pspAddr+0x81+uint32(i), tail[i])
+	}
+	e.memory.Write8(pspAddr+0x81+uint32(len(tail)), 0x0D)
+
+	var fcbArgs [2]string
+	copy(fcbArgs[:], args)
+	e.writeFCBName(pspAddr+0x5C, fcbArgs[0])
+	e.writeFCBName(pspAddr+0x6C, fcbArgs[1])
+}
+
+// setEnvironment hands the environment block at env to the program at
+// psp and records it at PSP:2Ch.
+func (e *DOSEmulator) setEnvironment(psp, env uint16) {
+	m := e.readMCB(env - 1)
+	m.owner = psp
+	e.writeMCB(m)
+	e.memory.Write16(memory.CalculateAddress(psp, 0x2C), env)
+}
+
+// writeFCBName parses arg as a file name into the drive, name and
+// extension fields of an unopened FCB. A '*' fills the rest of the field
+// with '?'.
+func (e *DOSEmulator) writeFCBName(addr uint32, arg string) {
+	arg = strings.ToUpper(arg)
+	var drive byte
+	if len(arg) >= 2 && arg[1] == ':' && arg[0] >= 'A' && arg[0] <= 'Z' {
+		drive = arg[0] - 'A' + 1
+		arg = arg[2:]
+	}
+	if strings.ContainsAny(arg, "\\/") {
+		arg = ""
+	}
+	name, ext, _ := strings.Cut(arg, ".")
+
+	e.memory.Write8(addr, drive)
+	e.writeFCBField(addr+1, name, 8)
+	e.writeFCBField(addr+9, ext, 3)
+}
+
+func (e *DOSEmulator) writeFCBField(addr uint32, value string, width int) {
+	for i := 0; i < width; i++ {
+		ch := byte(' ')
+		if i < len(value) {
+			ch = value[i]
+		}
+		if ch == '*' {
+			for ; i < width; i++ {
+				e.memory.Write8(addr+uint32(i), '?')
+			}
+			return
+		}
+		e.memory.Write8(addr+uint32(i), ch)
+	}
+}
@@ -0,0 +1,392 @@
+package dos
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"dos-emulator/bios"
+	"dos-emulator/cpu"
+	"dos-emulator/hardware"
+	"dos-emulator/memory"
+)
+
+// defaultRecordLimit is the number of instructions RECORD ON keeps when
+// it is given no number.
+const defaultRecordLimit = 100000
+
+// journalEntry is the machine state before one pass of Run's loop: an
+// instruction, together with any hardware interrupt delivered before it.
+// The state that every instruction changes is copied whole; the
+// coprocessor and display states are kept only when the instruction
+// changed them, and memory as the writes that undo it.
+type journalEntry struct {
+	count         uint64 // instructions executed before it
+	registers     cpu.CPU
+	exec          cpu.ExecutorState
+	pit           hardware.PITState
+	pic           hardware.PICState
+	elapsedCycles uint64
+	pitFraction   uint64
+	writes        uint64           // sequence number of its first write
+	fpu           *cpu.FPU         // the coprocessor before, if changed
+	video         *bios.VideoState // the display before, if changed
+}
+
+// journalWrite is a byte as it was before a write: a byte of memory, or
+// of a 16-colour graphics plane.
+type journalWrite struct {
+	addr  uint32
+	old   byte
+	plane int8 // -1 for memory
+}
+
+// recorder journals Run so that the monitor can take the machine back to
+// an earlier instruction. The entries form a ring of at most limit
+// instructions, and writes holds the writes of the entries in it.
+type recorder struct {
+	limit     int
+	entries   []journalEntry
+	first     int // index of the oldest entry
+	writes    []journalWrite
+	writeBase uint64 // sequence number of writes[0]
+
+	// The coprocessor and display as last seen, to find out what an
+	// instruction changed.
+	fpu   cpu.FPU
+	video bios.VideoState
+}
+
+func (r *recorder) entry(i int) *journalEntry {
+	return &r.entries[(r.first+i)%len(r.entries)]
+}
+
+func (r *recorder) last() *journalEntry {
+	return r.entry(len(r.entries) - 1)
+}
+
+func (r *recorder) written(addr uint32, old byte, plane int8) {
+	r.writes = append(r.writes, journalWrite{addr: addr, old: old, plane: plane})
+}
+
+// StartRecording journals Run from now on, keeping the last limit
+// instructions.
+func (e *DOSEmulator) StartRecording(limit int) {
+	e.rec = &recorder{limit: limit}
+	e.resetRecording()
+	e.updateJournal()
+}
+
+func (e *DOSEmulator) StopRecording() {
+	e.rec = nil
+	e.updateJournal()
+}
+
+// resetRecording empties the journal, as a newly loaded program cannot
+// go back into the previous one.
+func (e *DOSEmulator) resetRecording() {
+	r := e.rec
+	if r == nil {
+		return
+	}
+	r.entries, r.first = nil, 0
+	r.writes, r.writeBase = nil, 0
+	if fpu := e.exec.FPU(); fpu != nil {
+		r.fpu = *fpu
+	}
+	r.video = e.bios.VideoState()
+}
+
+// updateJournal installs the memory and plane journal hooks while there
+// is something to tell them to, and removes them otherwise.
+func (e *DOSEmulator) updateJournal() {
+	if e.rec != nil || len(e.watchpoints) != 0 {
+		e.memory.SetJournal(e.memoryWritten)
+	} else {
+		e.memory.SetJournal(nil)
+	}
+	if e.rec != nil {
+		e.bios.SetPlaneJournal(func(plane int, offset uint32, old byte) {
+			e.rec.written(offset, old, int8(plane))
+		})
+	} else {
+		e.bios.SetPlaneJournal(nil)
+	}
+}
+
+// recordEntry starts the journal entry for the next instruction. Run
+// comes back to the same instruction after stopping before it, which
+// continues the entry already started.
+func (e *DOSEmulator) recordEntry() {
+	r := e.rec
+	if len(r.entries) > 0 && r.last().count == e.instructionCount {
+		return
+	}
+	entry := journalEntry{
+		count:         e.instructionCount,
+		registers:     *e.cpu,
+		exec:          e.exec.State(),
+		pit:           e.pit.State(),
+		pic:           e.pic.State(),
+		elapsedCycles: e.elapsedCycles,
+		pitFraction:   e.pitFraction,
+		writes:        r.writeBase + uint64(len(r.writes)),
+	}
+	if len(r.entries) < r.limit {
+		r.entries = append(r.entries, entry)
+		return
+	}
+	r.entries[r.first] = entry
+	r.first = (r.first + 1) % len(r.entries)
+	drop := r.entry(0).writes - r.writeBase
+	r.writes = r.writes[drop:]
+	r.writeBase += drop
+}
+
+// recordExecuted completes the journal entry of inst with the state only
+// some instructions change: the coprocessor's, and the display's, which
+// changes through I/O ports or in the BIOS.
+func (e *DOSEmulator) recordExecuted(inst *cpu.Instruction) {
+	r := e.rec
+	if len(r.entries) == 0 {
+		return
+	}
+	entry := r.last()
+	op := inst.Opcode
+	if fpu := e.exec.FPU(); fpu != nil && op >= 0xD8 && op <= 0xDF && *fpu != r.fpu {
+		old := r.fpu
+		entry.fpu = &old
+		r.fpu = *fpu
+	}
+
+	host := op == cpu.TrapOpcode && inst.ModRM == cpu.TrapModRM
+	if !host && !isPortIO(op) {
+		return
+	}
+	if video := e.bios.VideoState(); video != r.video {
+		old := r.video
+		entry.video = &old
+		r.video = video
+	}
+}
+
+// isPortIO reports whether op is an IN, OUT, INS or OUTS instruction.
+func isPortIO(op byte) bool {
+	return op >= 0xE4 && op <= 0xE7 || op >= 0xEC && op <= 0xEF || op >= 0x6C && op <= 0x6F
+}
+
+// undoEntry removes the newest journal entry, putting back the memory,
+// coprocessor and display state it changed, and returns it. It reports
+// in hit whether the entry wrote to a watchpoint.
+func (e *DOSEmulator) undoEntry() (entry journalEntry, hit *Breakpoint) {
+	r := e.rec
+	// Put the ring in order, oldest first, so that the newest entry is
+	// the last.
+	if r.first != 0 {
+		r.entries = append(r.entries[r.first:], r.entries[:r.first]...)
+		r.first = 0
+	}
+	entry = r.entries[len(r.entries)-1]
+	r.entries = r.entries[:len(r.entries)-1]
+
+	start := int(entry.writes - r.writeBase)
+	for i := len(r.writes) - 1; i >= start; i-- {
+		w := r.writes[i]
+		if w.plane >= 0 {
+			e.bios.RestorePlane(int(w.plane), w.addr, w.old)
+			continue
+		}
+		e.memory.Restore(w.addr, w.old)
+		if wp := e.watchpointAt(w.addr); wp != nil {
+			hit = wp
+		}
+	}
+	r.writes = r.writes[:start]
+
+	if entry.fpu != nil {
+		if fpu := e.exec.FPU(); fpu != nil {
+			*fpu = *entry.fpu
+		}
+		r.fpu = *entry.fpu
+	}
+	if entry.video != nil {
+		e.bios.SetVideoState(*entry.video)
+		r.video = *entry.video
+	}
+	return entry, hit
+}
+
+// restoreEntry puts back the state copied whole into entry, completing
+// the return to the instruction it was made before.
+func (e *DOSEmulator) restoreEntry(entry journalEntry) {
+	*e.cpu = entry.registers
+	e.exec.SetState(entry.exec)
+	e.pit.SetState(entry.pit)
+	e.pic.SetState(entry.pic)
+	e.elapsedCycles = entry.elapsedCycles
+	e.pitFraction = entry.pitFraction
+	e.instructionCount = entry.count
+	e.mon.terminated = false
+	e.bios.Redraw()
+}
+
+// recordedRange returns the numbers of the oldest instruction recorded
+// and of the current one, or an error if there is no recording.
+func (e *DOSEmulator) recordedRange() (uint64, uint64, error) {
+	if e.rec == nil {
+		return 0, 0, fmt.Errorf("not recording (use RECORD ON)")
+	}
+	if len(e.rec.entries) == 0 {
+		return e.instructionCount, e.instructionCount, nil
+	}
+	return e.rec.entry(0).count, e.instructionCount, nil
+}
+
+// GoBack takes the machine back to the state before instruction number
+// count, which must still be in the recording. Memory, registers, timer,
+// coprocessor and display are restored; open files and other DOS state
+// are not.
+func (e *DOSEmulator) GoBack(count uint64) error {
+	oldest, current, err := e.recordedRange()
+	if err != nil {
+		return err
+	}
+	if count < oldest || count > current {
+		return fmt.Errorf("instruction %d is not recorded (%d to %d are)", count, oldest, current)
+	}
+	var entry journalEntry
+	undone := false
+	for len(e.rec.entries) > 0 && e.rec.last().count >= count {
+		entry, _ = e.undoEntry()
+		undone = true
+	}
+	if undone {
+		e.restoreEntry(entry)
+	}
+	return nil
+}
+
+// ReverseContinue goes back to the last instruction before the current
+// one that is at an enabled breakpoint whose condition holds or that
+// wrote to a watchpoint, or else to the oldest instruction recorded. It
+// returns what it stopped at.
+func (e *DOSEmulator) ReverseContinue() (string, error) {
+	if _, _, err := e.recordedRange(); err != nil {
+		return "", err
+	}
+	current := e.instructionCount
+	var entry journalEntry
+	undone := false
+	for len(e.rec.entries) > 0 {
+		var hit *Breakpoint
+		entry, hit = e.undoEntry()
+		undone = true
+		if entry.count >= current {
+			continue
+		}
+		if hit != nil {
+			e.restoreEntry(entry)
+			return fmt.Sprintf("Watchpoint %d", hit.ID), nil
+		}
+		addr := memory.CalculateAddress(entry.registers.CS, entry.registers.IP)
+		if bp := e.breakpoints[addr]; bp != nil && !bp.Disabled && (bp.Condition == nil || bp.Condition.holds(&entry.registers)) {
+			e.restoreEntry(entry)
+			return fmt.Sprintf("Breakpoint %d", bp.ID), nil
+		}
+	}
+	if undone {
+		e.restoreEntry(entry)
+	}
+	return "Start of recording", nil
+}
+
+// backCommand runs the monitor's BACK, BACKSTEP and REVERSE-CONTINUE,
+// which go back through the recording and show where they arrived.
+func (e *DOSEmulator) backCommand(command string, args []string) {
+	var reason string
+	var err error
+	switch command {
+	case "BACK":
+		if len(args) == 0 {
+			var oldest, current uint64
+			if oldest, current, err = e.recordedRange(); err == nil {
+				fmt.Printf("Instructions %d to %d recorded\n", oldest, current)
+			}
+			break
+		}
+		var count uint64
+		if count, err = strconv.ParseUint(args[0], 10, 64); err != nil {
+			err = fmt.Errorf("invalid instruction number: %s", args[0])
+			break
+		}
+		err = e.GoBack(count)
+	case "BACKSTEP":
+		count := uint64(1)
+		if len(args) > 0 {
+			if count, err = strconv.ParseUint(args[0], 16, 32); err != nil || count == 0 {
+				err = fmt.Errorf("invalid count: %s", args[0])
+				break
+			}
+		}
+		if count > e.instructionCount {
+			count = e.instructionCount
+		}
+		err = e.GoBack(e.instructionCount - count)
+	case "REVERSE-CONTINUE":
+		reason, err = e.ReverseContinue()
+	}
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	if len(args) == 0 && command == "BACK" {
+		return
+	}
+	if reason == "" {
+		e.showStop(fmt.Sprintf("Instruction %d", e.instructionCount))
+		return
+	}
+	e.showStop(fmt.Sprintf("%s, instruction %d", reason, e.instructionCount))
+}
+
+// RecordCommand runs RECORD, shared by the shell and the monitor:
+//
+//	RECORD              show what is recorded
+//	RECORD ON [n]       journal the last n instructions (default 100000)
+//	RECORD OFF          stop recording and discard the journal
+//
+// It returns false if parts is not a RECORD command.
+func (e *DOSEmulator) RecordCommand(parts []string) bool {
+	if len(parts) == 0 || strings.ToUpper(parts[0]) != "RECORD" {
+		return false
+	}
+	if len(parts) == 1 {
+		oldest, current, err := e.recordedRange()
+		if err != nil {
+			fmt.Println("Recording is off")
+			return true
+		}
+		fmt.Printf("Recording the last %d instructions; %d to %d recorded\n", e.rec.limit, oldest, current)
+		return true
+	}
+	switch strings.ToUpper(parts[1]) {
+	case "ON":
+		limit := defaultRecordLimit
+		if len(parts) > 2 {
+			n, err := strconv.Atoi(parts[2])
+			if err != nil || n <= 0 {
+				fmt.Printf("Error: invalid number: %s\n", parts[2])
+				return true
+			}
+			limit = n
+		}
+		e.StartRecording(limit)
+		fmt.Printf("Recording the last %d instructions\n", limit)
+	case "OFF":
+		e.StopRecording()
+		fmt.Println("Recording is off")
+	default:
+		fmt.Println("Usage: RECORD [ON [instructions]|OFF]")
+	}
+	return true
+}
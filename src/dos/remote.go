@@ -0,0 +1,71 @@
+package dos
+
+// Stop says why Resume returned.
+type Stop int
+
+const (
+	StopTrap        Stop = iota // at a breakpoint or after a single step
+	StopInterrupted             // Interrupt was called
+	StopExited                  // the program ended; ReturnCode has its exit code
+)
+
+// interruptedReason is the stop reason execute gives for Interrupt.
+const interruptedReason = "Interrupted"
+
+// Resume runs the loaded program under the control of a remote debugger:
+// with step set for a single instruction, otherwise until it reaches a
+// breakpoint, Interrupt is called or it ends. Like G and T in a DEBUG
+// session it goes through Run's loop, leaving the program to be resumed
+// again.
+func (e *DOSEmulator) Resume(step bool) Stop {
+	if e.mon.terminated {
+		return StopExited
+	}
+	e.mon.session = true
+	defer func() { e.mon.session = false }()
+	e.interrupt.Store(false)
+
+	e.mon.disarm()
+	if step {
+		e.mon.stepCount = 1
+		e.mon.stepOver = false
+		e.armStep(e.decoder.Decode(e.cpu.CS, e.cpu.IP))
+	}
+	reason, stopped := e.execute(true)
+	switch {
+	case !stopped:
+		e.mon.terminated = true
+		return StopExited
+	case reason == interruptedReason:
+		return StopInterrupted
+	}
+	return StopTrap
+}
+
+// AddRemoteBreakpoint makes Resume stop before the instruction at linear
+// address addr. A remote debugger's breakpoints are kept apart from those
+// of BP: they have no ID, condition or count, and a breakpoint of BP at
+// the same address keeps its own.
+func (e *DOSEmulator) AddRemoteBreakpoint(addr uint32) {
+	if e.mon.remoteBreakpoints == nil {
+		e.mon.remoteBreakpoints = make(map[uint32]bool)
+	}
+	e.mon.remoteBreakpoints[addr] = true
+}
+
+// DeleteRemoteBreakpoint removes the remote debugger's breakpoint at addr.
+func (e *DOSEmulator) DeleteRemoteBreakpoint(addr uint32) {
+	delete(e.mon.remoteBreakpoints, addr)
+}
+
+// Interrupt stops a running Resume within a few instructions. Unlike the
+// other methods it may be called from another goroutine.
+func (e *DOSEmulator) Interrupt() {
+	e.interrupt.Store(true)
+}
+
+// ReturnCode returns the exit code of the last program to end, with the
+// way it ended in the high byte, as INT 21h function 4Dh does.
+func (e *DOSEmulator) ReturnCode() uint16 {
+	return e.returnCode
+}
@@ -0,0 +1,30 @@
+package dos
+
+import (
+	"testing"
+
+	"dos-emulator/memory"
+)
+
+// TestRemoteBreakpointsApart checks that a remote debugger's breakpoint
+// at the address of a user's breakpoint neither changes nor removes it.
+func TestRemoteBreakpointsApart(t *testing.T) {
+	e := &DOSEmulator{breakpoints: make(map[uint32]*Breakpoint)}
+	cond, err := ParseCondition("AX==5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bp := e.AddBreakpoint(0x1000, 0x0100, cond, 3)
+	addr := memory.CalculateAddress(0x1000, 0x0100)
+
+	e.AddRemoteBreakpoint(addr)
+	e.DeleteRemoteBreakpoint(addr)
+
+	list := e.Breakpoints()
+	if len(list) != 1 || list[0] != bp || bp.Condition != cond || bp.Count != 3 {
+		t.Errorf("breakpoints %v after a remote breakpoint came and went, want %v", list, bp)
+	}
+	if len(e.mon.remoteBreakpoints) != 0 {
+		t.Errorf("remote breakpoints %v left over", e.mon.remoteBreakpoints)
+	}
+}
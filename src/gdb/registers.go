@@ -0,0 +1,126 @@
+package gdb
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// registerCount is the number of registers in the i386 general register
+// set: EAX, ECX, EDX, EBX, ESP, EBP, ESI, EDI, EIP, EFLAGS, CS, SS, DS,
+// ES, FS and GS. gdb marks the coprocessor registers that follow them in
+// its register set unavailable.
+const registerCount = 16
+
+// register returns register n, numbered as gdb numbers them.
+func (s *Server) register(n int) uint32 {
+	c := s.emu.CPU()
+	switch {
+	case n < 8:
+		return c.Register32(byte(n))
+	case n == 8:
+		return uint32(c.CS)<<4 + uint32(c.IP)
+	case n == 9:
+		return uint32(c.Flags.ToUint16())
+	}
+	return uint32(*s.segment(n))
+}
+
+func (s *Server) setRegister(n int, value uint32) {
+	c := s.emu.CPU()
+	switch {
+	case n < 8:
+		c.SetRegister32(byte(n), value)
+	case n == 8:
+		s.setPC(value)
+	case n == 9:
+		c.Flags.FromUint16(uint16(value))
+	default:
+		*s.segment(n) = uint16(value)
+	}
+}
+
+// segment returns segment register n, from 10 for CS to 15 for GS.
+func (s *Server) segment(n int) *uint16 {
+	c := s.emu.CPU()
+	return [...]*uint16{&c.CS, &c.SS, &c.DS, &c.ES, &c.FS, &c.GS}[n-10]
+}
+
+// readRegisters answers g with all the registers, each as four bytes in
+// little-endian order.
+func (s *Server) readRegisters() string {
+	var reply strings.Builder
+	for n := 0; n < registerCount; n++ {
+		reply.WriteString(encodeRegister(s.register(n)))
+	}
+	return reply.String()
+}
+
+// writeRegisters carries out G. EIP is set last, as it depends on CS.
+func (s *Server) writeRegisters(args string) string {
+	data, err := hex.DecodeString(args)
+	if err != nil || len(data) < registerCount*4 {
+		return "E01"
+	}
+	for _, n := range []int{0, 1, 2, 3, 4, 5, 6, 7, 9, 10, 11, 12, 13, 14, 15, 8} {
+		s.setRegister(n, binary.LittleEndian.Uint32(data[n*4:]))
+	}
+	return "OK"
+}
+
+func (s *Server) readRegister(args string) string {
+	n, err := parseHex(args)
+	if err != nil || n >= registerCount {
+		return ""
+	}
+	return encodeRegister(s.register(int(n)))
+}
+
+func (s *Server) writeRegister(args string) string {
+	number, value, ok := strings.Cut(args, "=")
+	n, err := parseHex(number)
+	data, err2 := hex.DecodeString(value)
+	if !ok || err != nil || err2 != nil || len(data) != 4 || n >= registerCount {
+		return "E01"
+	}
+	s.setRegister(int(n), binary.LittleEndian.Uint32(data))
+	return "OK"
+}
+
+func encodeRegister(value uint32) string {
+	var data [4]byte
+	binary.LittleEndian.PutUint32(data[:], value)
+	return hex.EncodeToString(data[:])
+}
+
+// readMemory answers m with the bytes at a linear address.
+func (s *Server) readMemory(args string) string {
+	var addr, length uint32
+	if _, err := fmt.Sscanf(args, "%x,%x", &addr, &length); err != nil {
+		return "E01"
+	}
+	length = min(length, packetSize/2)
+	data := make([]byte, length)
+	for i := range data {
+		data[i] = s.emu.Memory().Read8(addr + uint32(i))
+	}
+	return hex.EncodeToString(data)
+}
+
+// writeMemory carries out M, storing bytes at a linear address.
+func (s *Server) writeMemory(args string) string {
+	header, value, ok := strings.Cut(args, ":")
+	var addr, length uint32
+	if _, err := fmt.Sscanf(header, "%x,%x", &addr, &length); err != nil || !ok {
+		return "E01"
+	}
+	data, err := hex.DecodeString(value)
+	if err != nil || uint32(len(data)) != length {
+		return "E01"
+	}
+	for i, b := range data {
+		s.emu.Memory().Write8(addr+uint32(i), b)
+	}
+	return "OK"
+}
@@ -0,0 +1,283 @@
+// Package gdb lets the GNU debugger, or an IDE that speaks its remote
+// serial protocol, debug a program running in the emulator.
+//
+// Registers are exchanged in the i386 layout. EIP holds the linear
+// address CS*16+IP, so that gdb can read the code at the program
+// counter; memory addresses are linear throughout.
+package gdb
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"sync/atomic"
+
+	"dos-emulator/dos"
+	"dos-emulator/memory"
+)
+
+// targetXML tells gdb the processor is an 8086, so that it needs no
+// "set architecture i8086".
+const targetXML = `<?xml version="1.0"?>
+<!DOCTYPE target SYSTEM "gdb-target.dtd">
+<target version="1.0"><architecture>i8086</architecture></target>`
+
+// packetSize is the largest packet the server accepts, in bytes.
+const packetSize = 0x1000
+
+// Server is a debugging session with one gdb connection.
+type Server struct {
+	emu         *dos.DOSEmulator
+	conn        net.Conn
+	noAck       atomic.Bool
+	breakpoints map[uint32]bool // linear addresses of the breakpoints gdb set
+	exited      bool
+	detached    bool
+}
+
+// Serve waits for gdb to connect on addr, such as ":1234", and lets it
+// control the loaded program until it detaches, kills the program or
+// disconnects. A program gdb detaches from runs on to its end.
+func Serve(emu *dos.DOSEmulator, addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Waiting for gdb on %s\n", listener.Addr())
+	conn, err := listener.Accept()
+	listener.Close()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	fmt.Printf("gdb connected from %s\n", conn.RemoteAddr())
+
+	s := &Server{emu: emu, conn: conn, breakpoints: make(map[uint32]bool)}
+	packets := make(chan string)
+	go s.receive(packets)
+	for packet := range packets {
+		reply, done := s.handle(packet)
+		if err := s.send(reply); err != nil {
+			return err
+		}
+		if done {
+			break
+		}
+	}
+	for addr := range s.breakpoints {
+		emu.DeleteRemoteBreakpoint(addr)
+	}
+	if s.detached {
+		conn.Close()
+		s.runToEnd()
+	}
+	return nil
+}
+
+// receive reads packets from gdb, acknowledging them, and passes them on
+// until the connection closes. A Ctrl-C from gdb interrupts the program
+// at once rather than waiting its turn.
+func (s *Server) receive(packets chan<- string) {
+	defer close(packets)
+	reader := bufio.NewReader(s.conn)
+	for {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return
+		}
+		switch b {
+		case 0x03:
+			s.emu.Interrupt()
+			continue
+		case '$':
+		default:
+			// Acknowledgements; TCP leaves nothing to retransmit.
+			continue
+		}
+
+		data, err := reader.ReadString('#')
+		if err != nil {
+			return
+		}
+		data = data[:len(data)-1]
+		var sum [2]byte
+		for i := range sum {
+			if sum[i], err = reader.ReadByte(); err != nil {
+				return
+			}
+		}
+		if !s.noAck.Load() {
+			ack := "+"
+			if fmt.Sprintf("%02x", checksum(data)) != string(sum[:]) {
+				ack = "-"
+			}
+			s.conn.Write([]byte(ack))
+			if ack == "-" {
+				continue
+			}
+		}
+		packets <- data
+	}
+}
+
+// send sends a reply packet.
+func (s *Server) send(data string) error {
+	_, err := fmt.Fprintf(s.conn, "$%s#%02x", data, checksum(data))
+	return err
+}
+
+func checksum(data string) byte {
+	var sum byte
+	for i := 0; i < len(data); i++ {
+		sum += data[i]
+	}
+	return sum
+}
+
+// handle carries out one packet and returns the reply, and true when the
+// session is over. Packets it does not know get the empty reply, which
+// tells gdb they are not supported.
+func (s *Server) handle(packet string) (string, bool) {
+	if packet == "" {
+		return "", false
+	}
+	args := packet[1:]
+	switch packet[0] {
+	case '?':
+		return s.stopReply(dos.StopTrap), false
+	case 'g':
+		return s.readRegisters(), false
+	case 'G':
+		return s.writeRegisters(args), false
+	case 'p':
+		return s.readRegister(args), false
+	case 'P':
+		return s.writeRegister(args), false
+	case 'm':
+		return s.readMemory(args), false
+	case 'M':
+		return s.writeMemory(args), false
+	case 'c', 's':
+		if args != "" {
+			addr, err := parseHex(args)
+			if err != nil {
+				return "E01", false
+			}
+			s.setPC(addr)
+		}
+		return s.resume(packet[0] == 's'), false
+	case 'Z', 'z':
+		return s.breakpoint(packet[0] == 'Z', args), false
+	case 'H':
+		return "OK", false
+	case 'k':
+		return "OK", true
+	case 'D':
+		s.detached = true
+		return "OK", true
+	case 'q', 'Q':
+		return s.query(packet), false
+	}
+	return "", false
+}
+
+// query answers the general query and set packets.
+func (s *Server) query(packet string) string {
+	const features = "qXfer:features:read:target.xml:"
+	switch {
+	case strings.HasPrefix(packet, "qSupported"):
+		return fmt.Sprintf("PacketSize=%x;QStartNoAckMode+;qXfer:features:read+", packetSize)
+	case packet == "QStartNoAckMode":
+		s.noAck.Store(true)
+		return "OK"
+	case packet == "qAttached":
+		return "1"
+	case strings.HasPrefix(packet, features):
+		var offset, length int
+		if _, err := fmt.Sscanf(packet[len(features):], "%x,%x", &offset, &length); err != nil {
+			return "E01"
+		}
+		if offset >= len(targetXML) {
+			return "l"
+		}
+		if offset+length >= len(targetXML) {
+			return "l" + targetXML[offset:]
+		}
+		return "m" + targetXML[offset:offset+length]
+	}
+	return ""
+}
+
+// resume continues or single-steps the program and returns the stop
+// reply for where it stopped.
+func (s *Server) resume(step bool) string {
+	stop := s.emu.Resume(step)
+	if stop == dos.StopExited {
+		s.exited = true
+	}
+	return s.stopReply(stop)
+}
+
+func (s *Server) stopReply(stop dos.Stop) string {
+	if s.exited {
+		return fmt.Sprintf("W%02x", byte(s.emu.ReturnCode()))
+	}
+	if stop == dos.StopInterrupted {
+		return "S02" // SIGINT
+	}
+	return "S05" // SIGTRAP
+}
+
+// runToEnd lets the program run to its end once gdb has detached.
+func (s *Server) runToEnd() {
+	for !s.exited {
+		if s.emu.Resume(false) == dos.StopExited {
+			s.exited = true
+		}
+	}
+}
+
+// breakpoint inserts or removes a software (Z0) or hardware (Z1)
+// breakpoint; both become remote breakpoints of the emulator, which
+// leave the user's own breakpoints alone. Watchpoints are not supported.
+func (s *Server) breakpoint(insert bool, args string) string {
+	var kind, size int
+	var addr uint32
+	if _, err := fmt.Sscanf(args, "%d,%x,%x", &kind, &addr, &size); err != nil {
+		return "E01"
+	}
+	if kind != 0 && kind != 1 {
+		return ""
+	}
+	if !insert {
+		s.emu.DeleteRemoteBreakpoint(addr)
+		delete(s.breakpoints, addr)
+		return "OK"
+	}
+	s.emu.AddRemoteBreakpoint(addr)
+	s.breakpoints[addr] = true
+	return "OK"
+}
+
+// split turns a linear address into a segment and offset, relative to CS
+// when the address lies in the code segment.
+func (s *Server) split(addr uint32) (uint16, uint16) {
+	cs := s.emu.CPU().CS
+	if base := memory.CalculateAddress(cs, 0); addr >= base && addr-base <= 0xFFFF {
+		return cs, uint16(addr - base)
+	}
+	return uint16(addr >> 4), uint16(addr & 0x0F)
+}
+
+// setPC moves CS:IP to a linear address.
+func (s *Server) setPC(addr uint32) {
+	c := s.emu.CPU()
+	c.CS, c.IP = s.split(addr)
+}
+
+func parseHex(text string) (uint32, error) {
+	var value uint32
+	_, err := fmt.Sscanf(text, "%x", &value)
+	return value, err
+}
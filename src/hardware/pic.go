@@ -0,0 +1,164 @@
+// Package hardware emulates the support chips of the PC motherboard.
+package hardware
+
+// Ports of the master interrupt controller.
+const (
+	PICCommandPort = 0x20
+	PICDataPort    = 0x21
+)
+
+// PIC emulates an Intel 8259A programmable interrupt controller wired as
+// the single (master) controller of a PC. IRQ lines are edge triggered:
+// RaiseIRQ latches a request, which is delivered once it is unmasked and
+// no request of equal or higher priority is in service.
+type PIC struct {
+	irr        byte
+	isr        byte
+	imr        byte
+	vectorBase byte
+	initStep   int
+	single     bool
+	needICW4   bool
+	readISR    bool
+}
+
+// NewPIC returns a controller initialised as the BIOS leaves it: IRQs
+// mapped to INT 08h-0Fh with the timer, keyboard and floppy unmasked.
+func NewPIC() *PIC {
+	return &PIC{vectorBase: 0x08, imr: 0xBC}
+}
+
+// PICState is a copy of the controller's registers.
+type PICState struct {
+	pic PIC
+}
+
+// State returns the registers, for SetState to put back later.
+func (p *PIC) State() PICState {
+	return PICState{pic: *p}
+}
+
+func (p *PIC) SetState(s PICState) {
+	*p = s.pic
+}
+
+// RaiseIRQ requests interrupt line irq (0-7).
+func (p *PIC) RaiseIRQ(irq int) {
+	p.irr |= 1 << irq
+}
+
+// highest returns the highest-priority (lowest-numbered) set bit of
+// bits, or -1.
+func highest(bits byte) int {
+	for i := 0; i < 8; i++ {
+		if bits&(1<<i) != 0 {
+			return i
+		}
+	}
+	return -1
+}
+
+// pendingIRQ returns the IRQ the controller would deliver next, or -1.
+func (p *PIC) pendingIRQ() int {
+	irq := highest(p.irr &^ p.imr)
+	if irq < 0 {
+		return -1
+	}
+	if inService := highest(p.isr); inService >= 0 && inService <= irq {
+		return -1
+	}
+	return irq
+}
+
+// Pending reports whether an interrupt is waiting for the CPU.
+func (p *PIC) Pending() bool {
+	return p.pendingIRQ() >= 0
+}
+
+// Acknowledge moves the pending request into service and returns its
+// interrupt vector, as the CPU's interrupt acknowledge cycle does.
+func (p *PIC) Acknowledge() (byte, bool) {
+	irq := p.pendingIRQ()
+	if irq < 0 {
+		return 0, false
+	}
+	p.irr &^= 1 << irq
+	p.isr |= 1 << irq
+	return p.vectorBase + byte(irq), true
+}
+
+// Masked reports whether every IRQ line is masked.
+func (p *PIC) Masked() bool {
+	return p.imr == 0xFF
+}
+
+func (p *PIC) Read8(port uint16) byte {
+	if port == PICDataPort {
+		return p.imr
+	}
+	if p.readISR {
+		return p.isr
+	}
+	return p.irr
+}
+
+func (p *PIC) Write8(port uint16, value byte) {
+	if port == PICCommandPort {
+		switch {
+		case value&0x10 != 0: // ICW1
+			p.initStep = 2
+			p.single = value&0x02 != 0
+			p.needICW4 = value&0x01 != 0
+			p.imr = 0
+			p.isr = 0
+			p.irr = 0
+		case value&0x18 == 0x00: // OCW2
+			switch value & 0xE0 {
+			case 0x20: // non-specific EOI
+				if irq := highest(p.isr); irq >= 0 {
+					p.isr &^= 1 << irq
+				}
+			case 0x60: // specific EOI
+				p.isr &^= 1 << (value & 0x07)
+			}
+		case value&0x18 == 0x08: // OCW3
+			if value&0x02 != 0 {
+				p.readISR = value&0x01 != 0
+			}
+		}
+		return
+	}
+
+	switch p.initStep {
+	case 2: // ICW2: vector base
+		p.vectorBase = value &^ 0x07
+		p.initStep = 3
+		if p.single {
+			p.nextInitStep()
+		}
+	case 3: // ICW3: cascade wiring, not emulated
+		p.nextInitStep()
+	case 4: // ICW4
+		p.initStep = 0
+	default: // OCW1: interrupt mask
+		p.imr = value
+	}
+}
+
+// nextInitStep moves on from ICW3 to ICW4, or ends initialisation when
+// ICW1 said no ICW4 follows.
+func (p *PIC) nextInitStep() {
+	p.initStep = 4
+	if !p.needICW4 {
+		p.initStep = 0
+	}
+}
+
+func (p *PIC) Read16(port uint16) uint16 {
+	return uint16(p.Read8(port)) | uint16(p.Read8(port+1))<<8
+}
+
+func (p *PIC) Write16(port uint16, value uint16) {
+	p.Write8(port, byte(value))
+	p.Write8(port+1, byte(value>>8))
+}
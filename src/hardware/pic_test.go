@@ -0,0 +1,141 @@
+package hardware
+
+import "testing"
+
+// picStep is one action on the controller. For "ack" want is the vector
+// delivered, or -1 when nothing is pending; for "in" it is the byte read.
+type picStep struct {
+	op    string // "raise", "ack", "out" or "in"
+	port  uint16
+	value byte
+	want  int
+}
+
+func raise(irq byte) picStep           { return picStep{op: "raise", value: irq} }
+func ack(want int) picStep             { return picStep{op: "ack", want: want} }
+func out(port uint16, v byte) picStep  { return picStep{op: "out", port: port, value: v} }
+func in(port uint16, want int) picStep { return picStep{op: "in", port: port, want: want} }
+
+func TestPIC(t *testing.T) {
+	const cmd, data = PICCommandPort, PICDataPort
+	eoi := out(cmd, 0x20)
+
+	tests := []struct {
+		name  string
+		steps []picStep
+	}{
+		{"BIOS mask", []picStep{
+			in(data, 0xBC),
+			raise(2), ack(-1),
+			raise(0), ack(0x08),
+		}},
+		{"lowest IRQ first", []picStep{
+			out(data, 0x00),
+			raise(5), raise(3), raise(7),
+			ack(0x0B), eoi,
+			ack(0x0D), eoi,
+			ack(0x0F), eoi,
+			ack(-1),
+		}},
+		{"in service blocks equal and lower priority", []picStep{
+			out(data, 0x00),
+			raise(3), ack(0x0B),
+			raise(3), raise(4), ack(-1),
+			eoi, ack(0x0B),
+			eoi, ack(0x0C),
+		}},
+		{"higher priority nests", []picStep{
+			out(data, 0x00),
+			raise(3), ack(0x0B),
+			raise(1), ack(0x09),
+			eoi, ack(-1),
+			eoi, ack(-1),
+		}},
+		{"non-specific EOI ends the highest in service", []picStep{
+			out(data, 0x00),
+			raise(4), ack(0x0C),
+			raise(1), ack(0x09),
+			raise(2), eoi, ack(0x0A),
+		}},
+		{"specific EOI", []picStep{
+			out(data, 0x00),
+			raise(4), ack(0x0C),
+			raise(1), ack(0x09),
+			out(cmd, 0x64), raise(5), ack(-1),
+			eoi, ack(0x0D),
+		}},
+		{"masked requests wait", []picStep{
+			out(data, 0xFF),
+			raise(0), raise(6), ack(-1),
+			out(data, 0xBF), ack(0x0E), eoi,
+			out(data, 0x00), ack(0x08),
+		}},
+		{"mask does not hide in service", []picStep{
+			out(data, 0x00),
+			raise(2), ack(0x0A),
+			out(data, 0x04), raise(3), ack(-1),
+		}},
+		{"OCW3 selects IRR or ISR", []picStep{
+			out(data, 0x02),
+			raise(0), raise(1), ack(0x08),
+			in(cmd, 0x02),
+			out(cmd, 0x0B), in(cmd, 0x01),
+			out(cmd, 0x08), in(cmd, 0x01),
+			out(cmd, 0x0A), in(cmd, 0x02),
+		}},
+		{"initialisation", []picStep{
+			raise(0),
+			out(cmd, 0x11), out(data, 0x70), out(data, 0x04), out(data, 0x01),
+			in(data, 0x00), ack(-1),
+			raise(0), ack(0x70),
+			out(data, 0x00), in(data, 0x00),
+		}},
+		{"single controller without ICW4", []picStep{
+			out(cmd, 0x12), out(data, 0x57),
+			out(data, 0xFD), in(data, 0xFD),
+			raise(1), ack(0x51),
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := NewPIC()
+			for i, step := range test.steps {
+				got := step.want
+				switch step.op {
+				case "raise":
+					p.RaiseIRQ(int(step.value))
+				case "ack":
+					pending := p.Pending()
+					got = -1
+					if vector, ok := p.Acknowledge(); ok {
+						got = int(vector)
+					}
+					if pending != (got >= 0) {
+						t.Fatalf("step %d: Pending %v, but Acknowledge returned %02X", i, pending, got)
+					}
+				case "out":
+					p.Write8(step.port, step.value)
+				case "in":
+					got = int(p.Read8(step.port))
+				}
+				if got != step.want {
+					t.Fatalf("step %d (%s): got %02X, want %02X", i, step.op, got, step.want)
+				}
+			}
+		})
+	}
+}
+
+// TestPICMasked checks Masked, which lets a halted CPU stop waiting.
+func TestPICMasked(t *testing.T) {
+	p := NewPIC()
+	if p.Masked() {
+		t.Error("BIOS mask reported as fully masked")
+	}
+	p.Write8(PICDataPort, 0xFF)
+	p.RaiseIRQ(0)
+	if !p.Masked() || p.Pending() {
+		t.Error("mask FF: want masked and nothing pending")
+	}
+}
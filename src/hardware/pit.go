@@ -0,0 +1,196 @@
+package hardware
+
+// Ports of the programmable interval timer.
+const (
+	PITCounterPort = 0x40
+	PITControlPort = 0x43
+)
+
+// PITFrequency is the input clock of the timer in Hz.
+const PITFrequency = 1193182
+
+// Counter access modes selected by bits 4-5 of the control word.
+const (
+	accessLatch = 0
+	accessLow   = 1
+	accessHigh  = 2
+	accessBoth  = 3
+)
+
+type pitChannel struct {
+	mode      byte
+	access    byte
+	reload    uint32
+	count     uint32
+	running   bool
+	latched   bool
+	latch     uint16
+	readHigh  bool
+	writeHigh bool
+	writeLow  byte
+}
+
+// PIT emulates an Intel 8253/8254 programmable interval timer. It has no
+// clock of its own: the machine calls Advance with the number of timer
+// input clocks that elapsed. Channel 0 raises IRQ0 each time its count
+// expires; channels 1 (DRAM refresh) and 2 (speaker) count but have no
+// outputs wired up.
+type PIT struct {
+	channels [3]pitChannel
+	irq0     func()
+}
+
+// NewPIT returns a timer initialised as the BIOS leaves it: channel 0 in
+// square wave mode with a count of 65536, giving about 18.2 IRQ0s per
+// second. irq0 is called whenever channel 0 fires.
+func NewPIT(irq0 func()) *PIT {
+	t := &PIT{irq0: irq0}
+	t.channels[0] = pitChannel{mode: 3, access: accessBoth, reload: 0x10000, count: 0x10000, running: true}
+	return t
+}
+
+// PITState is a copy of the timer's counters.
+type PITState struct {
+	channels [3]pitChannel
+}
+
+// State returns the counters, for SetState to put back later.
+func (t *PIT) State() PITState {
+	return PITState{channels: t.channels}
+}
+
+func (t *PIT) SetState(s PITState) {
+	t.channels = s.channels
+}
+
+// Advance runs the timer for clocks input clock cycles.
+func (t *PIT) Advance(clocks uint32) {
+	for i := range t.channels {
+		ch := &t.channels[i]
+		if !ch.running || clocks == 0 {
+			continue
+		}
+		if clocks < ch.count {
+			ch.count -= clocks
+			continue
+		}
+
+		elapsed := clocks - ch.count
+		fired := uint32(1)
+		switch ch.mode {
+		case 2, 3:
+			// Periodic modes reload and keep counting.
+			fired += elapsed / ch.reload
+			ch.count = ch.reload - elapsed%ch.reload
+		default:
+			// One-shot modes fire once and then wrap around.
+			ch.running = false
+			ch.count = 0x10000 - elapsed%0x10000
+		}
+		if i == 0 && t.irq0 != nil {
+			for ; fired > 0; fired-- {
+				t.irq0()
+			}
+		}
+	}
+}
+
+func (t *PIT) Read8(port uint16) byte {
+	if port == PITControlPort {
+		return 0xFF
+	}
+	ch := &t.channels[port-PITCounterPort]
+
+	value := uint16(ch.count)
+	if ch.latched {
+		value = ch.latch
+	}
+
+	var result byte
+	switch ch.access {
+	case accessLow:
+		result = byte(value)
+		ch.latched = false
+	case accessHigh:
+		result = byte(value >> 8)
+		ch.latched = false
+	default:
+		if ch.readHigh {
+			result = byte(value >> 8)
+			ch.latched = false
+		} else {
+			result = byte(value)
+		}
+		ch.readHigh = !ch.readHigh
+	}
+	return result
+}
+
+func (t *PIT) Write8(port uint16, value byte) {
+	if port == PITControlPort {
+		t.control(value)
+		return
+	}
+	ch := &t.channels[port-PITCounterPort]
+
+	switch ch.access {
+	case accessLow:
+		ch.load(uint16(value))
+	case accessHigh:
+		ch.load(uint16(value) << 8)
+	default:
+		if ch.writeHigh {
+			ch.load(uint16(ch.writeLow) | uint16(value)<<8)
+		} else {
+			ch.writeLow = value
+		}
+		ch.writeHigh = !ch.writeHigh
+	}
+}
+
+// control handles a write to the mode/command register.
+func (t *PIT) control(value byte) {
+	sel := value >> 6
+	if sel == 3 {
+		return // read-back command, 8254 only
+	}
+	ch := &t.channels[sel]
+	access := (value >> 4) & 0x03
+
+	if access == accessLatch {
+		if !ch.latched {
+			ch.latched = true
+			ch.latch = uint16(ch.count)
+		}
+		return
+	}
+
+	ch.access = access
+	ch.mode = (value >> 1) & 0x07
+	if ch.mode > 5 {
+		ch.mode -= 4
+	}
+	ch.running = false
+	ch.latched = false
+	ch.readHigh = false
+	ch.writeHigh = false
+}
+
+// load starts the channel with a new count; 0 stands for 65536.
+func (ch *pitChannel) load(value uint16) {
+	ch.reload = uint32(value)
+	if ch.reload == 0 {
+		ch.reload = 0x10000
+	}
+	ch.count = ch.reload
+	ch.running = true
+}
+
+func (t *PIT) Read16(port uint16) uint16 {
+	return uint16(t.Read8(port)) | uint16(t.Read8(port+1))<<8
+}
+
+func (t *PIT) Write16(port uint16, value uint16) {
+	t.Write8(port, byte(value))
+	t.Write8(port+1, byte(value>>8))
+}
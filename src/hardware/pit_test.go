@@ -0,0 +1,137 @@
+package hardware
+
+import "testing"
+
+// readCounter latches channel 0 and reads the latched count, low byte
+// first.
+func readCounter(t *PIT) uint16 {
+	t.Write8(PITControlPort, 0x00)
+	return uint16(t.Read8(PITCounterPort)) | uint16(t.Read8(PITCounterPort))<<8
+}
+
+func TestPITModes(t *testing.T) {
+	tests := []struct {
+		name    string
+		control byte
+		count   uint16
+		advance []uint32 // clocks to run, one step at a time
+		irqs    []int    // total IRQ0s after each step
+		counter []uint16 // latched count after each step
+	}{
+		{"mode 0 fires once", 0x30, 100,
+			[]uint32{99, 1, 1000},
+			[]int{0, 1, 1},
+			[]uint16{1, 0, 0}},
+		{"mode 0 fires once when overrun", 0x30, 100,
+			[]uint32{350},
+			[]int{1},
+			[]uint16{0x10000 - 250}},
+		{"mode 2 reloads", 0x34, 100,
+			[]uint32{99, 1, 250, 50},
+			[]int{0, 1, 3, 4},
+			[]uint16{1, 100, 50, 100}},
+		{"mode 3 reloads", 0x36, 1000,
+			[]uint32{999, 1, 2500},
+			[]int{0, 1, 3},
+			[]uint16{1, 1000, 500}},
+		{"mode 3 count 0 is 65536", 0x36, 0,
+			[]uint32{0xFFFF, 1, 3 * 0x10000},
+			[]int{0, 1, 4},
+			[]uint16{1, 0, 0}},
+		{"mode 6 is mode 2", 0x3C, 10,
+			[]uint32{25},
+			[]int{2},
+			[]uint16{5}},
+		{"mode 7 is mode 3", 0x3E, 10,
+			[]uint32{25},
+			[]int{2},
+			[]uint16{5}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			irqs := 0
+			pit := NewPIT(func() { irqs++ })
+			pit.Write8(PITControlPort, test.control)
+			pit.Write8(PITCounterPort, byte(test.count))
+			pit.Write8(PITCounterPort, byte(test.count>>8))
+			for i, clocks := range test.advance {
+				pit.Advance(clocks)
+				if counter := readCounter(pit); irqs != test.irqs[i] || counter != test.counter[i] {
+					t.Fatalf("step %d: %d IRQs, counter %d; want %d IRQs, counter %d",
+						i, irqs, counter, test.irqs[i], test.counter[i])
+				}
+			}
+		})
+	}
+}
+
+// TestPITDefault checks the BIOS setting of channel 0: a count of 65536
+// in square wave mode.
+func TestPITDefault(t *testing.T) {
+	irqs := 0
+	pit := NewPIT(func() { irqs++ })
+	pit.Advance(18 * 0x10000)
+	if irqs != 18 {
+		t.Errorf("%d IRQs in 18 periods, want 18", irqs)
+	}
+}
+
+// TestPITProgramming checks that a control word stops the channel until
+// a count is loaded, the access modes, and that a latched count holds
+// while the counter runs on.
+func TestPITProgramming(t *testing.T) {
+	irqs := 0
+	pit := NewPIT(func() { irqs++ })
+
+	pit.Write8(PITControlPort, 0x34)
+	pit.Advance(0x20000)
+	if irqs != 0 {
+		t.Fatalf("%d IRQs before a count is loaded, want 0", irqs)
+	}
+	pit.Write8(PITCounterPort, 0x34)
+	pit.Advance(0x20000)
+	if irqs != 0 {
+		t.Fatalf("%d IRQs after the low byte only, want 0", irqs)
+	}
+	pit.Write8(PITCounterPort, 0x12)
+	pit.Advance(0x1234)
+	if irqs != 1 {
+		t.Fatalf("%d IRQs after one period, want 1", irqs)
+	}
+
+	// Low byte only access.
+	pit.Write8(PITControlPort, 0x14)
+	pit.Write8(PITCounterPort, 0x50)
+	pit.Advance(0x10)
+	if got := pit.Read8(PITCounterPort); got != 0x40 {
+		t.Errorf("low byte access reads %02X, want 40", got)
+	}
+
+	// High byte only access.
+	pit.Write8(PITControlPort, 0x24)
+	pit.Write8(PITCounterPort, 0x02)
+	pit.Advance(0x100)
+	if got := pit.Read8(PITCounterPort); got != 0x01 {
+		t.Errorf("high byte access reads %02X, want 01", got)
+	}
+
+	// The latch holds its value until both bytes are read; a second
+	// latch command before then is ignored.
+	pit.Write8(PITControlPort, 0x34)
+	pit.Write8(PITCounterPort, 0x00)
+	pit.Write8(PITCounterPort, 0x10)
+	pit.Advance(0x100)
+	pit.Write8(PITControlPort, 0x00)
+	pit.Advance(0x100)
+	pit.Write8(PITControlPort, 0x00)
+	low := pit.Read8(PITCounterPort)
+	pit.Advance(0x100)
+	high := pit.Read8(PITCounterPort)
+	if got := uint16(low) | uint16(high)<<8; got != 0x0F00 {
+		t.Errorf("latched count %04X, want 0F00", got)
+	}
+	if got := readCounter(pit); got != 0x0D00 {
+		t.Errorf("count %04X after the latch is read, want 0D00", got)
+	}
+}
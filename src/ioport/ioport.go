@@ -0,0 +1,96 @@
+// Package ioport implements the x86 I/O port address space. Emulated
+// hardware registers the ports it decodes on a Bus, and the CPU's IN and
+// OUT instructions are dispatched through it.
+package ioport
+
+import "fmt"
+
+// Device is a piece of emulated hardware reachable through I/O ports.
+// The port passed to each method is the full port number, so a device
+// claiming several ports can tell them apart. Read16 and Write16 are only
+// called when the device claims both port and port+1.
+type Device interface {
+	Read8(port uint16) byte
+	Write8(port uint16, value byte)
+	Read16(port uint16) uint16
+	Write16(port uint16, value uint16)
+}
+
+type portRange struct {
+	first, last uint16
+	device      Device
+}
+
+// Bus routes port accesses to the device that claimed the port. Reads
+// from unclaimed ports return all ones, as on a real ISA bus, and writes
+// to them are ignored.
+type Bus struct {
+	ranges    []portRange
+	debugMode bool
+}
+
+func New() *Bus {
+	return &Bus{}
+}
+
+func (b *Bus) SetDebugMode(enabled bool) {
+	b.debugMode = enabled
+}
+
+// Register claims ports first through last for device. Later
+// registrations take precedence over earlier ones for the same port.
+func (b *Bus) Register(first, last uint16, device Device) {
+	b.ranges = append(b.ranges, portRange{first: first, last: last, device: device})
+}
+
+func (b *Bus) lookup(port uint16) Device {
+	for i := len(b.ranges) - 1; i >= 0; i-- {
+		if port >= b.ranges[i].first && port <= b.ranges[i].last {
+			return b.ranges[i].device
+		}
+	}
+	return nil
+}
+
+func (b *Bus) unclaimed(access string, port uint16) {
+	if b.debugMode {
+		fmt.Printf("Unclaimed port %s: 0x%04X\n", access, port)
+	}
+}
+
+func (b *Bus) Read8(port uint16) byte {
+	if d := b.lookup(port); d != nil {
+		return d.Read8(port)
+	}
+	b.unclaimed("read", port)
+	return 0xFF
+}
+
+func (b *Bus) Write8(port uint16, value byte) {
+	if d := b.lookup(port); d != nil {
+		d.Write8(port, value)
+		return
+	}
+	b.unclaimed("write", port)
+}
+
+// Read16 reads the word at port and port+1. A device that claims both
+// ports gets the whole access; otherwise it is split into two byte
+// accesses, low byte first, so that each byte reaches the device that
+// claims its port.
+func (b *Bus) Read16(port uint16) uint16 {
+	if d := b.lookup(port); d != nil && b.lookup(port+1) == d {
+		return d.Read16(port)
+	}
+	return uint16(b.Read8(port)) | uint16(b.Read8(port+1))<<8
+}
+
+// Write16 writes the word at port and port+1, split like Read16.
+func (b *Bus) Write16(port uint16, value uint16) {
+	if d := b.lookup(port); d != nil && b.lookup(port+1) == d {
+		d.Write16(port, value)
+		return
+	}
+	b.Write8(port, byte(value))
+	b.Write8(port+1, byte(value>>8))
+}
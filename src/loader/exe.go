@@ -0,0 +1,80 @@
+// Package loader places COM and EXE program images into emulated memory.
+package loader
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+type EXEHeader struct {
+	Signature       uint16
+	BytesInLastPage uint16
+	PagesInFile     uint16
+	Relocations     uint16
+	HeaderSize      uint16
+	MinAlloc        uint16
+	MaxAlloc        uint16
+	InitialSS       uint16
+	InitialSP       uint16
+	Checksum        uint16
+	InitialIP       uint16
+	InitialCS       uint16
+	RelocTableOff   uint16
+	OverlayNumber   uint16
+}
+
+func ReadEXEHeader(data []byte) (*EXEHeader, error) {
+	if len(data) < 28 {
+		return nil, fmt.Errorf("file too small for EXE header")
+	}
+
+	header := &EXEHeader{
+		Signature:       binary.LittleEndian.Uint16(data[0:2]),
+		BytesInLastPage: binary.LittleEndian.Uint16(data[2:4]),
+		PagesInFile:     binary.LittleEndian.Uint16(data[4:6]),
+		Relocations:     binary.LittleEndian.Uint16(data[6:8]),
+		HeaderSize:      binary.LittleEndian.Uint16(data[8:10]),
+		MinAlloc:        binary.LittleEndian.Uint16(data[10:12]),
+		MaxAlloc:        binary.LittleEndian.Uint16(data[12:14]),
+		InitialSS:       binary.LittleEndian.Uint16(data[14:16]),
+		InitialSP:       binary.LittleEndian.Uint16(data[16:18]),
+		Checksum:        binary.LittleEndian.Uint16(data[18:20]),
+		InitialIP:       binary.LittleEndian.Uint16(data[20:22]),
+		InitialCS:       binary.LittleEndian.Uint16(data[22:24]),
+		RelocTableOff:   binary.LittleEndian.Uint16(data[24:26]),
+		OverlayNumber:   binary.LittleEndian.Uint16(data[26:28]),
+	}
+
+	if header.Signature != 0x5A4D && header.Signature != 0x4D5A {
+		return nil, fmt.Errorf("invalid EXE signature")
+	}
+
+	return header, nil
+}
+
+// LoadSize returns the size in bytes of the load module: the part of the
+// file after the header that is copied into memory.
+func (h *EXEHeader) LoadSize() int {
+	size := int(h.PagesInFile) * 512
+	if h.BytesInLastPage != 0 {
+		size = size - 512 + int(h.BytesInLastPage)
+	}
+	return size - int(h.HeaderSize)*16
+}
+
+// MinParagraphs returns the memory the program needs, in paragraphs,
+// counting the PSP, the load module, the minimum extra allocation and the
+// initial stack.
+func (h *EXEHeader) MinParagraphs() uint32 {
+	paras := 0x10 + (uint32(max(h.LoadSize(), 0))+15)/16 + uint32(h.MinAlloc)
+	stackTop := 0x10 + uint32(h.InitialSS) + (uint32(h.InitialSP)+15)/16
+	return max(paras, stackTop)
+}
+
+// MaxParagraphs returns the most memory the program asks for, in
+// paragraphs: the PSP, the load module and the maximum extra allocation.
+// It is never less than MinParagraphs.
+func (h *EXEHeader) MaxParagraphs() uint32 {
+	paras := 0x10 + (uint32(max(h.LoadSize(), 0))+15)/16 + uint32(h.MaxAlloc)
+	return max(paras, h.MinParagraphs())
+}
@@ -0,0 +1,102 @@
+package loader
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"dos-emulator/memory"
+)
+
+// MaxCOMSize is the largest COM image that fits in a 64 KB segment after
+// the PSP.
+const MaxCOMSize = 65280
+
+// Image describes where a loaded program starts executing.
+type Image struct {
+	CS, IP uint16
+	SS, SP uint16
+	Size   int
+}
+
+// IsEXE reports whether data starts with an MZ (or ZM) signature.
+func IsEXE(data []byte) bool {
+	if len(data) < 2 {
+		return false
+	}
+	signature := binary.LittleEndian.Uint16(data[0:2])
+	return signature == 0x5A4D || signature == 0x4D5A
+}
+
+// LoadCOM copies a COM image to pspSegment:0100.
+func LoadCOM(mem *memory.Memory, pspSegment uint16, data []byte) (*Image, error) {
+	if len(data) > MaxCOMSize {
+		return nil, fmt.Errorf("COM file too large")
+	}
+
+	comStart := memory.CalculateAddress(pspSegment, 0x100)
+	for i, b := range data {
+		mem.Write8(comStart+uint32(i), b)
+	}
+
+	return &Image{
+		CS:   pspSegment,
+		IP:   0x100,
+		SS:   pspSegment,
+		SP:   0xFFFE,
+		Size: len(data),
+	}, nil
+}
+
+// LoadEXE copies an EXE image to the paragraph following the PSP at
+// pspSegment and applies its relocation table.
+func LoadEXE(mem *memory.Memory, pspSegment uint16, data []byte) (*Image, *EXEHeader, error) {
+	if len(data) < 28 {
+		return nil, nil, fmt.Errorf("file too small to be an EXE")
+	}
+
+	header, err := ReadEXEHeader(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	loadSize := header.LoadSize()
+	headerSize := int(header.HeaderSize) * 16
+	if loadSize < 0 || headerSize+loadSize > len(data) {
+		return nil, nil, fmt.Errorf("invalid EXE image size")
+	}
+
+	programSegment := pspSegment + 0x10
+	programData := data[headerSize : headerSize+loadSize]
+	loadAddr := memory.CalculateAddress(programSegment, 0)
+
+	for i, b := range programData {
+		mem.Write8(loadAddr+uint32(i), b)
+	}
+
+	if header.Relocations > 0 && header.RelocTableOff > 0 {
+		relocTableAddr := int(header.RelocTableOff)
+		for i := 0; i < int(header.Relocations); i++ {
+			if relocTableAddr+4 > len(data) {
+				break
+			}
+
+			offset := binary.LittleEndian.Uint16(data[relocTableAddr : relocTableAddr+2])
+			segment := binary.LittleEndian.Uint16(data[relocTableAddr+2 : relocTableAddr+4])
+
+			relocAddr := memory.CalculateAddress(programSegment+segment, offset)
+			currentValue := mem.Read16(relocAddr)
+			newValue := currentValue + programSegment
+			mem.Write16(relocAddr, newValue)
+
+			relocTableAddr += 4
+		}
+	}
+
+	return &Image{
+		CS:   programSegment + header.InitialCS,
+		IP:   header.InitialIP,
+		SS:   programSegment + header.InitialSS,
+		SP:   header.InitialSP,
+		Size: len(programData),
+	}, header, nil
+}
@@ -0,0 +1,135 @@
+// Package memory implements the 1 MB real-mode address space of the
+// emulated PC.
+package memory
+
+// Size is the number of bytes addressable in real mode.
+const Size = 0x100000
+
+// WriteHook is called after the guest writes to a watched address.
+type WriteHook func(addr uint32)
+
+// JournalHook is called after every write through Write8 with the byte
+// the write replaced.
+type JournalHook func(addr uint32, old byte)
+
+// Code pages are the units in which the CPU's decode cache tracks guest
+// writes to memory it has decoded instructions from.
+const (
+	CodePageShift = 8
+	CodePageSize  = 1 << CodePageShift
+)
+
+type watch struct {
+	start, end uint32
+	hook       WriteHook
+}
+
+type Memory struct {
+	data      [Size]byte
+	watches   []watch
+	codePages [Size >> CodePageShift]bool
+	codeHook  WriteHook
+	journal   JournalHook
+}
+
+func New() *Memory {
+	return &Memory{}
+}
+
+func (m *Memory) Read8(addr uint32) byte {
+	if addr >= uint32(len(m.data)) {
+		return 0
+	}
+	return m.data[addr]
+}
+
+func (m *Memory) Write8(addr uint32, value byte) {
+	if addr < uint32(len(m.data)) {
+		m.Store(addr, value)
+		for i := range m.watches {
+			if addr >= m.watches[i].start && addr < m.watches[i].end {
+				m.watches[i].hook(addr)
+			}
+		}
+	}
+}
+
+// Store writes value at addr for a device that owns the address, such as
+// the BIOS drawing into video memory. Like Write8 it discards code
+// decoded from the page and calls the journal, but it does not call the
+// watch hooks, which tell devices about writes by the guest.
+func (m *Memory) Store(addr uint32, value byte) {
+	if addr >= uint32(len(m.data)) {
+		return
+	}
+	old := m.data[addr]
+	m.data[addr] = value
+	if m.codePages[addr>>CodePageShift] {
+		m.codePages[addr>>CodePageShift] = false
+		m.codeHook(addr)
+	}
+	if m.journal != nil {
+		m.journal(addr, old)
+	}
+}
+
+func (m *Memory) Read16(addr uint32) uint16 {
+	low := uint16(m.Read8(addr))
+	high := uint16(m.Read8(addr + 1))
+	return (high << 8) | low
+}
+
+func (m *Memory) Write16(addr uint32, value uint16) {
+	m.Write8(addr, byte(value&0xFF))
+	m.Write8(addr+1, byte((value>>8)&0xFF))
+}
+
+// Watch registers hook to be called for every write to [start, end).
+// Devices use it to notice guest writes to memory-mapped buffers.
+func (m *Memory) Watch(start, end uint32, hook WriteHook) {
+	m.watches = append(m.watches, watch{start: start, end: end, hook: hook})
+}
+
+// OnCodeWrite sets the hook called for the first write to a page marked
+// with MarkCode. The mark is cleared before the hook runs.
+func (m *Memory) OnCodeWrite(hook WriteHook) {
+	m.codeHook = hook
+}
+
+// SetJournal sets the hook called for every write, or removes it if hook
+// is nil.
+func (m *Memory) SetJournal(hook JournalHook) {
+	m.journal = hook
+}
+
+// Restore puts back a byte the journal recorded. Unlike Write8 it calls
+// neither the journal nor the watch hooks, though code decoded from the
+// page is still discarded.
+func (m *Memory) Restore(addr uint32, value byte) {
+	if addr >= uint32(len(m.data)) {
+		return
+	}
+	m.data[addr] = value
+	if m.codePages[addr>>CodePageShift] {
+		m.codePages[addr>>CodePageShift] = false
+		m.codeHook(addr)
+	}
+}
+
+// MarkCode marks the page containing addr as holding decoded code.
+func (m *Memory) MarkCode(addr uint32) {
+	if addr < Size && m.codeHook != nil {
+		m.codePages[addr>>CodePageShift] = true
+	}
+}
+
+// Slice returns the bytes in [start, end) without copying, for reading.
+// Writes through the slice would bypass the journal and the decode
+// cache; devices write with Store.
+func (m *Memory) Slice(start, end uint32) []byte {
+	return m.data[start:end]
+}
+
+func CalculateAddress(segment, offset uint16) uint32 {
+	return (uint32(segment) << 4) + uint32(offset)
+}
@@ -0,0 +1,512 @@
+// Package shell implements the interactive DOS-style command prompt.
+package shell
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"dos-emulator/cpu"
+	"dos-emulator/dos"
+	"dos-emulator/memory"
+)
+
+type Shell struct {
+	emu     *dos.DOSEmulator
+	cpu     *cpu.CPU
+	memory  *memory.Memory
+	decoder *cpu.InstructionDecoder
+}
+
+func New(emu *dos.DOSEmulator) *Shell {
+	return &Shell{
+		emu:     emu,
+		cpu:     emu.CPU(),
+		memory:  emu.Memory(),
+		decoder: emu.Decoder(),
+	}
+}
+
+func (s *Shell) Run() {
+	reader := s.emu.Input()
+
+	fmt.Println("MS-DOS Emulator v5.2 - Full COM & EXE Support")
+	fmt.Println("Full 8086 CPU + BIOS + DOS + REP PREFIX FULLY FIXED")
+	fmt.Println()
+	fmt.Println("Type 'HELP' for available commands")
+	fmt.Println()
+
+	for {
+		driveLetter := string(rune('A' + s.emu.CurrentDrive()))
+		fmt.Printf("%s:\\> ", driveLetter)
+
+		input, _ := reader.ReadString('\n')
+		input = strings.TrimSpace(input)
+
+		if input == "" {
+			continue
+		}
+
+		parts := strings.Fields(input)
+		command := strings.ToUpper(parts[0])
+
+		switch command {
+		case "HELP", "?":
+			s.showHelp()
+		case "CLS":
+			fmt.Print("\033[H\033[2J")
+		case "VER":
+			fmt.Println("MS-DOS Emulator Version 5.2 - Complete COM & EXE Support with REP Fixed")
+			fmt.Printf("CPU: %s\n", s.emu.Executor().Model())
+			fmt.Printf("Instructions executed: %d\n", s.emu.InstructionCount())
+		case "DIR":
+			s.listDirectory()
+		case "CD":
+			s.changeDirectory(parts)
+		case "MD", "MKDIR":
+			s.makeDirectory(parts)
+		case "RD", "RMDIR":
+			s.removeDirectory(parts)
+		case "DEL", "ERASE":
+			s.deleteFile(parts)
+		case "TYPE":
+			s.typeFile(parts)
+		case "COPY":
+			s.copyFile(parts)
+		case "REN", "RENAME":
+			s.renameFile(parts)
+		case "ECHO":
+			if len(parts) > 1 {
+				fmt.Println(strings.Join(parts[1:], " "))
+			}
+		case "DATE":
+			s.showDate()
+		case "TIME":
+			s.showTime()
+		case "MEM":
+			s.showMemoryInfo()
+		case "REGS":
+			s.showRegisters()
+		case "DEBUG":
+			if len(parts) > 1 && (strings.ToUpper(parts[1]) == "ON" || strings.ToUpper(parts[1]) == "OFF") {
+				s.emu.SetDebugMode(strings.ToUpper(parts[1]) == "ON")
+				fmt.Printf("Debug mode: %v\n", s.emu.DebugMode())
+			} else if len(parts) > 1 {
+				s.emu.Debug(parts[1], parts[2:])
+			} else {
+				s.emu.Debug("", nil)
+			}
+		case "STEP":
+			s.emu.SetStepMode(!s.emu.StepMode())
+			fmt.Printf("Step mode: %v\n", s.emu.StepMode())
+		case "TRACE":
+			s.emu.SetTraceMode(!s.emu.TraceMode())
+			fmt.Printf("Trace mode: %v\n", s.emu.TraceMode())
+		case "DUMP":
+			s.dumpMemory(parts)
+		case "STACK":
+			s.showStack()
+		case "STATS":
+			s.showStatistics()
+		case "DISASM":
+			s.disassemble(parts)
+		case "SCREENSHOT":
+			s.screenshot(parts)
+		case "BENCH":
+			s.benchmark(parts)
+		case "BP", "WP", "BL", "BC", "BD", "BE":
+			s.emu.BreakpointCommand(parts)
+		case "RECORD":
+			s.emu.RecordCommand(parts)
+		case "RUN", "EXEC":
+			if len(parts) < 2 {
+				fmt.Println("Usage: RUN <filename> [arguments]")
+				continue
+			}
+			if err := s.emu.LoadFile(parts[1], parts[2:]...); err != nil {
+				fmt.Printf("Error: %v\n", err)
+			} else {
+				s.emu.Run()
+			}
+		case "EXIT", "QUIT":
+			fmt.Println("Exiting emulator...")
+			return
+		default:
+			ext := strings.ToUpper(filepath.Ext(command))
+			if ext == ".COM" || ext == ".EXE" {
+				if err := s.emu.LoadFile(command, parts[1:]...); err != nil {
+					fmt.Printf("Bad command or file name: %s\n", command)
+				} else {
+					s.emu.Run()
+				}
+			} else {
+				fmt.Printf("Bad command or file name: %s\n", command)
+			}
+		}
+	}
+}
+
+func (s *Shell) showHelp() {
+	fmt.Println("\nAVAILABLE COMMANDS:")
+	fmt.Println("File: DIR, CD, MD, RD, DEL, TYPE, COPY, REN")
+	fmt.Println("System: CLS, VER, DATE, TIME, MEM, ECHO")
+	fmt.Println("Emulator: RUN, DEBUG, STEP, TRACE, REGS, DUMP, STACK, STATS, BENCH, DISASM, SCREENSHOT, EXIT")
+	fmt.Println("Breakpoints: BP seg:off [if AX==5] [count N], WP seg:off [length], BL, BC, BD, BE")
+	fmt.Println("RECORD ON|OFF records execution for the monitor's BACK commands")
+	fmt.Println("DEBUG [file] enters the monitor (? for its commands); DEBUG ON|OFF traces")
+	fmt.Println("Supports: .COM and .EXE files")
+	fmt.Println()
+}
+
+func (s *Shell) listDirectory() {
+	files, err := os.ReadDir(".")
+	if err != nil {
+		fmt.Println("Error reading directory")
+		return
+	}
+
+	fmt.Println("\n Volume in drive A is EMULATOR")
+	fmt.Println(" Directory of A:\\")
+	fmt.Println()
+
+	fileCount := 0
+	dirCount := 0
+	totalSize := int64(0)
+
+	for _, file := range files {
+		info, _ := file.Info()
+
+		if file.IsDir() {
+			fmt.Printf("%-12s <DIR>         %s\n",
+				file.Name(),
+				info.ModTime().Format("01-02-06  03:04p"))
+			dirCount++
+		} else {
+			fmt.Printf("%-12s %10d %s\n",
+				file.Name(),
+				info.Size(),
+				info.ModTime().Format("01-02-06  03:04p"))
+			fileCount++
+			totalSize += info.Size()
+		}
+	}
+
+	fmt.Printf("\n    %d File(s) %d bytes\n", fileCount, totalSize)
+	fmt.Printf("    %d Dir(s)\n\n", dirCount)
+}
+
+func (s *Shell) changeDirectory(parts []string) {
+	if len(parts) < 2 {
+		fmt.Println(s.emu.CurrentDir())
+		return
+	}
+
+	if err := s.emu.ChangeDir(parts[1]); err != nil {
+		fmt.Println("Invalid directory")
+	}
+}
+
+func (s *Shell) makeDirectory(parts []string) {
+	if len(parts) < 2 {
+		fmt.Println("Usage: MD <directory>")
+		return
+	}
+	err := os.Mkdir(parts[1], 0755)
+	if err != nil {
+		fmt.Println("Unable to create directory")
+	}
+}
+
+func (s *Shell) removeDirectory(parts []string) {
+	if len(parts) < 2 {
+		fmt.Println("Usage: RD <directory>")
+		return
+	}
+	err := os.Remove(parts[1])
+	if err != nil {
+		fmt.Println("Unable to remove directory")
+	}
+}
+
+func (s *Shell) deleteFile(parts []string) {
+	if len(parts) < 2 {
+		fmt.Println("Usage: DEL <filename>")
+		return
+	}
+	err := os.Remove(parts[1])
+	if err != nil {
+		fmt.Println("File not found")
+	}
+}
+
+func (s *Shell) typeFile(parts []string) {
+	if len(parts) < 2 {
+		fmt.Println("Usage: TYPE <filename>")
+		return
+	}
+	content, err := os.ReadFile(parts[1])
+	if err != nil {
+		fmt.Println("File not found")
+		return
+	}
+	fmt.Print(string(content))
+}
+
+func (s *Shell) copyFile(parts []string) {
+	if len(parts) < 3 {
+		fmt.Println("Usage: COPY <source> <destination>")
+		return
+	}
+	source, err := os.ReadFile(parts[1])
+	if err != nil {
+		fmt.Println("File not found")
+		return
+	}
+	err = os.WriteFile(parts[2], source, 0644)
+	if err != nil {
+		fmt.Println("Unable to copy file")
+		return
+	}
+	fmt.Println("        1 file(s) copied")
+}
+
+func (s *Shell) renameFile(parts []string) {
+	if len(parts) < 3 {
+		fmt.Println("Usage: REN <oldname> <newname>")
+		return
+	}
+	err := os.Rename(parts[1], parts[2])
+	if err != nil {
+		fmt.Println("Unable to rename file")
+	}
+}
+
+func (s *Shell) showDate() {
+	fmt.Printf("Current date: %s\n", time.Now().Format("Mon 01/02/2006"))
+}
+
+func (s *Shell) showTime() {
+	fmt.Printf("Current time: %s\n", time.Now().Format("15:04:05"))
+}
+
+func (s *Shell) showMemoryInfo() {
+	total, free, largest := s.emu.MemoryInfo()
+	fmt.Println("\nMemory Type        Total       Used       Free")
+	fmt.Printf("Conventional     %5dK      %5dK     %5dK\n", total/1024, (total-free)/1024, free/1024)
+	fmt.Println()
+	fmt.Printf("Largest executable program size %7d (%dK)\n", largest, largest/1024)
+	fmt.Println()
+}
+
+func (s *Shell) showRegisters() {
+	fmt.Println("\nCPU REGISTERS:")
+	fmt.Printf("AX=%04X  BX=%04X  CX=%04X  DX=%04X\n",
+		s.cpu.AX, s.cpu.BX, s.cpu.CX, s.cpu.DX)
+	fmt.Printf("SI=%04X  DI=%04X  BP=%04X  SP=%04X\n",
+		s.cpu.SI, s.cpu.DI, s.cpu.BP, s.cpu.SP)
+	fmt.Printf("CS=%04X  DS=%04X  ES=%04X  SS=%04X\n",
+		s.cpu.CS, s.cpu.DS, s.cpu.ES, s.cpu.SS)
+	fmt.Printf("IP=%04X  FLAGS=%04X  REP=%02X\n", s.cpu.IP, s.cpu.Flags.ToUint16(), s.emu.Executor().RepeatPrefix())
+
+	flags := ""
+	if s.cpu.Flags.CF() {
+		flags += "CF "
+	}
+	if s.cpu.Flags.PF() {
+		flags += "PF "
+	}
+	if s.cpu.Flags.AF() {
+		flags += "AF "
+	}
+	if s.cpu.Flags.ZF() {
+		flags += "ZF "
+	}
+	if s.cpu.Flags.SF() {
+		flags += "SF "
+	}
+	if s.cpu.Flags.TF {
+		flags += "TF "
+	}
+	if s.cpu.Flags.IF {
+		flags += "IF "
+	}
+	if s.cpu.Flags.DF {
+		flags += "DF "
+	}
+	if s.cpu.Flags.OF() {
+		flags += "OF "
+	}
+	fmt.Printf("Flags: %s\n\n", flags)
+}
+
+func (s *Shell) dumpMemory(parts []string) {
+	startAddr := uint32(0)
+	length := uint32(256)
+
+	if len(parts) > 1 {
+		addr, _ := strconv.ParseUint(parts[1], 16, 32)
+		startAddr = uint32(addr)
+	}
+
+	if len(parts) > 2 {
+		l, _ := strconv.ParseUint(parts[2], 10, 32)
+		length = uint32(l)
+	}
+
+	fmt.Printf("\nMemory dump from %08X:\n", startAddr)
+	for i := uint32(0); i < length; i += 16 {
+		addr := startAddr + i
+		fmt.Printf("%08X: ", addr)
+
+		for j := uint32(0); j < 16; j++ {
+			fmt.Printf("%02X ", s.memory.Read8(addr+j))
+		}
+
+		fmt.Print(" | ")
+		for j := uint32(0); j < 16; j++ {
+			ch := s.memory.Read8(addr + j)
+			if ch >= 32 && ch <= 126 {
+				fmt.Printf("%c", ch)
+			} else {
+				fmt.Print(".")
+			}
+		}
+		fmt.Println()
+	}
+	fmt.Println()
+}
+
+func (s *Shell) showStack() {
+	fmt.Println("\nStack (top 10 entries):")
+	stack := s.emu.Executor().Stack()
+	count := 0
+	for i := len(stack) - 1; i >= 0 && count < 10; i-- {
+		fmt.Printf("  [%02d] %04X\n", count, stack[i])
+		count++
+	}
+	if len(stack) == 0 {
+		fmt.Println("  (empty)")
+	}
+	fmt.Println()
+}
+
+// benchmark runs a program twice, first decoding every instruction afresh
+// and then through the decode cache, and compares the speeds.
+func (s *Shell) benchmark(parts []string) {
+	if len(parts) < 2 {
+		fmt.Println("Usage: BENCH <filename> [arguments]")
+		return
+	}
+	cache := s.emu.DecodeCache()
+	defer cache.SetEnabled(true)
+
+	var ips [2]float64
+	for i, enabled := range []bool{false, true} {
+		cache.SetEnabled(enabled)
+		if err := s.emu.LoadFile(parts[1], parts[2:]...); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+		before := s.emu.Stats()
+		s.emu.Run()
+		after := s.emu.Stats()
+		if runTime := after.RunTime - before.RunTime; runTime > 0 {
+			ips[i] = float64(after.Instructions-before.Instructions) / runTime.Seconds()
+		}
+	}
+
+	fmt.Println("\nBENCHMARK:")
+	fmt.Printf("Without decode cache: %.0f IPS\n", ips[0])
+	fmt.Printf("With decode cache:    %.0f IPS\n", ips[1])
+	if ips[0] > 0 {
+		fmt.Printf("Speedup:              %.2fx\n", ips[1]/ips[0])
+	}
+	fmt.Println()
+}
+
+func (s *Shell) showStatistics() {
+	stats := s.emu.Stats()
+	elapsed := stats.Elapsed
+
+	fmt.Println("\nEMULATOR STATISTICS:")
+	fmt.Printf("Program type:     %s\n", stats.ProgramType)
+	fmt.Printf("Instructions:     %d\n", stats.Instructions)
+	fmt.Printf("Running time:     %s\n", elapsed.Round(time.Millisecond))
+
+	fmt.Printf("Clock cycles:     %d\n", stats.Cycles)
+	fmt.Printf("Clock:            %s\n", dos.FormatClock(stats.Clock))
+
+	if stats.RunTime.Seconds() > 0 {
+		ips := float64(stats.Instructions) / stats.RunTime.Seconds()
+		fmt.Printf("IPS:              %.0f\n", ips)
+		fmt.Printf("Effective clock:  %.2f MHz\n", float64(stats.Cycles)/stats.RunTime.Seconds()/1e6)
+	}
+	if decoded := stats.DecodeHits + stats.DecodeMisses; decoded > 0 {
+		fmt.Printf("Decode cache:     %d hits, %d misses (%.1f%% hit rate)\n",
+			stats.DecodeHits, stats.DecodeMisses, 100*float64(stats.DecodeHits)/float64(decoded))
+	}
+
+	fmt.Printf("Stack depth:      %d\n", stats.StackDepth)
+	fmt.Printf("File handles:     %d\n", stats.FileHandles)
+	fmt.Printf("REP prefix:       %02X\n\n", stats.RepeatPrefix)
+}
+
+// disassemble runs DISASM, which lists count instructions from a
+// segment:offset address, or from a linear address taken relative to CS
+// when it lies in the code segment. Jumps within the listing lead to
+// labels.
+func (s *Shell) disassemble(parts []string) {
+	segment, offset := s.cpu.CS, s.cpu.IP
+	count := 20
+
+	if len(parts) > 1 {
+		if strings.Contains(parts[1], ":") {
+			var err error
+			if segment, offset, err = s.emu.ParseAddress(parts[1]); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				return
+			}
+		} else {
+			addr, _ := strconv.ParseUint(parts[1], 16, 32)
+			segment, offset = splitAddress(uint32(addr), s.cpu.CS)
+		}
+	}
+
+	if len(parts) > 2 {
+		c, _ := strconv.Atoi(parts[2])
+		count = c
+	}
+
+	fmt.Printf("\nDisassembly from %04X:%04X:\n", segment, offset)
+	for _, line := range s.decoder.Listing(segment, offset, count, 0) {
+		if line.Label != "" {
+			fmt.Printf("%s:\n", line.Label)
+		}
+		fmt.Printf("%04X:%04X  %-16X %s\n", segment, line.Offset, line.Code, line.Text)
+	}
+	fmt.Println()
+}
+
+// splitAddress turns a linear address into a segment and offset, relative
+// to cs when the address lies in that segment.
+func splitAddress(addr uint32, cs uint16) (uint16, uint16) {
+	if base := memory.CalculateAddress(cs, 0); addr >= base && addr-base <= 0xFFFF {
+		return cs, uint16(addr - base)
+	}
+	return uint16(addr >> 4), uint16(addr & 0x0F)
+}
+
+func (s *Shell) screenshot(parts []string) {
+	path := "SCREEN.PNG"
+	if len(parts) > 1 {
+		path = parts[1]
+	}
+	if err := s.emu.BIOS().Screenshot(path); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	fmt.Printf("Screen saved to %s\n", path)
+}